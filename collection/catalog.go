@@ -0,0 +1,95 @@
+package collection
+
+import (
+	"log"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erikbos/jellofin-server/database"
+)
+
+// updateCatalog replaces the items of a collection in the database catalog,
+// in case they changed since the catalog was last updated.
+func (cr *CollectionRepo) updateCatalog(c *Collection) {
+	if cr.db == nil {
+		return
+	}
+	items := make([]database.CatalogItem, 0, len(c.Items))
+	for _, i := range c.Items {
+		items = append(items, i.catalogItem())
+	}
+	if c.catalog != nil && reflect.DeepEqual(items, c.catalog) {
+		return
+	}
+	if err := cr.db.CatalogRepo.UpdateCollection(strconv.Itoa(c.ID), items); err != nil {
+		log.Printf("Error updating catalog of collection %s: %s\n", c.Name_, err)
+		return
+	}
+	c.catalog = items
+}
+
+// catalogItem returns the catalog entry of an item.
+func (i *Item) catalogItem() database.CatalogItem {
+	i.LoadNfo()
+	item := database.CatalogItem{
+		ID:             i.ID,
+		Type:           i.Type,
+		Name:           i.Name,
+		SortName:       i.Name,
+		Year:           i.Year,
+		OfficialRating: i.OfficialRating,
+		DateCreated:    time.Unix(i.FirstVideo/1000, 0).UTC(),
+		PremiereDate:   time.Unix(i.FirstVideo/1000, 0).UTC(),
+		HasSubtitles:   len(i.SrtSubs) != 0 || len(i.VttSubs) != 0,
+		Genres:         NormalizeGenres(i.Genres),
+		Studios:        i.Studios,
+	}
+	item.Title = i.Name
+	if i.Nfo != nil {
+		item.CommunityRating = math.Round(float64(i.Nfo.Rating)*10) / 10
+		if i.Nfo.Title != "" {
+			item.Title = i.Nfo.Title
+		}
+		item.OriginalTitle = i.Nfo.OTitle
+		item.Plot = i.Nfo.Plot
+		item.People = i.Nfo.people()
+		if premiereDate := i.Nfo.premiereDate(); !premiereDate.IsZero() {
+			item.PremiereDate = premiereDate
+		}
+		item.Width = i.Nfo.videoWidth()
+		item.HasSubtitles = item.HasSubtitles || i.Nfo.hasSubtitles()
+		item.HasTrailer = i.Nfo.TrailerURL() != ""
+		item.SeriesStatus = strings.TrimSpace(i.Nfo.Status)
+	}
+	// Shows take media details of their episodes
+	for _, s := range i.Seasons {
+		for _, e := range s.Episodes {
+			item.Episodes = append(item.Episodes, e.catalogEpisode())
+			item.HasSubtitles = item.HasSubtitles || len(e.SrtSubs) != 0 || len(e.VttSubs) != 0
+			if e.Nfo != nil {
+				item.Width = max(item.Width, e.Nfo.videoWidth())
+				item.HasSubtitles = item.HasSubtitles || e.Nfo.hasSubtitles()
+			}
+		}
+	}
+	if score, rated := i.ParentalRatingScore(); rated {
+		item.ParentalRating = &score
+	}
+	return item
+}
+
+// catalogEpisode returns the catalog entry of an episode.
+func (e *Episode) catalogEpisode() database.CatalogEpisode {
+	e.LoadNfo()
+	episode := database.CatalogEpisode{
+		ID: e.ID,
+	}
+	if e.Nfo != nil {
+		episode.Title = e.Nfo.Title
+		episode.Plot = e.Nfo.Plot
+	}
+	return episode
+}
@@ -1,8 +1,8 @@
 package collection
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"net/url"
 	"slices"
 	"strconv"
@@ -18,6 +18,16 @@ type Options struct {
 type CollectionRepo struct {
 	collections Collections
 	db          *database.DatabaseRepo
+	// changeHandlers are called after a scan changed items of a collection
+	changeHandlers []func(LibraryChange)
+}
+
+// LibraryChange holds IDs of items added, updated and removed by a scan of a collection.
+type LibraryChange struct {
+	CollectionID int
+	Added        []string
+	Updated      []string
+	Removed      []string
 }
 
 func New(options *Options) *CollectionRepo {
@@ -36,6 +46,8 @@ type Collection struct {
 	Directory string
 	BaseUrl   string
 	HlsServer string
+	// catalog holds the items last written to the database catalog
+	catalog []database.CatalogItem
 }
 
 const (
@@ -46,6 +58,7 @@ const (
 // CollectionDetails contains details about a collection
 type CollectionDetails struct {
 	Genres          []string
+	Studios         []string
 	Tags            []string
 	OfficialRatings []string
 	Years           []int
@@ -90,10 +103,15 @@ type Item struct {
 	Metadata *Metadata
 
 	Genres         []string
+	Studios        []string
 	OfficialRating string
 	Year           int
 	Rating         float32
 	Votes          int
+
+	// parentalRating and parentalRated hold the score of OfficialRating
+	parentalRating int
+	parentalRated  bool
 }
 
 type Metadata struct {
@@ -174,31 +192,77 @@ func (p PathString) String() string {
 	return string(p)
 }
 
-func (cr *CollectionRepo) updateCollections(pace int) {
+func (cr *CollectionRepo) updateCollections(ctx context.Context, pace int) {
 	id := 1
 	for i := range cr.collections {
 		c := &(cr.collections[i])
 		c.ID = id
 		c.BaseUrl = fmt.Sprintf("/data/%d", id)
+		before := c.itemVersions()
 		switch c.Type {
 		case CollectionMovies:
-			cr.buildMovies(c, pace)
+			cr.buildMovies(ctx, c, pace)
 		case CollectionShows:
-			cr.buildShows(c, pace)
+			cr.buildShows(ctx, c, pace)
+		}
+		// Only replace the catalog after a complete scan
+		if ctx.Err() == nil {
+			cr.updateCatalog(c)
+			cr.notifyChanges(c, before)
 		}
 		id++
 	}
 }
 
+// OnChange registers a function to be called after a scan changed items of a collection.
+// Functions should be registered before Init is called.
+func (cr *CollectionRepo) OnChange(handler func(LibraryChange)) {
+	cr.changeHandlers = append(cr.changeHandlers, handler)
+}
+
+// itemVersions returns the timestamp of the most recent video of each item, keyed by item ID.
+func (c *Collection) itemVersions() map[string]int64 {
+	versions := make(map[string]int64, len(c.Items))
+	for _, i := range c.Items {
+		versions[i.ID] = i.LastVideo
+	}
+	return versions
+}
+
+// notifyChanges calls the change handlers in case items of the collection
+// were added, updated or removed since the versions before the scan.
+func (cr *CollectionRepo) notifyChanges(c *Collection, before map[string]int64) {
+	change := LibraryChange{CollectionID: c.ID}
+	for id, version := range c.itemVersions() {
+		previous, ok := before[id]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, id)
+		case previous != version:
+			change.Updated = append(change.Updated, id)
+		}
+		delete(before, id)
+	}
+	for id := range before {
+		change.Removed = append(change.Removed, id)
+	}
+	if len(change.Added) == 0 && len(change.Updated) == 0 && len(change.Removed) == 0 {
+		return
+	}
+	for _, handler := range cr.changeHandlers {
+		handler(change)
+	}
+}
+
 // Init initalizes content collections
 func (cr *CollectionRepo) Init() {
-	cr.updateCollections(0)
+	cr.updateCollections(context.Background(), 0)
 }
 
-// Background keeps scanning content collections for changes continously
-func (cr *CollectionRepo) Background() {
-	for {
-		cr.updateCollections(1)
+// Background keeps scanning content collections for changes continously, until ctx is cancelled
+func (cr *CollectionRepo) Background(ctx context.Context) {
+	for ctx.Err() == nil {
+		cr.updateCollections(ctx, 1)
 	}
 }
 
@@ -290,147 +354,64 @@ func (cr *CollectionRepo) GetEpisodeByID(episodeID string) (*Collection, *Item,
 	return nil, nil, nil, nil
 }
 
-// Returns the nextup episodes in the collection based upon list of watched episodes
-func (cr *CollectionRepo) NextUp(watchedEpisodeIDs []string) (nextUpEpisodeIDs []string, e error) {
-
-	type ShowEntry struct {
-		show          *Item
-		seasonNumber  int
-		episodeNumber int
-		seasonIdx     int
-		epIdx         int
-	}
-	showMap := make(map[string]ShowEntry)
-
-	for _, episodeID := range watchedEpisodeIDs {
-
-		c, show, season, episode := cr.GetEpisodeByID(episodeID)
-		if c == nil || show == nil || season == nil || episode == nil {
-			continue
-		}
-
-		// NextUp skips everything apart from shows
-		if c.Type != CollectionShows {
-			continue
-		}
-
-		log.Printf("NextUp: %s(%s) %s, %d-%d\n", show.Name, show.ID, episode.ID, episode.SeasonNo, episode.EpisodeNo)
-
-		// Find season and episode index
-		seasonIdx, epIdx := -1, -1
-		// seasonIdx = season.SeasonNo - 1
-		// epIdx = episode.EpisodeNo - 1
-		for si, s := range show.Seasons {
-			if s.ID == season.ID {
-				seasonIdx = si
-				for ei, e := range s.Episodes {
-					if e.ID == episode.ID {
-						epIdx = ei
-						break
-					}
-				}
-				break
-			}
-		}
-		if seasonIdx == -1 || epIdx == -1 {
-			continue
-		}
-
-		entry, exists := showMap[show.ID]
-		// No entries for this show, add it
-		if !exists ||
-			// watched item is in next season
-			season.SeasonNo > entry.seasonNumber ||
-			// watched item is in same season but next episode
-			(season.SeasonNo == entry.seasonNumber && episode.EpisodeNo > entry.episodeNumber) {
-			showMap[show.ID] = ShowEntry{
-				show:          show,
-				seasonNumber:  season.SeasonNo,
-				episodeNumber: episode.EpisodeNo,
-				seasonIdx:     seasonIdx,
-				epIdx:         epIdx,
-			}
-		}
+// Details returns collection details such as genres, tags, ratings, etc.
+// In case allowed is not nil only items it returns true for are included.
+func (c *CollectionRepo) Details(allowed func(c *Collection, i *Item) bool) CollectionDetails {
+	details := newCollectionDetails()
+	for n := range c.collections {
+		c.collections[n].addDetails(&details, allowed)
 	}
+	slices.Sort(details.Years)
+	return details
+}
 
-	log.Printf("NextUp: showMap: %+v\n", showMap)
-
-	nextUpEpisodeIDs = make([]string, 0)
-	for _, entry := range showMap {
-		item := entry.show
-		seasonIdx := entry.seasonIdx
-		epIdx := entry.epIdx
-
-		if seasonIdx < len(item.Seasons) {
-			season := &item.Seasons[seasonIdx]
-			if epIdx+1 < len(season.Episodes) {
-				log.Printf("Adding: in same season %s(%s) %s, %d-%d\n", item.Name, item.ID, season.Episodes[epIdx+1].ID, seasonIdx, epIdx+1)
-				// Try next episode in same season
-				nextUpEpisodeIDs = append(nextUpEpisodeIDs, season.Episodes[epIdx+1].ID)
-				continue
-			}
-			// Try first episode in next season
-			if seasonIdx+1 < len(item.Seasons) && len(item.Seasons[seasonIdx+1].Episodes) > 0 {
-				log.Printf("Adding: in next season %s(%s) %s, %d-%d\n", item.Name, item.ID, item.Seasons[seasonIdx+1].Episodes[0].ID, seasonIdx+1, 0)
-				nextUpEpisodeIDs = append(nextUpEpisodeIDs, item.Seasons[seasonIdx+1].Episodes[0].ID)
-			}
-		}
+// GenreItemCount returns number of items per genre.
+// In case allowed is not nil only items it returns true for are counted.
+func (c *CollectionRepo) GenreItemCount(allowed func(c *Collection, i *Item) bool) map[string]int {
+	genreCount := make(map[string]int)
+	for n := range c.collections {
+		c.collections[n].countGenres(genreCount, allowed)
 	}
-
-	return nextUpEpisodeIDs, nil
+	return genreCount
 }
 
-// Details returns collection details such as genres, tags, ratings, etc.
-func (c *CollectionRepo) Details() CollectionDetails {
-	genres := make([]string, 0)
-	tags := make([]string, 0)
-	official := make([]string, 0)
-	years := make([]int, 0)
-
-	for _, collection := range c.collections {
+// StudioItemCount returns number of items per studio.
+// In case allowed is not nil only items it returns true for are counted.
+func (c *CollectionRepo) StudioItemCount(allowed func(c *Collection, i *Item) bool) map[string]int {
+	studioCount := make(map[string]int)
+	for n := range c.collections {
+		collection := &c.collections[n]
 		for _, i := range collection.Items {
-			for _, g := range i.Genres {
-				g := normalizeGenre(g)
-				if !slices.Contains(genres, g) {
-					genres = append(genres, g)
-				}
-			}
-			if i.OfficialRating != "" && !slices.Contains(official, i.OfficialRating) {
-				official = append(official, i.OfficialRating)
+			if allowed != nil && !allowed(collection, i) {
+				continue
 			}
-			if i.Year != 0 && !slices.Contains(years, i.Year) {
-				years = append(years, i.Year)
+			for _, s := range i.Studios {
+				if s == "" {
+					continue
+				}
+				studioCount[s] += 1
 			}
 		}
 	}
-
-	details := CollectionDetails{
-		Genres:          genres,
-		Tags:            tags,
-		OfficialRatings: official,
-		Years:           years,
-	}
-	return details
+	return studioCount
 }
 
-// GenreItemCount returns number of items per genre.
-func (c *CollectionRepo) GenreItemCount() map[string]int {
-	genreCount := make(map[string]int)
-	for _, collection := range c.collections {
+// YearItemCount returns number of items per production year.
+// In case allowed is not nil only items it returns true for are counted.
+func (c *CollectionRepo) YearItemCount(allowed func(c *Collection, i *Item) bool) map[int]int {
+	yearCount := make(map[int]int)
+	for n := range c.collections {
+		collection := &c.collections[n]
 		for _, i := range collection.Items {
-			for _, g := range i.Genres {
-				if g == "" {
-					continue
-				}
-				if _, found := genreCount[g]; !found {
-					genreCount[g] = 1
-				} else {
-					genreCount[g] += 1
-				}
+			if allowed != nil && !allowed(collection, i) {
+				continue
+			}
+			if i.Year != 0 {
+				yearCount[i.Year] += 1
 			}
 		}
 	}
-	return genreCount
+	return yearCount
 }
 
 func (c *Collection) GetHlsServer() string {
@@ -442,54 +423,71 @@ func (c *Collection) GetDataDir() string {
 }
 
 // Details returns collection details such as genres, tags, ratings, etc.
-func (c *Collection) Details() CollectionDetails {
-	genres := make([]string, 0)
-	tags := make([]string, 0)
-	official := make([]string, 0)
-	years := make([]int, 0)
+// In case allowed is not nil only items it returns true for are included.
+func (c *Collection) Details(allowed func(c *Collection, i *Item) bool) CollectionDetails {
+	details := newCollectionDetails()
+	c.addDetails(&details, allowed)
+	slices.Sort(details.Years)
+	return details
+}
 
+func newCollectionDetails() CollectionDetails {
+	return CollectionDetails{
+		Genres:          make([]string, 0),
+		Studios:         make([]string, 0),
+		Tags:            make([]string, 0),
+		OfficialRatings: make([]string, 0),
+		Years:           make([]int, 0),
+	}
+}
+
+// addDetails adds genres, studios, ratings and years of allowed items to details.
+func (c *Collection) addDetails(details *CollectionDetails, allowed func(c *Collection, i *Item) bool) {
 	for _, i := range c.Items {
+		if allowed != nil && !allowed(c, i) {
+			continue
+		}
 		for _, g := range i.Genres {
 			g := normalizeGenre(g)
-			if !slices.Contains(genres, g) {
-				genres = append(genres, g)
+			if !slices.Contains(details.Genres, g) {
+				details.Genres = append(details.Genres, g)
 			}
 		}
-		if i.OfficialRating != "" && !slices.Contains(official, i.OfficialRating) {
-			official = append(official, i.OfficialRating)
+		for _, s := range i.Studios {
+			if !slices.Contains(details.Studios, s) {
+				details.Studios = append(details.Studios, s)
+			}
 		}
-		if i.Year != 0 && !slices.Contains(years, i.Year) {
-			years = append(years, i.Year)
+		if i.OfficialRating != "" && !slices.Contains(details.OfficialRatings, i.OfficialRating) {
+			details.OfficialRatings = append(details.OfficialRatings, i.OfficialRating)
+		}
+		if i.Year != 0 && !slices.Contains(details.Years, i.Year) {
+			details.Years = append(details.Years, i.Year)
 		}
 	}
-
-	slices.Sort(years)
-
-	details := CollectionDetails{
-		Genres:          genres,
-		Tags:            tags,
-		OfficialRatings: official,
-		Years:           years,
-	}
-	return details
 }
 
 // GenreCount returns number of items per genre.
-func (c *Collection) GenreCount() map[string]int {
+// In case allowed is not nil only items it returns true for are counted.
+func (c *Collection) GenreCount(allowed func(c *Collection, i *Item) bool) map[string]int {
 	genreCount := make(map[string]int)
+	c.countGenres(genreCount, allowed)
+	return genreCount
+}
+
+// countGenres adds number of allowed items per genre to genreCount.
+func (c *Collection) countGenres(genreCount map[string]int, allowed func(c *Collection, i *Item) bool) {
 	for _, i := range c.Items {
+		if allowed != nil && !allowed(c, i) {
+			continue
+		}
 		for _, g := range i.Genres {
 			if g == "" {
 				continue
 			}
-			if _, found := genreCount[g]; !found {
-				genreCount[g] = 1
-			} else {
-				genreCount[g] += 1
-			}
+			genreCount[g] += 1
 		}
 	}
-	return genreCount
 }
 
 // LoadNfo loads the NFO file for the item if not loaded already
@@ -497,12 +495,69 @@ func (i *Item) LoadNfo() {
 	loadNFO(&i.Nfo, i.nfoPath)
 	if i.Nfo != nil {
 		i.Genres = i.Nfo.Genre
+		i.Studios = i.Nfo.Studio
 		i.OfficialRating = i.Nfo.Mpaa
 		i.Year = i.Nfo.Year
 	}
+	i.parentalRating, i.parentalRated = ParentalRatingScore(i.OfficialRating)
+}
+
+// itemsByID returns the items of the collection keyed by item ID.
+func (c *Collection) itemsByID() map[string]*Item {
+	items := make(map[string]*Item, len(c.Items))
+	for _, i := range c.Items {
+		items[i.ID] = i
+	}
+	return items
+}
+
+// reuseNfo takes over the NFO files of the item and its episodes as parsed
+// during the previous scan, so NFO files that did not change are not parsed again.
+func (i *Item) reuseNfo(previous *Item) {
+	if previous.Nfo != nil && previous.nfoPath == i.nfoPath && previous.nfoTime == i.nfoTime {
+		i.Nfo = previous.Nfo
+	}
+	if len(i.Seasons) == 0 {
+		return
+	}
+	episodes := make(map[string]*Episode)
+	for s := range previous.Seasons {
+		for e := range previous.Seasons[s].Episodes {
+			episodes[previous.Seasons[s].Episodes[e].ID] = &previous.Seasons[s].Episodes[e]
+		}
+	}
+	for s := range i.Seasons {
+		for n := range i.Seasons[s].Episodes {
+			e := &i.Seasons[s].Episodes[n]
+			if p := episodes[e.ID]; p != nil && p.Nfo != nil && p.nfoPath == e.nfoPath && p.nfoTime == e.nfoTime {
+				e.Nfo = p.Nfo
+			}
+		}
+	}
 }
 
 // LoadNfo loads the NFO file for the episode if not loaded already
 func (e *Episode) LoadNfo() {
 	loadNFO(&e.Nfo, e.nfoPath)
 }
+
+// Duration returns the duration of the movie in seconds, 0 if unknown.
+func (i *Item) Duration() int {
+	i.LoadNfo()
+	if i.Nfo == nil {
+		return 0
+	}
+	if i.Nfo.Runtime != 0 {
+		return i.Nfo.Runtime * 60
+	}
+	return i.Nfo.videoDuration()
+}
+
+// Duration returns the duration of the episode in seconds, 0 if unknown.
+func (e *Episode) Duration() int {
+	e.LoadNfo()
+	if e.Nfo == nil {
+		return 0
+	}
+	return e.Nfo.videoDuration()
+}
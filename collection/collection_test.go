@@ -0,0 +1,80 @@
+package collection
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestDetailsOfAllowedItems(t *testing.T) {
+	cr := &CollectionRepo{collections: Collections{
+		{ID: 1, Items: []*Item{
+			{ID: "a", Genres: []string{"Drama"}, Studios: []string{"HBO"}, Year: 2001, OfficialRating: "PG"},
+			{ID: "b", Genres: []string{"Horror"}, Studios: []string{"A24"}, Year: 2019, OfficialRating: "R"},
+		}},
+		{ID: 2, Items: []*Item{
+			{ID: "c", Genres: []string{"Drama"}, Studios: []string{"HBO"}, Year: 1999},
+		}},
+	}}
+	// Hide rated R items and all items of collection 2
+	allowed := func(c *Collection, i *Item) bool {
+		return c.ID == 1 && i.OfficialRating != "R"
+	}
+
+	details := cr.Details(allowed)
+	if !slices.Equal(details.Genres, []string{"Drama"}) || !slices.Equal(details.Studios, []string{"HBO"}) ||
+		!slices.Equal(details.Years, []int{2001}) || !slices.Equal(details.OfficialRatings, []string{"PG"}) {
+		t.Errorf("details = %+v", details)
+	}
+	if all := cr.Details(nil); !slices.Equal(all.Years, []int{1999, 2001, 2019}) {
+		t.Errorf("years of all items = %v", all.Years)
+	}
+	if got := cr.GenreItemCount(allowed); !maps.Equal(got, map[string]int{"Drama": 1}) {
+		t.Errorf("genre count = %v", got)
+	}
+	if got := cr.StudioItemCount(nil); !maps.Equal(got, map[string]int{"HBO": 2, "A24": 1}) {
+		t.Errorf("studio count = %v", got)
+	}
+	if got := cr.YearItemCount(allowed); !maps.Equal(got, map[int]int{2001: 1}) {
+		t.Errorf("year count = %v", got)
+	}
+	if got := cr.collections[1].Details(allowed); len(got.Genres) != 0 {
+		t.Errorf("details of hidden collection = %+v", got)
+	}
+}
+
+func TestReuseNfo(t *testing.T) {
+	nfo := &Nfo{Title: "Blade Runner"}
+	episodeNfo := &Nfo{Title: "Pilot"}
+	previous := &Item{ID: "show", nfoPath: "/show/tvshow.nfo", nfoTime: 10, Nfo: nfo,
+		Seasons: []Season{{Episodes: []Episode{
+			{ID: "e1", nfoPath: "/show/e1.nfo", nfoTime: 10, Nfo: episodeNfo},
+			{ID: "e2", nfoPath: "/show/e2.nfo", nfoTime: 10, Nfo: episodeNfo},
+		}}},
+	}
+
+	unchanged := &Item{ID: "show", nfoPath: "/show/tvshow.nfo", nfoTime: 10,
+		Seasons: []Season{{Episodes: []Episode{
+			{ID: "e1", nfoPath: "/show/e1.nfo", nfoTime: 10},
+			{ID: "e2", nfoPath: "/show/e2.nfo", nfoTime: 20},
+			{ID: "e3", nfoPath: "/show/e3.nfo", nfoTime: 10},
+		}}},
+	}
+	unchanged.reuseNfo(previous)
+	if unchanged.Nfo != nfo {
+		t.Error("NFO of unchanged item not reused")
+	}
+	episodes := unchanged.Seasons[0].Episodes
+	if episodes[0].Nfo != episodeNfo {
+		t.Error("NFO of unchanged episode not reused")
+	}
+	if episodes[1].Nfo != nil || episodes[2].Nfo != nil {
+		t.Error("NFO of changed or new episode reused")
+	}
+
+	changed := &Item{ID: "show", nfoPath: "/show/tvshow.nfo", nfoTime: 20}
+	changed.reuseNfo(previous)
+	if changed.Nfo != nil {
+		t.Error("NFO of changed item reused")
+	}
+}
@@ -0,0 +1,73 @@
+package collection
+
+import (
+	"github.com/erikbos/jellofin-server/database"
+)
+
+// Item reference types, in addition to ItemTypeMovie and ItemTypeShow.
+const (
+	ItemRefTypeSeason  = "season"
+	ItemRefTypeEpisode = "episode"
+)
+
+// DescribeItemRef fills in the identity of the movie, show, season or
+// episode with ref.ID: its type, directory name of the movie or show and
+// season and episode number. Returns false in case the item is unknown.
+func (cr *CollectionRepo) DescribeItemRef(ref *database.ItemRef) bool {
+	if _, i := cr.GetItemByID(ref.ID); i != nil {
+		ref.Type = i.Type
+		ref.Name = i.Name
+		return true
+	}
+	if _, i, s := cr.GetSeasonByID(ref.ID); s != nil {
+		ref.Type = ItemRefTypeSeason
+		ref.Name = i.Name
+		ref.SeasonNo = s.SeasonNo
+		return true
+	}
+	if _, i, _, e := cr.GetEpisodeByID(ref.ID); e != nil {
+		ref.Type = ItemRefTypeEpisode
+		ref.Name = i.Name
+		ref.SeasonNo = e.SeasonNo
+		ref.EpisodeNo = e.EpisodeNo
+		return true
+	}
+	return false
+}
+
+// ResolveItemRef sets ref.ID to the current ID of the item identified by
+// ref's type, name, season and episode number. Returns false in case the
+// item cannot be found.
+func (cr *CollectionRepo) ResolveItemRef(ref *database.ItemRef) bool {
+	for _, c := range cr.collections {
+		for _, i := range c.Items {
+			if i.Name != ref.Name {
+				continue
+			}
+			switch ref.Type {
+			case ItemTypeMovie, ItemTypeShow:
+				if i.Type == ref.Type {
+					ref.ID = i.ID
+					return true
+				}
+			case ItemRefTypeSeason:
+				for _, s := range i.Seasons {
+					if s.SeasonNo == ref.SeasonNo {
+						ref.ID = s.ID
+						return true
+					}
+				}
+			case ItemRefTypeEpisode:
+				for _, s := range i.Seasons {
+					for _, e := range s.Episodes {
+						if e.SeasonNo == ref.SeasonNo && e.EpisodeNo == ref.EpisodeNo {
+							ref.ID = e.ID
+							return true
+						}
+					}
+				}
+			}
+		}
+	}
+	return false
+}
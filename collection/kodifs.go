@@ -2,6 +2,7 @@
 package collection
 
 import (
+	"context"
 	//	"fmt"
 	"fmt"
 	"net/url"
@@ -40,7 +41,7 @@ func escapePath(p string) string {
 	return u.EscapedPath()
 }
 
-func (cr *CollectionRepo) buildMovies(coll *Collection, pace int) (items []*Item) {
+func (cr *CollectionRepo) buildMovies(ctx context.Context, coll *Collection, pace int) (items []*Item) {
 	f, err := OpenDir(coll.Directory)
 	if err != nil {
 		return
@@ -50,6 +51,7 @@ func (cr *CollectionRepo) buildMovies(coll *Collection, pace int) (items []*Item
 	if len(fi) == 0 {
 		return
 	}
+	previous := coll.itemsByID()
 	for _, f := range fi {
 		name := f.Name()
 		if (len(name) > 0 && name[:1] == ".") ||
@@ -58,11 +60,21 @@ func (cr *CollectionRepo) buildMovies(coll *Collection, pace int) (items []*Item
 		}
 		m := cr.buildMovie(coll, name)
 		if m != nil {
+			if p := previous[m.ID]; p != nil {
+				m.reuseNfo(p)
+			}
+			// Load the NFO before the item is published, access checks need its parental rating
+			m.LoadNfo()
 			items = append(items, m)
 		}
 		if pace > 0 {
 			d := time.Duration(int64(pace)) * time.Second
-			time.Sleep(d)
+			select {
+			case <-ctx.Done():
+				// Keep current items as the scan did not complete
+				return
+			case <-time.After(d):
+			}
 		}
 	}
 	coll.Items = items
@@ -189,6 +201,7 @@ func (cr *CollectionRepo) buildMovie(coll *Collection, dir string) (movie *Item)
 
 		if ext == "nfo" {
 			movie.nfoPath = path.Join(coll.Directory, dir, name)
+			movie.nfoTime = f.Modtime().UnixMilli()
 			continue
 		}
 	}
@@ -207,7 +220,7 @@ func (cr *CollectionRepo) buildMovie(coll *Collection, dir string) (movie *Item)
 	return
 }
 
-func (cr *CollectionRepo) buildShows(coll *Collection, pace int) (items []*Item) {
+func (cr *CollectionRepo) buildShows(ctx context.Context, coll *Collection, pace int) (items []*Item) {
 	f, err := OpenDir(coll.Directory)
 	if err != nil {
 		return
@@ -217,6 +230,7 @@ func (cr *CollectionRepo) buildShows(coll *Collection, pace int) (items []*Item)
 	if len(fi) == 0 {
 		return
 	}
+	previous := coll.itemsByID()
 	for _, f := range fi {
 		name := f.Name()
 		if (len(name) > 0 && name[:1] == ".") ||
@@ -225,11 +239,21 @@ func (cr *CollectionRepo) buildShows(coll *Collection, pace int) (items []*Item)
 		}
 		m := cr.buildShow(coll, name)
 		if m != nil {
+			if p := previous[m.ID]; p != nil {
+				m.reuseNfo(p)
+			}
+			// Load the NFO before the item is published, access checks need its parental rating
+			m.LoadNfo()
 			items = append(items, m)
 		}
 		if pace > 0 {
 			d := time.Duration(int64(pace)) * time.Second
-			time.Sleep(d)
+			select {
+			case <-ctx.Done():
+				// Keep current items as the scan did not complete
+				return
+			case <-time.After(d):
+			}
 		}
 	}
 	coll.Items = items
@@ -311,6 +335,7 @@ func (cr *CollectionRepo) showScanDir(baseDir string, dir string, seasonHint int
 			// nfo file.
 			if fn == "tvshow.nfo" {
 				show.nfoPath = path.Join(d, fn)
+				show.nfoTime = f.Modtime().UnixMilli()
 				continue
 			}
 
@@ -455,6 +480,7 @@ func (cr *CollectionRepo) showScanDir(baseDir string, dir string, seasonHint int
 
 		if ext == "nfo" {
 			ep.nfoPath = path.Join(baseDir, dir, name)
+			ep.nfoTime = f.Modtime().UnixMilli()
 			continue
 		}
 	}
@@ -0,0 +1,177 @@
+package collection
+
+import (
+	"sort"
+	"time"
+
+	"github.com/erikbos/jellofin-server/database"
+)
+
+// NextUpOptions controls which episodes NextUp returns.
+type NextUpOptions struct {
+	// SeriesID, if set, only returns next up episode of this show
+	SeriesID string
+	// DateCutoff, if set, skips shows that have not been watched since
+	DateCutoff time.Time
+	// EnableRewatching continues after the most recently played episode,
+	// even if the next episode has been played before
+	EnableRewatching bool
+	// DisableFirstEpisode skips shows of which no episode has been played yet
+	DisableFirstEpisode bool
+	// EnableResumable includes partially watched episodes
+	EnableResumable bool
+}
+
+// NextUp returns the next episode to watch for each show the user is watching,
+// most recently watched show first. Specials (season 0) are never returned and
+// do not advance the position in a show.
+func (cr *CollectionRepo) NextUp(userID string, options NextUpOptions) (nextUpEpisodeIDs []string, err error) {
+	userData, err := cr.db.UserDataRepo.GetAll(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	type nextUpEntry struct {
+		episodeID  string
+		lastPlayed time.Time
+	}
+	var entries []nextUpEntry
+
+	for _, c := range cr.collections {
+		if c.Type != CollectionShows {
+			continue
+		}
+		for _, show := range c.Items {
+			if options.SeriesID != "" && show.ID != options.SeriesID {
+				continue
+			}
+			episodeID, lastPlayed := nextUpEpisode(show, userData, options)
+			if episodeID == "" {
+				continue
+			}
+			if !options.DateCutoff.IsZero() && lastPlayed.Before(options.DateCutoff) {
+				continue
+			}
+			entries = append(entries, nextUpEntry{episodeID: episodeID, lastPlayed: lastPlayed})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].lastPlayed.After(entries[j].lastPlayed)
+	})
+
+	nextUpEpisodeIDs = make([]string, 0, len(entries))
+	for _, e := range entries {
+		nextUpEpisodeIDs = append(nextUpEpisodeIDs, e.episodeID)
+	}
+	return nextUpEpisodeIDs, nil
+}
+
+// nextUpEpisode returns ID of the episode to watch next in a show and
+// the time the user last watched an episode of the show.
+func nextUpEpisode(show *Item, userData map[string]database.UserData, options NextUpOptions) (episodeID string, lastPlayed time.Time) {
+	episodes := showEpisodesInOrder(show)
+	if len(episodes) == 0 {
+		return "", time.Time{}
+	}
+
+	// played tracks per episode whether it has been played, a played
+	// double episode also covers the episode it was combined with
+	played := make([]bool, len(episodes))
+	for idx, e := range episodes {
+		if state, found := userData[e.ID]; found && state.Played {
+			played[idx] = true
+			if e.Double && idx+1 < len(episodes) && coveredByDouble(e, episodes[idx+1]) {
+				played[idx+1] = true
+			}
+		}
+	}
+
+	// Find the episode to continue after: highest played episode in airing
+	// order, or most recently played episode in case of rewatching.
+	// Activity on the show and most recently played episode are tracked separately
+	// as an episode in progress does not move the position in the show.
+	last := -1
+	var lastPlayedEpisode time.Time
+	for idx, e := range episodes {
+		state, found := userData[e.ID]
+		if !found || (!state.Played && state.Position == 0 && state.PlayedPercentage == 0) {
+			continue
+		}
+		if state.Timestamp.After(lastPlayed) {
+			lastPlayed = state.Timestamp
+		}
+		if options.EnableRewatching {
+			if state.Played && (last == -1 || state.Timestamp.After(lastPlayedEpisode)) {
+				last = idx
+				lastPlayedEpisode = state.Timestamp
+			}
+		} else if played[idx] {
+			last = idx
+		}
+	}
+	// Specials count as watching a show, but do not move the position in it
+	for _, s := range show.Seasons {
+		if s.SeasonNo != 0 {
+			continue
+		}
+		for _, e := range s.Episodes {
+			if state, found := userData[e.ID]; found && state.Timestamp.After(lastPlayed) {
+				lastPlayed = state.Timestamp
+			}
+		}
+	}
+
+	// Nothing played yet, only offer first episode if the show was asked for explicitly
+	if last == -1 && lastPlayed.IsZero() && (options.SeriesID == "" || options.DisableFirstEpisode) {
+		return "", time.Time{}
+	}
+
+	for idx := last + 1; idx < len(episodes); idx++ {
+		e := episodes[idx]
+		// Skip the second half of a double episode we have just watched
+		if last >= 0 && idx == last+1 && episodes[last].Double && coveredByDouble(episodes[last], e) {
+			continue
+		}
+		if played[idx] && !options.EnableRewatching {
+			continue
+		}
+		if state, found := userData[e.ID]; found && !state.Played && (state.Position > 0 || state.PlayedPercentage > 0) {
+			if !options.EnableResumable {
+				// Partially watched episode shows up in resume list instead
+				return "", time.Time{}
+			}
+		}
+		return e.ID, lastPlayed
+	}
+	return "", time.Time{}
+}
+
+// showEpisodesInOrder returns all regular episodes of a show in airing order, specials excluded.
+func showEpisodesInOrder(show *Item) (episodes []*Episode) {
+	seasons := make([]*Season, 0, len(show.Seasons))
+	for idx := range show.Seasons {
+		if show.Seasons[idx].SeasonNo != 0 {
+			seasons = append(seasons, &show.Seasons[idx])
+		}
+	}
+	sort.SliceStable(seasons, func(i, j int) bool {
+		return seasons[i].SeasonNo < seasons[j].SeasonNo
+	})
+	for _, s := range seasons {
+		seasonEpisodes := make([]*Episode, 0, len(s.Episodes))
+		for idx := range s.Episodes {
+			seasonEpisodes = append(seasonEpisodes, &s.Episodes[idx])
+		}
+		sort.SliceStable(seasonEpisodes, func(i, j int) bool {
+			return seasonEpisodes[i].EpisodeNo < seasonEpisodes[j].EpisodeNo
+		})
+		episodes = append(episodes, seasonEpisodes...)
+	}
+	return
+}
+
+// coveredByDouble returns true if episode next is the second half of double episode e.
+func coveredByDouble(e, next *Episode) bool {
+	return e.Double && e.SeasonNo == next.SeasonNo && next.EpisodeNo == e.EpisodeNo+1
+}
@@ -0,0 +1,102 @@
+package collection
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/erikbos/jellofin-server/database"
+)
+
+// testShow returns a show with one season of n episodes with IDs e1..en.
+func testShow(n int) *Item {
+	season := Season{ID: "s1", SeasonNo: 1}
+	for no := 1; no <= n; no++ {
+		season.Episodes = append(season.Episodes, Episode{
+			ID:        "e" + strconv.Itoa(no),
+			SeasonNo:  1,
+			EpisodeNo: no,
+		})
+	}
+	return &Item{ID: "show", Type: ItemTypeShow, Seasons: []Season{season}}
+}
+
+func TestNextUpEpisode(t *testing.T) {
+	at := func(seconds int) time.Time {
+		return time.Unix(int64(seconds), 0).UTC()
+	}
+	played := func(seconds int) database.UserData {
+		return database.UserData{Played: true, Timestamp: at(seconds)}
+	}
+	inProgress := func(seconds int) database.UserData {
+		return database.UserData{Position: 60, PlayedPercentage: 10, Timestamp: at(seconds)}
+	}
+
+	tests := []struct {
+		name           string
+		userData       map[string]database.UserData
+		options        NextUpOptions
+		wantEpisodeID  string
+		wantLastPlayed time.Time
+	}{
+		{
+			name:           "continue after highest played episode",
+			userData:       map[string]database.UserData{"e1": played(10), "e3": played(5)},
+			wantEpisodeID:  "e4",
+			wantLastPlayed: at(10),
+		},
+		{
+			name:          "nothing played",
+			userData:      map[string]database.UserData{},
+			wantEpisodeID: "",
+		},
+		{
+			name:          "first episode of explicitly requested show",
+			userData:      map[string]database.UserData{},
+			options:       NextUpOptions{SeriesID: "show"},
+			wantEpisodeID: "e1",
+		},
+		{
+			name:           "rewatching continues after most recently played episode",
+			userData:       map[string]database.UserData{"e5": played(10), "e2": played(20)},
+			options:        NextUpOptions{EnableRewatching: true},
+			wantEpisodeID:  "e3",
+			wantLastPlayed: at(20),
+		},
+		{
+			name:           "rewatching ignores more recent episode in progress",
+			userData:       map[string]database.UserData{"e5": played(10), "e2": inProgress(20)},
+			options:        NextUpOptions{EnableRewatching: true, EnableResumable: true},
+			wantEpisodeID:  "e6",
+			wantLastPlayed: at(20),
+		},
+		{
+			name:          "episode in progress is left to resume list",
+			userData:      map[string]database.UserData{"e1": played(10), "e2": inProgress(20)},
+			wantEpisodeID: "",
+		},
+		{
+			name:           "episode in progress with resumable enabled",
+			userData:       map[string]database.UserData{"e1": played(10), "e2": inProgress(20)},
+			options:        NextUpOptions{EnableResumable: true},
+			wantEpisodeID:  "e2",
+			wantLastPlayed: at(20),
+		},
+		{
+			name:          "all episodes played",
+			userData:      map[string]database.UserData{"e5": played(10), "e6": played(20)},
+			wantEpisodeID: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			episodeID, lastPlayed := nextUpEpisode(testShow(6), tt.userData, tt.options)
+			if episodeID != tt.wantEpisodeID {
+				t.Errorf("episode = %q, want %q", episodeID, tt.wantEpisodeID)
+			}
+			if tt.wantEpisodeID != "" && !lastPlayed.Equal(tt.wantLastPlayed) {
+				t.Errorf("lastPlayed = %v, want %v", lastPlayed, tt.wantLastPlayed)
+			}
+		})
+	}
+}
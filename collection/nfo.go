@@ -5,8 +5,11 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Nfo struct {
@@ -23,12 +26,16 @@ type Nfo struct {
 	Season       string       `xml:"season,omitempty"`
 	Episode      string       `xml:"episode,omitempty"`
 	Aired        string       `xml:"aired,omitempty"`
-	Studio       string       `xml:"studio,omitempty"`
+	Status       string       `xml:"status,omitempty"`
+	Studio       []string     `xml:"studio,omitempty"`
 	RatingString string       `xml:"rating,omitempty"`
 	Rating       float32      `xml:"-"`
 	VotesString  string       `xml:"votes,omitempty"`
 	Votes        int          `xml:"-"`
 	Genre        []string     `xml:"genre,omitempty"`
+	Tag          []string     `xml:"tag,omitempty"`
+	Trailer      string       `xml:"trailer,omitempty"`
+	Set          *Set         `xml:"set,omitempty"`
 	Actor        []Actor      `xml:"actor,omitempty"`
 	Director     string       `xml:"director,omitempty"`
 	Credits      string       `xml:"credits,omitempty"`
@@ -41,6 +48,39 @@ type Nfo struct {
 	FileInfo     *VidFileInfo `xml:"fileinfo,omitempty"`
 }
 
+// people returns names of actors and directors.
+func (n *Nfo) people() (names []string) {
+	for _, a := range n.Actor {
+		if name := strings.TrimSpace(a.Name); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for name := range strings.SplitSeq(n.Director, "/") {
+		if name := strings.TrimSpace(name); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// Set holds the movie set (collection) an item is part of. Older NFO files
+// have the set name as text, newer ones have it in a <name> element.
+type Set struct {
+	Name  string `xml:"name,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+// SetName returns the name of the set.
+func (s *Set) SetName() string {
+	if s == nil {
+		return ""
+	}
+	if s.Name != "" {
+		return strings.TrimSpace(s.Name)
+	}
+	return strings.TrimSpace(s.Value)
+}
+
 type UniqueID struct {
 	Type    string `xml:"type,attr"`
 	Default string `xml:"default,attr"`
@@ -61,8 +101,9 @@ type VidFileInfo struct {
 	StreamDetails *StreamDetails `xml:"streamdetails,omitempty"`
 }
 type StreamDetails struct {
-	Video *VideoDetails `xml:"video,omitempty"`
-	Audio *AudioDetails `xml:"audio,omitempty"`
+	Video    *VideoDetails     `xml:"video,omitempty"`
+	Audio    []AudioDetails    `xml:"audio,omitempty"`
+	Subtitle []SubtitleDetails `xml:"subtitle,omitempty"`
 }
 type VideoDetails struct {
 	Codec             string  `xml:"codec,omitempty"`
@@ -81,6 +122,10 @@ type AudioDetails struct {
 	Language string `xml:"language,omitempty"`
 }
 
+type SubtitleDetails struct {
+	Language string `xml:"language,omitempty"`
+}
+
 func NfoDecode(r io.ReadSeeker) (nfo *Nfo) {
 	// this is a really dirty hack to partially support <xbmcmultiepisode>
 	// for now. It just skips the tag and as a result parses just
@@ -133,6 +178,19 @@ func NfoDecode(r io.ReadSeeker) (nfo *Nfo) {
 
 	data.Genre = NormalizeGenres(data.Genre)
 
+	// Studios can be provided as multiple tags or as one
+	// tag with a list, e.g. "HBO / Warner Bros."
+	studios := make([]string, 0)
+	for _, s := range data.Studio {
+		for s2 := range strings.SplitSeq(s, " / ") {
+			s2 = strings.TrimSpace(s2)
+			if s2 != "" && !slices.Contains(studios, s2) {
+				studios = append(studios, s2)
+			}
+		}
+	}
+	data.Studio = studios
+
 	// Some non-string fields can be fscked up and explode the
 	// XML decoder, so decode them after the fact.
 	data.Rating = parseFloat32(data.RatingString)
@@ -158,3 +216,53 @@ func parseFloat32(s string) (i float32) {
 	}
 	return
 }
+
+// videoDuration returns the duration of the video stream in seconds, 0 if unknown.
+func (n *Nfo) videoDuration() int {
+	if n.FileInfo == nil || n.FileInfo.StreamDetails == nil || n.FileInfo.StreamDetails.Video == nil {
+		return 0
+	}
+	return n.FileInfo.StreamDetails.Video.DurationInSeconds
+}
+
+// videoWidth returns the width of the video stream, 0 if unknown.
+func (n *Nfo) videoWidth() int {
+	if n.FileInfo == nil || n.FileInfo.StreamDetails == nil || n.FileInfo.StreamDetails.Video == nil {
+		return 0
+	}
+	return n.FileInfo.StreamDetails.Video.Width
+}
+
+// hasSubtitles returns true if the video has embedded subtitles.
+func (n *Nfo) hasSubtitles() bool {
+	return n.FileInfo != nil && n.FileInfo.StreamDetails != nil && len(n.FileInfo.StreamDetails.Subtitle) != 0
+}
+
+// premiereDate returns the premiere or first air date, zero if unknown.
+func (n *Nfo) premiereDate() time.Time {
+	for _, date := range []string{n.Aired, n.Premiered} {
+		if t, err := time.Parse("2006-01-02", strings.TrimSpace(date)); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// TrailerURL returns the URL of the trailer, empty if there is none. Trailers
+// played by the Kodi YouTube add-on are converted to a YouTube URL.
+func (n *Nfo) TrailerURL() string {
+	trailer := strings.TrimSpace(n.Trailer)
+	if strings.HasPrefix(trailer, "http://") || strings.HasPrefix(trailer, "https://") {
+		return trailer
+	}
+	if strings.HasPrefix(trailer, "plugin://plugin.video.youtube") {
+		if u, err := url.Parse(trailer); err == nil {
+			for _, param := range []string{"videoid", "video_id"} {
+				if videoID := u.Query().Get(param); videoID != "" {
+					return "https://www.youtube.com/watch?v=" + videoID
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+package collection
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ParentalRating is an official rating with its score, the score
+// is the minimum age the rating is considered suitable for.
+type ParentalRating struct {
+	// Country of the rating system, e.g. US, GB, NL, DE
+	Country string
+	Name    string
+	Score   int
+}
+
+// parentalRatings holds the rating systems we know of per country.
+// US contains both MPAA movie and TV parental guidelines ratings.
+var parentalRatings = map[string][]ParentalRating{
+	"US": {
+		{Name: "G", Score: 0},
+		{Name: "TV-Y", Score: 0},
+		{Name: "TV-G", Score: 0},
+		{Name: "TV-Y7", Score: 7},
+		{Name: "PG", Score: 10},
+		{Name: "TV-PG", Score: 10},
+		{Name: "PG-13", Score: 13},
+		{Name: "TV-14", Score: 14},
+		{Name: "R", Score: 17},
+		{Name: "TV-MA", Score: 17},
+		{Name: "NC-17", Score: 18},
+	},
+	// BBFC
+	"GB": {
+		{Name: "U", Score: 0},
+		{Name: "PG", Score: 8},
+		{Name: "12", Score: 12},
+		{Name: "12A", Score: 12},
+		{Name: "15", Score: 15},
+		{Name: "18", Score: 18},
+		{Name: "R18", Score: 21},
+	},
+	// Kijkwijzer
+	"NL": {
+		{Name: "AL", Score: 0},
+		{Name: "6", Score: 6},
+		{Name: "9", Score: 9},
+		{Name: "12", Score: 12},
+		{Name: "14", Score: 14},
+		{Name: "16", Score: 16},
+		{Name: "18", Score: 18},
+	},
+	// FSK
+	"DE": {
+		{Name: "0", Score: 0},
+		{Name: "6", Score: 6},
+		{Name: "12", Score: 12},
+		{Name: "16", Score: 16},
+		{Name: "18", Score: 18},
+	},
+}
+
+// parentalRatingCountries is the order in which rating systems are
+// tried in case a rating does not specify its country.
+var parentalRatingCountries = []string{"US", "GB", "NL", "DE"}
+
+// countryAliases maps country names used in NFO files to country codes.
+var countryAliases = map[string]string{
+	"UK":          "GB",
+	"USA":         "US",
+	"NETHERLANDS": "NL",
+	"GERMANY":     "DE",
+}
+
+// ParentalRatings returns all known parental ratings, ordered by score. Names used
+// by several rating systems, e.g. "PG", are returned once with the score of the
+// rating system ParentalRatingScore picks for a rating without country.
+func ParentalRatings() (ratings []ParentalRating) {
+	for _, country := range parentalRatingCountries {
+		for _, r := range parentalRatings[country] {
+			if slices.ContainsFunc(ratings, func(known ParentalRating) bool { return known.Name == r.Name }) {
+				continue
+			}
+			r.Country = country
+			ratings = append(ratings, r)
+		}
+	}
+	sort.SliceStable(ratings, func(i, j int) bool {
+		return ratings[i].Score < ratings[j].Score
+	})
+	return
+}
+
+// ParentalRatingScore returns the score of an official rating, e.g. "PG-13",
+// "Rated R", "GB:15", "NL:12" or "DE:FSK 16". Rated is false in case the
+// rating is empty or unknown.
+func ParentalRatingScore(rating string) (score int, rated bool) {
+	rating = strings.ToUpper(strings.TrimSpace(rating))
+	rating = strings.TrimSpace(strings.TrimPrefix(rating, "RATED "))
+
+	countries := parentalRatingCountries
+	if country, name, found := strings.Cut(rating, ":"); found {
+		country = strings.TrimSpace(country)
+		if alias, ok := countryAliases[country]; ok {
+			country = alias
+		}
+		if _, ok := parentalRatings[country]; ok {
+			countries = []string{country}
+			rating = strings.TrimSpace(name)
+		}
+	}
+	// FSK ratings are often written as "FSK 12" or "FSK12"
+	if strings.HasPrefix(rating, "FSK") {
+		countries = []string{"DE"}
+		rating = strings.TrimLeft(strings.TrimPrefix(rating, "FSK"), " -")
+	}
+
+	for _, country := range countries {
+		for _, r := range parentalRatings[country] {
+			if r.Name == rating {
+				return r.Score, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// ParentalRatingScore returns the score of the official rating of the item,
+// the score is determined when the NFO of the item is loaded.
+func (i *Item) ParentalRatingScore() (score int, rated bool) {
+	return i.parentalRating, i.parentalRated
+}
@@ -0,0 +1,57 @@
+package collection
+
+import "testing"
+
+func TestParentalRatingScore(t *testing.T) {
+	tests := []struct {
+		rating    string
+		wantScore int
+		wantRated bool
+	}{
+		{rating: "PG-13", wantScore: 13, wantRated: true},
+		{rating: "Rated R", wantScore: 17, wantRated: true},
+		{rating: "PG", wantScore: 10, wantRated: true},
+		{rating: "GB:PG", wantScore: 8, wantRated: true},
+		{rating: "UK:15", wantScore: 15, wantRated: true},
+		{rating: "DE:FSK 16", wantScore: 16, wantRated: true},
+		{rating: "FSK12", wantScore: 12, wantRated: true},
+		{rating: "", wantRated: false},
+		{rating: "Unknown", wantRated: false},
+	}
+	for _, tt := range tests {
+		score, rated := ParentalRatingScore(tt.rating)
+		if score != tt.wantScore || rated != tt.wantRated {
+			t.Errorf("ParentalRatingScore(%q) = %d, %v, want %d, %v", tt.rating, score, rated, tt.wantScore, tt.wantRated)
+		}
+	}
+}
+
+func TestParentalRatingsListsNameOnce(t *testing.T) {
+	seen := make(map[string]bool)
+	previous := -1
+	for _, r := range ParentalRatings() {
+		if seen[r.Name] {
+			t.Errorf("rating %q listed more than once", r.Name)
+		}
+		seen[r.Name] = true
+		// The listed score must match the score items with this rating get
+		if score, _ := ParentalRatingScore(r.Name); score != r.Score {
+			t.Errorf("rating %q listed with score %d, items get %d", r.Name, r.Score, score)
+		}
+		if r.Score < previous {
+			t.Errorf("rating %q not ordered by score", r.Name)
+		}
+		previous = r.Score
+	}
+}
+
+func TestItemParentalRatingScoreIsCached(t *testing.T) {
+	i := &Item{Nfo: &Nfo{Mpaa: "PG-13"}}
+	if _, rated := i.ParentalRatingScore(); rated {
+		t.Error("item rated before its NFO is loaded")
+	}
+	i.LoadNfo()
+	if score, rated := i.ParentalRatingScore(); score != 13 || !rated {
+		t.Errorf("score = %d, %v, want 13, true", score, rated)
+	}
+}
@@ -0,0 +1,298 @@
+package collection
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/erikbos/jellofin-server/database"
+)
+
+// RecommendationType indicates why a group of items is recommended.
+type RecommendationType int
+
+const (
+	// Items similar to an item the user recently played
+	RecommendationSimilarToRecentlyPlayed RecommendationType = iota
+	// Items similar to a favorite item of the user
+	RecommendationSimilarToLikedItem
+	// Items starring an actor of an item the user recently played
+	RecommendationHasActorFromRecentlyPlayed
+	// Items directed by the director of an item the user recently played
+	RecommendationHasDirectorFromRecentlyPlayed
+)
+
+// Recommendation is a group of recommended items with the reason they are recommended.
+type Recommendation struct {
+	Type RecommendationType
+	// BaselineItemName is the name of the item or person the recommendation is based upon
+	BaselineItemName string
+	ItemIDs          []string
+}
+
+// Weights of user activity when building a user profile.
+const (
+	profileWeightPlayed    = 1.0
+	profileWeightInProgess = 0.5
+	profileWeightFavorite  = 2.0
+)
+
+// userProfile holds the preferences of a user derived from play state and favorites.
+type userProfile struct {
+	genres  map[string]float64
+	people  map[string]float64
+	decades map[int]float64
+	// started holds items (movies or shows) the user has started or finished watching
+	started map[string]bool
+	// recentlyPlayed holds played items, most recent first
+	recentlyPlayed []*Item
+	// favorites holds favorite items of the user
+	favorites []*Item
+}
+
+// Recommend returns IDs of items the user has not watched yet, ranked on
+// how well they match the genres, people and decades the user watches.
+func (cr *CollectionRepo) Recommend(userID string) (itemIDs []string, err error) {
+	profile, err := cr.buildUserProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	type scoredItem struct {
+		id    string
+		name  string
+		score float64
+	}
+	var candidates []scoredItem
+	for _, c := range cr.collections {
+		for _, i := range c.Items {
+			if profile.started[i.ID] {
+				continue
+			}
+			i.LoadNfo()
+			if score := profile.score(i); score > 0 {
+				candidates = append(candidates, scoredItem{id: i.ID, name: i.Name, score: score})
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	itemIDs = make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		itemIDs = append(itemIDs, c.id)
+	}
+	return itemIDs, nil
+}
+
+// Recommendations returns groups of recommended unwatched items of the given item type,
+// e.g. "Because you watched X", "Starring Y" and "Directed by Z".
+// At most categoryLimit groups with each at most itemLimit items are returned.
+// In case allowed is not nil only items it returns true for are recommended.
+func (cr *CollectionRepo) Recommendations(userID, itemType string, categoryLimit, itemLimit int,
+	allowed func(c *Collection, i *Item) bool) (recommendations []Recommendation, err error) {
+	profile, err := cr.buildUserProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// unwatched returns up to itemLimit unwatched and allowed items of requested type
+	unwatched := func(itemIDs []string) (result []string) {
+		for _, id := range itemIDs {
+			if len(result) >= itemLimit {
+				break
+			}
+			c, i := cr.GetItemByID(id)
+			if i == nil || i.Type != itemType || profile.started[id] {
+				continue
+			}
+			if allowed == nil || allowed(c, i) {
+				result = append(result, id)
+			}
+		}
+		return
+	}
+	add := func(recommendationType RecommendationType, baseline string, itemIDs []string) {
+		if len(itemIDs) == 0 || len(recommendations) >= categoryLimit {
+			return
+		}
+		for _, r := range recommendations {
+			if r.Type == recommendationType && r.BaselineItemName == baseline {
+				return
+			}
+		}
+		recommendations = append(recommendations, Recommendation{
+			Type:             recommendationType,
+			BaselineItemName: baseline,
+			ItemIDs:          itemIDs,
+		})
+	}
+
+	// Interleave categories so we do not end up with only one kind of recommendation
+	for n := 0; n < categoryLimit; n++ {
+		if n < len(profile.recentlyPlayed) {
+			i := profile.recentlyPlayed[n]
+			if similar, err := cr.Similar(i.ID); err == nil {
+				add(RecommendationSimilarToRecentlyPlayed, nfoTitle(i), unwatched(similar))
+			}
+			if i.Nfo != nil {
+				if len(i.Nfo.Actor) > 0 {
+					actor := i.Nfo.Actor[0].Name
+					add(RecommendationHasActorFromRecentlyPlayed, actor, unwatched(cr.itemsWithPerson(actor)))
+				}
+				if director := i.Nfo.Director; director != "" {
+					add(RecommendationHasDirectorFromRecentlyPlayed, director, unwatched(cr.itemsWithPerson(director)))
+				}
+			}
+		}
+		if n < len(profile.favorites) {
+			i := profile.favorites[n]
+			if similar, err := cr.Similar(i.ID); err == nil {
+				add(RecommendationSimilarToLikedItem, nfoTitle(i), unwatched(similar))
+			}
+		}
+	}
+	return recommendations, nil
+}
+
+// buildUserProfile builds a profile of the user based upon play state and favorites.
+func (cr *CollectionRepo) buildUserProfile(userID string) (*userProfile, error) {
+	userData, err := cr.db.UserDataRepo.GetAll(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &userProfile{
+		genres:  make(map[string]float64),
+		people:  make(map[string]float64),
+		decades: make(map[int]float64),
+		started: make(map[string]bool),
+	}
+
+	type playedItem struct {
+		item      *Item
+		timestamp time.Time
+	}
+	var played []playedItem
+
+	for _, c := range cr.collections {
+		for _, i := range c.Items {
+			// Aggregate play state of a show from its episodes
+			var weight float64
+			var favorite bool
+			var lastPlayed time.Time
+
+			state, found := userData[i.ID]
+			if found {
+				weight, favorite, lastPlayed = profileWeight(state)
+			}
+			for _, s := range i.Seasons {
+				for _, e := range s.Episodes {
+					if state, found := userData[e.ID]; found {
+						w, _, ts := profileWeight(state)
+						weight = max(weight, w)
+						if ts.After(lastPlayed) {
+							lastPlayed = ts
+						}
+					}
+				}
+			}
+			if weight > 0 {
+				profile.started[i.ID] = true
+			}
+			if favorite {
+				weight += profileWeightFavorite
+			}
+			if weight == 0 {
+				continue
+			}
+
+			i.LoadNfo()
+			profile.add(i, weight)
+			if favorite {
+				profile.favorites = append(profile.favorites, i)
+			}
+			if !lastPlayed.IsZero() && profile.started[i.ID] {
+				played = append(played, playedItem{item: i, timestamp: lastPlayed})
+			}
+		}
+	}
+
+	sort.Slice(played, func(i, j int) bool {
+		return played[i].timestamp.After(played[j].timestamp)
+	})
+	for _, p := range played {
+		profile.recentlyPlayed = append(profile.recentlyPlayed, p.item)
+	}
+	sort.Slice(profile.favorites, func(i, j int) bool {
+		return profile.favorites[i].Name < profile.favorites[j].Name
+	})
+	return profile, nil
+}
+
+// profileWeight returns how much an item's play state adds to the user profile.
+func profileWeight(state database.UserData) (weight float64, favorite bool, lastPlayed time.Time) {
+	if state.Played {
+		weight = profileWeightPlayed
+		lastPlayed = state.Timestamp
+	} else if state.PlayedPercentage > 0 || state.Position > 0 {
+		weight = profileWeightInProgess
+		lastPlayed = state.Timestamp
+	}
+	return weight, state.Favorite, lastPlayed
+}
+
+// add adds the attributes of an item to the user profile.
+func (p *userProfile) add(i *Item, weight float64) {
+	for _, g := range i.Genres {
+		p.genres[strings.ToLower(g)] += weight
+	}
+	for _, person := range i.ItemPeople() {
+		p.people[strings.ToLower(person)] += weight
+	}
+	if i.Year != 0 {
+		p.decades[i.Year/10*10] += weight
+	}
+}
+
+// score returns how well an item matches the user profile.
+func (p *userProfile) score(i *Item) (score float64) {
+	for _, g := range i.Genres {
+		score += p.genres[strings.ToLower(g)]
+	}
+	for _, person := range i.ItemPeople() {
+		score += p.people[strings.ToLower(person)]
+	}
+	// Decade only adds to items that have something else in common
+	if score > 0 && i.Year != 0 {
+		score += p.decades[i.Year/10*10] / 2
+	}
+	return
+}
+
+// itemsWithPerson returns IDs of items the person acted in or directed.
+func (cr *CollectionRepo) itemsWithPerson(person string) (itemIDs []string) {
+	for _, c := range cr.collections {
+		for _, i := range c.Items {
+			i.LoadNfo()
+			if slices.Contains(i.ItemPeople(), person) {
+				itemIDs = append(itemIDs, i.ID)
+			}
+		}
+	}
+	return
+}
+
+// nfoTitle returns title of item from NFO if available, otherwise its name.
+func nfoTitle(i *Item) string {
+	if i.Nfo != nil && i.Nfo.Title != "" {
+		return i.Nfo.Title
+	}
+	return i.Name
+}
@@ -0,0 +1,154 @@
+package collection
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Weights used to score similarity between two items.
+const (
+	similarWeightGenre  = 3.0
+	similarWeightTag    = 2.0
+	similarWeightPerson = 1.5
+	similarWeightStudio = 2.0
+	similarWeightSet    = 6.0
+	// Items released in the same year score similarWeightYear,
+	// decreasing linearly to zero at similarYearRange years apart.
+	similarWeightYear = 2.0
+	similarYearRange  = 10
+)
+
+var ErrItemNotFound = errors.New("item not found")
+
+// Similar returns the IDs of items that are similar to the provided item,
+// most similar item first. Items are scored by overlap of genres, tags,
+// people, studios, set membership and proximity of release year. Only items
+// of the same type are considered, the item itself is never returned.
+func (cr *CollectionRepo) Similar(itemID string) (similarItemIDs []string, err error) {
+	_, item := cr.GetItemByID(itemID)
+	if item == nil {
+		return nil, ErrItemNotFound
+	}
+	item.LoadNfo()
+	source := makeSimilarProfile(item)
+
+	type scoredItem struct {
+		id    string
+		name  string
+		score float64
+	}
+	var candidates []scoredItem
+
+	for _, c := range cr.collections {
+		for _, i := range c.Items {
+			if i.ID == item.ID || i.Type != item.Type {
+				continue
+			}
+			i.LoadNfo()
+			if score := source.score(makeSimilarProfile(i)); score > 0 {
+				candidates = append(candidates, scoredItem{
+					id:    i.ID,
+					name:  i.Name,
+					score: score,
+				})
+			}
+		}
+	}
+
+	// Highest score first, use name as tie breaker to get a stable order
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	similarItemIDs = make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		similarItemIDs = append(similarItemIDs, c.id)
+	}
+	return similarItemIDs, nil
+}
+
+// ItemPeople returns the names of actors and directors of an item.
+func (i *Item) ItemPeople() (people []string) {
+	if i.Nfo == nil {
+		return
+	}
+	for _, a := range i.Nfo.Actor {
+		if a.Name != "" && !slices.Contains(people, a.Name) {
+			people = append(people, a.Name)
+		}
+	}
+	if i.Nfo.Director != "" && !slices.Contains(people, i.Nfo.Director) {
+		people = append(people, i.Nfo.Director)
+	}
+	return
+}
+
+// similarProfile holds the normalized attributes of an item used for scoring.
+type similarProfile struct {
+	genres  []string
+	tags    []string
+	people  []string
+	studios []string
+	set     string
+	year    int
+}
+
+func makeSimilarProfile(i *Item) similarProfile {
+	p := similarProfile{
+		genres:  lowerAll(i.Genres),
+		studios: lowerAll(i.Studios),
+		people:  lowerAll(i.ItemPeople()),
+		year:    i.Year,
+	}
+	if i.Nfo != nil {
+		p.tags = lowerAll(i.Nfo.Tag)
+		p.set = strings.ToLower(i.Nfo.Set.SetName())
+	}
+	return p
+}
+
+// score returns the similarity score of two profiles, 0 means not similar at all.
+func (p similarProfile) score(o similarProfile) (score float64) {
+	score += similarWeightGenre * float64(overlap(p.genres, o.genres))
+	score += similarWeightTag * float64(overlap(p.tags, o.tags))
+	score += similarWeightPerson * float64(overlap(p.people, o.people))
+	score += similarWeightStudio * float64(overlap(p.studios, o.studios))
+	if p.set != "" && p.set == o.set {
+		score += similarWeightSet
+	}
+	// Year proximity only adds to items that have something else in common,
+	// otherwise every item of the same year would be similar.
+	if score > 0 && p.year != 0 && o.year != 0 {
+		distance := p.year - o.year
+		if distance < 0 {
+			distance = -distance
+		}
+		if distance < similarYearRange {
+			score += similarWeightYear * float64(similarYearRange-distance) / similarYearRange
+		}
+	}
+	return
+}
+
+// overlap returns the number of entries present in both lists.
+func overlap(a, b []string) (count int) {
+	for _, v := range a {
+		if slices.Contains(b, v) {
+			count++
+		}
+	}
+	return
+}
+
+func lowerAll(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		result = append(result, strings.ToLower(v))
+	}
+	return result
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/erikbos/jellofin-server/collection"
+	"github.com/erikbos/jellofin-server/database"
+	"github.com/erikbos/jellofin-server/importer"
+)
+
+// runCommand runs a command given on the command line, e.g.
+// "jellofin-server export --out state.json".
+func runCommand(config *cfgMain, db *database.DatabaseRepo, args []string) error {
+	switch args[0] {
+	case "export":
+		return exportCommand(config, db, args[1:])
+	case "import":
+		return importCommand(config, db, args[1:])
+	case "backup":
+		return backupCommand(db, args[1:])
+	case "import-history":
+		return importHistoryCommand(config, db, args[1:])
+	}
+	return fmt.Errorf("unknown command %q, valid commands are export, import, import-history and backup", args[0])
+}
+
+// exportCommand writes all user state to a JSON file.
+func exportCommand(config *cfgMain, db *database.DatabaseRepo, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	out := flags.String("out", "", "Path of file to write state to, default is standard output.")
+	flags.Parse(args)
+
+	state, err := db.Export()
+	if err != nil {
+		return err
+	}
+
+	// Add identity of items so they can be found after rebuilding the library
+	collections := initCollections(config, db)
+	unknown := 0
+	for _, ref := range stateItemRefs(state) {
+		if !describeItemRef(collections, ref) {
+			unknown++
+		}
+	}
+	if unknown != 0 {
+		log.Printf("export: %d item references do not refer to a known item", unknown)
+	}
+
+	output := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		output = f
+	}
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(state); err != nil {
+		return err
+	}
+	log.Printf("export: exported %d users, %d play states, %d playlists and %d access tokens",
+		len(state.Users), len(state.UserData), len(state.Playlists), len(state.AccessTokens))
+	return nil
+}
+
+// importCommand reads user state from a JSON file and stores it in the database.
+func importCommand(config *cfgMain, db *database.DatabaseRepo, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	in := flags.String("in", "", "Path of file to read state from.")
+	flags.Parse(args)
+	if *in == "" && flags.NArg() > 0 {
+		*in = flags.Arg(0)
+	}
+	if *in == "" {
+		return fmt.Errorf("import: no input file provided")
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	var state database.State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	// Map items to their ID in the current library
+	collections := initCollections(config, db)
+	unmatched := map[*database.ItemRef]bool{}
+	for _, ref := range stateItemRefs(&state) {
+		if ref.Type != "" && !resolveItemRef(collections, ref) {
+			log.Printf("import: no match for %s %q season %d episode %d",
+				ref.Type, ref.Name, ref.SeasonNo, ref.EpisodeNo)
+			unmatched[ref] = true
+		}
+	}
+	// Drop state of unmatched items
+	userData := state.UserData[:0]
+	for i := range state.UserData {
+		if !unmatched[&state.UserData[i].Item] {
+			userData = append(userData, state.UserData[i])
+		}
+	}
+	state.UserData = userData
+	for i := range state.Playlists {
+		p := &state.Playlists[i]
+		items := make([]database.ItemRef, 0, len(p.Items))
+		for j := range p.Items {
+			if !unmatched[&p.Items[j]] {
+				items = append(items, p.Items[j])
+			}
+		}
+		p.Items = items
+	}
+
+	if err := db.Import(&state); err != nil {
+		return err
+	}
+	log.Printf("import: imported %d users, %d play states, %d playlists and %d access tokens, %d items not matched",
+		len(state.Users), len(state.UserData), len(state.Playlists), len(state.AccessTokens), len(unmatched))
+	return nil
+}
+
+// backupCommand writes a consistent copy of the database.
+func backupCommand(db *database.DatabaseRepo, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := flags.String("out", "", "Path of file to write database backup to.")
+	flags.Parse(args)
+	if *out == "" {
+		return fmt.Errorf("backup: no output file provided")
+	}
+	if err := db.Backup(*out); err != nil {
+		return err
+	}
+	log.Printf("backup: database written to %s", *out)
+	return nil
+}
+
+// importHistoryCommand imports watch history of another media server for a user.
+// The server must be stopped, as it keeps play state in memory and would overwrite
+// the imported play state.
+func importHistoryCommand(config *cfgMain, db *database.DatabaseRepo, args []string) error {
+	flags := flag.NewFlagSet("import-history", flag.ExitOnError)
+	format := flags.String("format", "", "Format of file to import: "+strings.Join(importer.Formats, ", ")+".")
+	username := flags.String("user", "", "Name of user to import watch history for.")
+	sourceUser := flags.String("source-user", "", "Name or ID of user in the file to import, required in case the file holds multiple users.")
+	dryRun := flags.Bool("dry-run", false, "Match items and report, but do not store watch history.")
+	flags.Parse(args)
+	if *format == "" || *username == "" || flags.NArg() != 1 {
+		return fmt.Errorf("usage: import-history --format <format> --user <username> [--source-user <user>] [--dry-run] <file>")
+	}
+	if !*dryRun && serverRunning(config) {
+		return fmt.Errorf("import-history: server is running on port %d, stop it before importing", config.Listen.Port)
+	}
+
+	users, err := db.UserRepo.GetAll()
+	if err != nil {
+		return err
+	}
+	userIndex := slices.IndexFunc(users, func(u database.User) bool { return u.Username == *username })
+	if userIndex == -1 {
+		return fmt.Errorf("import-history: %w: %s", database.ErrUserNotFound, *username)
+	}
+
+	records, err := importer.Read(*format, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	// Only import records of one user
+	sourceUsers := map[string]bool{}
+	selected := records[:0]
+	for _, r := range records {
+		if r.User == "" || *sourceUser == "" || r.User == *sourceUser {
+			selected = append(selected, r)
+		}
+		if r.User != "" {
+			sourceUsers[r.User] = true
+		}
+	}
+	if *sourceUser == "" && len(sourceUsers) > 1 {
+		return fmt.Errorf("import-history: file holds multiple users, select one with --source-user: %s",
+			strings.Join(slices.Sorted(maps.Keys(sourceUsers)), ", "))
+	}
+
+	collections := initCollections(config, db)
+	result, err := importer.Import(collections, db.UserDataRepo, users[userIndex].ID, selected, *dryRun)
+	if err != nil {
+		return err
+	}
+	for _, r := range result.Unmatched {
+		log.Printf("import-history: no match for %s %s", r.Type, r)
+	}
+	log.Printf("import-history: read %d records, %d matched, %d not matched, play state of %d items updated",
+		len(selected), result.Matched, len(result.Unmatched), result.Updated)
+	return nil
+}
+
+// serverRunning returns true in case a server is listening on the configured port.
+func serverRunning(config *cfgMain) bool {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("localhost:%d", config.Listen.Port), time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// initCollections scans all collections so item IDs can be mapped.
+func initCollections(config *cfgMain, db *database.DatabaseRepo) *collection.CollectionRepo {
+	log.Printf("Initializing collections..")
+	c := collection.New(&collection.Options{
+		Collections: config.Collections,
+		Db:          db,
+	})
+	c.Init()
+	return c
+}
+
+// stateItemRefs returns pointers to all item references in state.
+func stateItemRefs(state *database.State) (refs []*database.ItemRef) {
+	for i := range state.UserData {
+		refs = append(refs, &state.UserData[i].Item)
+	}
+	for i := range state.Playlists {
+		for j := range state.Playlists[i].Items {
+			refs = append(refs, &state.Playlists[i].Items[j])
+		}
+	}
+	return
+}
+
+// describeItemRef fills in the identity of an item reference. Item IDs used
+// by Jellyfin clients can have a prefix such as "episode_", the identity is
+// that of the item without prefix.
+func describeItemRef(collections *collection.CollectionRepo, ref *database.ItemRef) bool {
+	prefix, itemID := splitItemID(ref.ID)
+	r := database.ItemRef{ID: itemID}
+	if !collections.DescribeItemRef(&r) {
+		return false
+	}
+	r.ID = prefix + r.ID
+	*ref = r
+	return true
+}
+
+// resolveItemRef sets the ID of an item reference to the current ID of the item, keeping its prefix.
+func resolveItemRef(collections *collection.CollectionRepo, ref *database.ItemRef) bool {
+	prefix, _ := splitItemID(ref.ID)
+	r := *ref
+	if !collections.ResolveItemRef(&r) {
+		return false
+	}
+	ref.ID = prefix + r.ID
+	return true
+}
+
+// splitItemID splits an item ID into its prefix, e.g. "episode_", and ID.
+func splitItemID(itemID string) (prefix, id string) {
+	if i := strings.LastIndex(itemID, "_"); i != -1 {
+		return itemID[:i+1], itemID[i+1:]
+	}
+	return "", itemID
+}
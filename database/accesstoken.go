@@ -1,9 +1,11 @@
 package database
 
 import (
+	"context"
 	"crypto/rand"
 	"errors"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,17 +20,24 @@ type AccessTokenStorage struct {
 	lastDBSyncTime   time.Time
 	mu               sync.Mutex
 	accessTokenCache map[string]*AccessToken
+	// idleTimeout is the duration after which an unused token expires, 0 means never
+	idleTimeout time.Duration
+	// maxAge is the duration after which a token expires regardless of use, 0 means never
+	maxAge time.Duration
 }
 
 var (
 	ErrAccessTokenNotFound = errors.New("access token not found")
+	ErrAccessTokenExpired  = errors.New("access token expired")
 )
 
 // NewAccessTokenStorage initializes access token issuer
-func NewAccessTokenStorage(d *sqlx.DB) *AccessTokenStorage {
+func NewAccessTokenStorage(d *sqlx.DB, idleTimeout, maxAge time.Duration) *AccessTokenStorage {
 	return &AccessTokenStorage{
 		dbHandle:         d,
 		accessTokenCache: make(map[string]*AccessToken),
+		idleTimeout:      idleTimeout,
+		maxAge:           maxAge,
 	}
 }
 
@@ -38,30 +47,40 @@ type AccessToken struct {
 	Token string
 	// UserID of the user
 	UserID string
+	// Created is the time the token was issued
+	Created time.Time
 	// LastUsed of last use
 	LastUsed time.Time
+	// DeviceID of the device the token was issued to
+	DeviceID string
+	// DeviceName of the device the token was issued to
+	DeviceName string
+	// Client is the name of the application the token was issued to
+	Client string
+	// ApplicationVersion is the version of the application the token was issued to
+	ApplicationVersion string
 }
 
-// Generate generates new token
-func (s *AccessTokenStorage) Generate(userID string) (string, error) {
+// Generate generates new token for a user, device details are taken from the provided token.
+func (s *AccessTokenStorage) Generate(details AccessToken) (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	token := rand.Text()
-	t := &AccessToken{
-		Token:    token,
-		UserID:   userID,
-		LastUsed: time.Now().UTC(),
-	}
+	now := time.Now().UTC()
+	t := details
+	t.Token = rand.Text()
+	t.Created = now
+	t.LastUsed = now
+
 	// Store accesstoken in database
-	if err := s.storeToken(*t); err != nil {
+	if err := s.storeToken(t); err != nil {
 		return "", err
 	}
 
 	// Store accesstoken in memory
-	s.accessTokenCache[token] = t
+	s.accessTokenCache[t.Token] = &t
 
-	return token, nil
+	return t.Token, nil
 }
 
 // Get accesstoken details by tokenid
@@ -70,39 +89,153 @@ func (s *AccessTokenStorage) Get(token string) (*AccessToken, error) {
 	defer s.mu.Unlock()
 
 	// Try our in-memory store first
-	if at, ok := s.accessTokenCache[token]; ok {
-		// Update token timestamp so we can keep track of in-use tokens
-		at.LastUsed = time.Now().UTC()
-		s.accessTokenCache[token] = at
-		return at, nil
+	at, ok := s.accessTokenCache[token]
+	if !ok {
+		// try database
+		var t AccessToken
+		if err := s.dbHandle.Get(&t, "SELECT * FROM accesstokens WHERE token=? LIMIT 1", token); err != nil {
+			return nil, ErrAccessTokenNotFound
+		}
+		at = &t
+	}
+
+	if s.expired(at, time.Now().UTC()) {
+		delete(s.accessTokenCache, token)
+		if err := s.deleteTokens("DELETE FROM accesstokens WHERE token=?", token); err != nil {
+			log.Printf("Error deleting expired access token: %s\n", err)
+		}
+		return nil, ErrAccessTokenExpired
+	}
+
+	// Update token timestamp so we can keep track of in-use tokens
+	at.LastUsed = time.Now().UTC()
+	s.accessTokenCache[token] = at
+	return at, nil
+}
+
+// GetAll returns all access tokens, most recently used first.
+func (s *AccessTokenStorage) GetAll() ([]AccessToken, error) {
+	// Make sure recent use of tokens is reflected in the database
+	if err := s.writeChangedAccessTokensToDB(); err != nil {
+		return nil, err
+	}
+
+	var tokens []AccessToken
+	if err := s.dbHandle.Select(&tokens, "SELECT * FROM accesstokens"); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	result := make([]AccessToken, 0, len(tokens))
+	for _, t := range tokens {
+		if !s.expired(&t, now) {
+			result = append(result, t)
+		}
 	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastUsed.After(result[j].LastUsed)
+	})
+	return result, nil
+}
+
+// Delete revokes an access token.
+func (s *AccessTokenStorage) Delete(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.accessTokenCache, token)
+	return s.deleteTokens("DELETE FROM accesstokens WHERE token=?", token)
+}
 
-	// try database
-	var t AccessToken
-	sqlerr := s.dbHandle.Get(&t, "SELECT * FROM accesstokens WHERE token=? LIMIT 1", token)
-	if sqlerr == nil {
-		t.LastUsed = time.Now().UTC()
-		// Store accesstoken in memory
-		s.accessTokenCache[token] = &t
-		return &t, nil
+// DeleteByDevice revokes all access tokens of a user issued to a device.
+func (s *AccessTokenStorage) DeleteByDevice(userID, deviceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token, t := range s.accessTokenCache {
+		if t.UserID == userID && t.DeviceID == deviceID {
+			delete(s.accessTokenCache, token)
+		}
 	}
+	return s.deleteTokens("DELETE FROM accesstokens WHERE userid=? AND deviceid=?", userID, deviceID)
+}
+
+// DeleteByUser revokes all access tokens of a user.
+func (s *AccessTokenStorage) DeleteByUser(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return nil, ErrAccessTokenNotFound
+	for token, t := range s.accessTokenCache {
+		if t.UserID == userID {
+			delete(s.accessTokenCache, token)
+		}
+	}
+	return s.deleteTokens("DELETE FROM accesstokens WHERE userid=?", userID)
 }
 
-// BackgroundJobs writes changed accesstokens to database.
-func (s *AccessTokenStorage) BackgroundJobs() {
+// BackgroundJobs writes changed accesstokens to database and removes expired tokens
+// every 60 seconds, until ctx is cancelled.
+func (s *AccessTokenStorage) BackgroundJobs(ctx context.Context) {
 	if s.dbHandle == nil {
 		log.Fatal(ErrNoDbHandle)
 	}
 
 	s.lastDBSyncTime = time.Now().UTC()
+	ticker := time.NewTicker(60 * time.Second)
+	defer ticker.Stop()
 	for {
 		if err := s.writeChangedAccessTokensToDB(); err != nil {
 			log.Printf("Error writing access tokens to db: %s\n", err)
 		}
-		time.Sleep(60 * time.Second)
+		if err := s.removeExpiredTokens(); err != nil {
+			log.Printf("Error removing expired access tokens: %s\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush writes access tokens of which the last use changed to database.
+func (s *AccessTokenStorage) Flush() error {
+	return s.writeChangedAccessTokensToDB()
+}
+
+// expired returns true if a token is past its idle timeout or maximum age.
+func (s *AccessTokenStorage) expired(t *AccessToken, now time.Time) bool {
+	if s.idleTimeout != 0 && now.Sub(t.LastUsed) > s.idleTimeout {
+		return true
+	}
+	if s.maxAge != 0 && now.Sub(t.Created) > s.maxAge {
+		return true
+	}
+	return false
+}
+
+// removeExpiredTokens removes expired tokens from memory and database.
+func (s *AccessTokenStorage) removeExpiredTokens() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for token, t := range s.accessTokenCache {
+		if s.expired(t, now) {
+			delete(s.accessTokenCache, token)
+		}
+	}
+	if s.idleTimeout != 0 {
+		if err := s.deleteTokens("DELETE FROM accesstokens WHERE lastused < ?", now.Add(-s.idleTimeout)); err != nil {
+			return err
+		}
+	}
+	if s.maxAge != 0 {
+		if err := s.deleteTokens("DELETE FROM accesstokens WHERE created < ?", now.Add(-s.maxAge)); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // writeChangedAccessTokensToDB writes updated access tokens to db to persist last use date.
@@ -132,11 +265,22 @@ func (s *AccessTokenStorage) storeToken(t AccessToken) error {
 	}
 	defer tx.Rollback()
 
-	_, err = tx.NamedExec(`INSERT OR REPLACE INTO accesstokens (userid, token, lastused)
-		VALUES (:userid, :token, :lastused)`, t)
+	_, err = tx.NamedExec(`INSERT OR REPLACE INTO accesstokens (userid, token, created, lastused,
+		deviceid, devicename, client, applicationversion)
+		VALUES (:userid, :token, :created, :lastused,
+		:deviceid, :devicename, :client, :applicationversion)`, t)
 	if err != nil {
 		return err
 
 	}
 	return tx.Commit()
 }
+
+// deleteTokens removes access tokens matching a query from the database
+func (s *AccessTokenStorage) deleteTokens(query string, args ...any) error {
+	if s.dbHandle == nil {
+		return ErrNoDbHandle
+	}
+	_, err := s.dbHandle.Exec(query, args...)
+	return err
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	backupFilePrefix = "jellofin-backup-"
+	backupFileSuffix = ".db"
+)
+
+var (
+	ErrBackupExists = errors.New("backup file already exists")
+)
+
+// Backup writes a consistent copy of the database to filename using SQLite's
+// online backup API, the database remains available while the backup is made.
+func (d *DatabaseRepo) Backup(filename string) error {
+	if d.dbHandle == nil {
+		return ErrNoDbHandle
+	}
+	if _, err := os.Stat(filename); err == nil {
+		return fmt.Errorf("%w: %s", ErrBackupExists, filename)
+	}
+
+	// Write to temporary file first so an interrupted backup never looks complete
+	tmpFilename := filename + ".tmp"
+	os.Remove(tmpFilename)
+	if err := d.backupTo(tmpFilename); err != nil {
+		os.Remove(tmpFilename)
+		return err
+	}
+	return os.Rename(tmpFilename, filename)
+}
+
+// backupTo copies all pages of the database to a new database file.
+func (d *DatabaseRepo) backupTo(filename string) error {
+	ctx := context.Background()
+
+	destDb, err := sql.Open("sqlite3", filename)
+	if err != nil {
+		return err
+	}
+	defer destDb.Close()
+
+	destConn, err := destDb.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	srcConn, err := d.dbHandle.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			dest, ok := destDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("backup destination is not a sqlite3 connection")
+			}
+			src, ok := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("backup source is not a sqlite3 connection")
+			}
+			backup, err := dest.Backup("main", src, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// BackgroundBackup periodically writes a timestamped backup of the database
+// to directory, keeping the most recent keep backups, until ctx is cancelled.
+// Keep 0 means all backups are kept.
+func (d *DatabaseRepo) BackgroundBackup(ctx context.Context, directory string, interval time.Duration, keep int) {
+	if d.dbHandle == nil {
+		log.Fatal(ErrNoDbHandle)
+	}
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		log.Printf("Error creating backup directory: %s\n", err)
+		return
+	}
+
+	for {
+		filename := filepath.Join(directory,
+			backupFilePrefix+time.Now().UTC().Format("20060102-150405")+backupFileSuffix)
+		if err := d.Backup(filename); err != nil {
+			log.Printf("Error backing up database: %s\n", err)
+		} else {
+			log.Printf("Database backup written to %s\n", filename)
+		}
+		if err := pruneBackups(directory, keep); err != nil {
+			log.Printf("Error removing old database backups: %s\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// pruneBackups removes the oldest backups in directory keeping the most recent keep backups.
+func pruneBackups(directory string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), backupFilePrefix) &&
+			strings.HasSuffix(e.Name(), backupFileSuffix) {
+			backups = append(backups, e.Name())
+		}
+	}
+	// Filenames contain the backup time, so sorting them orders by age
+	slices.Sort(backups)
+	for len(backups) > keep {
+		if err := os.Remove(filepath.Join(directory, backups[0])); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
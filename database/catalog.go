@@ -0,0 +1,424 @@
+package database
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/erikbos/jellofin-server/idhash"
+)
+
+// The catalog is an index of all movies and shows in the collections with the
+// fields clients filter and sort on. It is rebuilt after each scan of a
+// collection and allows item queries to be answered without materializing
+// every item in the library.
+
+type CatalogStorage struct {
+	dbHandle *sqlx.DB
+	// userData holds play state of users, which is kept in memory
+	userData *UserDataStorage
+	// fts is true if SQLite supports full-text search
+	fts bool
+	mu  sync.Mutex
+	// vocabulary holds all search index terms, used for fuzzy matching
+	vocabulary []string
+}
+
+// CatalogItem is a movie or show in the catalog.
+type CatalogItem struct {
+	ID           string
+	CollectionID string
+	// Type is the collection item type, e.g. movie or show
+	Type     string
+	Name     string
+	SortName string
+	Year     int
+	// CommunityRating is the rating from the NFO file, 0 if unknown
+	CommunityRating float64
+	OfficialRating  string
+	// ParentalRating is the score of the official rating, nil if unrated
+	ParentalRating *int
+	DateCreated    time.Time
+	// PremiereDate is the release or first air date
+	PremiereDate time.Time
+	// Width of the video, the widest episode in case of a show, 0 if unknown
+	Width        int
+	HasSubtitles bool
+	HasTrailer   bool
+	// SeriesStatus is the status of a show, e.g. Continuing or Ended
+	SeriesStatus string
+	Genres       []string `db:"-"`
+	Studios      []string `db:"-"`
+	// Title, OriginalTitle, Plot and People are only used for the search index
+	Title         string   `db:"-"`
+	OriginalTitle string   `db:"-"`
+	Plot          string   `db:"-"`
+	People        []string `db:"-"`
+	// Episodes of a show, used for the search index and play state of the show
+	Episodes []CatalogEpisode `db:"-"`
+}
+
+// CatalogEpisode is an episode of a show in the catalog.
+type CatalogEpisode struct {
+	ID    string
+	Title string
+	Plot  string
+}
+
+// CatalogQuery selects, sorts and paginates catalog items. Empty fields do not restrict the result.
+type CatalogQuery struct {
+	// UserID is used for filtering and sorting on play state
+	UserID string
+	// CollectionIDs restricts the result to these collections, the user is allowed to access
+	CollectionIDs []string
+	// ItemIDs restricts the result to these items, ExcludeItemIDs excludes items
+	ItemIDs        []string
+	ExcludeItemIDs []string
+	// IncludeItemTypes and ExcludeItemTypes are collection item types, e.g. movie or show
+	IncludeItemTypes []string
+	ExcludeItemTypes []string
+	Genres           []string
+	GenreIDs         []string
+	Studios          []string
+	StudioIDs        []string
+	OfficialRatings  []string
+	Years            []int
+	// NameContains matches part of the name, case insensitive
+	NameContains string
+	// NameStartsWith matches the start of the sort name, case insensitive
+	NameStartsWith string
+	// NameLessThan selects items with a sort name ordered before it
+	NameLessThan string
+	// MinCommunityRating excludes items rated lower, 0 means no limit
+	MinCommunityRating float64
+	// MinPremiereDate excludes items released before, zero means no limit
+	MinPremiereDate time.Time
+	// SeriesStatus restricts the result to shows with one of these statuses, e.g. Continuing or Ended
+	SeriesStatus []string
+	// HasSubtitles, HasTrailer, IsHD and Is4K filter on media details, nil does not filter
+	HasSubtitles *bool
+	HasTrailer   *bool
+	IsHD         *bool
+	Is4K         *bool
+	// IsPlayed, IsFavorite and IsResumable filter on play state of the user, nil does not filter
+	IsPlayed    *bool
+	IsFavorite  *bool
+	IsResumable *bool
+	// SearchTerm is searched in the full-text search index
+	SearchTerm string
+	// MaxParentalRating excludes items with a higher parental rating score, nil means no limit
+	MaxParentalRating *int
+	// BlockUnrated excludes items without parental rating
+	BlockUnrated bool
+	// SortBy holds Jellyfin sort fields, e.g. SortName or DateCreated
+	SortBy []string
+	// SortDescending holds the order per SortBy field, the last one applies to remaining fields
+	SortDescending []bool
+	StartIndex     int
+	// Limit is the maximum number of items to return, 0 means no limit
+	Limit int
+}
+
+// catalogSortColumns maps lowercase Jellyfin sort fields to catalog columns.
+var catalogSortColumns = map[string]string{
+	"default":              "c.sortname",
+	"sortname":             "c.sortname",
+	"seriessortname":       "c.sortname",
+	"name":                 "c.sortname",
+	"datecreated":          "c.datecreated",
+	"datelastcontentadded": "c.datecreated",
+	"productionyear":       "c.year",
+	"premieredate":         "c.premieredate",
+	"communityrating":      "c.communityrating",
+	"criticrating":         "c.communityrating",
+	"officialrating":       "c.parentalrating",
+	"dateplayed":           "ps.value",
+	"random":               "random()",
+}
+
+func NewCatalogStorage(d *sqlx.DB, userData *UserDataStorage) *CatalogStorage {
+	c := &CatalogStorage{
+		dbHandle: d,
+		userData: userData,
+	}
+	if err := c.initSearchIndex(); err != nil {
+		log.Printf("WARNING: full-text search not available, build with -tags sqlite_fts5 to enable. "+
+			"Search falls back to slower matching of terms: %s\n", err)
+	} else {
+		c.fts = true
+	}
+	return c
+}
+
+// UpdateCollection replaces all items of a collection in the catalog.
+func (c *CatalogStorage) UpdateCollection(collectionID string, items []CatalogItem) error {
+	if c.dbHandle == nil {
+		return ErrNoDbHandle
+	}
+
+	tx, err := c.dbHandle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"catalog_genre", "catalog_studio", "catalog_episode"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE itemid IN
+			(SELECT id FROM catalog_item WHERE collectionid=?)`, collectionID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM catalog_item WHERE collectionid=?`, collectionID); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		item.CollectionID = collectionID
+		item.DateCreated = item.DateCreated.UTC()
+		item.PremiereDate = item.PremiereDate.UTC()
+		if _, err := tx.NamedExec(`INSERT OR REPLACE INTO catalog_item (id, collectionid, type, name, sortname,
+			year, communityrating, officialrating, parentalrating, datecreated,
+			premieredate, width, hassubtitles, hastrailer, seriesstatus)
+			VALUES (:id, :collectionid, :type, :name, :sortname,
+			:year, :communityrating, :officialrating, :parentalrating, :datecreated,
+			:premieredate, :width, :hassubtitles, :hastrailer, :seriesstatus)`, item); err != nil {
+			return err
+		}
+		for _, episode := range item.Episodes {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO catalog_episode (itemid, episodeid) VALUES (?, ?)`,
+				item.ID, episode.ID); err != nil {
+				return err
+			}
+		}
+		for _, genre := range item.Genres {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO catalog_genre (itemid, genre, genreid) VALUES (?, ?, ?)`,
+				item.ID, genre, idhash.IdHash(genre)); err != nil {
+				return err
+			}
+		}
+		for _, studio := range item.Studios {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO catalog_studio (itemid, studio, studioid) VALUES (?, ?, ?)`,
+				item.ID, studio, idhash.IdHash(studio)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := c.updateSearchIndex(tx, collectionID, items); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.vocabulary = nil
+	c.mu.Unlock()
+	return nil
+}
+
+// QueryItems returns IDs of the requested page of catalog items, and the
+// total number of items matching the query.
+func (c *CatalogStorage) QueryItems(q CatalogQuery) (itemIDs []string, totalCount int, err error) {
+	if c.dbHandle == nil {
+		return nil, 0, ErrNoDbHandle
+	}
+
+	where, args, err := c.filter(q, true)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	from := "catalog_item c"
+	orderBy := c.orderBy(q)
+	if strings.Contains(orderBy, "ps.") {
+		// Join play times of the in-memory play state to sort on
+		playTimes, err := c.userData.playTimes(q.UserID)
+		if err != nil {
+			return nil, 0, err
+		}
+		from += " LEFT JOIN json_each(?) ps ON ps.key=c.id"
+		args = append([]any{playTimes}, args...)
+	}
+	if len(where) != 0 {
+		from += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	if err := c.dbHandle.Get(&totalCount, "SELECT COUNT(*) FROM "+from, args...); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT c.id FROM " + from + " ORDER BY " + orderBy
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	query += " LIMIT ? OFFSET ?"
+	args = append(args, limit, max(q.StartIndex, 0))
+
+	itemIDs = []string{}
+	if err := c.dbHandle.Select(&itemIDs, query, args...); err != nil {
+		return nil, 0, err
+	}
+	return itemIDs, totalCount, nil
+}
+
+// filtersPlayState returns true if the query filters on play state of the user.
+func (q CatalogQuery) filtersPlayState() bool {
+	return q.IsPlayed != nil || q.IsFavorite != nil || q.IsResumable != nil
+}
+
+// filter returns the conditions and arguments selecting catalog items c
+// matching the query, item types are only included if withTypes is true.
+// Play state filters use the in-memory play state, which can be newer than
+// play state in the database.
+func (c *CatalogStorage) filter(q CatalogQuery, withTypes bool) (where []string, args []any, err error) {
+	var played, favorite, resumable string
+	if q.filtersPlayState() {
+		if played, favorite, resumable, err = c.userData.playStateItemIDs(q.UserID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	addIn := func(column string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		where = append(where, column+" IN ("+placeholders(len(values))+")")
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	addExists := func(table, column string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		where = append(where, "EXISTS (SELECT 1 FROM "+table+" x WHERE x.itemid=c.id AND x."+
+			column+" IN ("+placeholders(len(values))+"))")
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+
+	addBool := func(condition string, value *bool, conditionArgs ...any) {
+		if value == nil {
+			return
+		}
+		if !*value {
+			condition = "NOT " + condition
+		}
+		where = append(where, condition)
+		args = append(args, conditionArgs...)
+	}
+
+	addIn("c.collectionid", q.CollectionIDs)
+	addIn("c.id", q.ItemIDs)
+	if len(q.ExcludeItemIDs) != 0 {
+		where = append(where, "c.id NOT IN ("+placeholders(len(q.ExcludeItemIDs))+")")
+		for _, v := range q.ExcludeItemIDs {
+			args = append(args, v)
+		}
+	}
+	if withTypes {
+		addIn("c.type", q.IncludeItemTypes)
+		if len(q.ExcludeItemTypes) != 0 {
+			where = append(where, "c.type NOT IN ("+placeholders(len(q.ExcludeItemTypes))+")")
+			for _, v := range q.ExcludeItemTypes {
+				args = append(args, v)
+			}
+		}
+	}
+	addExists("catalog_genre", "genre", q.Genres)
+	addExists("catalog_genre", "genreid", q.GenreIDs)
+	addExists("catalog_studio", "studio", q.Studios)
+	addExists("catalog_studio", "studioid", q.StudioIDs)
+	addIn("c.officialrating", q.OfficialRatings)
+	if len(q.Years) != 0 {
+		where = append(where, "c.year IN ("+placeholders(len(q.Years))+")")
+		for _, v := range q.Years {
+			args = append(args, v)
+		}
+	}
+	if q.NameContains != "" {
+		where = append(where, `c.name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(q.NameContains)+"%")
+	}
+	if q.NameStartsWith != "" {
+		where = append(where, `c.sortname LIKE ? ESCAPE '\'`)
+		args = append(args, escapeLike(q.NameStartsWith)+"%")
+	}
+	if q.NameLessThan != "" {
+		where = append(where, "c.sortname < ? COLLATE NOCASE")
+		args = append(args, q.NameLessThan)
+	}
+	if q.MinCommunityRating > 0 {
+		where = append(where, "c.communityrating >= ?")
+		args = append(args, q.MinCommunityRating)
+	}
+	if !q.MinPremiereDate.IsZero() {
+		where = append(where, "c.premieredate >= ?")
+		args = append(args, q.MinPremiereDate.UTC())
+	}
+	if len(q.SeriesStatus) != 0 {
+		where = append(where, "c.seriesstatus COLLATE NOCASE IN ("+placeholders(len(q.SeriesStatus))+")")
+		for _, v := range q.SeriesStatus {
+			args = append(args, v)
+		}
+	}
+	addBool("c.hassubtitles", q.HasSubtitles)
+	addBool("c.hastrailer", q.HasTrailer)
+	addBool("c.width >= 1200", q.IsHD)
+	addBool("c.width >= 3800", q.Is4K)
+
+	// A show is played if all its episodes are played
+	addBool(`(CASE WHEN EXISTS (SELECT 1 FROM catalog_episode e WHERE e.itemid=c.id)
+		THEN NOT EXISTS (SELECT 1 FROM catalog_episode e WHERE e.itemid=c.id
+			AND e.episodeid NOT IN (SELECT value FROM json_each(?)))
+		ELSE c.id IN (SELECT value FROM json_each(?)) END)`,
+		q.IsPlayed, played, played)
+	addBool("c.id IN (SELECT value FROM json_each(?))", q.IsFavorite, favorite)
+	addBool("c.id IN (SELECT value FROM json_each(?))", q.IsResumable, resumable)
+
+	if q.BlockUnrated {
+		where = append(where, "c.parentalrating IS NOT NULL")
+	}
+	if q.MaxParentalRating != nil {
+		where = append(where, "(c.parentalrating IS NULL OR c.parentalrating <= ?)")
+		args = append(args, *q.MaxParentalRating)
+	}
+	return
+}
+
+// orderBy returns the ORDER BY clause of a query, items are always ordered
+// by sort name and ID last to keep pagination stable.
+func (c *CatalogStorage) orderBy(q CatalogQuery) string {
+	var order []string
+	for n, field := range q.SortBy {
+		column, ok := catalogSortColumns[strings.ToLower(strings.TrimSpace(field))]
+		if !ok {
+			log.Printf("QueryItems: unknown sort field %s\n", field)
+			continue
+		}
+		descending := false
+		if len(q.SortDescending) != 0 {
+			descending = q.SortDescending[min(n, len(q.SortDescending)-1)]
+		}
+		if descending {
+			column += " DESC"
+		}
+		order = append(order, column)
+	}
+	return strings.Join(append(order, "c.sortname", "c.id"), ", ")
+}
+
+// placeholders returns n comma separated query placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// escapeLike escapes wildcards in a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestQueryItemsPlayState(t *testing.T) {
+	d := newTestDatabase(t)
+
+	items := []CatalogItem{
+		{ID: "alien", Type: "movie", Name: "Alien", SortName: "alien"},
+		{ID: "brazil", Type: "movie", Name: "Brazil", SortName: "brazil"},
+		{ID: "casablanca", Type: "movie", Name: "Casablanca", SortName: "casablanca"},
+		{ID: "dark", Type: "show", Name: "Dark", SortName: "dark",
+			Episodes: []CatalogEpisode{{ID: "dark1", Title: "Secrets"}, {ID: "dark2", Title: "Lies"}}},
+	}
+	if err := d.CatalogRepo.UpdateCollection("1", items); err != nil {
+		t.Fatal(err)
+	}
+
+	// Play state is only kept in memory, it is not written to the database
+	for itemID, state := range map[string]UserData{
+		"alien":  {Played: true, Favorite: true},
+		"brazil": {Position: 600},
+		"dark1":  {Played: true},
+		"dark2":  {Played: true},
+	} {
+		if err := d.UserDataRepo.Update("u1", itemID, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Brazil was played after Alien
+	userData := d.UserDataRepo.(*UserDataStorage)
+	for n, itemID := range []string{"alien", "brazil"} {
+		state := userData.userDataEntries[makeKey("u1", itemID)]
+		state.Timestamp = time.Date(2026, 1, 1, n, 0, 0, 0, time.UTC)
+		userData.userDataEntries[makeKey("u1", itemID)] = state
+	}
+
+	yes, no := true, false
+	tests := []struct {
+		name  string
+		query CatalogQuery
+		want  []string
+	}{
+		{name: "played", query: CatalogQuery{IsPlayed: &yes}, want: []string{"alien", "dark"}},
+		{name: "unplayed", query: CatalogQuery{IsPlayed: &no}, want: []string{"brazil", "casablanca"}},
+		{name: "favorite", query: CatalogQuery{IsFavorite: &yes}, want: []string{"alien"}},
+		{name: "resumable", query: CatalogQuery{IsResumable: &yes}, want: []string{"brazil"}},
+		{name: "other user", query: CatalogQuery{UserID: "u2", IsPlayed: &yes}, want: []string{}},
+		{name: "recently played", query: CatalogQuery{SortBy: []string{"DatePlayed"}, SortDescending: []bool{true}},
+			want: []string{"brazil", "alien", "casablanca", "dark"}},
+	}
+	for _, tt := range tests {
+		if tt.query.UserID == "" {
+			tt.query.UserID = "u1"
+		}
+		itemIDs, totalCount, err := d.CatalogRepo.QueryItems(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if !slices.Equal(itemIDs, tt.want) || totalCount != len(tt.want) {
+			t.Errorf("%s = %v, %d, want %v", tt.name, itemIDs, totalCount, tt.want)
+		}
+	}
+
+	var count int
+	if err := d.dbHandle.Get(&count, "SELECT COUNT(*) FROM playstate"); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("play state queries wrote %d play states to database", count)
+	}
+}
@@ -1,9 +1,11 @@
 package database
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
@@ -12,6 +14,10 @@ import (
 type (
 	Options struct {
 		Filename string
+		// AccessTokenIdleTimeout expires access tokens not used for this duration, 0 means never
+		AccessTokenIdleTimeout time.Duration
+		// AccessTokenMaxAge expires access tokens this long after they were issued, 0 means never
+		AccessTokenMaxAge time.Duration
 	}
 
 	DatabaseRepo struct {
@@ -20,6 +26,10 @@ type (
 		ItemRepo
 		UserDataRepo
 		PlaylistRepo
+		PlaybackHistoryRepo
+		CatalogRepo
+		DisplayPreferencesRepo
+		dbHandle *sqlx.DB
 	}
 
 	// UserRepo defines the interface for user database operations
@@ -28,17 +38,39 @@ type (
 		GetByID(userID string) (user *User, err error)
 		// Validate checks if the user exists and the password is correct.
 		Validate(username, password string) (user *User, err error)
+		// GetAll retrieves all users from the database.
+		GetAll() (users []User, err error)
 		// Insert inserts a new user into the database.
 		Insert(username, password string) (user *User, err error)
+		// Update stores the admin and disabled flags, library access and parental control of a user.
+		Update(user User) error
+		// UpdateConfiguration stores the playback and home screen preferences of a user.
+		UpdateConfiguration(userID string, config UserConfiguration) error
+		// SetPassword changes the password of a user.
+		SetPassword(userID, password string) error
+		// Delete removes a user from the database.
+		Delete(userID string) error
+		// GetGuest returns a user with the most restrictive policy of all users.
+		GetGuest() (*User, error)
 	}
 
 	AccessTokenRepo interface {
 		// Get accesstoken details by tokenid
 		Get(token string) (*AccessToken, error)
-		// Generate generates new access token
-		Generate(userID string) (string, error)
-		// BackgroundJobs syncs changed accesstokens periodically to database
-		BackgroundJobs()
+		// GetAll returns all access tokens, most recently used first.
+		GetAll() ([]AccessToken, error)
+		// Generate generates new access token for a user and device
+		Generate(details AccessToken) (string, error)
+		// Delete revokes an access token
+		Delete(token string) error
+		// DeleteByDevice revokes all access tokens of a user issued to a device
+		DeleteByDevice(userID, deviceID string) error
+		// DeleteByUser revokes all access tokens of a user
+		DeleteByUser(userID string) error
+		// BackgroundJobs syncs changed accesstokens periodically to database, until ctx is cancelled
+		BackgroundJobs(ctx context.Context)
+		// Flush writes changed accesstokens to database
+		Flush() error
 	}
 
 	ItemRepo interface {
@@ -48,14 +80,20 @@ type (
 	UserDataRepo interface {
 		// Get the play state details for an item per user.
 		Get(userID, itemID string) (details UserData, err error)
+		// GetAll returns the play state details of all items of a user, keyed by item ID.
+		GetAll(userID string) (details map[string]UserData, err error)
 		// Get all favorite items of a user.
 		GetFavorites(userID string) (favoriteItemIDs []string, err error)
 		// GetRecentlyWatched returns up to 10 most recently watched items that have not been fully watched.
 		GetRecentlyWatched(userID string, includeFullyWatched bool) (resumeItemIDs []string, err error)
 		// Update stores the play state details for a user and item.
 		Update(userID, itemID string, details UserData) error
-		// BackgroundJobs syncs changed play state to periodically to database.
-		BackgroundJobs()
+		// Restore stores play state details of items of a user as-is, keeping their timestamp.
+		Restore(userID string, details map[string]UserData) error
+		// BackgroundJobs syncs changed play state to periodically to database, until ctx is cancelled.
+		BackgroundJobs(ctx context.Context)
+		// Flush writes changed play state to database.
+		Flush() error
 	}
 
 	// PlaylistRepo defines the interface for database operations
@@ -63,9 +101,55 @@ type (
 		CreatePlaylist(Playlist) (playlistID string, err error)
 		GetPlaylists(userID string) (playlistIDs []string, err error)
 		GetPlaylist(userID, playlistID string) (*Playlist, error)
+		// UpdatePlaylist renames a playlist, and replaces its items in case ItemIDs is not nil.
+		UpdatePlaylist(Playlist) error
+		// DeletePlaylist removes a playlist including its items.
+		DeletePlaylist(playlistID string) error
 		AddItemsToPlaylist(userID, playlistID string, itemIDs []string) error
-		DeleteItemsFromPlaylist(playlistID string, itemIDs []string) error
-		MovePlaylistItem(playlistID string, itemID string, newIndex int) error
+		// DeleteItemsFromPlaylist removes entries from a playlist by entry ID.
+		DeleteItemsFromPlaylist(playlistID string, entryIDs []string) error
+		// MovePlaylistItem moves an entry to a new zero-based position in a playlist.
+		MovePlaylistItem(playlistID string, entryID string, newIndex int) error
+		// UpdatePlaylistSharing sets open access and replaces the list of users a playlist is shared with.
+		UpdatePlaylistSharing(playlistID string, openAccess bool, shares []PlaylistShare) error
+		// SetPlaylistShare shares a playlist with a user, or updates the user's permissions.
+		SetPlaylistShare(playlistID string, share PlaylistShare) error
+		// DeletePlaylistShare stops sharing a playlist with a user.
+		DeletePlaylistShare(playlistID, userID string) error
+	}
+
+	// PlaybackHistoryRepo defines the interface for playback history database operations
+	PlaybackHistoryRepo interface {
+		// RecordPlayback stores a playback start, progress or stop event.
+		RecordPlayback(event PlaybackEvent) error
+		// GetPlayStats returns play count and last played date of an item of a user.
+		GetPlayStats(userID, itemID string) PlayStats
+		// GetHistory returns playback history of a user, or of all users in case userID is empty, most recent first.
+		GetHistory(userID string, since, until time.Time, limit int) ([]PlaybackHistory, error)
+		// GetPlaysPerDay returns the number of playbacks and play duration per user per day.
+		GetPlaysPerDay(since, until time.Time) ([]DailyPlays, error)
+		// GetUserActivity returns the number of playbacks and play duration per user.
+		GetUserActivity(since, until time.Time) ([]UserActivity, error)
+		// GetTopItems returns the number of playbacks and play duration per item, most played first.
+		GetTopItems(since, until time.Time) ([]ItemPlays, error)
+	}
+
+	// CatalogRepo defines the interface for catalog database operations
+	CatalogRepo interface {
+		// UpdateCollection replaces all items of a collection in the catalog.
+		UpdateCollection(collectionID string, items []CatalogItem) error
+		// QueryItems returns IDs of the requested page of catalog items, and the total number of items matching the query.
+		QueryItems(q CatalogQuery) (itemIDs []string, totalCount int, err error)
+		// SearchItems returns the requested page of movies, shows, episodes and people matching the search term, most relevant first.
+		SearchItems(q CatalogQuery) (results []SearchResult, totalCount int, err error)
+	}
+
+	// DisplayPreferencesRepo defines the interface for display preferences database operations
+	DisplayPreferencesRepo interface {
+		// Get returns the display preferences of a user, client and display ID.
+		Get(userID, client, displayID string) (*DisplayPreferences, error)
+		// Update stores display preferences, replacing all existing custom preferences.
+		Update(prefs DisplayPreferences) error
 	}
 )
 
@@ -84,16 +168,39 @@ func New(o *Options) (*DatabaseRepo, error) {
 	if err := dbInitSchema(dbHandle); err != nil {
 		return nil, err
 	}
+	if err := dbMigrateSchema(dbHandle); err != nil {
+		return nil, err
+	}
+	userData := NewUserDataStorage(dbHandle)
+	playbackHistory := NewPlaybackHistoryStorage(dbHandle)
 	d := &DatabaseRepo{
-		UserRepo:        NewUserStorage(dbHandle),
-		AccessTokenRepo: NewAccessTokenStorage(dbHandle),
-		ItemRepo:        NewItemStorage(dbHandle),
-		UserDataRepo:    NewUserDataStorage(dbHandle),
-		PlaylistRepo:    NewPlaylistStorage(dbHandle),
+		UserRepo:               NewUserStorage(dbHandle, userData, playbackHistory),
+		AccessTokenRepo:        NewAccessTokenStorage(dbHandle, o.AccessTokenIdleTimeout, o.AccessTokenMaxAge),
+		ItemRepo:               NewItemStorage(dbHandle),
+		UserDataRepo:           userData,
+		PlaylistRepo:           NewPlaylistStorage(dbHandle),
+		PlaybackHistoryRepo:    playbackHistory,
+		CatalogRepo:            NewCatalogStorage(dbHandle, userData),
+		DisplayPreferencesRepo: NewDisplayPreferencesStorage(dbHandle),
+		dbHandle:               dbHandle,
 	}
 	return d, nil
 }
 
+// Close writes all changed play state and access tokens to database and closes it.
+func (d *DatabaseRepo) Close() error {
+	if d.dbHandle == nil {
+		return ErrNoDbHandle
+	}
+	if err := d.UserDataRepo.Flush(); err != nil {
+		log.Printf("Error writing play state to db: %s\n", err)
+	}
+	if err := d.AccessTokenRepo.Flush(); err != nil {
+		log.Printf("Error writing access tokens to db: %s\n", err)
+	}
+	return d.dbHandle.Close()
+}
+
 func dbInitSchema(d *sqlx.DB) error {
 	tx, err := d.Beginx()
 	if err != nil {
@@ -117,14 +224,42 @@ lastvideo INTEGER NOT NULL);`,
 		`CREATE TABLE IF NOT EXISTS users (
 id TEXT NOT NULL PRIMARY KEY,
 username TEXT NOT NULL,
-password TEXT NOT NULL);`,
+password TEXT NOT NULL,
+admin BOOLEAN NOT NULL DEFAULT 0,
+disabled BOOLEAN NOT NULL DEFAULT 0,
+enableallfolders BOOLEAN NOT NULL DEFAULT 1,
+maxparentalrating INTEGER,
+blockunrateditems BOOLEAN NOT NULL DEFAULT 0);`,
 
 		`CREATE UNIQUE INDEX IF NOT EXISTS users_name_idx ON users (username);`,
 
+		`CREATE TABLE IF NOT EXISTS user_folder (
+userid TEXT NOT NULL,
+folderid TEXT NOT NULL,
+PRIMARY KEY (userid, folderid),
+FOREIGN KEY (userid) REFERENCES users(id)
+);`,
+
+		`CREATE TABLE IF NOT EXISTS user_configuration (
+userid TEXT NOT NULL PRIMARY KEY,
+audiolanguagepreference TEXT NOT NULL DEFAULT '',
+subtitlelanguagepreference TEXT NOT NULL DEFAULT '',
+subtitlemode TEXT NOT NULL DEFAULT 'Default',
+playdefaultaudiotrack BOOLEAN NOT NULL DEFAULT 1,
+orderedviews TEXT NOT NULL DEFAULT '',
+latestitemsexcludes TEXT NOT NULL DEFAULT '',
+FOREIGN KEY (userid) REFERENCES users(id)
+);`,
+
 		`CREATE TABLE IF NOT EXISTS accesstokens (
 userid TEXT NOT NULL,
 token TEXT NOT NULL,
-lastused DATETIME);`,
+created DATETIME,
+lastused DATETIME,
+deviceid TEXT NOT NULL DEFAULT '',
+devicename TEXT NOT NULL DEFAULT '',
+client TEXT NOT NULL DEFAULT '',
+applicationversion TEXT NOT NULL DEFAULT '');`,
 
 		`CREATE UNIQUE INDEX IF NOT EXISTS accesstokens_idx ON accesstokens (userid, token);`,
 
@@ -143,16 +278,131 @@ timestamp DATETIME);`,
 id TEXT NOT NULL PRIMARY KEY,
 name TEXT NOT NULL,
 userid TEXT NOT NULL,
+openaccess BOOLEAN NOT NULL DEFAULT 0,
 timestamp DATETIME);`,
 
+		`CREATE TABLE IF NOT EXISTS playlist_share (
+playlistid TEXT NOT NULL,
+userid TEXT NOT NULL,
+canedit BOOLEAN NOT NULL DEFAULT 0,
+PRIMARY KEY (playlistid, userid),
+FOREIGN KEY (playlistid) REFERENCES playlist(id)
+);`,
+
 		`CREATE TABLE IF NOT EXISTS playlist_item (
+id TEXT NOT NULL PRIMARY KEY,
 playlistid TEXT NOT NULL,
 itemid TEXT NOT NULL,
 itemorder INTEGER NOT NULL,
 timestamp DATETIME,
-PRIMARY KEY (playlistid, itemid),
-FOREIGN KEY (playlistid) REFERENCES playlists(id)
+FOREIGN KEY (playlistid) REFERENCES playlist(id)
 );`,
+
+		`CREATE TABLE IF NOT EXISTS playback_history (
+id TEXT NOT NULL PRIMARY KEY,
+userid TEXT NOT NULL,
+itemid TEXT NOT NULL,
+playsessionid TEXT NOT NULL DEFAULT '',
+deviceid TEXT NOT NULL DEFAULT '',
+devicename TEXT NOT NULL DEFAULT '',
+client TEXT NOT NULL DEFAULT '',
+playmethod TEXT NOT NULL DEFAULT '',
+started DATETIME NOT NULL,
+stopped DATETIME,
+lastupdate DATETIME NOT NULL,
+startposition INTEGER NOT NULL DEFAULT 0,
+position INTEGER NOT NULL DEFAULT 0,
+playduration INTEGER NOT NULL DEFAULT 0,
+paused BOOLEAN NOT NULL DEFAULT 0,
+completed BOOLEAN NOT NULL DEFAULT 0);`,
+
+		`CREATE INDEX IF NOT EXISTS playback_history_user_idx ON playback_history (userid, itemid);`,
+
+		`CREATE INDEX IF NOT EXISTS playback_history_started_idx ON playback_history (started);`,
+
+		`CREATE TABLE IF NOT EXISTS catalog_item (
+id TEXT NOT NULL PRIMARY KEY,
+collectionid TEXT NOT NULL,
+type TEXT NOT NULL,
+name TEXT NOT NULL,
+sortname TEXT NOT NULL,
+year INTEGER NOT NULL DEFAULT 0,
+communityrating REAL NOT NULL DEFAULT 0,
+officialrating TEXT NOT NULL DEFAULT '',
+parentalrating INTEGER,
+datecreated DATETIME,
+premieredate DATETIME,
+width INTEGER NOT NULL DEFAULT 0,
+hassubtitles BOOLEAN NOT NULL DEFAULT 0,
+hastrailer BOOLEAN NOT NULL DEFAULT 0,
+seriesstatus TEXT NOT NULL DEFAULT '');`,
+
+		`CREATE INDEX IF NOT EXISTS catalog_item_collection_idx ON catalog_item (collectionid, type);`,
+
+		`CREATE INDEX IF NOT EXISTS catalog_item_sortname_idx ON catalog_item (sortname);`,
+
+		`CREATE INDEX IF NOT EXISTS catalog_item_datecreated_idx ON catalog_item (datecreated);`,
+
+		`CREATE TABLE IF NOT EXISTS catalog_genre (
+itemid TEXT NOT NULL,
+genre TEXT NOT NULL,
+genreid TEXT NOT NULL,
+PRIMARY KEY (itemid, genre));`,
+
+		`CREATE INDEX IF NOT EXISTS catalog_genre_idx ON catalog_genre (genre);`,
+
+		`CREATE TABLE IF NOT EXISTS catalog_studio (
+itemid TEXT NOT NULL,
+studio TEXT NOT NULL,
+studioid TEXT NOT NULL,
+PRIMARY KEY (itemid, studio));`,
+
+		`CREATE INDEX IF NOT EXISTS catalog_studio_idx ON catalog_studio (studio);`,
+
+		`CREATE TABLE IF NOT EXISTS catalog_episode (
+itemid TEXT NOT NULL,
+episodeid TEXT NOT NULL,
+PRIMARY KEY (itemid, episodeid));`,
+
+		`CREATE TABLE IF NOT EXISTS search_document (
+itemid TEXT NOT NULL,
+type TEXT NOT NULL,
+catalogid TEXT NOT NULL,
+collectionid TEXT NOT NULL,
+name TEXT NOT NULL,
+title TEXT NOT NULL,
+originaltitle TEXT NOT NULL,
+people TEXT NOT NULL,
+plot TEXT NOT NULL,
+keywords TEXT NOT NULL);`,
+
+		`CREATE INDEX IF NOT EXISTS search_document_collectionid_idx ON search_document (collectionid);`,
+
+		`CREATE TABLE IF NOT EXISTS display_preferences (
+userid TEXT NOT NULL,
+client TEXT NOT NULL,
+displayid TEXT NOT NULL,
+viewtype TEXT NOT NULL DEFAULT '',
+sortby TEXT NOT NULL DEFAULT '',
+indexby TEXT NOT NULL DEFAULT '',
+sortorder TEXT NOT NULL DEFAULT '',
+scrolldirection TEXT NOT NULL DEFAULT '',
+rememberindexing BOOLEAN NOT NULL DEFAULT 0,
+remembersorting BOOLEAN NOT NULL DEFAULT 0,
+showbackdrop BOOLEAN NOT NULL DEFAULT 0,
+showsidebar BOOLEAN NOT NULL DEFAULT 0,
+primaryimageheight INTEGER NOT NULL DEFAULT 0,
+primaryimagewidth INTEGER NOT NULL DEFAULT 0,
+timestamp DATETIME,
+PRIMARY KEY (userid, client, displayid));`,
+
+		`CREATE TABLE IF NOT EXISTS display_preferences_custom (
+userid TEXT NOT NULL,
+client TEXT NOT NULL,
+displayid TEXT NOT NULL,
+key TEXT NOT NULL,
+value TEXT NOT NULL,
+PRIMARY KEY (userid, client, displayid, key));`,
 	}
 
 	for _, query := range schema {
@@ -164,3 +414,159 @@ FOREIGN KEY (playlistid) REFERENCES playlists(id)
 
 	return tx.Commit()
 }
+
+// dbMigrateSchema upgrades tables created by older versions to the current schema.
+func dbMigrateSchema(d *sqlx.DB) error {
+	tx, err := d.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// playlist_item entries got their own id so an item can be added more than once
+	hasEntryID, err := dbHasColumn(tx, "playlist_item", "id")
+	if err != nil {
+		return err
+	}
+	if !hasEntryID {
+		log.Printf("dbMigrateSchema: adding entry id to playlist_item\n")
+		migration := []string{
+			`ALTER TABLE playlist_item RENAME TO playlist_item_old;`,
+			`CREATE TABLE playlist_item (
+id TEXT NOT NULL PRIMARY KEY,
+playlistid TEXT NOT NULL,
+itemid TEXT NOT NULL,
+itemorder INTEGER NOT NULL,
+timestamp DATETIME,
+FOREIGN KEY (playlistid) REFERENCES playlist(id)
+);`,
+			`INSERT INTO playlist_item (id, playlistid, itemid, itemorder, timestamp)
+SELECT lower(hex(randomblob(10))), playlistid, itemid, itemorder, timestamp FROM playlist_item_old;`,
+			`DROP TABLE playlist_item_old;`,
+		}
+		for _, query := range migration {
+			if _, err = tx.Exec(query); err != nil {
+				return err
+			}
+		}
+	}
+
+	// users got an admin flag, only the oldest user becomes administrator as other
+	// users, e.g. profiles of kids, must not be able to change their own policy
+	hasAdmin, err := dbHasColumn(tx, "users", "admin")
+	if err != nil {
+		return err
+	}
+	if !hasAdmin {
+		log.Printf("dbMigrateSchema: adding admin and disabled to users\n")
+		migration := []string{
+			`ALTER TABLE users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT 0;`,
+			`ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT 0;`,
+			`UPDATE users SET admin = 1 WHERE rowid = (SELECT MIN(rowid) FROM users);`,
+		}
+		for _, query := range migration {
+			if _, err = tx.Exec(query); err != nil {
+				return err
+			}
+		}
+	}
+
+	// users can be restricted to a set of collections
+	hasEnableAllFolders, err := dbHasColumn(tx, "users", "enableallfolders")
+	if err != nil {
+		return err
+	}
+	if !hasEnableAllFolders {
+		log.Printf("dbMigrateSchema: adding enableallfolders to users\n")
+		if _, err = tx.Exec(`ALTER TABLE users ADD COLUMN enableallfolders BOOLEAN NOT NULL DEFAULT 1;`); err != nil {
+			return err
+		}
+	}
+
+	// users can be restricted to items up to a parental rating
+	hasMaxParentalRating, err := dbHasColumn(tx, "users", "maxparentalrating")
+	if err != nil {
+		return err
+	}
+	if !hasMaxParentalRating {
+		log.Printf("dbMigrateSchema: adding parental rating to users\n")
+		migration := []string{
+			`ALTER TABLE users ADD COLUMN maxparentalrating INTEGER;`,
+			`ALTER TABLE users ADD COLUMN blockunrateditems BOOLEAN NOT NULL DEFAULT 0;`,
+		}
+		for _, query := range migration {
+			if _, err = tx.Exec(query); err != nil {
+				return err
+			}
+		}
+	}
+
+	// access tokens keep track of issue time and device they were issued to
+	hasCreated, err := dbHasColumn(tx, "accesstokens", "created")
+	if err != nil {
+		return err
+	}
+	if !hasCreated {
+		log.Printf("dbMigrateSchema: adding device details to accesstokens\n")
+		migration := []string{
+			`ALTER TABLE accesstokens ADD COLUMN created DATETIME;`,
+			`UPDATE accesstokens SET created = lastused;`,
+			`ALTER TABLE accesstokens ADD COLUMN deviceid TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE accesstokens ADD COLUMN devicename TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE accesstokens ADD COLUMN client TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE accesstokens ADD COLUMN applicationversion TEXT NOT NULL DEFAULT '';`,
+		}
+		for _, query := range migration {
+			if _, err = tx.Exec(query); err != nil {
+				return err
+			}
+		}
+	}
+
+	// playlists can be made accessible to all users
+	hasOpenAccess, err := dbHasColumn(tx, "playlist", "openaccess")
+	if err != nil {
+		return err
+	}
+	if !hasOpenAccess {
+		log.Printf("dbMigrateSchema: adding openaccess to playlist\n")
+		if _, err = tx.Exec(`ALTER TABLE playlist ADD COLUMN openaccess BOOLEAN NOT NULL DEFAULT 0;`); err != nil {
+			return err
+		}
+	}
+
+	// catalog items got media details to filter on, filled in by the next scan
+	hasPremiereDate, err := dbHasColumn(tx, "catalog_item", "premieredate")
+	if err != nil {
+		return err
+	}
+	if !hasPremiereDate {
+		log.Printf("dbMigrateSchema: adding media details to catalog_item\n")
+		migration := []string{
+			`ALTER TABLE catalog_item ADD COLUMN premieredate DATETIME;`,
+			`ALTER TABLE catalog_item ADD COLUMN width INTEGER NOT NULL DEFAULT 0;`,
+			`ALTER TABLE catalog_item ADD COLUMN hassubtitles BOOLEAN NOT NULL DEFAULT 0;`,
+			`ALTER TABLE catalog_item ADD COLUMN hastrailer BOOLEAN NOT NULL DEFAULT 0;`,
+			`ALTER TABLE catalog_item ADD COLUMN seriesstatus TEXT NOT NULL DEFAULT '';`,
+		}
+		for _, query := range migration {
+			if _, err = tx.Exec(query); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err = tx.Exec(`CREATE INDEX IF NOT EXISTS playlist_item_idx ON playlist_item (playlistid, itemorder);`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// dbHasColumn returns true if a table has a column with the given name.
+func dbHasColumn(tx *sqlx.Tx, table, column string) (bool, error) {
+	var count int
+	if err := tx.Get(&count, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name=?`, table, column); err != nil {
+		return false, err
+	}
+	return count != 0, nil
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Display preferences are stored per user, client and display ID. Clients use
+// the display ID to store settings of a view, e.g. sort order of a library, or
+// "usersettings" for generic settings such as home screen sections.
+
+type DisplayPreferencesStorage struct {
+	dbHandle *sqlx.DB
+}
+
+func NewDisplayPreferencesStorage(d *sqlx.DB) *DisplayPreferencesStorage {
+	return &DisplayPreferencesStorage{
+		dbHandle: d,
+	}
+}
+
+// DisplayPreferences holds the settings of a view of a client.
+type DisplayPreferences struct {
+	UserID             string
+	Client             string
+	DisplayID          string
+	ViewType           string
+	SortBy             string
+	IndexBy            string
+	SortOrder          string
+	ScrollDirection    string
+	RememberIndexing   bool
+	RememberSorting    bool
+	ShowBackdrop       bool
+	ShowSidebar        bool
+	PrimaryImageHeight int
+	PrimaryImageWidth  int
+	// CustomPrefs holds client specific settings
+	CustomPrefs map[string]string `db:"-"`
+	Timestamp   time.Time
+}
+
+var (
+	ErrDisplayPreferencesNotFound = errors.New("display preferences not found")
+)
+
+// Get returns the display preferences of a user, client and display ID.
+func (d *DisplayPreferencesStorage) Get(userID, client, displayID string) (*DisplayPreferences, error) {
+	if d.dbHandle == nil {
+		return nil, ErrNoDbHandle
+	}
+
+	var prefs DisplayPreferences
+	err := d.dbHandle.Get(&prefs, `SELECT * FROM display_preferences
+		WHERE userid=? AND client=? AND displayid=?`, userID, client, displayID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDisplayPreferencesNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var custom []struct {
+		Key   string
+		Value string
+	}
+	if err := d.dbHandle.Select(&custom, `SELECT key, value FROM display_preferences_custom
+		WHERE userid=? AND client=? AND displayid=?`, userID, client, displayID); err != nil {
+		return nil, err
+	}
+	prefs.CustomPrefs = make(map[string]string, len(custom))
+	for _, c := range custom {
+		prefs.CustomPrefs[c.Key] = c.Value
+	}
+	return &prefs, nil
+}
+
+// Update stores display preferences, replacing all existing custom preferences.
+func (d *DisplayPreferencesStorage) Update(prefs DisplayPreferences) error {
+	if d.dbHandle == nil {
+		return ErrNoDbHandle
+	}
+
+	tx, err := d.dbHandle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	prefs.Timestamp = time.Now().UTC()
+	if _, err := tx.NamedExec(`INSERT OR REPLACE INTO display_preferences (userid, client, displayid,
+		viewtype, sortby, indexby, sortorder, scrolldirection, rememberindexing, remembersorting,
+		showbackdrop, showsidebar, primaryimageheight, primaryimagewidth, timestamp)
+		VALUES (:userid, :client, :displayid,
+		:viewtype, :sortby, :indexby, :sortorder, :scrolldirection, :rememberindexing, :remembersorting,
+		:showbackdrop, :showsidebar, :primaryimageheight, :primaryimagewidth, :timestamp)`, prefs); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM display_preferences_custom WHERE userid=? AND client=? AND displayid=?`,
+		prefs.UserID, prefs.Client, prefs.DisplayID); err != nil {
+		return err
+	}
+	for key, value := range prefs.CustomPrefs {
+		if _, err := tx.Exec(`INSERT INTO display_preferences_custom (userid, client, displayid, key, value)
+			VALUES (?, ?, ?, ?, ?)`, prefs.UserID, prefs.Client, prefs.DisplayID, key, value); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// StateVersion is the version of the state export format.
+const StateVersion = 1
+
+// State holds all user state of the server: users, play state, favorites,
+// playlists and access tokens. Items are referred to by ItemRef so state can
+// be imported into a rebuilt library in which item IDs have changed.
+type State struct {
+	Version      int
+	Exported     time.Time
+	Users        []User
+	UserData     []UserDataState
+	Playlists    []PlaylistState
+	AccessTokens []AccessToken
+}
+
+// ItemRef refers to a movie, show, season or episode. ID is the item ID at
+// time of export, the other fields identify the item in case its ID changed.
+type ItemRef struct {
+	ID        string
+	Type      string `json:",omitempty"`
+	Name      string `json:",omitempty"`
+	SeasonNo  int
+	EpisodeNo int
+}
+
+// UserDataState is the play state of an item for a user.
+type UserDataState struct {
+	UserID string
+	Item   ItemRef
+	UserData
+}
+
+// PlaylistState is a playlist with its items in playlist order.
+type PlaylistState struct {
+	ID         string
+	UserID     string
+	Name       string
+	OpenAccess bool
+	Shares     []PlaylistShare
+	Items      []ItemRef
+}
+
+var (
+	ErrStateVersion = errors.New("unsupported state version")
+)
+
+// Export returns all user state stored in the database. Item references
+// only have their ID set.
+func (d *DatabaseRepo) Export() (*State, error) {
+	if d.dbHandle == nil {
+		return nil, ErrNoDbHandle
+	}
+	state := &State{
+		Version:      StateVersion,
+		Exported:     time.Now().UTC(),
+		Users:        []User{},
+		UserData:     []UserDataState{},
+		Playlists:    []PlaylistState{},
+		AccessTokens: []AccessToken{},
+	}
+
+	// Users including their password hash
+	if err := d.dbHandle.Select(&state.Users, "SELECT * FROM users ORDER BY username"); err != nil {
+		return nil, err
+	}
+	for i := range state.Users {
+		state.Users[i].EnabledFolders = []string{}
+		if err := d.dbHandle.Select(&state.Users[i].EnabledFolders,
+			"SELECT folderid FROM user_folder WHERE userid=? ORDER BY folderid", state.Users[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	var userData []struct {
+		UserID           string    `db:"userid"`
+		ItemID           string    `db:"itemid"`
+		Position         int       `db:"position"`
+		PlayedPercentage int       `db:"playedpercentage"`
+		Played           bool      `db:"played"`
+		Favorite         bool      `db:"favorite"`
+		Timestamp        time.Time `db:"timestamp"`
+	}
+	if err := d.dbHandle.Select(&userData, "SELECT * FROM playstate ORDER BY userid, itemid"); err != nil {
+		return nil, err
+	}
+	for _, u := range userData {
+		state.UserData = append(state.UserData, UserDataState{
+			UserID: u.UserID,
+			Item:   ItemRef{ID: u.ItemID},
+			UserData: UserData{
+				Position:         u.Position,
+				PlayedPercentage: u.PlayedPercentage,
+				Played:           u.Played,
+				Favorite:         u.Favorite,
+				Timestamp:        u.Timestamp,
+			},
+		})
+	}
+
+	if err := d.dbHandle.Select(&state.Playlists,
+		"SELECT id, userid, name, openaccess FROM playlist ORDER BY userid, name"); err != nil {
+		return nil, err
+	}
+	for i := range state.Playlists {
+		p := &state.Playlists[i]
+		p.Shares = []PlaylistShare{}
+		if err := d.dbHandle.Select(&p.Shares,
+			"SELECT userid, canedit FROM playlist_share WHERE playlistid=? ORDER BY userid", p.ID); err != nil {
+			return nil, err
+		}
+		var itemIDs []string
+		if err := d.dbHandle.Select(&itemIDs,
+			"SELECT itemid FROM playlist_item WHERE playlistid=? ORDER BY itemorder, timestamp", p.ID); err != nil {
+			return nil, err
+		}
+		p.Items = []ItemRef{}
+		for _, itemID := range itemIDs {
+			p.Items = append(p.Items, ItemRef{ID: itemID})
+		}
+	}
+
+	if err := d.dbHandle.Select(&state.AccessTokens, "SELECT * FROM accesstokens ORDER BY userid, created"); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Import stores user state in the database, existing users, play state,
+// playlists and access tokens with the same ID are replaced. Item references
+// should have been resolved to item IDs of the current library.
+// Import should not be used while the server is running as the server keeps
+// play state and access tokens in memory.
+func (d *DatabaseRepo) Import(state *State) error {
+	if d.dbHandle == nil {
+		return ErrNoDbHandle
+	}
+	if state.Version != StateVersion {
+		return fmt.Errorf("%w: %d", ErrStateVersion, state.Version)
+	}
+
+	tx, err := d.dbHandle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, u := range state.Users {
+		if err := importUser(tx, u); err != nil {
+			return fmt.Errorf("user %s: %w", u.Username, err)
+		}
+	}
+	for _, u := range state.UserData {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO playstate (userid, itemid, position, playedpercentage, played, favorite, timestamp)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			u.UserID, u.Item.ID, u.Position, u.PlayedPercentage, u.Played, u.Favorite, u.Timestamp.UTC())
+		if err != nil {
+			return fmt.Errorf("play state %s: %w", u.Item.ID, err)
+		}
+	}
+	for _, p := range state.Playlists {
+		if err := importPlaylist(tx, p); err != nil {
+			return fmt.Errorf("playlist %s: %w", p.Name, err)
+		}
+	}
+	for _, t := range state.AccessTokens {
+		_, err = tx.NamedExec(`INSERT OR REPLACE INTO accesstokens (userid, token, created, lastused,
+			deviceid, devicename, client, applicationversion)
+			VALUES (:userid, :token, :created, :lastused,
+			:deviceid, :devicename, :client, :applicationversion)`, t)
+		if err != nil {
+			return fmt.Errorf("access token of user %s: %w", t.UserID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// importUser stores a user including password hash and library access.
+func importUser(tx *sqlx.Tx, u User) error {
+	_, err := tx.NamedExec(`INSERT OR REPLACE INTO users (id, username, password, admin, disabled,
+		enableallfolders, maxparentalrating, blockunrateditems)
+		VALUES (:id, :username, :password, :admin, :disabled,
+		:enableallfolders, :maxparentalrating, :blockunrateditems)`, u)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_folder WHERE userid=?", u.ID); err != nil {
+		return err
+	}
+	for _, folderID := range u.EnabledFolders {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO user_folder (userid, folderid) VALUES (?, ?)", u.ID, folderID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importPlaylist replaces a playlist including its shares and items.
+func importPlaylist(tx *sqlx.Tx, p PlaylistState) error {
+	for _, query := range []string{
+		"DELETE FROM playlist_item WHERE playlistid=?",
+		"DELETE FROM playlist_share WHERE playlistid=?",
+		"DELETE FROM playlist WHERE id=?",
+	} {
+		if _, err := tx.Exec(query, p.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO playlist (id, name, userid, openaccess, timestamp)
+		VALUES (?, ?, ?, ?, ?)`, p.ID, p.Name, p.UserID, p.OpenAccess, time.Now().UTC()); err != nil {
+		return err
+	}
+	if err := insertPlaylistShares(tx, p.ID, p.Shares); err != nil {
+		return err
+	}
+	itemIDs := make([]string, 0, len(p.Items))
+	for _, item := range p.Items {
+		itemIDs = append(itemIDs, item.ID)
+	}
+	return insertPlaylistItems(tx, p.ID, itemIDs, 1)
+}
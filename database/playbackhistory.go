@@ -0,0 +1,325 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Playback history is an append-only log of all playbacks. Each playback of
+// an item on a device is a row which is updated by progress reports until the
+// playback is stopped. Play count and last played date of items are derived
+// from the history and kept in memory.
+
+type PlaybackHistoryStorage struct {
+	dbHandle *sqlx.DB
+	mu       sync.Mutex
+	// stats holds play count and last played date per user and item
+	stats map[UserDataKey]PlayStats
+}
+
+// PlaybackHistory is a playback of an item by a user.
+type PlaybackHistory struct {
+	ID     string
+	UserID string
+	ItemID string
+	// PlaySessionID as provided by the client
+	PlaySessionID string
+	DeviceID      string
+	DeviceName    string
+	Client        string
+	// PlayMethod, e.g. DirectPlay
+	PlayMethod string
+	Started    time.Time
+	// Stopped is nil while the item is playing
+	Stopped *time.Time
+	// LastUpdate is the time of the last report of the client
+	LastUpdate time.Time
+	// StartPosition and Position in seconds
+	StartPosition int
+	Position      int
+	// PlayDuration is number of seconds played, excluding pauses
+	PlayDuration int
+	Paused       bool
+	// Completed indicates the item was played until the end
+	Completed bool
+}
+
+// Playback event types
+const (
+	PlaybackStart    = "start"
+	PlaybackProgress = "progress"
+	PlaybackStop     = "stop"
+)
+
+// PlaybackEvent is a playback start, progress or stop report of a client.
+type PlaybackEvent struct {
+	// Type is one of PlaybackStart, PlaybackProgress or PlaybackStop
+	Type          string
+	UserID        string
+	ItemID        string
+	PlaySessionID string
+	DeviceID      string
+	DeviceName    string
+	Client        string
+	PlayMethod    string
+	// Position in seconds
+	Position int
+	Paused   bool
+	// Completed indicates the item has been played until the end
+	Completed bool
+}
+
+// PlayStats holds play count and last played date of an item.
+type PlayStats struct {
+	PlayCount  int
+	LastPlayed time.Time
+}
+
+// DailyPlays is the number of playbacks and play duration of a user on a day.
+type DailyPlays struct {
+	UserID string `db:"userid"`
+	// Date in YYYY-MM-DD format
+	Date         string `db:"date"`
+	Count        int    `db:"count"`
+	PlayDuration int    `db:"playduration"`
+}
+
+// UserActivity is the number of playbacks and play duration of a user,
+// including details of the most recent playback.
+type UserActivity struct {
+	UserID       string
+	Count        int
+	PlayDuration int
+	LastPlayback PlaybackHistory
+}
+
+// ItemPlays is the number of playbacks and play duration of an item.
+type ItemPlays struct {
+	ItemID       string `db:"itemid"`
+	Count        int    `db:"count"`
+	PlayDuration int    `db:"playduration"`
+}
+
+// maxProgressInterval is the maximum time between progress reports that is counted as play duration.
+const maxProgressInterval = 5 * time.Minute
+
+var (
+	ErrPlaybackHistoryUnknownEvent = errors.New("unknown playback event")
+)
+
+func NewPlaybackHistoryStorage(d *sqlx.DB) *PlaybackHistoryStorage {
+	p := &PlaybackHistoryStorage{
+		dbHandle: d,
+		stats:    make(map[UserDataKey]PlayStats),
+	}
+	if err := p.loadStatsFromDB(); err != nil {
+		log.Printf("Error loading playback history from db: %s\n", err)
+	}
+	return p
+}
+
+// evictUser removes play stats of a user from memory, caller must hold the lock.
+func (p *PlaybackHistoryStorage) evictUser(userID string) {
+	for key := range p.stats {
+		if key.userID == userID {
+			delete(p.stats, key)
+		}
+	}
+}
+
+// RecordPlayback stores a playback event. A start event starts a new entry
+// in the playback history, progress and stop events update the entry of the
+// item playing on the device.
+func (p *PlaybackHistoryStorage) RecordPlayback(event PlaybackEvent) error {
+	if p.dbHandle == nil {
+		return ErrNoDbHandle
+	}
+	if event.Type != PlaybackStart && event.Type != PlaybackProgress && event.Type != PlaybackStop {
+		return ErrPlaybackHistoryUnknownEvent
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tx, err := p.dbHandle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if event.Type == PlaybackStart {
+		// A device plays one item at a time, close entries of earlier playbacks
+		if _, err := tx.Exec(`UPDATE playback_history SET stopped=lastupdate
+			WHERE userid=? AND deviceid=? AND stopped IS NULL`, event.UserID, event.DeviceID); err != nil {
+			return err
+		}
+	}
+
+	var entry PlaybackHistory
+	err = tx.Get(&entry, `SELECT * FROM playback_history
+		WHERE userid=? AND deviceid=? AND itemid=? AND stopped IS NULL
+		ORDER BY started DESC LIMIT 1`, event.UserID, event.DeviceID, event.ItemID)
+	switch {
+	case err == sql.ErrNoRows:
+		// New playback, or a progress report of a playback we did not see start
+		entry = PlaybackHistory{
+			ID:            rand.Text(),
+			UserID:        event.UserID,
+			ItemID:        event.ItemID,
+			PlaySessionID: event.PlaySessionID,
+			DeviceID:      event.DeviceID,
+			DeviceName:    event.DeviceName,
+			Client:        event.Client,
+			PlayMethod:    event.PlayMethod,
+			Started:       now,
+			LastUpdate:    now,
+			StartPosition: event.Position,
+		}
+		if _, err := tx.NamedExec(`INSERT INTO playback_history (id, userid, itemid, playsessionid,
+			deviceid, devicename, client, playmethod, started, lastupdate, startposition, position)
+			VALUES (:id, :userid, :itemid, :playsessionid,
+			:deviceid, :devicename, :client, :playmethod, :started, :lastupdate, :startposition, :startposition)`, entry); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+
+	// Count time since previous report as played, unless playback was paused
+	if !entry.Paused {
+		entry.PlayDuration += int(min(now.Sub(entry.LastUpdate), maxProgressInterval).Seconds())
+	}
+	completedNow := event.Completed && !entry.Completed
+	entry.Completed = entry.Completed || event.Completed
+	entry.Position = event.Position
+	entry.Paused = event.Paused
+	entry.LastUpdate = now
+	if event.PlayMethod != "" {
+		entry.PlayMethod = event.PlayMethod
+	}
+	if event.Type == PlaybackStop {
+		entry.Stopped = &now
+	}
+	if _, err := tx.NamedExec(`UPDATE playback_history SET playmethod=:playmethod, stopped=:stopped,
+		lastupdate=:lastupdate, position=:position, playduration=:playduration, paused=:paused,
+		completed=:completed WHERE id=:id`, entry); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	key := makeKey(event.UserID, event.ItemID)
+	stats := p.stats[key]
+	if completedNow {
+		stats.PlayCount++
+	}
+	stats.LastPlayed = now
+	p.stats[key] = stats
+	return nil
+}
+
+// GetPlayStats returns play count and last played date of an item of a user.
+func (p *PlaybackHistoryStorage) GetPlayStats(userID, itemID string) PlayStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.stats[makeKey(userID, itemID)]
+}
+
+// GetHistory returns playback history of a user, most recent first. In case
+// userID is empty history of all users is returned.
+func (p *PlaybackHistoryStorage) GetHistory(userID string, since, until time.Time, limit int) ([]PlaybackHistory, error) {
+	history := []PlaybackHistory{}
+	err := p.dbHandle.Select(&history, `SELECT * FROM playback_history
+		WHERE (?='' OR userid=?) AND started >= ? AND started < ?
+		ORDER BY started DESC LIMIT ?`, userID, userID, since.UTC(), until.UTC(), limit)
+	return history, err
+}
+
+// GetPlaysPerDay returns the number of playbacks and play duration per user per day.
+func (p *PlaybackHistoryStorage) GetPlaysPerDay(since, until time.Time) ([]DailyPlays, error) {
+	plays := []DailyPlays{}
+	err := p.dbHandle.Select(&plays, `SELECT userid, substr(started, 1, 10) AS date,
+		COUNT(*) AS count, SUM(playduration) AS playduration
+		FROM playback_history WHERE started >= ? AND started < ?
+		GROUP BY userid, date ORDER BY date, userid`, since.UTC(), until.UTC())
+	return plays, err
+}
+
+// GetUserActivity returns the number of playbacks and play duration per user.
+func (p *PlaybackHistoryStorage) GetUserActivity(since, until time.Time) ([]UserActivity, error) {
+	// Columns not aggregated are taken from the row with the most recent lastupdate
+	var rows []struct {
+		PlaybackHistory
+		LastUpdateMax string `db:"lastupdatemax"`
+		Count         int    `db:"playcount"`
+		PlayDuration  int    `db:"totalplayduration"`
+	}
+	if err := p.dbHandle.Select(&rows, `SELECT *, MAX(lastupdate) AS lastupdatemax,
+		COUNT(*) AS playcount, SUM(playduration) AS totalplayduration
+		FROM playback_history WHERE started >= ? AND started < ?
+		GROUP BY userid ORDER BY playcount DESC`, since.UTC(), until.UTC()); err != nil {
+		return nil, err
+	}
+
+	activity := make([]UserActivity, 0, len(rows))
+	for _, row := range rows {
+		activity = append(activity, UserActivity{
+			UserID:       row.UserID,
+			Count:        row.Count,
+			PlayDuration: row.PlayDuration,
+			LastPlayback: row.PlaybackHistory,
+		})
+	}
+	return activity, nil
+}
+
+// GetTopItems returns the number of playbacks and play duration per item, most played first.
+func (p *PlaybackHistoryStorage) GetTopItems(since, until time.Time) ([]ItemPlays, error) {
+	plays := []ItemPlays{}
+	err := p.dbHandle.Select(&plays, `SELECT itemid, COUNT(*) AS count, SUM(playduration) AS playduration
+		FROM playback_history WHERE started >= ? AND started < ?
+		GROUP BY itemid ORDER BY count DESC, playduration DESC`, since.UTC(), until.UTC())
+	return plays, err
+}
+
+// loadStatsFromDB derives play count and last played date of items from the playback history.
+func (p *PlaybackHistoryStorage) loadStatsFromDB() error {
+	if p.dbHandle == nil {
+		return ErrNoDbHandle
+	}
+
+	var history []struct {
+		UserID     string    `db:"userid"`
+		ItemID     string    `db:"itemid"`
+		LastUpdate time.Time `db:"lastupdate"`
+		Completed  bool      `db:"completed"`
+	}
+	if err := p.dbHandle.Select(&history, "SELECT userid, itemid, lastupdate, completed FROM playback_history"); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, h := range history {
+		key := makeKey(h.UserID, h.ItemID)
+		stats := p.stats[key]
+		if h.Completed {
+			stats.PlayCount++
+		}
+		if h.LastUpdate.After(stats.LastPlayed) {
+			stats.LastPlayed = h.LastUpdate
+		}
+		p.stats[key] = stats
+	}
+	return nil
+}
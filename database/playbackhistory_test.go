@@ -0,0 +1,44 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetUserActivity(t *testing.T) {
+	d := newTestDatabase(t)
+
+	play := func(userID, itemID, deviceID string) {
+		t.Helper()
+		for _, eventType := range []string{PlaybackStart, PlaybackStop} {
+			event := PlaybackEvent{Type: eventType, UserID: userID, ItemID: itemID, DeviceID: deviceID, Completed: true}
+			if err := d.PlaybackHistoryRepo.RecordPlayback(event); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	play("u1", "a", "d1")
+	play("u2", "b", "d2")
+	play("u1", "c", "d1")
+	play("u1", "d", "d3")
+
+	since := time.Now().Add(-time.Hour)
+	activity, err := d.PlaybackHistoryRepo.GetUserActivity(since, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activity) != 2 {
+		t.Fatalf("activity of %d users, want 2", len(activity))
+	}
+	// Most active user first, with details of its most recent playback
+	if a := activity[0]; a.UserID != "u1" || a.Count != 3 || a.LastPlayback.ItemID != "d" || a.LastPlayback.DeviceID != "d3" {
+		t.Errorf("activity[0] = %+v, want u1 with 3 plays, last item d on d3", a)
+	}
+	if a := activity[1]; a.UserID != "u2" || a.Count != 1 || a.LastPlayback.ItemID != "b" {
+		t.Errorf("activity[1] = %+v, want u2 with 1 play, last item b", a)
+	}
+
+	if activity, err := d.PlaybackHistoryRepo.GetUserActivity(since.Add(-time.Hour), since); err != nil || len(activity) != 0 {
+		t.Errorf("activity before playbacks = %+v, %v, want none", activity, err)
+	}
+}
@@ -1,6 +1,9 @@
 package database
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"log"
 	"time"
 
@@ -20,10 +23,48 @@ func NewPlaylistStorage(d *sqlx.DB) *PlaylistStorage {
 }
 
 type Playlist struct {
-	ID      string
-	UserID  string
-	Name    string
+	ID string
+	// UserID of the owner of the playlist
+	UserID string
+	Name   string
+	// OpenAccess playlists can be viewed by every user
+	OpenAccess bool
+	// Shares lists the users the playlist is shared with
+	Shares []PlaylistShare
+	// ItemIDs of the playlist, in playlist order
 	ItemIDs []string
+	// Entries of the playlist, in playlist order
+	Entries []PlaylistEntry
+}
+
+// PlaylistEntry is an item in a playlist. An item can be present more than once
+// in a playlist, each entry has its own unique ID.
+type PlaylistEntry struct {
+	ID     string
+	ItemID string
+}
+
+// PlaylistShare gives a user access to a playlist of another user.
+type PlaylistShare struct {
+	UserID  string `db:"userid"`
+	CanEdit bool   `db:"canedit"`
+}
+
+var (
+	ErrPlaylistEntryNotFound = errors.New("playlist entry not found")
+)
+
+// CanEdit returns true if the user is allowed to change the playlist.
+func (p *Playlist) CanEdit(userID string) bool {
+	if p.UserID == userID {
+		return true
+	}
+	for _, share := range p.Shares {
+		if share.UserID == userID {
+			return share.CanEdit
+		}
+	}
+	return false
 }
 
 func (p *PlaylistStorage) CreatePlaylist(newPlaylist Playlist) (playlistID string, err error) {
@@ -39,31 +80,23 @@ func (p *PlaylistStorage) CreatePlaylist(newPlaylist Playlist) (playlistID strin
 	}
 	defer tx.Rollback()
 
-	if _, err = tx.NamedExec(`INSERT INTO playlist (id, name, userid, timestamp)
-		VALUES (:id, :name, :userid, :timestamp)`,
+	if _, err = tx.NamedExec(`INSERT INTO playlist (id, name, userid, openaccess, timestamp)
+		VALUES (:id, :name, :userid, :openaccess, :timestamp)`,
 		map[string]interface{}{
-			"id":        newPlaylist.ID,
-			"name":      newPlaylist.Name,
-			"userid":    newPlaylist.UserID,
-			"timestamp": time.Now().UTC(),
+			"id":         newPlaylist.ID,
+			"name":       newPlaylist.Name,
+			"userid":     newPlaylist.UserID,
+			"openaccess": newPlaylist.OpenAccess,
+			"timestamp":  time.Now().UTC(),
 		}); err != nil {
 		return "", err
 	}
+	if err = insertPlaylistShares(tx, newPlaylist.ID, newPlaylist.Shares); err != nil {
+		return "", err
+	}
 
-	order := 1
-	for _, itemID := range newPlaylist.ItemIDs {
-		_, err := tx.NamedExec(`INSERT INTO playlist_item (playlistid, itemid, itemorder, timestamp)
-	            VALUES (:playlist_id, :item_id, :item_order, :timestamp)`,
-			map[string]interface{}{
-				"playlist_id": newPlaylist.ID,
-				"item_id":     itemID,
-				"item_order":  order,
-				"timestamp":   time.Now().UTC(),
-			})
-		if err != nil {
-			return "", err
-		}
-		order++
+	if err = insertPlaylistItems(tx, newPlaylist.ID, newPlaylist.ItemIDs, 1); err != nil {
+		return "", err
 	}
 	return newPlaylist.ID, tx.Commit()
 }
@@ -72,7 +105,9 @@ func (p *PlaylistStorage) GetPlaylists(userID string) (playlistIDs []string, err
 	var playlistIDEntries []struct {
 		ID string `db:"id"`
 	}
-	err = p.dbHandle.Select(&playlistIDEntries, "SELECT id FROM playlist WHERE userid=?", userID)
+	err = p.dbHandle.Select(&playlistIDEntries, `SELECT id FROM playlist WHERE userid=? OR openaccess
+		OR id IN (SELECT playlistid FROM playlist_share WHERE userid=?)
+		ORDER BY timestamp`, userID, userID)
 	if err != nil {
 		return
 	}
@@ -86,38 +121,135 @@ func (p *PlaylistStorage) GetPlaylist(userID, playlistID string) (*Playlist, err
 	// log.Printf("db - GetPlaylist: %s\n", playlistID)
 
 	var playlist struct {
-		ID        string    `db:"id"`
-		Name      string    `db:"name"`
-		UserID    string    `db:"userid"`
-		Timestamp time.Time `db:"timestamp"`
+		ID         string `db:"id"`
+		Name       string `db:"name"`
+		UserID     string `db:"userid"`
+		OpenAccess bool   `db:"openaccess"`
 	}
-	if err := p.dbHandle.Get(&playlist, "SELECT * FROM playlist WHERE userid=? AND id=? LIMIT 1",
-		userID, playlistID); err != nil {
+	// Playlist is accessible by its owner, users it is shared with, or everybody in case of open access
+	if err := p.dbHandle.Get(&playlist, `SELECT id, name, userid, openaccess FROM playlist
+		WHERE id=? AND (userid=? OR openaccess OR id IN (SELECT playlistid FROM playlist_share WHERE userid=?))
+		LIMIT 1`, playlistID, userID, userID); err != nil {
 		return nil, err
 	}
 
 	result := &Playlist{
-		ID:     playlist.ID,
-		Name:   playlist.Name,
-		UserID: playlist.UserID,
+		ID:         playlist.ID,
+		Name:       playlist.Name,
+		UserID:     playlist.UserID,
+		OpenAccess: playlist.OpenAccess,
+		Shares:     []PlaylistShare{},
+	}
+	if err := p.dbHandle.Select(&result.Shares,
+		"SELECT userid, canedit FROM playlist_share WHERE playlistid=? ORDER BY userid", playlistID); err != nil {
+		return nil, err
 	}
 
 	var playlistEntries []struct {
-		PlaylistID string    `db:"playlistid"`
-		ItemID     string    `db:"itemid"`
-		ItemOrder  string    `db:"itemorder"`
-		Timestamp  time.Time `db:"timestamp"`
+		ID     string `db:"id"`
+		ItemID string `db:"itemid"`
 	}
-	if err := p.dbHandle.Select(&playlistEntries, "SELECT * FROM playlist_item WHERE playlistid=?",
+	if err := p.dbHandle.Select(&playlistEntries,
+		"SELECT id, itemid FROM playlist_item WHERE playlistid=? ORDER BY itemorder, timestamp",
 		playlistID); err != nil {
 		return nil, err
 	}
 	for _, ps := range playlistEntries {
 		result.ItemIDs = append(result.ItemIDs, ps.ItemID)
+		result.Entries = append(result.Entries, PlaylistEntry{ID: ps.ID, ItemID: ps.ItemID})
 	}
 	return result, nil
 }
 
+func (p *PlaylistStorage) UpdatePlaylist(playlist Playlist) error {
+	tx, err := p.dbHandle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if playlist.Name != "" {
+		if _, err = tx.Exec("UPDATE playlist SET name=? WHERE id=?", playlist.Name, playlist.ID); err != nil {
+			return err
+		}
+	}
+	if playlist.ItemIDs != nil {
+		// Entries of items that stay keep their ID, as clients refer to entries by ID
+		var entries []PlaylistEntry
+		if err = tx.Select(&entries, "SELECT id, itemid FROM playlist_item WHERE playlistid=? ORDER BY itemorder, timestamp",
+			playlist.ID); err != nil {
+			return err
+		}
+		entryIDs := make(map[string][]string)
+		for _, e := range entries {
+			entryIDs[e.ItemID] = append(entryIDs[e.ItemID], e.ID)
+		}
+
+		if _, err = tx.Exec("DELETE FROM playlist_item WHERE playlistid=?", playlist.ID); err != nil {
+			return err
+		}
+		for idx, itemID := range playlist.ItemIDs {
+			entryID := newPlaylistEntryID()
+			if ids := entryIDs[itemID]; len(ids) != 0 {
+				entryID, entryIDs[itemID] = ids[0], ids[1:]
+			}
+			if err = insertPlaylistEntry(tx, playlist.ID, entryID, itemID, idx+1); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *PlaylistStorage) DeletePlaylist(playlistID string) error {
+	tx, err := p.dbHandle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM playlist_item WHERE playlistid=?", playlistID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM playlist_share WHERE playlistid=?", playlistID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM playlist WHERE id=?", playlistID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PlaylistStorage) UpdatePlaylistSharing(playlistID string, openAccess bool, shares []PlaylistShare) error {
+	tx, err := p.dbHandle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("UPDATE playlist SET openaccess=? WHERE id=?", openAccess, playlistID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM playlist_share WHERE playlistid=?", playlistID); err != nil {
+		return err
+	}
+	if err = insertPlaylistShares(tx, playlistID, shares); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PlaylistStorage) SetPlaylistShare(playlistID string, share PlaylistShare) error {
+	_, err := p.dbHandle.Exec(`INSERT OR REPLACE INTO playlist_share (playlistid, userid, canedit)
+		VALUES (?, ?, ?)`, playlistID, share.UserID, share.CanEdit)
+	return err
+}
+
+func (p *PlaylistStorage) DeletePlaylistShare(playlistID, userID string) error {
+	_, err := p.dbHandle.Exec("DELETE FROM playlist_share WHERE playlistid=? AND userid=?", playlistID, userID)
+	return err
+}
+
 func (p *PlaylistStorage) AddItemsToPlaylist(UserID, playlistID string, itemIDs []string) error {
 	log.Printf("AddItemsToPlaylist: %s, %s, %+v\n", UserID, playlistID, itemIDs)
 
@@ -135,32 +267,119 @@ func (p *PlaylistStorage) AddItemsToPlaylist(UserID, playlistID string, itemIDs
 		return err
 	}
 
-	order := maxOrder + 1
-	for _, itemID := range itemIDs {
-		_, err := tx.NamedExec(`INSERT OR REPLACE INTO playlist_item (playlistid, itemid, itemorder, timestamp)
-                VALUES (:playlistid, :itemid, :itemorder, :timestamp)`,
-			map[string]interface{}{
-				"playlistid": playlistID,
-				"itemid":     itemID,
-				"itemorder":  order,
-				"timestamp":  time.Now().UTC(),
-			})
-		log.Printf("AddItemsToPlaylist: err2: %+v\n", err)
-		if err != nil {
+	if err = insertPlaylistItems(tx, playlistID, itemIDs, maxOrder+1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *PlaylistStorage) DeleteItemsFromPlaylist(playlistID string, entryIDs []string) error {
+	tx, err := p.dbHandle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, entryID := range entryIDs {
+		if _, err = tx.Exec("DELETE FROM playlist_item WHERE playlistid=? AND id=?", playlistID, entryID); err != nil {
 			return err
 		}
-		order++
+	}
+	if err = renumberPlaylistItems(tx, playlistID, "", 0); err != nil {
+		return err
 	}
 	return tx.Commit()
 }
 
-func (p *PlaylistStorage) DeleteItemsFromPlaylist(playlistID string, itemIDs []string) error {
-	log.Printf("DeleteItemsFromPlaylist: %s, %+v\n", playlistID, itemIDs)
+func (p *PlaylistStorage) MovePlaylistItem(playlistID string, entryID string, newIndex int) error {
+	tx, err := p.dbHandle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err = tx.Get(&count, "SELECT COUNT(*) FROM playlist_item WHERE playlistid=? AND id=?",
+		playlistID, entryID); err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrPlaylistEntryNotFound
+	}
+	if err = renumberPlaylistItems(tx, playlistID, entryID, newIndex); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertPlaylistShares shares a playlist with users.
+func insertPlaylistShares(tx *sqlx.Tx, playlistID string, shares []PlaylistShare) error {
+	for _, share := range shares {
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO playlist_share (playlistid, userid, canedit)
+			VALUES (?, ?, ?)`, playlistID, share.UserID, share.CanEdit); err != nil {
+			return err
+		}
+	}
 	return nil
+}
 
+// insertPlaylistItems adds items to a playlist, numbering them starting at order.
+func insertPlaylistItems(tx *sqlx.Tx, playlistID string, itemIDs []string, order int) error {
+	for _, itemID := range itemIDs {
+		if err := insertPlaylistEntry(tx, playlistID, newPlaylistEntryID(), itemID, order); err != nil {
+			return err
+		}
+		order++
+	}
+	return nil
 }
 
-func (p *PlaylistStorage) MovePlaylistItem(playlistID string, itemID string, newIndex int) error {
-	log.Printf("MovePlaylistItem: %s, %s, %d", playlistID, itemID, newIndex)
+// insertPlaylistEntry adds an entry to a playlist.
+func insertPlaylistEntry(tx *sqlx.Tx, playlistID, entryID, itemID string, order int) error {
+	_, err := tx.NamedExec(`INSERT INTO playlist_item (id, playlistid, itemid, itemorder, timestamp)
+		VALUES (:id, :playlistid, :itemid, :itemorder, :timestamp)`,
+		map[string]interface{}{
+			"id":         entryID,
+			"playlistid": playlistID,
+			"itemid":     itemID,
+			"itemorder":  order,
+			"timestamp":  time.Now().UTC(),
+		})
+	return err
+}
+
+// newPlaylistEntryID returns a random entry ID, in the same format as
+// the IDs given to existing entries by dbMigrateSchema.
+func newPlaylistEntryID() string {
+	b := make([]byte, 10)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// renumberPlaylistItems renumbers the entries of a playlist to a consecutive order.
+// If moveEntryID is set that entry is moved to zero-based position newIndex.
+func renumberPlaylistItems(tx *sqlx.Tx, playlistID, moveEntryID string, newIndex int) error {
+	var entryIDs []string
+	if err := tx.Select(&entryIDs, "SELECT id FROM playlist_item WHERE playlistid=? ORDER BY itemorder, timestamp",
+		playlistID); err != nil {
+		return err
+	}
+
+	if moveEntryID != "" {
+		for idx, id := range entryIDs {
+			if id == moveEntryID {
+				entryIDs = append(entryIDs[:idx], entryIDs[idx+1:]...)
+				break
+			}
+		}
+		newIndex = max(0, min(newIndex, len(entryIDs)))
+		entryIDs = append(entryIDs[:newIndex], append([]string{moveEntryID}, entryIDs[newIndex:]...)...)
+	}
+
+	for idx, id := range entryIDs {
+		if _, err := tx.Exec("UPDATE playlist_item SET itemorder=? WHERE id=?", idx+1, id); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// newTestDatabase returns a database in a temporary directory.
+func newTestDatabase(t *testing.T) *DatabaseRepo {
+	t.Helper()
+	d, err := New(&Options{Filename: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestUpdatePlaylistKeepsEntryIDs(t *testing.T) {
+	d := newTestDatabase(t)
+
+	playlistID, err := d.CreatePlaylist(Playlist{UserID: "u1", Name: "list", ItemIDs: []string{"a", "b", "a", "c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := d.GetPlaylist("u1", playlistID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entryIDFormat := regexp.MustCompile(`^[0-9a-f]{20}$`)
+	for _, e := range before.Entries {
+		if !entryIDFormat.MatchString(e.ID) {
+			t.Errorf("entry ID %q does not match format of migrated entries", e.ID)
+		}
+	}
+
+	// Drop b, reorder and add d
+	if err := d.UpdatePlaylist(Playlist{ID: playlistID, ItemIDs: []string{"c", "a", "a", "d"}}); err != nil {
+		t.Fatal(err)
+	}
+	after, err := d.GetPlaylist("u1", playlistID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(after.ItemIDs, []string{"c", "a", "a", "d"}) {
+		t.Fatalf("items = %v", after.ItemIDs)
+	}
+	// Entries of a, a and c are kept in order of their previous position
+	want := []string{before.Entries[3].ID, before.Entries[0].ID, before.Entries[2].ID}
+	for idx, id := range want {
+		if after.Entries[idx].ID != id {
+			t.Errorf("entry %d ID = %q, want %q", idx, after.Entries[idx].ID, id)
+		}
+	}
+	if slices.ContainsFunc(before.Entries, func(e PlaylistEntry) bool { return e.ID == after.Entries[3].ID }) {
+		t.Errorf("new entry reuses ID %q", after.Entries[3].ID)
+	}
+}
@@ -0,0 +1,470 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/erikbos/jellofin-server/diacritics"
+	"github.com/erikbos/jellofin-server/idhash"
+)
+
+// The search index is an SQLite FTS5 table holding titles, original titles,
+// plots and people of movies and shows, and titles and plots of episodes.
+// People are indexed as separate documents so they can be found as well.
+// Diacritics are removed by the tokenizer so "amelie" finds "Amélie". In case
+// a search does not find anything the search terms are expanded with similar
+// terms from the index to tolerate typos.
+//
+// In case SQLite is built without FTS5 the same documents are stored in the
+// search_document table as lowercase terms without diacritics, and searched
+// by matching terms against each column.
+
+// Search index document types, in addition to the movie and show catalog item types.
+const (
+	CatalogTypeEpisode = "episode"
+	CatalogTypePerson  = "person"
+)
+
+// SearchResult is an item found by a search.
+type SearchResult struct {
+	ID string
+	// Type is the catalog item type, e.g. movie, show, episode or person
+	Type string
+	// Name is the indexed title of the item
+	Name string
+}
+
+// searchRank orders results by relevance, titles weigh more than people and
+// plots. Weights are listed per column of the search index, unindexed columns
+// first. Episodes rank lower so a show comes before its episodes.
+const searchRank = "bm25(search_index, 0, 0, 0, 0, 10.0, 8.0, 3.0, 1.0, 5.0) * " + episodeRank
+
+// episodeRank lowers the rank of episodes.
+const episodeRank = "(CASE s.type WHEN '" + CatalogTypeEpisode + "' THEN 0.5 ELSE 1.0 END)"
+
+// searchDocumentColumns are the searched columns of the search_document
+// table, with the same weights as searchRank.
+var searchDocumentColumns = []struct {
+	name   string
+	weight string
+}{
+	{"title", "10.0"}, {"originaltitle", "8.0"}, {"people", "3.0"}, {"plot", "1.0"}, {"keywords", "5.0"},
+}
+
+// searchMatch selects and ranks the documents matching a search.
+type searchMatch struct {
+	// table holding the documents
+	table string
+	// name is the column with the title of a document
+	name string
+	// condition selects matching documents
+	condition     string
+	conditionArgs []any
+	// rank orders matching documents, most relevant first
+	rank     string
+	rankArgs []any
+}
+
+// romanNumerals are indexed with their arabic counterpart and vice versa so
+// "godfather 2" finds "The Godfather Part II".
+var romanNumerals = []string{"", "i", "ii", "iii", "iv", "v", "vi", "vii", "viii", "ix", "x",
+	"xi", "xii", "xiii", "xiv", "xv", "xvi", "xvii", "xviii", "xix", "xx"}
+
+var (
+	ErrNoFullTextSearch = errors.New("sqlite3 built without FTS5")
+)
+
+// initSearchIndex creates the search index, fails in case SQLite was built without FTS5.
+func (c *CatalogStorage) initSearchIndex() error {
+	if c.dbHandle == nil {
+		return ErrNoDbHandle
+	}
+	// Check explicitly as an existing index can be opened without FTS5 support
+	var fts5 bool
+	if err := c.dbHandle.Get(&fts5, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`); err != nil {
+		return err
+	}
+	if !fts5 {
+		return ErrNoFullTextSearch
+	}
+	schema := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(
+itemid UNINDEXED,
+type UNINDEXED,
+catalogid UNINDEXED,
+collectionid UNINDEXED,
+title,
+originaltitle,
+people,
+plot,
+keywords,
+tokenize='unicode61 remove_diacritics 2');`,
+
+		`CREATE VIRTUAL TABLE IF NOT EXISTS search_vocabulary USING fts5vocab(search_index, 'row');`,
+	}
+	for _, query := range schema {
+		if _, err := c.dbHandle.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateSearchIndex replaces all documents of a collection in the search
+// index, or in the search_document table without full-text search.
+func (c *CatalogStorage) updateSearchIndex(tx *sqlx.Tx, collectionID string, items []CatalogItem) error {
+	table := "search_index"
+	if !c.fts {
+		table = "search_document"
+	}
+	if _, err := tx.Exec(`DELETE FROM `+table+` WHERE collectionid=?`, collectionID); err != nil {
+		return err
+	}
+
+	insert := func(itemID, itemType, catalogID, title, originalTitle, people, plot string) error {
+		if originalTitle == title {
+			originalTitle = ""
+		}
+		keywords := numeralKeywords(title + " " + originalTitle)
+		if !c.fts {
+			_, err := tx.Exec(`INSERT INTO search_document (itemid, type, catalogid, collectionid,
+				name, title, originaltitle, people, plot, keywords) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				itemID, itemType, catalogID, collectionID, title, documentTerms(title),
+				documentTerms(originalTitle), documentTerms(people), documentTerms(plot), documentTerms(keywords))
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO search_index (itemid, type, catalogid, collectionid,
+			title, originaltitle, people, plot, keywords) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			itemID, itemType, catalogID, collectionID, title, originalTitle, people, plot, keywords)
+		return err
+	}
+
+	people := make(map[string]bool)
+	for _, item := range items {
+		if err := insert(item.ID, item.Type, item.ID, item.Title, item.OriginalTitle,
+			strings.Join(item.People, ", "), item.Plot); err != nil {
+			return err
+		}
+		for _, e := range item.Episodes {
+			if err := insert(e.ID, CatalogTypeEpisode, item.ID, e.Title, "", "", e.Plot); err != nil {
+				return err
+			}
+		}
+		for _, name := range item.People {
+			people[name] = true
+		}
+	}
+	for name := range people {
+		if err := insert(idhash.IdHash(name), CatalogTypePerson, "", name, "", "", ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchItems returns the requested page of items matching the search term
+// of the query, most relevant first, and the total number of items found.
+// Results are movies, shows, episodes or people, other query fields filter
+// the movies and shows searched, or the shows of episodes.
+func (c *CatalogStorage) SearchItems(q CatalogQuery) (results []SearchResult, totalCount int, err error) {
+	if c.dbHandle == nil {
+		return nil, 0, ErrNoDbHandle
+	}
+
+	match, ok := c.searchMatch(q.SearchTerm, false)
+	if !ok {
+		return []SearchResult{}, 0, nil
+	}
+	results, totalCount, err = c.search(q, match)
+	if err == nil && totalCount == 0 {
+		// Nothing found, retry with similar terms to tolerate typos
+		if match, ok := c.searchMatch(q.SearchTerm, true); ok {
+			return c.search(q, match)
+		}
+	}
+	return
+}
+
+// search runs a search query.
+func (c *CatalogStorage) search(q CatalogQuery, match searchMatch) (results []SearchResult, totalCount int, err error) {
+	results = []SearchResult{}
+	filter, filterArgs, err := c.filter(q, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	where := []string{match.condition}
+	args := slices.Concat(match.rankArgs, match.conditionArgs)
+	if len(q.CollectionIDs) != 0 {
+		where = append(where, "s.collectionid IN ("+placeholders(len(q.CollectionIDs))+")")
+		for _, v := range q.CollectionIDs {
+			args = append(args, v)
+		}
+	}
+	if len(q.IncludeItemTypes) != 0 {
+		where = append(where, "s.type IN ("+placeholders(len(q.IncludeItemTypes))+")")
+		for _, v := range q.IncludeItemTypes {
+			args = append(args, v)
+		}
+	}
+	if len(q.ExcludeItemTypes) != 0 {
+		where = append(where, "s.type NOT IN ("+placeholders(len(q.ExcludeItemTypes))+")")
+		for _, v := range q.ExcludeItemTypes {
+			args = append(args, v)
+		}
+	}
+	// People do not belong to a catalog item, other documents must match the catalog filters
+	itemFilter := "c.id IS NOT NULL"
+	if len(filter) != 0 {
+		itemFilter += " AND " + strings.Join(filter, " AND ")
+	}
+	where = append(where, "(s.type='"+CatalogTypePerson+"' OR ("+itemFilter+"))")
+	args = append(args, filterArgs...)
+
+	// People are indexed once per collection, group to return them once
+	matches := `SELECT s.itemid AS id, s.type AS type, ` + match.name + ` AS name, ` + match.rank + ` AS rank
+		FROM ` + match.table + ` s LEFT JOIN catalog_item c ON c.id=s.catalogid
+		WHERE ` + strings.Join(where, " AND ")
+	// Materialize matches as bm25() cannot be used in an aggregate query
+	grouped := `WITH matches AS MATERIALIZED (` + matches + `)
+		SELECT id, type, name, MIN(rank) AS rank FROM matches GROUP BY id, type`
+
+	if err := c.dbHandle.Get(&totalCount, `SELECT COUNT(*) FROM (`+grouped+`)`, args...); err != nil {
+		return nil, 0, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	var rows []struct {
+		SearchResult
+		Rank float64
+	}
+	if err := c.dbHandle.Select(&rows, grouped+` ORDER BY rank, name LIMIT ? OFFSET ?`,
+		append(args, limit, max(q.StartIndex, 0))...); err != nil {
+		return nil, 0, err
+	}
+	for _, r := range rows {
+		results = append(results, r.SearchResult)
+	}
+	return results, totalCount, nil
+}
+
+// searchMatch returns the match of all terms of a search, the last term also
+// matches as prefix to support search as you type. In case fuzzy is true
+// terms also match similar terms in the index. False is returned if there
+// are no terms, or no similar terms in case of fuzzy.
+func (c *CatalogStorage) searchMatch(searchTerm string, fuzzy bool) (searchMatch, bool) {
+	terms := searchTerms(searchTerm)
+	if len(terms) == 0 {
+		return searchMatch{}, false
+	}
+	var vocabulary []string
+	if fuzzy {
+		vocabulary = c.getVocabulary()
+	}
+
+	var expanded bool
+	alternatives := make([][]string, 0, len(terms))
+	for _, term := range terms {
+		var similar []string
+		if fuzzy {
+			similar = similarTerms(term, vocabulary)
+			expanded = expanded || len(similar) != 0
+		}
+		alternatives = append(alternatives, append([]string{term}, similar...))
+	}
+	if fuzzy && !expanded {
+		return searchMatch{}, false
+	}
+	if !c.fts {
+		return documentMatch(alternatives), true
+	}
+	return fullTextMatch(alternatives), true
+}
+
+// fullTextMatch returns an FTS5 query matching one of the alternatives of
+// each term, the first alternative of the last term also matches as prefix.
+func fullTextMatch(terms [][]string) searchMatch {
+	parts := make([]string, 0, len(terms))
+	for n, alternatives := range terms {
+		quoted := make([]string, 0, len(alternatives)+1)
+		for _, term := range alternatives {
+			quoted = append(quoted, strconv.Quote(term))
+		}
+		if n == len(terms)-1 {
+			quoted = append(quoted, strconv.Quote(alternatives[0])+"*")
+		}
+		parts = append(parts, "("+strings.Join(quoted, " OR ")+")")
+	}
+	return searchMatch{
+		table:         "search_index",
+		name:          "s.title",
+		condition:     "search_index MATCH ?",
+		conditionArgs: []any{strings.Join(parts, " AND ")},
+		rank:          searchRank,
+	}
+}
+
+// documentMatch returns a query of the search_document table matching one
+// of the alternatives of each term, the first alternative of the last term
+// also matches as prefix. Documents rank by the weight of the columns the
+// terms are found in.
+func documentMatch(terms [][]string) searchMatch {
+	m := searchMatch{table: "search_document", name: "s.name"}
+	conditions := make([]string, 0, len(terms))
+	scores := make([]string, 0, len(terms))
+	for n, alternatives := range terms {
+		// Columns hold terms separated and surrounded by spaces
+		patterns := make([]any, 0, len(alternatives)+1)
+		for _, term := range alternatives {
+			patterns = append(patterns, " "+term+" ")
+		}
+		if n == len(terms)-1 {
+			patterns = append(patterns, " "+alternatives[0])
+		}
+
+		var found, score []string
+		var args []any
+		for _, column := range searchDocumentColumns {
+			contains := strings.TrimSuffix(strings.Repeat("instr(s."+column.name+", ?) OR ", len(patterns)), " OR ")
+			found = append(found, "("+contains+")")
+			score = append(score, "("+contains+") * "+column.weight)
+			args = append(args, patterns...)
+		}
+		conditions = append(conditions, "("+strings.Join(found, " OR ")+")")
+		scores = append(scores, strings.Join(score, " + "))
+		m.conditionArgs = append(m.conditionArgs, args...)
+		m.rankArgs = append(m.rankArgs, args...)
+	}
+	m.condition = strings.Join(conditions, " AND ")
+	// Negate as lower ranks come first, as with bm25()
+	m.rank = "-(" + strings.Join(scores, " + ") + ") * " + episodeRank
+	return m
+}
+
+// getVocabulary returns all terms in the search index.
+func (c *CatalogStorage) getVocabulary() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.vocabulary == nil {
+		vocabulary := []string{}
+		query := `SELECT term FROM search_vocabulary`
+		if !c.fts {
+			query = `SELECT title || originaltitle || people || plot || keywords FROM search_document`
+		}
+		if err := c.dbHandle.Select(&vocabulary, query); err != nil {
+			log.Printf("Error loading search vocabulary: %s\n", err)
+			return nil
+		}
+		if !c.fts {
+			vocabulary = documentVocabulary(vocabulary)
+		}
+		c.vocabulary = vocabulary
+	}
+	return c.vocabulary
+}
+
+// documentVocabulary returns the sorted unique terms of search documents.
+func documentVocabulary(documents []string) []string {
+	terms := make(map[string]bool)
+	for _, document := range documents {
+		for _, term := range strings.Fields(document) {
+			terms[term] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(terms))
+}
+
+// documentTerms returns the search terms of text separated and surrounded
+// by spaces, as stored in the search_document table.
+func documentTerms(text string) string {
+	return " " + strings.Join(searchTerms(text), " ") + " "
+}
+
+// searchTerms splits a search into lowercase terms without diacritics.
+func searchTerms(search string) []string {
+	return strings.FieldsFunc(diacritics.Remove(strings.ToLower(search)), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+}
+
+// similarTerms returns terms of the vocabulary within a small edit distance
+// of term, longer terms allow more typos. At most 10 terms are returned.
+func similarTerms(term string, vocabulary []string) (similar []string) {
+	maxDistance := 0
+	switch length := len([]rune(term)); {
+	case length >= 8:
+		maxDistance = 2
+	case length >= 3:
+		maxDistance = 1
+	}
+	if maxDistance == 0 {
+		return nil
+	}
+	for _, candidate := range vocabulary {
+		if candidate == term || abs(len(candidate)-len(term)) > maxDistance {
+			continue
+		}
+		if editDistance(term, candidate) <= maxDistance {
+			similar = append(similar, candidate)
+			if len(similar) == 10 {
+				break
+			}
+		}
+	}
+	return
+}
+
+// editDistance returns the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	previous := make([]int, len(t)+1)
+	current := make([]int, len(t)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		current[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(t)]
+}
+
+// numeralKeywords returns arabic numbers for roman numerals in a title, and
+// roman numerals for numbers.
+func numeralKeywords(title string) string {
+	var keywords []string
+	for _, term := range searchTerms(title) {
+		for n := 1; n < len(romanNumerals); n++ {
+			if term == romanNumerals[n] {
+				keywords = append(keywords, strconv.Itoa(n))
+			} else if term == strconv.Itoa(n) {
+				keywords = append(keywords, romanNumerals[n])
+			}
+		}
+	}
+	return strings.Join(keywords, " ")
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/erikbos/jellofin-server/idhash"
+)
+
+func TestSearchItems(t *testing.T) {
+	d := newTestDatabase(t)
+
+	items := []CatalogItem{
+		{ID: "godfather", Type: "movie", Name: "The Godfather Part II", Title: "The Godfather Part II",
+			Plot: "The early life of Vito Corleone.", People: []string{"Al Pacino", "Robert De Niro"}},
+		{ID: "amelie", Type: "movie", Name: "Amélie", Title: "Amélie",
+			OriginalTitle: "Le Fabuleux Destin d'Amélie Poulain", People: []string{"Audrey Tautou"}},
+		{ID: "breakingbad", Type: "show", Name: "Breaking Bad", Title: "Breaking Bad",
+			Plot: "A chemistry teacher turns to crime.", People: []string{"Bryan Cranston"},
+			Episodes: []CatalogEpisode{
+				{ID: "pilot", Title: "Pilot", Plot: "Walter gets a diagnosis."},
+				{ID: "badbreak", Title: "Bad Break"},
+			}},
+	}
+	if err := d.CatalogRepo.UpdateCollection("1", items); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		search string
+		types  []string
+		want   []SearchResult
+	}{
+		// Roman numerals
+		{search: "godfather 2", want: []SearchResult{{ID: "godfather", Type: "movie", Name: "The Godfather Part II"}}},
+		// Diacritics and original titles
+		{search: "amelie poulain", want: []SearchResult{{ID: "amelie", Type: "movie", Name: "Amélie"}}},
+		// Plots
+		{search: "corleone", want: []SearchResult{{ID: "godfather", Type: "movie", Name: "The Godfather Part II"}}},
+		// People are found as well as their movies
+		{search: "pacino", want: []SearchResult{
+			{ID: "godfather", Type: "movie", Name: "The Godfather Part II"},
+			{ID: idhash.IdHash("Al Pacino"), Type: CatalogTypePerson, Name: "Al Pacino"},
+		}},
+		// Episodes are found by their plot
+		{search: "diagnosis", want: []SearchResult{{ID: "pilot", Type: CatalogTypeEpisode, Name: "Pilot"}}},
+		// Episodes rank below their show
+		{search: "bad", want: []SearchResult{
+			{ID: "breakingbad", Type: "show", Name: "Breaking Bad"},
+			{ID: "badbreak", Type: CatalogTypeEpisode, Name: "Bad Break"},
+		}},
+		// Prefix of the last term
+		{search: "breaking ba", types: []string{"show"}, want: []SearchResult{{ID: "breakingbad", Type: "show", Name: "Breaking Bad"}}},
+		// Typos
+		{search: "godfathr", want: []SearchResult{{ID: "godfather", Type: "movie", Name: "The Godfather Part II"}}},
+		{search: "nothing like this", want: []SearchResult{}},
+	}
+	for _, tt := range tests {
+		results, totalCount, err := d.CatalogRepo.SearchItems(CatalogQuery{SearchTerm: tt.search, IncludeItemTypes: tt.types})
+		if err != nil {
+			t.Fatalf("search %q: %s", tt.search, err)
+		}
+		// Order of equally ranked results differs between full-text search and fallback
+		slices.SortStableFunc(results, func(a, b SearchResult) int {
+			return compareType(a.Type) - compareType(b.Type)
+		})
+		if !slices.Equal(results, tt.want) || totalCount != len(tt.want) {
+			t.Errorf("search %q = %+v, %d, want %+v", tt.search, results, totalCount, tt.want)
+		}
+	}
+}
+
+// compareType orders people after other results.
+func compareType(itemType string) int {
+	if itemType == CatalogTypePerson {
+		return 1
+	}
+	return 0
+}
@@ -1,7 +1,10 @@
 package database
 
 import (
+	"database/sql"
 	"errors"
+	"slices"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	"golang.org/x/crypto/bcrypt"
@@ -11,11 +14,16 @@ import (
 
 type UserStorage struct {
 	dbHandle *sqlx.DB
+	// userData and playbackHistory cache details of users, evicted when a user is deleted
+	userData        *UserDataStorage
+	playbackHistory *PlaybackHistoryStorage
 }
 
-func NewUserStorage(d *sqlx.DB) *UserStorage {
+func NewUserStorage(d *sqlx.DB, userData *UserDataStorage, playbackHistory *PlaybackHistoryStorage) *UserStorage {
 	return &UserStorage{
-		dbHandle: d,
+		dbHandle:        d,
+		userData:        userData,
+		playbackHistory: playbackHistory,
 	}
 }
 
@@ -23,11 +31,53 @@ type User struct {
 	ID       string
 	Username string
 	Password string
+	// Admin indicates the user is allowed to manage the server and other users
+	Admin bool
+	// Disabled users are not allowed to login
+	Disabled bool
+	// EnableAllFolders gives access to all collections, otherwise only to EnabledFolders
+	EnableAllFolders bool
+	// EnabledFolders holds IDs of collections the user has access to
+	EnabledFolders []string `db:"-"`
+	// MaxParentalRating is the highest parental rating score the user is allowed to watch, nil means no limit
+	MaxParentalRating *int
+	// BlockUnratedItems blocks items without (known) parental rating
+	BlockUnratedItems bool
+	// Configuration holds the playback and home screen preferences of the user
+	Configuration UserConfiguration `db:"-"`
+}
+
+// UserConfiguration holds the playback and home screen preferences of a user.
+type UserConfiguration struct {
+	// AudioLanguagePreference and SubtitleLanguagePreference are ISO 639-2 language codes, empty means no preference
+	AudioLanguagePreference    string
+	SubtitleLanguagePreference string
+	// SubtitleMode is one of Default, Always, OnlyForced, None or Smart
+	SubtitleMode string
+	// PlayDefaultAudioTrack plays the default audio track regardless of the audio language preference
+	PlayDefaultAudioTrack bool
+	// OrderedViews holds IDs of views in the order the user wants them listed
+	OrderedViews []string
+	// LatestItemsExcludes holds IDs of views excluded from latest items
+	LatestItemsExcludes []string
+}
+
+// userConfigurationRow is how user configuration is stored, lists are comma separated.
+type userConfigurationRow struct {
+	UserID                     string
+	AudioLanguagePreference    string
+	SubtitleLanguagePreference string
+	SubtitleMode               string
+	PlayDefaultAudioTrack      bool
+	OrderedViews               string
+	LatestItemsExcludes        string
 }
 
 var (
 	ErrUserNotFound    = errors.New("user not found")
 	ErrInvalidPassword = errors.New("invalid password")
+	ErrUserExists      = errors.New("user already exists")
+	ErrLastAdmin       = errors.New("cannot remove last administrator")
 )
 
 // GetByID retrieves a user from the database by their ID.
@@ -38,6 +88,12 @@ func (u *UserStorage) GetByID(userID string) (user *User, err error) {
 	}
 	// No need to return hashed pw
 	data.Password = ""
+	if err := u.loadFolders(&data); err != nil {
+		return nil, err
+	}
+	if err := u.loadConfiguration(&data); err != nil {
+		return nil, err
+	}
 	return &data, nil
 }
 
@@ -53,10 +109,35 @@ func (u *UserStorage) Validate(username, password string) (user *User, err error
 	if err != nil {
 		return nil, ErrInvalidPassword
 	}
+	if err := u.loadFolders(&data); err != nil {
+		return nil, err
+	}
+	if err := u.loadConfiguration(&data); err != nil {
+		return nil, err
+	}
 	return &data, nil
 }
 
-// Insert inserts a new user into the database.
+// GetAll retrieves all users from the database.
+func (u *UserStorage) GetAll() (users []User, err error) {
+	if err = u.dbHandle.Select(&users, "SELECT * FROM users ORDER BY username"); err != nil {
+		return nil, err
+	}
+	// No need to return hashed pw
+	for i := range users {
+		users[i].Password = ""
+		if err := u.loadFolders(&users[i]); err != nil {
+			return nil, err
+		}
+		if err := u.loadConfiguration(&users[i]); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// Insert inserts a new user into the database. The first user
+// created becomes administrator.
 func (u *UserStorage) Insert(username, password string) (user *User, err error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -64,19 +145,252 @@ func (u *UserStorage) Insert(username, password string) (user *User, err error)
 	}
 
 	user = &User{
-		ID:       idhash.IdHash(username),
-		Username: username,
-		Password: string(hashedPassword),
+		ID:               idhash.IdHash(username),
+		Username:         username,
+		Password:         string(hashedPassword),
+		EnableAllFolders: true,
+	}
+
+	tx, err := u.dbHandle.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err = tx.Get(&count, "SELECT COUNT(*) FROM users WHERE username=?", username); err != nil {
+		return nil, err
+	}
+	if count != 0 {
+		return nil, ErrUserExists
+	}
+	if err = tx.Get(&count, "SELECT COUNT(*) FROM users"); err != nil {
+		return nil, err
+	}
+	user.Admin = count == 0
+
+	_, err = tx.NamedExec(`INSERT INTO users (id, username, password, admin, disabled, enableallfolders) `+
+		`VALUES (:id, :username, :password, :admin, :disabled, :enableallfolders)`, user)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	user.Password = ""
+	return user, nil
+}
+
+// Update stores the admin and disabled flags, library access and parental control of a user.
+func (u *UserStorage) Update(user User) error {
+	tx, err := u.dbHandle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !user.Admin || user.Disabled {
+		if err := lastAdminCheck(tx, user.ID); err != nil {
+			return err
+		}
+	}
+	result, err := tx.Exec(`UPDATE users SET admin=?, disabled=?, enableallfolders=?,
+		maxparentalrating=?, blockunrateditems=? WHERE id=?`,
+		user.Admin, user.Disabled, user.EnableAllFolders,
+		user.MaxParentalRating, user.BlockUnratedItems, user.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	if _, err := tx.Exec("DELETE FROM user_folder WHERE userid=?", user.ID); err != nil {
+		return err
+	}
+	for _, folderID := range user.EnabledFolders {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO user_folder (userid, folderid) VALUES (?, ?)", user.ID, folderID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UpdateConfiguration stores the playback and home screen preferences of a user.
+func (u *UserStorage) UpdateConfiguration(userID string, config UserConfiguration) error {
+	row := userConfigurationRow{
+		UserID:                     userID,
+		AudioLanguagePreference:    config.AudioLanguagePreference,
+		SubtitleLanguagePreference: config.SubtitleLanguagePreference,
+		SubtitleMode:               config.SubtitleMode,
+		PlayDefaultAudioTrack:      config.PlayDefaultAudioTrack,
+		OrderedViews:               strings.Join(config.OrderedViews, ","),
+		LatestItemsExcludes:        strings.Join(config.LatestItemsExcludes, ","),
+	}
+	_, err := u.dbHandle.NamedExec(`INSERT OR REPLACE INTO user_configuration (userid,
+		audiolanguagepreference, subtitlelanguagepreference, subtitlemode, playdefaultaudiotrack,
+		orderedviews, latestitemsexcludes)
+		VALUES (:userid, :audiolanguagepreference, :subtitlelanguagepreference, :subtitlemode,
+		:playdefaultaudiotrack, :orderedviews, :latestitemsexcludes)`, row)
+	return err
+}
+
+// SetPassword changes the password of a user.
+func (u *UserStorage) SetPassword(userID, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	result, err := u.dbHandle.Exec("UPDATE users SET password=? WHERE id=?", string(hashedPassword), userID)
+	if err != nil {
+		return err
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// Delete removes a user from the database.
+func (u *UserStorage) Delete(userID string) error {
+	// Hold the cache locks so details of the user cannot be written back while they are deleted
+	u.userData.mu.Lock()
+	defer u.userData.mu.Unlock()
+	u.playbackHistory.mu.Lock()
+	defer u.playbackHistory.mu.Unlock()
 
-	tx, _ := u.dbHandle.Beginx()
+	tx, err := u.dbHandle.Beginx()
+	if err != nil {
+		return err
+	}
 	defer tx.Rollback()
 
-	_, err = tx.NamedExec(`INSERT INTO users (id, username, password) `+
-		`VALUES (:id, :username, :password)`, user)
+	if err := lastAdminCheck(tx, userID); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM users WHERE id=?", userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	// Playlists owned by the user are removed, including their items and shares
+	for _, query := range []string{
+		"DELETE FROM playlist_item WHERE playlistid IN (SELECT id FROM playlist WHERE userid=?)",
+		"DELETE FROM playlist_share WHERE playlistid IN (SELECT id FROM playlist WHERE userid=?)",
+		"DELETE FROM playlist WHERE userid=?",
+	} {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return err
+		}
+	}
+	for _, table := range []string{"user_folder", "user_configuration", "display_preferences",
+		"display_preferences_custom", "playstate", "playback_history", "playlist_share"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE userid=?", userID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	u.userData.evictUser(userID)
+	u.playbackHistory.evictUser(userID)
+	return nil
+}
+
+// GetGuest returns a user without ID holding the most restrictive policy of all
+// users. It is used for requests without authentication, so these do not get
+// access to collections or parental ratings that are hidden from any user.
+func (u *UserStorage) GetGuest() (*User, error) {
+	guest := &User{
+		EnableAllFolders: true,
+		EnabledFolders:   []string{},
+	}
+	var policy struct {
+		MaxParentalRating *int  `db:"maxparentalrating"`
+		BlockUnratedItems *bool `db:"blockunrateditems"`
+		Restricted        int   `db:"restricted"`
+	}
+	if err := u.dbHandle.Get(&policy, `SELECT MIN(maxparentalrating) AS maxparentalrating,
+		MAX(blockunrateditems) AS blockunrateditems,
+		COUNT(*) FILTER (WHERE NOT enableallfolders) AS restricted FROM users`); err != nil {
+		return nil, err
+	}
+	guest.MaxParentalRating = policy.MaxParentalRating
+	guest.BlockUnratedItems = policy.BlockUnratedItems != nil && *policy.BlockUnratedItems
+	if policy.Restricted == 0 {
+		return guest, nil
+	}
+	// Only collections all users with restricted access have access to
+	guest.EnableAllFolders = false
+	if err := u.dbHandle.Select(&guest.EnabledFolders, `SELECT folderid FROM user_folder
+		WHERE userid IN (SELECT id FROM users WHERE NOT enableallfolders)
+		GROUP BY folderid HAVING COUNT(*) = ? ORDER BY folderid`, policy.Restricted); err != nil {
+		return nil, err
+	}
+	return guest, nil
+}
+
+// CollectionAllowed returns true if the user has access to the collection.
+func (user *User) CollectionAllowed(collectionID string) bool {
+	return user.EnableAllFolders || slices.Contains(user.EnabledFolders, collectionID)
+}
+
+// ParentalRatingAllowed returns true if the user is allowed to watch an item
+// with the provided parental rating score, rated is false for unrated items.
+func (user *User) ParentalRatingAllowed(score int, rated bool) bool {
+	if !rated {
+		return !user.BlockUnratedItems
+	}
+	return user.MaxParentalRating == nil || score <= *user.MaxParentalRating
+}
+
+// loadFolders loads IDs of collections the user has access to.
+func (u *UserStorage) loadFolders(user *User) error {
+	user.EnabledFolders = []string{}
+	return u.dbHandle.Select(&user.EnabledFolders,
+		"SELECT folderid FROM user_folder WHERE userid=? ORDER BY folderid", user.ID)
+}
+
+// loadConfiguration loads the preferences of a user, users that never stored
+// their preferences get the defaults.
+func (u *UserStorage) loadConfiguration(user *User) error {
+	user.Configuration = UserConfiguration{
+		SubtitleMode:          "Default",
+		PlayDefaultAudioTrack: true,
+		OrderedViews:          []string{},
+		LatestItemsExcludes:   []string{},
+	}
+
+	var row userConfigurationRow
+	err := u.dbHandle.Get(&row, "SELECT * FROM user_configuration WHERE userid=?", user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
 	if err != nil {
-		return
+		return err
+	}
+	user.Configuration.AudioLanguagePreference = row.AudioLanguagePreference
+	user.Configuration.SubtitleLanguagePreference = row.SubtitleLanguagePreference
+	user.Configuration.SubtitleMode = row.SubtitleMode
+	user.Configuration.PlayDefaultAudioTrack = row.PlayDefaultAudioTrack
+	if row.OrderedViews != "" {
+		user.Configuration.OrderedViews = strings.Split(row.OrderedViews, ",")
+	}
+	if row.LatestItemsExcludes != "" {
+		user.Configuration.LatestItemsExcludes = strings.Split(row.LatestItemsExcludes, ",")
+	}
+	return nil
+}
+
+// lastAdminCheck returns an error in case the user is the only remaining enabled administrator.
+func lastAdminCheck(tx *sqlx.Tx, userID string) error {
+	var count int
+	if err := tx.Get(&count, "SELECT COUNT(*) FROM users WHERE admin AND NOT disabled AND id!=?", userID); err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrLastAdmin
 	}
-	tx.Commit()
-	return
+	return nil
 }
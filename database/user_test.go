@@ -0,0 +1,115 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestInsertFirstUserIsAdmin(t *testing.T) {
+	d := newTestDatabase(t)
+
+	first, err := d.UserRepo.Insert("first", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := d.UserRepo.Insert("second", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Admin || second.Admin {
+		t.Errorf("admin = %v, %v, want true, false", first.Admin, second.Admin)
+	}
+	if err := d.UserRepo.Delete(first.ID); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("delete of last administrator: err = %v, want %v", err, ErrLastAdmin)
+	}
+}
+
+func TestDeleteUserRemovesUserDetails(t *testing.T) {
+	d := newTestDatabase(t)
+
+	if _, err := d.UserRepo.Insert("admin", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	user, err := d.UserRepo.Insert("user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UserDataRepo.Update(user.ID, "item", UserData{Played: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UserDataRepo.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, eventType := range []string{PlaybackStart, PlaybackStop} {
+		event := PlaybackEvent{Type: eventType, UserID: user.ID, ItemID: "item", DeviceID: "device", Completed: true}
+		if err := d.PlaybackHistoryRepo.RecordPlayback(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d.CreatePlaylist(Playlist{UserID: user.ID, Name: "list", ItemIDs: []string{"item"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.UserRepo.Delete(user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"playstate", "playback_history", "playlist", "playlist_item"} {
+		var count int
+		if err := d.dbHandle.Get(&count, "SELECT COUNT(*) FROM "+table); err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("%s has %d rows left", table, count)
+		}
+	}
+	if _, err := d.UserDataRepo.Get(user.ID, "item"); err == nil {
+		t.Error("play state of deleted user still cached")
+	}
+	if stats := d.PlaybackHistoryRepo.GetPlayStats(user.ID, "item"); stats.PlayCount != 0 {
+		t.Errorf("play count of deleted user = %d, want 0", stats.PlayCount)
+	}
+}
+
+func TestGetGuestHasMostRestrictivePolicy(t *testing.T) {
+	d := newTestDatabase(t)
+
+	guest, err := d.UserRepo.GetGuest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !guest.EnableAllFolders || guest.MaxParentalRating != nil || guest.BlockUnratedItems {
+		t.Errorf("guest without users = %+v, want unrestricted", guest)
+	}
+
+	rating := func(score int) *int { return &score }
+	for _, policy := range []User{
+		{Username: "admin", Admin: true, EnableAllFolders: true},
+		{Username: "teen", EnabledFolders: []string{"1", "2", "3"}, MaxParentalRating: rating(13)},
+		{Username: "kid", EnabledFolders: []string{"2", "3", "4"}, MaxParentalRating: rating(7), BlockUnratedItems: true},
+	} {
+		user, err := d.UserRepo.Insert(policy.Username, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		policy.ID = user.ID
+		if err := d.UserRepo.Update(policy); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	guest, err = d.UserRepo.GetGuest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guest.EnableAllFolders || !slices.Equal(guest.EnabledFolders, []string{"2", "3"}) {
+		t.Errorf("guest folders = %v, all %v, want [2 3]", guest.EnabledFolders, guest.EnableAllFolders)
+	}
+	if guest.MaxParentalRating == nil || *guest.MaxParentalRating != 7 {
+		t.Errorf("guest max parental rating = %v, want 7", guest.MaxParentalRating)
+	}
+	if !guest.BlockUnratedItems {
+		t.Error("guest does not block unrated items")
+	}
+}
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"log"
 	"sort"
@@ -85,6 +87,55 @@ func (u *UserDataStorage) Update(userID, itemID string, details UserData) (err e
 	return
 }
 
+// Restore stores play state details of items of a user as-is, keeping their
+// timestamp, e.g. when importing watch history. Details are written to the
+// database immediately as the timestamps are likely older than the last sync.
+func (u *UserDataStorage) Restore(userID string, details map[string]UserData) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.dbHandle == nil {
+		return ErrNoDbHandle
+	}
+
+	tx, err := u.dbHandle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for itemID, value := range details {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO playstate (userid, itemid, position, playedpercentage, played, favorite, timestamp)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			userID, itemID, value.Position, value.PlayedPercentage, value.Played, value.Favorite, value.Timestamp.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for itemID, value := range details {
+		u.userDataEntries[makeKey(userID, itemID)] = value
+	}
+	return nil
+}
+
+// GetAll returns the play state details of all items of a user, keyed by item ID.
+func (u *UserDataStorage) GetAll(userID string) (details map[string]UserData, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	details = make(map[string]UserData)
+	for key, state := range u.userDataEntries {
+		if key.userID == userID {
+			details[key.itemID] = state
+		}
+	}
+	return
+}
+
 // GetFavorites returns all favorite items of a user.
 func (u *UserDataStorage) GetFavorites(userID string) (favoriteItemIDs []string, err error) {
 	u.mu.Lock()
@@ -111,8 +162,9 @@ func (u *UserDataStorage) GetRecentlyWatched(userID string, includeFullyWatched
 
 	for key, state := range u.userDataEntries {
 		if key.userID == userID {
-			// add, if partial watched or fully watched.
-			if (!state.Played && state.PlayedPercentage > 0 && state.PlayedPercentage < 100) || includeFullyWatched {
+			// add, if partial watched or fully watched. Position without percentage
+			// is a resume position of an item of which the duration is unknown.
+			if (!state.Played && (state.PlayedPercentage > 0 || state.Position > 0) && state.PlayedPercentage < 100) || includeFullyWatched {
 				i := resumeItem{
 					itemID:    key.itemID,
 					timestamp: state.Timestamp,
@@ -134,6 +186,57 @@ func (u *UserDataStorage) GetRecentlyWatched(userID string, includeFullyWatched
 	return
 }
 
+// playStateItemIDs returns JSON arrays of the IDs of played, favorite and
+// resumable items of a user, for use in queries with json_each().
+func (u *UserDataStorage) playStateItemIDs(userID string) (played, favorite, resumable string, err error) {
+	u.mu.Lock()
+	var playedIDs, favoriteIDs, resumableIDs []string
+	for key, state := range u.userDataEntries {
+		if key.userID != userID {
+			continue
+		}
+		if state.Played {
+			playedIDs = append(playedIDs, key.itemID)
+		} else if state.Position > 0 {
+			resumableIDs = append(resumableIDs, key.itemID)
+		}
+		if state.Favorite {
+			favoriteIDs = append(favoriteIDs, key.itemID)
+		}
+	}
+	u.mu.Unlock()
+
+	ids := make([]string, 3)
+	for n, itemIDs := range [][]string{playedIDs, favoriteIDs, resumableIDs} {
+		if itemIDs == nil {
+			itemIDs = []string{}
+		}
+		b, err := json.Marshal(itemIDs)
+		if err != nil {
+			return "", "", "", err
+		}
+		ids[n] = string(b)
+	}
+	return ids[0], ids[1], ids[2], nil
+}
+
+// playTimes returns a JSON object with the time of the play state of each
+// item of a user, in microseconds since epoch keyed by item ID, for use in
+// queries with json_each().
+func (u *UserDataStorage) playTimes(userID string) (string, error) {
+	u.mu.Lock()
+	times := make(map[string]int64)
+	for key, state := range u.userDataEntries {
+		if key.userID == userID {
+			times[key.itemID] = state.Timestamp.UnixMicro()
+		}
+	}
+	u.mu.Unlock()
+
+	b, err := json.Marshal(times)
+	return string(b), err
+}
+
 // LoadUserDataFromDB loads UserData table into memory.
 func (u *UserDataStorage) LoadStateFromDB() error {
 	if u.dbHandle == nil {
@@ -210,19 +313,40 @@ func (u *UserDataStorage) writeStateToDB() error {
 	return tx.Commit()
 }
 
-// BackgroundJobs loads state and writes changed play state to database every 3 seconds.
-func (u *UserDataStorage) BackgroundJobs() {
+// BackgroundJobs writes changed play state to database every 10 seconds,
+// until ctx is cancelled.
+func (u *UserDataStorage) BackgroundJobs(ctx context.Context) {
 	if u.dbHandle == nil {
 		log.Fatal(ErrNoDbHandle)
 	}
 
 	u.lastDBSyncTime = time.Now().UTC()
 
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
 	for {
-		if err := u.writeStateToDB(); err != nil {
-			log.Printf("Error writing play state to db: %s\n", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := u.writeStateToDB(); err != nil {
+				log.Printf("Error writing play state to db: %s\n", err)
+			}
+		}
+	}
+}
+
+// Flush writes all changed play state to database.
+func (u *UserDataStorage) Flush() error {
+	return u.writeStateToDB()
+}
+
+// evictUser removes all play state of a user from memory, caller must hold the lock.
+func (u *UserDataStorage) evictUser(userID string) {
+	for key := range u.userDataEntries {
+		if key.userID == userID {
+			delete(u.userDataEntries, key)
 		}
-		time.Sleep(10 * time.Second)
 	}
 }
 
@@ -0,0 +1,22 @@
+package diacritics
+
+import "strings"
+
+// replacer maps common accented letters to their base letter.
+var replacer = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "æ", "ae",
+	"ç", "c",
+	"è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i",
+	"ñ", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "œ", "oe",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+	"ý", "y", "ÿ", "y",
+	"ß", "ss",
+)
+
+// Remove replaces common lowercase accented letters by their base letter,
+// so "amélie" becomes "amelie". Lowercase text first to remove all.
+func Remove(s string) string {
+	return replacer.Replace(s)
+}
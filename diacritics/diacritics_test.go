@@ -0,0 +1,18 @@
+package diacritics
+
+import "testing"
+
+func TestRemove(t *testing.T) {
+	tests := map[string]string{
+		"amélie":          "amelie",
+		"crème brûlée":    "creme brulee",
+		"straße":          "strasse",
+		"smørrebrød":      "smorrebrod",
+		"plain title 123": "plain title 123",
+	}
+	for in, want := range tests {
+		if got := Remove(in); got != want {
+			t.Errorf("Remove(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
@@ -29,6 +32,16 @@ func (w *statusWriter) Write(b []byte) (length int, err error) {
 	return
 }
 
+// Hijack lets a handler take over the connection, e.g. for WebSockets.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection does not support hijacking")
+	}
+	w.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
 // HttpLog calls ServeHTTP with a custom responsewriter that
 // stores the requests status and length so we can log it.
 func HttpLog(handle http.Handler) http.HandlerFunc {
@@ -0,0 +1,207 @@
+// Package importer imports watch history of other media servers such as
+// Jellyfin, Kodi and Plex.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erikbos/jellofin-server/collection"
+	"github.com/erikbos/jellofin-server/database"
+)
+
+// Record types
+const (
+	RecordTypeMovie   = "movie"
+	RecordTypeEpisode = "episode"
+)
+
+// Record is the watch state of a movie or episode read from another media server.
+type Record struct {
+	// User in the source, empty in case the source does not have users
+	User string
+	// Type is either RecordTypeMovie or RecordTypeEpisode
+	Type string
+	// Title of the movie, or of the show in case of an episode
+	Title string
+	// Year of the movie or show, 0 if unknown
+	Year int
+	// SeasonNo and EpisodeNo of an episode
+	SeasonNo  int
+	EpisodeNo int
+	// Path of the video file
+	Path string
+	// ImdbID and TmdbID of the movie or show
+	ImdbID string
+	TmdbID string
+	// Played indicates the item has been fully watched
+	Played bool
+	// Position in seconds to resume playback at
+	Position int
+	// Duration of the video in seconds according to the source, 0 if unknown
+	Duration int
+	// Favorite indicates the item is a favorite of the user
+	Favorite bool
+	// LastPlayed is the time the item was last played, zero if unknown
+	LastPlayed time.Time
+}
+
+// Result holds the outcome of an import.
+type Result struct {
+	// Matched is the number of records matched to an item
+	Matched int
+	// Updated is the number of items of which the play state was updated
+	Updated int
+	// Unmatched holds the records that could not be matched to an item
+	Unmatched []Record
+}
+
+var (
+	ErrUnknownFormat = errors.New("unknown import format")
+)
+
+// Formats lists the supported import formats.
+var Formats = []string{"jellyfin", "kodi", "plex"}
+
+// Read reads watch history records from a file in the given format.
+func Read(format, filename string) ([]Record, error) {
+	switch format {
+	case "jellyfin":
+		return ReadJellyfin(filename)
+	case "kodi":
+		return ReadKodi(filename)
+	case "plex":
+		return ReadPlex(filename)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+}
+
+// String returns a description of the record, used for reporting.
+func (r Record) String() string {
+	s := r.Title
+	if r.Year != 0 {
+		s += fmt.Sprintf(" (%d)", r.Year)
+	}
+	if r.Type == RecordTypeEpisode {
+		s += fmt.Sprintf(" S%02dE%02d", r.SeasonNo, r.EpisodeNo)
+	}
+	if r.Path != "" {
+		s += " [" + r.Path + "]"
+	}
+	return s
+}
+
+// Import matches records to items of the collections and stores their play
+// state for userID. Play state is merged with the existing play state: items
+// are never marked as unplayed or removed as favorite. In case dryRun is true
+// records are matched but no play state is stored.
+func Import(collections *collection.CollectionRepo, userDataRepo database.UserDataRepo,
+	userID string, records []Record, dryRun bool) (result Result, err error) {
+
+	m := newMatcher(collections)
+	updates := make(map[string]database.UserData)
+	for _, r := range records {
+		itemID, duration, found := m.match(r)
+		if !found {
+			result.Unmatched = append(result.Unmatched, r)
+			continue
+		}
+		result.Matched++
+
+		current, ok := updates[itemID]
+		if !ok {
+			current, _ = userDataRepo.Get(userID, itemID)
+		}
+		if updated, changed := mergeUserData(current, r, duration); changed {
+			updates[itemID] = updated
+		}
+	}
+	result.Updated = len(updates)
+
+	if dryRun || len(updates) == 0 {
+		return result, nil
+	}
+	return result, userDataRepo.Restore(userID, updates)
+}
+
+// mergeUserData merges the play state of a record into existing play state.
+// Duration is the duration of the matched item in seconds, in case it is
+// unknown the duration according to the source is used.
+func mergeUserData(current database.UserData, r Record, duration int) (database.UserData, bool) {
+	updated := current
+	if r.Played {
+		updated.Played = true
+		updated.Position = 0
+		updated.PlayedPercentage = 0
+	} else if !current.Played && r.Position > 0 &&
+		(current.Position == 0 || r.LastPlayed.After(current.Timestamp)) {
+		if duration == 0 {
+			duration = r.Duration
+		}
+		updated.Position = r.Position
+		updated.PlayedPercentage = 0
+		if duration > 0 {
+			updated.PlayedPercentage = min(100*r.Position/duration, 99)
+		}
+	}
+	if r.Favorite {
+		updated.Favorite = true
+	}
+	if r.LastPlayed.After(updated.Timestamp) {
+		updated.Timestamp = r.LastPlayed
+	}
+	if updated == current {
+		return current, false
+	}
+	if updated.Timestamp.IsZero() {
+		updated.Timestamp = time.Now().UTC()
+	}
+	return updated, true
+}
+
+// timeLayouts are the date formats used by the media servers we import from.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.9999999Z07:00",
+	"2006-01-02 15:04:05.9999999",
+	"2006-01-02T15:04:05.9999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"01/02/2006 15:04:05",
+	"01/02/2006",
+}
+
+// parseTime parses a date in one of the known formats or as unix timestamp,
+// returns zero time in case the date cannot be parsed.
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		// Unix timestamp, in seconds or milliseconds
+		if n > 1e11 {
+			return time.UnixMilli(n).UTC()
+		}
+		return time.Unix(n, 0).UTC()
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// parseYear returns the year of a date such as "2001-04-25", 0 if unknown.
+func parseYear(s string) int {
+	s = strings.TrimSpace(s)
+	if len(s) < 4 {
+		return 0
+	}
+	year, _ := strconv.Atoi(s[:4])
+	return year
+}
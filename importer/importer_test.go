@@ -0,0 +1,110 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/erikbos/jellofin-server/database"
+)
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2024, 3, 9, 20, 15, 30, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{in: "2024-03-09T20:15:30Z", want: want},
+		{in: "2024-03-09T21:15:30+01:00", want: want},
+		{in: "2024-03-09 20:15:30.0000000Z", want: want},
+		{in: "2024-03-09 20:15:30", want: want},
+		{in: "2024-03-09T20:15:30.0000000", want: want},
+		{in: "2024-03-09 20:15", want: want.Add(-30 * time.Second)},
+		{in: "2024-03-09", want: time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)},
+		{in: "03/09/2024 20:15:30", want: want},
+		{in: " 1710015330 ", want: want},
+		{in: "1710015330000", want: want},
+		{in: "", want: time.Time{}},
+		{in: "yesterday", want: time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := parseTime(tt.in); !got.Equal(tt.want) {
+			t.Errorf("parseTime(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMergeUserData(t *testing.T) {
+	earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := earlier.Add(24 * time.Hour)
+
+	tests := []struct {
+		name        string
+		current     database.UserData
+		record      Record
+		duration    int
+		want        database.UserData
+		wantChanged bool
+	}{
+		{
+			name:        "played",
+			current:     database.UserData{Position: 600, PlayedPercentage: 10, Timestamp: earlier},
+			record:      Record{Played: true, LastPlayed: later},
+			want:        database.UserData{Played: true, Timestamp: later},
+			wantChanged: true,
+		},
+		{
+			name:        "resume position with duration of item",
+			record:      Record{Position: 1800, Duration: 7200, LastPlayed: later},
+			duration:    3600,
+			want:        database.UserData{Position: 1800, PlayedPercentage: 50, Timestamp: later},
+			wantChanged: true,
+		},
+		{
+			name:        "resume position with duration of source",
+			record:      Record{Position: 1800, Duration: 7200, LastPlayed: later},
+			want:        database.UserData{Position: 1800, PlayedPercentage: 25, Timestamp: later},
+			wantChanged: true,
+		},
+		{
+			name:        "resume position without duration",
+			record:      Record{Position: 1800, LastPlayed: later},
+			want:        database.UserData{Position: 1800, Timestamp: later},
+			wantChanged: true,
+		},
+		{
+			name:        "resume position at end is not played",
+			record:      Record{Position: 3600, LastPlayed: later},
+			duration:    3600,
+			want:        database.UserData{Position: 3600, PlayedPercentage: 99, Timestamp: later},
+			wantChanged: true,
+		},
+		{
+			name:     "older resume position is ignored",
+			current:  database.UserData{Position: 600, PlayedPercentage: 10, Timestamp: later},
+			record:   Record{Position: 1800, LastPlayed: earlier},
+			duration: 6000,
+			want:     database.UserData{Position: 600, PlayedPercentage: 10, Timestamp: later},
+		},
+		{
+			name:    "played item is not marked unplayed",
+			current: database.UserData{Played: true, Timestamp: later},
+			record:  Record{Position: 1800, LastPlayed: earlier},
+			want:    database.UserData{Played: true, Timestamp: later},
+		},
+		{
+			name:        "favorite",
+			current:     database.UserData{Timestamp: earlier},
+			record:      Record{Favorite: true},
+			want:        database.UserData{Favorite: true, Timestamp: earlier},
+			wantChanged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := mergeUserData(tt.current, tt.record, tt.duration)
+			if got != tt.want || changed != tt.wantChanged {
+				t.Errorf("mergeUserData() = %+v, %v, want %+v, %v", got, changed, tt.want, tt.wantChanged)
+			}
+		})
+	}
+}
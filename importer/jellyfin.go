@@ -0,0 +1,80 @@
+package importer
+
+import (
+	"errors"
+)
+
+var (
+	ErrJellyfinUnknownDatabase = errors.New("not a Jellyfin library.db or jellyfin.db database")
+)
+
+// Jellyfin item types
+const (
+	jellyfinTypeMovie   = "MediaBrowser.Controller.Entities.Movies.Movie"
+	jellyfinTypeEpisode = "MediaBrowser.Controller.Entities.TV.Episode"
+	jellyfinTypeSeries  = "MediaBrowser.Controller.Entities.TV.Series"
+)
+
+// jellyfinLibraryQuery reads watch state from library.db as used by Jellyfin 10.10
+// and older. Users are identified by their internal ID.
+const jellyfinLibraryQuery = `SELECT
+	CASE t.type WHEN '` + jellyfinTypeMovie + `' THEN 'movie' ELSE 'episode' END AS type,
+	CASE t.type WHEN '` + jellyfinTypeMovie + `' THEN COALESCE(t.Name, '') ELSE COALESCE(t.SeriesName, '') END AS title,
+	CAST(COALESCE(CASE t.type WHEN '` + jellyfinTypeMovie + `' THEN t.ProductionYear ELSE s.ProductionYear END, '') AS TEXT) AS year,
+	COALESCE(t.Path, '') AS path,
+	COALESCE(CASE t.type WHEN '` + jellyfinTypeMovie + `' THEN t.ProviderIds ELSE s.ProviderIds END, '') AS providerids,
+	COALESCE(t.ParentIndexNumber, 0) AS seasonno,
+	COALESCE(t.IndexNumber, 0) AS episodeno,
+	CAST(u.userId AS TEXT) AS user,
+	COALESCE(u.playCount, 0) AS playcount,
+	COALESCE(u.played, 0) AS played,
+	COALESCE(u.isFavorite, 0) AS favorite,
+	CAST(COALESCE(u.playbackPositionTicks, 0) / 10000000 AS INTEGER) AS position,
+	CAST(COALESCE(t.RunTimeTicks, 0) / 10000000 AS INTEGER) AS duration,
+	CAST(COALESCE(u.lastPlayedDate, '') AS TEXT) AS lastplayed
+FROM UserDatas u
+JOIN TypedBaseItems t ON t.UserDataKey = u.key
+LEFT JOIN TypedBaseItems s ON s.PresentationUniqueKey = t.SeriesPresentationUniqueKey AND s.type = '` + jellyfinTypeSeries + `'
+WHERE t.type IN ('` + jellyfinTypeMovie + `', '` + jellyfinTypeEpisode + `')`
+
+// jellyfinProviderIDs returns provider IDs of an item in BaseItemProviders as "Imdb=tt0083658|Tmdb=78".
+const jellyfinProviderIDs = `(SELECT group_concat(p.ProviderId || '=' || p.ProviderValue, '|') FROM BaseItemProviders p WHERE p.ItemId = `
+
+// jellyfinQuery reads watch state from jellyfin.db as used by Jellyfin 10.11 and newer.
+const jellyfinQuery = `SELECT
+	CASE t.Type WHEN '` + jellyfinTypeMovie + `' THEN 'movie' ELSE 'episode' END AS type,
+	CASE t.Type WHEN '` + jellyfinTypeMovie + `' THEN COALESCE(t.Name, '') ELSE COALESCE(t.SeriesName, '') END AS title,
+	CAST(COALESCE(CASE t.Type WHEN '` + jellyfinTypeMovie + `' THEN t.ProductionYear ELSE s.ProductionYear END, '') AS TEXT) AS year,
+	COALESCE(t.Path, '') AS path,
+	COALESCE(CASE t.Type WHEN '` + jellyfinTypeMovie + `' THEN ` + jellyfinProviderIDs + `t.Id) ELSE ` + jellyfinProviderIDs + `t.SeriesId) END, '') AS providerids,
+	COALESCE(t.ParentIndexNumber, 0) AS seasonno,
+	COALESCE(t.IndexNumber, 0) AS episodeno,
+	COALESCE(us.Username, u.UserId) AS user,
+	COALESCE(u.PlayCount, 0) AS playcount,
+	COALESCE(u.Played, 0) AS played,
+	COALESCE(u.IsFavorite, 0) AS favorite,
+	CAST(COALESCE(u.PlaybackPositionTicks, 0) / 10000000 AS INTEGER) AS position,
+	CAST(COALESCE(t.RunTimeTicks, 0) / 10000000 AS INTEGER) AS duration,
+	CAST(COALESCE(u.LastPlayedDate, '') AS TEXT) AS lastplayed
+FROM UserData u
+JOIN BaseItems t ON t.Id = u.ItemId
+LEFT JOIN BaseItems s ON s.Id = t.SeriesId
+LEFT JOIN Users us ON us.Id = u.UserId
+WHERE t.Type IN ('` + jellyfinTypeMovie + `', '` + jellyfinTypeEpisode + `')`
+
+// ReadJellyfin reads watch state of all users from a Jellyfin library.db or jellyfin.db database.
+func ReadJellyfin(filename string) ([]Record, error) {
+	db, err := openSQLite(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	switch {
+	case hasTables(db, "UserData", "BaseItems"):
+		return readRows(db, jellyfinQuery)
+	case hasTables(db, "UserDatas", "TypedBaseItems"):
+		return readRows(db, jellyfinLibraryQuery)
+	}
+	return nil, ErrJellyfinUnknownDatabase
+}
@@ -0,0 +1,74 @@
+package importer
+
+import (
+	"errors"
+)
+
+var (
+	ErrKodiUnknownDatabase = errors.New("not a Kodi MyVideos database")
+)
+
+// kodiUniqueIDs returns provider IDs of a movie or show as "imdb=tt0083658|tmdb=78".
+const kodiUniqueIDs = `(SELECT group_concat(u.type || '=' || u.value, '|') FROM uniqueid u WHERE `
+
+// kodiBookmark returns the resume position of a file in seconds.
+const kodiBookmark = `COALESCE((SELECT CAST(b.timeInSeconds AS INTEGER) FROM bookmark b WHERE b.idFile = f.idFile AND b.type = 1 LIMIT 1), 0)`
+
+// kodiDuration returns the duration of a file in seconds as stored with its resume position.
+const kodiDuration = `COALESCE((SELECT CAST(b.totalTimeInSeconds AS INTEGER) FROM bookmark b WHERE b.idFile = f.idFile AND b.type = 1 LIMIT 1), 0)`
+
+// kodiQuery reads watch state of movies and episodes from a Kodi MyVideos database.
+// Titles are stored in column c00, season and episode number of episodes in
+// c12 and c13 and premiere date of shows in c05.
+const kodiQuery = `SELECT
+	'movie' AS type,
+	COALESCE(m.c00, '') AS title,
+	COALESCE(m.premiered, '') AS year,
+	COALESCE(p.strPath, '') || COALESCE(f.strFilename, '') AS path,
+	COALESCE(` + kodiUniqueIDs + `u.media_id = m.idMovie AND u.media_type = 'movie'), '') AS providerids,
+	0 AS seasonno,
+	0 AS episodeno,
+	'' AS user,
+	COALESCE(f.playCount, 0) AS playcount,
+	0 AS played,
+	0 AS favorite,
+	` + kodiBookmark + ` AS position,
+	` + kodiDuration + ` AS duration,
+	COALESCE(f.lastPlayed, '') AS lastplayed
+FROM movie m
+JOIN files f ON f.idFile = m.idFile
+LEFT JOIN path p ON p.idPath = f.idPath
+UNION ALL SELECT
+	'episode' AS type,
+	COALESCE(s.c00, '') AS title,
+	COALESCE(s.c05, '') AS year,
+	COALESCE(p.strPath, '') || COALESCE(f.strFilename, '') AS path,
+	COALESCE(` + kodiUniqueIDs + `u.media_id = s.idShow AND u.media_type = 'tvshow'), '') AS providerids,
+	CAST(COALESCE(e.c12, 0) AS INTEGER) AS seasonno,
+	CAST(COALESCE(e.c13, 0) AS INTEGER) AS episodeno,
+	'' AS user,
+	COALESCE(f.playCount, 0) AS playcount,
+	0 AS played,
+	0 AS favorite,
+	` + kodiBookmark + ` AS position,
+	` + kodiDuration + ` AS duration,
+	COALESCE(f.lastPlayed, '') AS lastplayed
+FROM episode e
+JOIN tvshow s ON s.idShow = e.idShow
+JOIN files f ON f.idFile = e.idFile
+LEFT JOIN path p ON p.idPath = f.idPath`
+
+// ReadKodi reads watch state from a Kodi MyVideosNN.db database. Kodi does not
+// have users, favorites are not stored in the video database.
+func ReadKodi(filename string) ([]Record, error) {
+	db, err := openSQLite(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if !hasTables(db, "files", "path", "bookmark", "movie", "episode", "tvshow", "uniqueid") {
+		return nil, ErrKodiUnknownDatabase
+	}
+	return readRows(db, kodiQuery)
+}
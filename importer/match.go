@@ -0,0 +1,224 @@
+package importer
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/erikbos/jellofin-server/collection"
+	"github.com/erikbos/jellofin-server/diacritics"
+)
+
+// matcher matches records to items of the collections.
+type matcher struct {
+	movies titleIndex
+	shows  titleIndex
+	// movieFiles and episodeFiles map lowercase filenames of videos to movies and episodes
+	movieFiles   map[string]*collection.Item
+	episodeFiles map[string]*collection.Episode
+}
+
+// titleIndex indexes movies or shows by provider ID and title.
+type titleIndex struct {
+	// byProviderID maps e.g. "imdb:tt0083658" to an item
+	byProviderID map[string]*collection.Item
+	// byTitleYear maps normalized title and year to an item
+	byTitleYear map[string]*collection.Item
+	// byTitle maps normalized title to an item, nil in case title is not unique
+	byTitle map[string]*collection.Item
+}
+
+// titleYear matches the year in a directory name such as "Blade Runner (1982)"
+var titleYear = regexp.MustCompile(`^(.*) \(([0-9]{4})\)$`)
+
+func newTitleIndex() titleIndex {
+	return titleIndex{
+		byProviderID: make(map[string]*collection.Item),
+		byTitleYear:  make(map[string]*collection.Item),
+		byTitle:      make(map[string]*collection.Item),
+	}
+}
+
+// newMatcher builds an index of all movies, shows and episodes.
+func newMatcher(collections *collection.CollectionRepo) *matcher {
+	m := &matcher{
+		movies:       newTitleIndex(),
+		shows:        newTitleIndex(),
+		movieFiles:   make(map[string]*collection.Item),
+		episodeFiles: make(map[string]*collection.Episode),
+	}
+	for _, c := range collections.GetCollections() {
+		for _, i := range c.Items {
+			switch i.Type {
+			case collection.ItemTypeMovie:
+				m.movies.add(i)
+				m.movieFiles[videoFilename(i.Video)] = i
+			case collection.ItemTypeShow:
+				m.shows.add(i)
+				for _, s := range i.Seasons {
+					for k := range s.Episodes {
+						m.episodeFiles[videoFilename(s.Episodes[k].Video)] = &s.Episodes[k]
+					}
+				}
+			}
+		}
+	}
+	return m
+}
+
+// add indexes an item by its provider IDs, title and year.
+func (t *titleIndex) add(i *collection.Item) {
+	i.LoadNfo()
+
+	title, year := i.Name, i.Year
+	if s := titleYear.FindStringSubmatch(i.Name); s != nil {
+		title = s[1]
+		if year == 0 {
+			year, _ = strconv.Atoi(s[2])
+		}
+	}
+	titles := []string{title}
+	if i.Nfo != nil {
+		for _, id := range i.Nfo.UniqueIDs {
+			if key := providerKey(id.Type, id.Value); key != "" {
+				t.byProviderID[key] = i
+			}
+		}
+		if strings.HasPrefix(i.Nfo.Id, "tt") {
+			t.byProviderID[providerKey("imdb", i.Nfo.Id)] = i
+		}
+		titles = append(titles, i.Nfo.Title, i.Nfo.OTitle)
+	}
+
+	for _, title := range titles {
+		title = normalizeTitle(title)
+		if title == "" {
+			continue
+		}
+		t.byTitleYear[title+"|"+strconv.Itoa(year)] = i
+		if other, found := t.byTitle[title]; found && other != i {
+			t.byTitle[title] = nil
+		} else {
+			t.byTitle[title] = i
+		}
+	}
+}
+
+// findByProviderID looks up an item by IMDb or TMDB ID.
+func (t *titleIndex) findByProviderID(r Record) *collection.Item {
+	for _, key := range []string{providerKey("imdb", r.ImdbID), providerKey("tmdb", r.TmdbID)} {
+		if i := t.byProviderID[key]; key != "" && i != nil {
+			return i
+		}
+	}
+	return nil
+}
+
+// findByTitle looks up an item by title and year. In case allowTitleOnly is
+// true, or the year is unknown, an item with a unique matching title is returned.
+func (t *titleIndex) findByTitle(r Record, allowTitleOnly bool) *collection.Item {
+	title := normalizeTitle(r.Title)
+	if title == "" {
+		return nil
+	}
+	if i := t.byTitleYear[title+"|"+strconv.Itoa(r.Year)]; i != nil {
+		return i
+	}
+	if allowTitleOnly || r.Year == 0 {
+		return t.byTitle[title]
+	}
+	return nil
+}
+
+// match returns the item ID and duration of the movie or episode a record
+// refers to. Records are matched by provider ID, by filename and finally by
+// title and year.
+func (m *matcher) match(r Record) (itemID string, duration int, found bool) {
+	switch r.Type {
+	case RecordTypeMovie:
+		if i := m.movies.findByProviderID(r); i != nil {
+			return i.ID, i.Duration(), true
+		}
+		if i := m.movieFiles[videoFilename(r.Path)]; i != nil && r.Path != "" {
+			return i.ID, i.Duration(), true
+		}
+		if i := m.movies.findByTitle(r, false); i != nil {
+			return i.ID, i.Duration(), true
+		}
+	case RecordTypeEpisode:
+		if show := m.shows.findByProviderID(r); show != nil {
+			if e := findEpisode(show, r.SeasonNo, r.EpisodeNo); e != nil {
+				return e.ID, e.Duration(), true
+			}
+		}
+		if e := m.episodeFiles[videoFilename(r.Path)]; e != nil && r.Path != "" {
+			return e.ID, e.Duration(), true
+		}
+		// Year of an episode is often the year it aired, not the year of the show
+		if show := m.shows.findByTitle(r, true); show != nil {
+			if e := findEpisode(show, r.SeasonNo, r.EpisodeNo); e != nil {
+				return e.ID, e.Duration(), true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// findEpisode returns an episode of a show by season and episode number.
+func findEpisode(show *collection.Item, seasonNo, episodeNo int) *collection.Episode {
+	for _, s := range show.Seasons {
+		if s.SeasonNo != seasonNo {
+			continue
+		}
+		for i := range s.Episodes {
+			if s.Episodes[i].EpisodeNo == episodeNo {
+				return &s.Episodes[i]
+			}
+		}
+	}
+	return nil
+}
+
+// providerKey returns the index key of a provider ID, e.g. "imdb:tt0083658".
+func providerKey(provider, id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if id == "" || id == "0" {
+		return ""
+	}
+	switch strings.ToLower(provider) {
+	case "imdb":
+		return "imdb:" + id
+	case "tmdb", "themoviedb":
+		return "tmdb:" + id
+	}
+	return ""
+}
+
+// videoFilename returns the lowercase filename of a video path, which can be
+// an escaped path, a unix path or a windows path.
+func videoFilename(p string) string {
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		p = unescaped
+	}
+	p = strings.ReplaceAll(p, `\`, "/")
+	return strings.ToLower(path.Base(p))
+}
+
+// normalizeTitle lowercases a title, removes diacritics, punctuation and
+// spaces and a leading article, so "The Amélie!" and "amelie" are equal.
+func normalizeTitle(title string) string {
+	title = diacritics.Remove(strings.ReplaceAll(strings.ToLower(strings.TrimSpace(title)), "&", "and"))
+	for _, article := range []string{"the ", "a ", "an "} {
+		title = strings.TrimPrefix(title, article)
+	}
+	var b strings.Builder
+	for _, c := range title {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
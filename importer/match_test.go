@@ -0,0 +1,64 @@
+package importer
+
+import "testing"
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "Blade Runner", want: "bladerunner"},
+		{in: "The Amélie!", want: "amelie"},
+		{in: "  amelie ", want: "amelie"},
+		{in: "A Beautiful Mind", want: "beautifulmind"},
+		{in: "An Education", want: "education"},
+		{in: "Fast & Furious", want: "fastandfurious"},
+		{in: "Léon: The Professional", want: "leontheprofessional"},
+		{in: "2001: A Space Odyssey", want: "2001aspaceodyssey"},
+		{in: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeTitle(tt.in); got != tt.want {
+			t.Errorf("normalizeTitle(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVideoFilename(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "/media/movies/Blade Runner (1982)/Blade Runner (1982).mkv", want: "blade runner (1982).mkv"},
+		{in: `D:\Movies\Blade Runner (1982)\Blade Runner (1982).mkv`, want: "blade runner (1982).mkv"},
+		{in: "Blade%20Runner%20%281982%29/Blade%20Runner%20%281982%29.mkv", want: "blade runner (1982).mkv"},
+		{in: "smb://nas/movies/Amelie.mp4", want: "amelie.mp4"},
+		{in: "100%.mkv", want: "100%.mkv"},
+	}
+	for _, tt := range tests {
+		if got := videoFilename(tt.in); got != tt.want {
+			t.Errorf("videoFilename(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestProviderKey(t *testing.T) {
+	tests := []struct {
+		provider string
+		id       string
+		want     string
+	}{
+		{provider: "imdb", id: "tt0083658", want: "imdb:tt0083658"},
+		{provider: "Imdb", id: " TT0083658 ", want: "imdb:tt0083658"},
+		{provider: "tmdb", id: "78", want: "tmdb:78"},
+		{provider: "themoviedb", id: "78", want: "tmdb:78"},
+		{provider: "tmdb", id: "0", want: ""},
+		{provider: "imdb", id: "", want: ""},
+		{provider: "tvdb", id: "12345", want: ""},
+	}
+	for _, tt := range tests {
+		if got := providerKey(tt.provider, tt.id); got != tt.want {
+			t.Errorf("providerKey(%q, %q) = %q, want %q", tt.provider, tt.id, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrPlexNoTitleColumn = errors.New("CSV file does not have a title column")
+)
+
+// plexColumns maps normalized CSV column names, as used by the various Plex
+// export tools, to the record field they hold.
+var plexColumns = map[string]string{
+	"type":             "type",
+	"mediatype":        "type",
+	"librarytype":      "type",
+	"title":            "title",
+	"movietitle":       "title",
+	"grandparenttitle": "show",
+	"show":             "show",
+	"showtitle":        "show",
+	"series":           "show",
+	"seriestitle":      "show",
+	"year":             "year",
+	"season":           "season",
+	"seasonnumber":     "season",
+	"parentindex":      "season",
+	"episode":          "episode",
+	"episodenumber":    "episode",
+	"index":            "episode",
+	"file":             "path",
+	"path":             "path",
+	"filepath":         "path",
+	"partfile":         "path",
+	"mediapartfile":    "path",
+	"location":         "path",
+	"imdb":             "imdb",
+	"imdbid":           "imdb",
+	"tmdb":             "tmdb",
+	"tmdbid":           "tmdb",
+	"guid":             "guid",
+	"guids":            "guid",
+	"viewcount":        "viewcount",
+	"playcount":        "viewcount",
+	"views":            "viewcount",
+	"watched":          "watched",
+	"played":           "watched",
+	"viewoffset":       "viewoffset",
+	"duration":         "duration",
+	"lastviewedat":     "lastviewed",
+	"lastviewed":       "lastviewed",
+	"lastplayed":       "lastviewed",
+	"user":             "user",
+	"username":         "user",
+}
+
+// ReadPlex reads watch state from a CSV export of a Plex library. The first
+// line should hold column names, e.g. "Type,Title,Year,Show,Season,Episode,
+// File,GUID,View Count,View Offset,Duration,Last Viewed At". View Offset and
+// Duration are in milliseconds.
+// For episodes Title can hold the episode title in case Show is present.
+func ReadPlex(filename string) ([]Record, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for index, name := range header {
+		if field, ok := plexColumns[normalizeColumnName(name)]; ok {
+			if _, exists := columns[field]; !exists {
+				columns[field] = index
+			}
+		}
+	}
+	if _, ok := columns["title"]; !ok {
+		if _, ok := columns["show"]; !ok {
+			return nil, ErrPlexNoTitleColumn
+		}
+	}
+
+	var records []Record
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(field string) string {
+			if index, ok := columns[field]; ok && index < len(line) {
+				return strings.TrimSpace(line[index])
+			}
+			return ""
+		}
+
+		r := Record{
+			User:       value("user"),
+			Title:      value("title"),
+			Year:       parseYear(value("year")),
+			Path:       value("path"),
+			ImdbID:     value("imdb"),
+			TmdbID:     value("tmdb"),
+			LastPlayed: parseTime(value("lastviewed")),
+		}
+		parsePlexGUIDs(value("guid"), &r)
+
+		r.Type = RecordTypeMovie
+		switch strings.ToLower(value("type")) {
+		case "episode", "show", "tv", "series":
+			r.Type = RecordTypeEpisode
+		case "":
+			if value("show") != "" || value("season") != "" {
+				r.Type = RecordTypeEpisode
+			}
+		}
+		if r.Type == RecordTypeEpisode {
+			if show := value("show"); show != "" {
+				r.Title = show
+			}
+			r.SeasonNo, _ = strconv.Atoi(value("season"))
+			r.EpisodeNo, _ = strconv.Atoi(value("episode"))
+		}
+
+		viewCount, _ := strconv.Atoi(value("viewcount"))
+		watched := strings.ToLower(value("watched"))
+		r.Played = viewCount > 0 || watched == "yes" || watched == "true" || watched == "1"
+		if offset, err := strconv.Atoi(value("viewoffset")); err == nil {
+			r.Position = offset / 1000
+		}
+		if duration, err := strconv.Atoi(value("duration")); err == nil {
+			r.Duration = duration / 1000
+		}
+		if r.Played || r.Position > 0 {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// parsePlexGUIDs sets provider IDs from Plex GUIDs such as "imdb://tt0083658",
+// multiple GUIDs can be separated by spaces, commas or semicolons.
+func parsePlexGUIDs(guids string, r *Record) {
+	for _, guid := range strings.FieldsFunc(guids, func(c rune) bool {
+		return c == ' ' || c == ',' || c == ';' || c == '|'
+	}) {
+		provider, id, found := strings.Cut(guid, "://")
+		if !found {
+			continue
+		}
+		// Legacy agents append a language, e.g. "com.plexapp.agents.imdb://tt0083658?lang=en"
+		id, _, _ = strings.Cut(id, "?")
+		switch {
+		case strings.HasSuffix(provider, "imdb"):
+			r.ImdbID = id
+		case strings.HasSuffix(provider, "tmdb"), strings.HasSuffix(provider, "themoviedb"):
+			r.TmdbID = id
+		}
+	}
+}
+
+// normalizeColumnName lowercases a column name and removes spaces and punctuation.
+func normalizeColumnName(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
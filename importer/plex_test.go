@@ -0,0 +1,56 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParsePlexGUIDs(t *testing.T) {
+	tests := []struct {
+		guids    string
+		wantImdb string
+		wantTmdb string
+	}{
+		{guids: "imdb://tt0083658", wantImdb: "tt0083658"},
+		{guids: "imdb://tt0083658 tmdb://78", wantImdb: "tt0083658", wantTmdb: "78"},
+		{guids: "imdb://tt0083658,tmdb://78;tvdb://5", wantImdb: "tt0083658", wantTmdb: "78"},
+		{guids: "com.plexapp.agents.imdb://tt0083658?lang=en", wantImdb: "tt0083658"},
+		{guids: "com.plexapp.agents.themoviedb://78?lang=en", wantTmdb: "78"},
+		{guids: "plex://movie/5d776825880197001ec967c6"},
+		{guids: "tt0083658"},
+		{guids: ""},
+	}
+	for _, tt := range tests {
+		var r Record
+		parsePlexGUIDs(tt.guids, &r)
+		if r.ImdbID != tt.wantImdb || r.TmdbID != tt.wantTmdb {
+			t.Errorf("parsePlexGUIDs(%q) = %q, %q, want %q, %q", tt.guids, r.ImdbID, r.TmdbID, tt.wantImdb, tt.wantTmdb)
+		}
+	}
+}
+
+func TestReadPlex(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "plex.csv")
+	csv := "Type,Title,Year,Show,Season,Episode,GUID,View Count,View Offset,Duration,Last Viewed At\n" +
+		"movie,Blade Runner,1982,,,,imdb://tt0083658,1,0,7020000,2024-03-09 20:15:30\n" +
+		"episode,Pilot,,The Wire,1,1,,0,1800000,3600000,\n" +
+		"movie,Unwatched,2001,,,,,0,0,5400000,\n"
+	if err := os.WriteFile(filename, []byte(csv), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	records, err := ReadPlex(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Type: RecordTypeMovie, Title: "Blade Runner", Year: 1982, ImdbID: "tt0083658", Played: true,
+			Duration: 7020, LastPlayed: time.Date(2024, 3, 9, 20, 15, 30, 0, time.UTC)},
+		{Type: RecordTypeEpisode, Title: "The Wire", SeasonNo: 1, EpisodeNo: 1, Position: 1800, Duration: 3600},
+	}
+	if !slices.Equal(records, want) {
+		t.Errorf("records = %+v, want %+v", records, want)
+	}
+}
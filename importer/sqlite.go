@@ -0,0 +1,87 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sourceRow is a row of watch state read from the database of another media server.
+type sourceRow struct {
+	Type  string `db:"type"`
+	Title string `db:"title"`
+	Year  string `db:"year"`
+	Path  string `db:"path"`
+	// ProviderIDs of the movie or show, e.g. "Imdb=tt0083658|Tmdb=78"
+	ProviderIDs string `db:"providerids"`
+	SeasonNo    int    `db:"seasonno"`
+	EpisodeNo   int    `db:"episodeno"`
+	User        string `db:"user"`
+	PlayCount   int    `db:"playcount"`
+	Played      bool   `db:"played"`
+	Favorite    bool   `db:"favorite"`
+	Position    int    `db:"position"`
+	Duration    int    `db:"duration"`
+	LastPlayed  string `db:"lastplayed"`
+}
+
+// openSQLite opens the SQLite database of another media server read-only.
+func openSQLite(filename string) (*sqlx.DB, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, err
+	}
+	return sqlx.Connect("sqlite3", "file:"+filename+"?mode=ro")
+}
+
+// hasTables returns true in case all tables exist in the database.
+func hasTables(db *sqlx.DB, tables ...string) bool {
+	for _, table := range tables {
+		var count int
+		if err := db.Get(&count, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?", table); err != nil || count == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// readRows runs a query returning sourceRows and converts them into records.
+// Rows without any play state are skipped.
+func readRows(db *sqlx.DB, query string) ([]Record, error) {
+	var rows []sourceRow
+	if err := db.Select(&rows, query); err != nil {
+		return nil, fmt.Errorf("reading watch state: %w", err)
+	}
+	records := make([]Record, 0, len(rows))
+	for _, row := range rows {
+		r := Record{
+			User:       row.User,
+			Type:       row.Type,
+			Title:      strings.TrimSpace(row.Title),
+			Year:       parseYear(row.Year),
+			SeasonNo:   row.SeasonNo,
+			EpisodeNo:  row.EpisodeNo,
+			Path:       row.Path,
+			Played:     row.Played || row.PlayCount > 0,
+			Position:   row.Position,
+			Duration:   row.Duration,
+			Favorite:   row.Favorite,
+			LastPlayed: parseTime(row.LastPlayed),
+		}
+		for _, id := range strings.Split(row.ProviderIDs, "|") {
+			provider, value, _ := strings.Cut(id, "=")
+			switch strings.ToLower(provider) {
+			case "imdb":
+				r.ImdbID = value
+			case "tmdb":
+				r.TmdbID = value
+			}
+		}
+		if r.Played || r.Position > 0 || r.Favorite {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
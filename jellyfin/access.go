@@ -0,0 +1,69 @@
+package jellyfin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/erikbos/jellofin-server/collection"
+	"github.com/erikbos/jellofin-server/database"
+)
+
+// collectionAllowed returns true if the user has access to the collection
+func collectionAllowed(user *database.User, c *collection.Collection) bool {
+	return user != nil && c != nil && user.CollectionAllowed(CollectionIDToString(c.ID))
+}
+
+// itemAllowed returns true if the user has access to an item of a collection
+// and is allowed to watch it based upon its parental rating
+func itemAllowed(user *database.User, c *collection.Collection, i *collection.Item) bool {
+	return i != nil && collectionAllowed(user, c) && user.ParentalRatingAllowed(i.ParentalRatingScore())
+}
+
+// userItemFilter returns a filter that allows items the user has access to.
+func userItemFilter(user *database.User) func(c *collection.Collection, i *collection.Item) bool {
+	return func(c *collection.Collection, i *collection.Item) bool {
+		return itemAllowed(user, c, i)
+	}
+}
+
+// itemIDAllowed returns true if the user has access to the collection, item,
+// season or episode with the provided ID. Unknown items are not allowed,
+// favorites, playlists and other virtual items are.
+func (j *Jellyfin) itemIDAllowed(user *database.User, itemID string) bool {
+	switch {
+	case strings.HasPrefix(itemID, itemprefix_collection):
+		return collectionAllowed(user, j.collections.GetCollection(trimPrefix(itemID)))
+	case strings.HasPrefix(itemID, itemprefix_season):
+		c, i, _ := j.collections.GetSeasonByID(trimPrefix(itemID))
+		return itemAllowed(user, c, i)
+	case strings.HasPrefix(itemID, itemprefix_episode):
+		c, i, _, _ := j.collections.GetEpisodeByID(trimPrefix(itemID))
+		return itemAllowed(user, c, i)
+	case strings.Contains(itemID, itemprefix_separator):
+		return user != nil
+	}
+	if c, i := j.collections.GetItemByID(itemID); i != nil {
+		return itemAllowed(user, c, i)
+	}
+	// Episodes are also referred to without prefix, e.g. in userdata
+	c, i, _, _ := j.collections.GetEpisodeByID(itemID)
+	return itemAllowed(user, c, i)
+}
+
+// getOptionalUserDetails returns the user of a request to an endpoint that does not
+// require authentication. Requests without valid access token get the guest user,
+// which holds the most restrictive policy of all users. Returns nil on error.
+func (j *Jellyfin) getOptionalUserDetails(r *http.Request) *database.User {
+	if token, found := j.getRequestToken(r); found {
+		if tokendetails, err := j.db.AccessTokenRepo.Get(token); err == nil {
+			if user, err := j.db.UserRepo.GetByID(tokendetails.UserID); err == nil {
+				return user
+			}
+		}
+	}
+	guest, err := j.db.UserRepo.GetGuest()
+	if err != nil {
+		return nil
+	}
+	return guest
+}
@@ -25,6 +25,9 @@ type contextKey string
 const (
 	// Context key holding access token details within a request
 	contextAccessTokenDetails contextKey = "AccessTokenDetails"
+	contextSessionDetails     contextKey = "SessionDetails"
+	// Context key holding details of the authenticated user within a request
+	contextUserDetails contextKey = "UserDetails"
 )
 
 // curl -v 'http://127.0.0.1:9090/Users/2b1ec0a52b09456c9823a367d84ac9e5/Views?IncludeExternalContent=false'
@@ -38,8 +41,16 @@ func (j *Jellyfin) usersViewsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	items := make([]JFItem, 0)
 	for _, c := range j.collections.GetCollections() {
+		if !collectionAllowed(user, &c) {
+			continue
+		}
 		if item, err := j.makeJItemCollection(CollectionIDToString(c.ID)); err == nil {
 			items = append(items, item)
 		}
@@ -55,6 +66,16 @@ func (j *Jellyfin) usersViewsHandler(w http.ResponseWriter, r *http.Request) {
 		items = append(items, playlistCollection)
 	}
 
+	// Views ordered by the user come first, in their order
+	orderedViews := user.Configuration.OrderedViews
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := slices.Index(orderedViews, items[i].ID), slices.Index(orderedViews, items[j].ID)
+		if a == -1 || b == -1 {
+			return a > b
+		}
+		return a < b
+	})
+
 	response := JFUserViewsResponse{
 		Items:            items,
 		TotalRecordCount: len(items),
@@ -65,8 +86,16 @@ func (j *Jellyfin) usersViewsHandler(w http.ResponseWriter, r *http.Request) {
 
 // curl -v http://127.0.0.1:9090/Users/2b1ec0a52b09456c9823a367d84ac9e5/GroupingOptions
 func (j *Jellyfin) usersGroupingOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	collections := []JFCollection{}
 	for _, c := range j.collections.GetCollections() {
+		if !collectionAllowed(user, &c) {
+			continue
+		}
 		collectionItem, err := j.makeJItemCollection(CollectionIDToString(c.ID))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -89,8 +118,16 @@ func (j *Jellyfin) usersItemHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	vars := mux.Vars(r)
-	// itemID := vars["item"]
+	if !j.itemIDAllowed(user, vars["item"]) {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
 
 	splitted := strings.Split(vars["item"], itemprefix_separator)
 	if len(splitted) == 2 {
@@ -222,12 +259,20 @@ func (j *Jellyfin) usersItemUserDataHandler(w http.ResponseWriter, r *http.Reque
 // - SearchTerm, substring to match on
 // - StartIndex, index of first result item
 // - Limit=50, number of items to return
+// - isPlayed, isFavorite, filters, ids, nameStartsWith and more, see makeCatalogQuery
+// Items are selected, sorted and paginated by querying the catalog, only the
+// requested page of items is materialized.
 func (j *Jellyfin) usersItemsHandler(w http.ResponseWriter, r *http.Request) {
 	accessToken := j.getAccessTokenDetails(w, r)
 	if accessToken == nil {
 		return
 	}
 
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	queryparams := r.URL.Query()
 	searchCollection := queryparams.Get("parentId")
 
@@ -237,7 +282,7 @@ func (j *Jellyfin) usersItemsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Return favorites collection if requested
 	if strings.HasPrefix(searchCollection, itemprefix_collection_favorites) {
-		items, err = j.makeJFItemFavoritesOverview(accessToken.UserID)
+		items, err = j.makeJFItemFavoritesOverview(user)
 		if err != nil {
 			http.Error(w, "Could not find favorites collection", http.StatusNotFound)
 			return
@@ -255,36 +300,38 @@ func (j *Jellyfin) usersItemsHandler(w http.ResponseWriter, r *http.Request) {
 		collectionPopulated = true
 	}
 
-	// Search for items in case favorites or playlist collection not requested
-	if !collectionPopulated {
-		var searchC *collection.Collection
-		if searchCollection != "" {
-			collectionid := strings.TrimPrefix(searchCollection, itemprefix_collection)
-			searchC = j.collections.GetCollection(collectionid)
-		}
-
-		searchTerm := queryparams.Get("searchTerm")
-
-		for _, c := range j.collections.GetCollections() {
-			// Skip if we are searching in one particular collection?
-			if searchC != nil && searchC.ID != c.ID {
-				continue
-			}
+	// Seasons and episodes are not in the catalog, look up requested items by ID
+	if ids := splitQueryParam(queryparams.Get("ids"), ","); slices.ContainsFunc(ids, isSeasonOrEpisodeID) {
+		excludeIDs := splitQueryParam(queryparams.Get("excludeItemIds"), ",")
+		items = j.makeJFItemsByID(user, slices.DeleteFunc(ids, func(id string) bool {
+			return slices.Contains(excludeIDs, id)
+		}))
+		collectionPopulated = true
+	}
 
-			for _, i := range c.Items {
-				if searchTerm == "" || strings.Contains(strings.ToLower(i.Name), strings.ToLower(searchTerm)) {
-					if j.applyItemFilter(i, queryparams) {
-						items = append(items, j.makeJFItem(accessToken.UserID, i, idhash.IdHash(c.Name_), c.Type, true))
-					}
-				}
-			}
+	// Favorites, playlist collections and requested items are small, sort and paginate them in memory
+	if collectionPopulated {
+		totalItemCount := len(items)
+		responseItems, startIndex := j.applyItemPaginating(j.applyItemSorting(items, queryparams), queryparams)
+		response := UserItemsResponse{
+			Items:            responseItems,
+			StartIndex:       startIndex,
+			TotalRecordCount: totalItemCount,
 		}
+		serveJSON(response, w)
+		return
 	}
 
-	totalItemCount := len(items)
-	responseItems, startIndex := j.applyItemPaginating(j.applyItemSorting(items, queryparams), queryparams)
+	// Query catalog for the requested page of items
+	items, startIndex, totalItemCount, err := j.queryCatalog(user, queryparams,
+		[]string{collection.ItemTypeMovie, collection.ItemTypeShow, database.CatalogTypeEpisode})
+	if err != nil {
+		log.Printf("usersItemsHandler: %s\n", err)
+		http.Error(w, "Could not query items", http.StatusInternalServerError)
+		return
+	}
 	response := UserItemsResponse{
-		Items:            responseItems,
+		Items:            items,
 		StartIndex:       startIndex,
 		TotalRecordCount: totalItemCount,
 	}
@@ -300,11 +347,16 @@ func (j *Jellyfin) usersItemsAncestorsHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	vars := mux.Vars(r)
 	itemID := vars["item"]
 
 	c, i := j.collections.GetItemByID(itemID)
-	if i == nil {
+	if !itemAllowed(user, c, i) {
 		http.Error(w, "Item not found", http.StatusNotFound)
 		return
 	}
@@ -336,35 +388,40 @@ func (j *Jellyfin) usersItemsLatestHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	queryparams := r.URL.Query()
 
-	searchCollection := queryparams.Get("parentId")
-	var searchC *collection.Collection
-	if searchCollection != "" {
-		collectionid := strings.TrimPrefix(searchCollection, itemprefix_collection)
-		searchC = j.collections.GetCollection(collectionid)
+	// The catalog selects the requested page, only items of that page are made
+	query := j.makeCatalogQuery(user, queryparams)
+	// Skip collections the user excluded from latest items, unless explicitly requested
+	if queryparams.Get("parentId") == "" {
+		query.CollectionIDs = slices.DeleteFunc(query.CollectionIDs, func(id string) bool {
+			return slices.Contains(user.Configuration.LatestItemsExcludes, itemprefix_collection+id)
+		})
+		if len(query.CollectionIDs) == 0 {
+			query.CollectionIDs = []string{""}
+		}
 	}
+	// Most recent releases first
+	query.SortBy = []string{"PremiereDate"}
+	query.SortDescending = []bool{true}
 
-	items := make([]JFItem, 0)
-	for _, c := range j.collections.GetCollections() {
-		// Skip if we are searching in one particular collection
-		if searchC != nil && searchC.ID != c.ID {
-			continue
-		}
-		for _, i := range c.Items {
-			if j.applyItemFilter(i, queryparams) {
-				items = append(items, j.makeJFItem(accessToken.UserID, i, idhash.IdHash(c.Name_), c.Type, true))
-			}
+	itemIDs, _, err := j.db.CatalogRepo.QueryItems(query)
+	if err != nil {
+		log.Printf("usersItemsLatestHandler: %s\n", err)
+		http.Error(w, "Could not get latest items", http.StatusInternalServerError)
+		return
+	}
+	items := make([]JFItem, 0, len(itemIDs))
+	for _, itemID := range itemIDs {
+		if item, ok := j.makeJFItemSearchResult(accessToken.UserID, database.SearchResult{ID: itemID}); ok {
+			items = append(items, item)
 		}
 	}
-
-	// Sort by premieredate to list most recent releases first
-	sort.SliceStable(items, func(i, j int) bool {
-		return items[i].PremiereDate.After(items[j].PremiereDate)
-	})
-
-	items, _ = j.applyItemPaginating(items, queryparams)
-
 	serveJSON(items, w)
 }
 
@@ -377,6 +434,11 @@ func (j *Jellyfin) searchHintsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	queryparams := r.URL.Query()
 
 	// Return playlist collection if requested
@@ -387,32 +449,13 @@ func (j *Jellyfin) searchHintsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var searchC *collection.Collection
-	if searchCollection != "" {
-		collectionid := strings.TrimPrefix(searchCollection, itemprefix_collection)
-		searchC = j.collections.GetCollection(collectionid)
-	}
-
-	searchTerm := queryparams.Get("searchTerm")
-	items := make([]JFItem, 0)
-	for _, c := range j.collections.GetCollections() {
-		// Skip if we are searching in one particular collection?
-		if searchC != nil && searchC.ID != c.ID {
-			continue
-		}
-
-		for _, i := range c.Items {
-			if searchTerm == "" || strings.Contains(strings.ToLower(i.Name), strings.ToLower(searchTerm)) {
-				if j.applyItemFilter(i, queryparams) {
-					items = append(items, j.makeJFItem(accessToken.UserID, i, idhash.IdHash(c.Name_), c.Type, true))
-				}
-			}
-		}
+	searchItems, _, totalItemCount, err := j.queryCatalog(user, queryparams,
+		[]string{collection.ItemTypeMovie, collection.ItemTypeShow, database.CatalogTypeEpisode, database.CatalogTypePerson})
+	if err != nil {
+		log.Printf("searchHintsHandler: %s\n", err)
+		http.Error(w, "Could not search items", http.StatusInternalServerError)
+		return
 	}
-
-	totalItemCount := len(items)
-	searchItems, _ := j.applyItemPaginating(j.applyItemSorting(items, queryparams), queryparams)
-
 	response := SearchHintsResponse{
 		SearchHints:      searchItems,
 		TotalRecordCount: totalItemCount,
@@ -420,27 +463,43 @@ func (j *Jellyfin) searchHintsHandler(w http.ResponseWriter, r *http.Request) {
 	serveJSON(response, w)
 }
 
-// /Shows/NextUp?
-// 	enableImageTypes=Primary&
-// 	enableImageTypes=Backdrop&
-// 	enableImageTypes=Thumb&
-// 	enableResumable=false&
-// 	fields=MediaSourceCount&limit=20&
-
+// /Shows/NextUp?enableImageTypes=Primary&enableImageTypes=Backdrop&enableImageTypes=Thumb&enableResumable=false&fields=MediaSourceCount&limit=20
+//
+// showsNextUpHandler returns the next episode to watch for each show the user is watching
+// query params:
+// - seriesId, if provided only return next up episode of this show
+// - nextUpDateCutoff, skip shows not watched since this date
+// - enableRewatching, continue after most recently played episode even if already played
+// - disableFirstEpisode, do not return first episode of a show that has not been started
+// - enableResumable, include partially watched episodes (default true)
+// - startIndex, index of first result item
+// - limit, number of items to return
 func (j *Jellyfin) showsNextUpHandler(w http.ResponseWriter, r *http.Request) {
 	accessToken := j.getAccessTokenDetails(w, r)
 	if accessToken == nil {
 		return
 	}
 
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	queryparams := r.URL.Query()
 
-	recentlyWatchedIDs, err := j.db.UserDataRepo.GetRecentlyWatched(accessToken.UserID, true)
-	if err != nil {
-		http.Error(w, "Could not get recently watched items list", http.StatusInternalServerError)
-		return
+	options := collection.NextUpOptions{
+		SeriesID:            trimPrefix(queryparams.Get("seriesId")),
+		EnableRewatching:    strings.EqualFold(queryparams.Get("enableRewatching"), "true"),
+		DisableFirstEpisode: strings.EqualFold(queryparams.Get("disableFirstEpisode"), "true"),
+		EnableResumable:     !strings.EqualFold(queryparams.Get("enableResumable"), "false"),
+	}
+	if cutoff := queryparams.Get("nextUpDateCutoff"); cutoff != "" {
+		if parsedTime, err := parseTime(cutoff); err == nil {
+			options.DateCutoff = parsedTime
+		}
 	}
-	nextUpItemIDs, err := j.collections.NextUp(recentlyWatchedIDs)
+
+	nextUpItemIDs, err := j.collections.NextUp(accessToken.UserID, options)
 	if err != nil {
 		http.Error(w, "Could not get next up items list", http.StatusInternalServerError)
 		return
@@ -448,44 +507,28 @@ func (j *Jellyfin) showsNextUpHandler(w http.ResponseWriter, r *http.Request) {
 
 	items := make([]JFItem, 0)
 	for _, id := range nextUpItemIDs {
-		// if c, i := j.collections.GetItemByID(id); c != nil && i != nil {
-		// 	if j.applyItemFilter(i, queryparams) {
-		// 		items = append(items, j.makeJFItem(accessToken.UserID, i, idhash.IdHash(c.Name_), c.Type, true))
-		// 	}
-		// 	continue
-		// }
-		if _, i, _, e := j.collections.GetEpisodeByID(id); i != nil {
-			if j.applyItemFilter(i, queryparams) {
+		if c, i, _, e := j.collections.GetEpisodeByID(id); i != nil {
+			if itemAllowed(user, c, i) && j.applyItemFilter(i, queryparams) {
 				if episode, err := j.makeJFItemEpisode(accessToken.UserID, e.ID); err == nil {
 					items = append(items, episode)
 				}
 			}
 			continue
 		}
-		log.Printf("usersItemsResumeHandler: item %s not found\n", id)
+		log.Printf("showsNextUpHandler: item %s not found\n", id)
 	}
 
-	// Apply user provided sorting
+	// Apply user provided sorting, by default most recently watched show first
 	items = j.applyItemSorting(items, queryparams)
 
 	totalItemCount := len(items)
-	resumeItems, startIndex := j.applyItemPaginating(items, queryparams)
+	nextUpItems, startIndex := j.applyItemPaginating(items, queryparams)
 	response := JFShowsNextUpResponse{
-		Items:            resumeItems,
+		Items:            nextUpItems,
 		StartIndex:       startIndex,
 		TotalRecordCount: totalItemCount,
 	}
 	serveJSON(response, w)
-
-	// c, i := j.collections.GetItemByID("rVFG3EzPthk2wowNkqUl")
-	// response = JFShowsNextUpResponse{
-	// 	Items: []JFItem{
-	// 		j.makeJFItem(accessToken.UserID, i, idhash.IdHash(c.Name_), c.Type, true),
-	// 	},
-	// 	TotalRecordCount: 1,
-	// 	StartIndex:       0,
-	// }
-	// serveJSON(response, w)
 }
 
 // /UserItems/Resume?userId=XAOVn7iqiBujnIQY8sd0&enableImageTypes=Primary&enableImageTypes=Backdrop&enableImageTypes=Thumb&includeItemTypes=Movie&includeItemTypes=Series&includeItemTypes=Episode
@@ -498,6 +541,11 @@ func (j *Jellyfin) usersItemsResumeHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	queryparams := r.URL.Query()
 
 	resumeItemIDs, err := j.db.UserDataRepo.GetRecentlyWatched(accessToken.UserID, false)
@@ -509,13 +557,13 @@ func (j *Jellyfin) usersItemsResumeHandler(w http.ResponseWriter, r *http.Reques
 	items := make([]JFItem, 0)
 	for _, id := range resumeItemIDs {
 		if c, i := j.collections.GetItemByID(id); c != nil && i != nil {
-			if j.applyItemFilter(i, queryparams) {
+			if itemAllowed(user, c, i) && j.applyItemFilter(i, queryparams) {
 				items = append(items, j.makeJFItem(accessToken.UserID, i, idhash.IdHash(c.Name_), c.Type, true))
 			}
 			continue
 		}
-		if _, i, _, e := j.collections.GetEpisodeByID(id); i != nil {
-			if j.applyItemFilter(i, queryparams) {
+		if c, i, _, e := j.collections.GetEpisodeByID(id); i != nil {
+			if itemAllowed(user, c, i) && j.applyItemFilter(i, queryparams) {
 				if episode, err := j.makeJFItemEpisode(accessToken.UserID, e.ID); err == nil {
 					items = append(items, episode)
 				}
@@ -538,30 +586,227 @@ func (j *Jellyfin) usersItemsResumeHandler(w http.ResponseWriter, r *http.Reques
 	serveJSON(response, w)
 }
 
-// /Items/Similar
+// /Items/{item}/Similar
+// /Movies/{item}/Similar
+// /Shows/{item}/Similar
 //
 // usersItemsSimilarHandler returns a list of items that are similar
+// query params:
+// - limit, maximum number of items to return
+// - excludeArtistIds, skip items featuring any of these people
 func (j *Jellyfin) usersItemsSimilarHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	queryparams := r.URL.Query()
+
+	similarItemIDs, err := j.collections.Similar(trimPrefix(vars["item"]))
+	if err != nil || !j.itemIDAllowed(user, vars["item"]) {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+
+	var excludePersonIDs []string
+	for _, entry := range queryparams["excludeArtistIds"] {
+		excludePersonIDs = append(excludePersonIDs, strings.Split(entry, ",")...)
+	}
+
+	startIndex, _ := strconv.Atoi(queryparams.Get("startIndex"))
+	startIndex = max(startIndex, 0)
+	limit, _ := strconv.Atoi(queryparams.Get("limit"))
+
+	// Only items of the requested page are made, stop once the page is complete
+	type similarItem struct {
+		c *collection.Collection
+		i *collection.Item
+	}
+	var candidates []similarItem
+	for _, id := range similarItemIDs {
+		if limit > 0 && len(candidates) == startIndex+limit {
+			break
+		}
+		c, i := j.collections.GetItemByID(id)
+		if !itemAllowed(user, c, i) {
+			continue
+		}
+		if slices.ContainsFunc(i.ItemPeople(), func(person string) bool {
+			return slices.Contains(excludePersonIDs, idhash.IdHash(person))
+		}) {
+			continue
+		}
+		// Skip items the user has already fully watched
+		if j.itemPlayed(accessToken.UserID, i) {
+			continue
+		}
+		candidates = append(candidates, similarItem{c, i})
+	}
+
+	items := make([]JFItem, 0)
+	for _, candidate := range candidates[min(startIndex, len(candidates)):] {
+		items = append(items, j.makeJFItem(accessToken.UserID, candidate.i,
+			idhash.IdHash(candidate.c.Name_), candidate.c.Type, true))
+	}
+
 	response := JFUsersItemsSimilarResponse{
-		Items:            []JFItem{},
-		StartIndex:       0,
-		TotalRecordCount: 0,
+		Items:            items,
+		StartIndex:       startIndex,
+		TotalRecordCount: len(candidates),
 	}
 	serveJSON(response, w)
 }
 
-// /Items/Suggestions
+// /Items/Suggestions?type=Movie,Series&limit=12
 //
-// usersItemsSuggestionsHandler returns a list of items that are suggested for the user
+// usersItemsSuggestionsHandler returns a list of unwatched items that are suggested for the user
+// based upon genres, people and decades of items the user played or marked as favorite.
+// query params:
+// - type, item types to return, e.g. Movie,Series
+// - startIndex, index of first result item
+// - limit, number of items to return
 func (j *Jellyfin) usersItemsSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
+	queryparams := r.URL.Query()
+	// Suggestions endpoint names the item type filter "type"
+	if itemTypes := queryparams["type"]; len(itemTypes) > 0 {
+		queryparams["includeItemTypes"] = append(queryparams["includeItemTypes"], itemTypes...)
+	}
+
+	suggestedItemIDs, err := j.collections.Recommend(accessToken.UserID)
+	if err != nil {
+		http.Error(w, "Could not get suggestions", http.StatusInternalServerError)
+		return
+	}
+
+	// Filter all suggestions to count them, only items of the requested page are made
+	type suggestedItem struct {
+		c *collection.Collection
+		i *collection.Item
+	}
+	var suggested []suggestedItem
+	for _, id := range suggestedItemIDs {
+		c, i := j.collections.GetItemByID(id)
+		if itemAllowed(user, c, i) && j.applyItemFilter(i, queryparams) {
+			suggested = append(suggested, suggestedItem{c, i})
+		}
+	}
+
+	startIndex, _ := strconv.Atoi(queryparams.Get("startIndex"))
+	page := suggested[min(max(startIndex, 0), len(suggested)):]
+	if limit, err := strconv.Atoi(queryparams.Get("limit")); err == nil && limit > 0 && limit < len(page) {
+		page = page[:limit]
+	}
+	items := make([]JFItem, 0, len(page))
+	for _, s := range page {
+		items = append(items, j.makeJFItem(accessToken.UserID, s.i, idhash.IdHash(s.c.Name_), s.c.Type, true))
+	}
 	response := JFUsersItemsSuggestionsResponse{
-		Items:            []JFItem{},
-		StartIndex:       0,
-		TotalRecordCount: 0,
+		Items:            items,
+		StartIndex:       startIndex,
+		TotalRecordCount: len(suggested),
 	}
 	serveJSON(response, w)
 }
 
+// /Movies/Recommendations?categoryLimit=6&itemLimit=8&parentId=collection_1
+//
+// moviesRecommendationsHandler returns categories of recommended movies,
+// e.g. "Because you watched X", "Starring Y" and "Directed by Z".
+// query params:
+// - categoryLimit, maximum number of categories to return
+// - itemLimit, maximum number of items per category
+// - parentId, if provided scope result set to this collection
+func (j *Jellyfin) moviesRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
+	queryparams := r.URL.Query()
+
+	categoryLimit := 5
+	if v, err := strconv.Atoi(queryparams.Get("categoryLimit")); err == nil && v > 0 {
+		categoryLimit = v
+	}
+	itemLimit := 8
+	if v, err := strconv.Atoi(queryparams.Get("itemLimit")); err == nil && v > 0 {
+		itemLimit = v
+	}
+
+	var searchC *collection.Collection
+	if searchCollection := queryparams.Get("parentId"); searchCollection != "" {
+		searchC = j.collections.GetCollection(strings.TrimPrefix(searchCollection, itemprefix_collection))
+	}
+
+	// Filter before items are cut to itemLimit, so rows stay filled
+	recommendations, err := j.collections.Recommendations(accessToken.UserID, collection.ItemTypeMovie, categoryLimit, itemLimit,
+		func(c *collection.Collection, i *collection.Item) bool {
+			return itemAllowed(user, c, i) && (searchC == nil || searchC.ID == c.ID)
+		})
+	if err != nil {
+		http.Error(w, "Could not get recommendations", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]JFRecommendation, 0)
+	for _, rec := range recommendations {
+		items := make([]JFItem, 0)
+		for _, id := range rec.ItemIDs {
+			c, i := j.collections.GetItemByID(id)
+			if i == nil {
+				continue
+			}
+			items = append(items, j.makeJFItem(accessToken.UserID, i, idhash.IdHash(c.Name_), c.Type, true))
+		}
+		if len(items) == 0 {
+			continue
+		}
+		recommendationType := makeJFRecommendationType(rec.Type)
+		response = append(response, JFRecommendation{
+			Items:              items,
+			RecommendationType: recommendationType,
+			BaselineItemName:   rec.BaselineItemName,
+			CategoryId:         idhash.IdHash(recommendationType + rec.BaselineItemName),
+		})
+	}
+	serveJSON(response, w)
+}
+
+func makeJFRecommendationType(t collection.RecommendationType) string {
+	switch t {
+	case collection.RecommendationSimilarToRecentlyPlayed:
+		return "SimilarToRecentlyPlayed"
+	case collection.RecommendationSimilarToLikedItem:
+		return "SimilarToLikedItem"
+	case collection.RecommendationHasActorFromRecentlyPlayed:
+		return "HasActorFromRecentlyPlayed"
+	case collection.RecommendationHasDirectorFromRecentlyPlayed:
+		return "HasDirectorFromRecentlyPlayed"
+	}
+	return ""
+}
+
 // applyItemFilter checks if the item should be included in a result set or not
 func (j *Jellyfin) applyItemFilter(i *collection.Item, queryparams url.Values) bool {
 	// includeItemTypes can be provided multiple times and contains a comma separated list of types
@@ -630,6 +875,34 @@ func (j *Jellyfin) applyItemFilter(i *collection.Item, queryparams url.Values) b
 		}
 	}
 
+	// filter on studio name
+	if includeStudios := queryparams.Get("studios"); includeStudios != "" {
+		keepItem := false
+		for studio := range strings.SplitSeq(includeStudios, "|") {
+			if slices.Contains(i.Studios, studio) {
+				keepItem = true
+			}
+		}
+		if !keepItem {
+			return false
+		}
+	}
+
+	// filter on studio id
+	if includeStudioIDs := queryparams.Get("studioIds"); includeStudioIDs != "" {
+		keepItem := false
+		for includeID := range strings.SplitSeq(includeStudioIDs, "|") {
+			for _, studio := range i.Studios {
+				if idhash.IdHash(studio) == includeID {
+					keepItem = true
+				}
+			}
+		}
+		if !keepItem {
+			return false
+		}
+	}
+
 	// filter on offical rating
 	if includeOfficialRating := queryparams.Get("officialRatings"); includeOfficialRating != "" {
 		keepItem := false
@@ -661,6 +934,206 @@ func (j *Jellyfin) applyItemFilter(i *collection.Item, queryparams url.Values) b
 	return true
 }
 
+// queryCatalog returns the requested page of items and the total number of
+// items matching the query parameters. In case of a search term results are
+// ordered by relevance and limited to searchTypes, unless includeItemTypes
+// is provided.
+func (j *Jellyfin) queryCatalog(user *database.User, queryparams url.Values, searchTypes []string) (items []JFItem, startIndex, totalCount int, err error) {
+	query := j.makeCatalogQuery(user, queryparams)
+	items = []JFItem{}
+
+	if query.SearchTerm == "" {
+		itemIDs, totalCount, err := j.db.CatalogRepo.QueryItems(query)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		for _, itemID := range itemIDs {
+			if item, ok := j.makeJFItemSearchResult(user.ID, database.SearchResult{ID: itemID}); ok {
+				items = append(items, item)
+			}
+		}
+		return items, query.StartIndex, totalCount, nil
+	}
+
+	if len(query.IncludeItemTypes) == 0 {
+		query.IncludeItemTypes = searchTypes
+	}
+	results, totalCount, err := j.db.CatalogRepo.SearchItems(query)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	for _, result := range results {
+		if item, ok := j.makeJFItemSearchResult(user.ID, result); ok {
+			items = append(items, item)
+		}
+	}
+	return items, query.StartIndex, totalCount, nil
+}
+
+// makeJFItemSearchResult makes an item of a catalog query or search result,
+// returns false in case the item disappeared since the catalog was updated.
+func (j *Jellyfin) makeJFItemSearchResult(userID string, result database.SearchResult) (JFItem, bool) {
+	switch result.Type {
+	case database.CatalogTypeEpisode:
+		item, err := j.makeJFItemEpisode(userID, result.ID)
+		return item, err == nil
+	case database.CatalogTypePerson:
+		return j.makeJFItemPerson(result.Name), true
+	}
+	if c, i := j.collections.GetItemByID(result.ID); i != nil {
+		return j.makeJFItem(userID, i, idhash.IdHash(c.Name_), c.Type, true), true
+	}
+	return JFItem{}, false
+}
+
+// makeCatalogQuery translates /Items query parameters into a catalog query,
+// restricted to the collections and parental ratings the user has access to.
+func (j *Jellyfin) makeCatalogQuery(user *database.User, queryparams url.Values) database.CatalogQuery {
+	query := database.CatalogQuery{
+		UserID:            user.ID,
+		CollectionIDs:     []string{},
+		IncludeItemTypes:  catalogItemTypes(queryparams["includeItemTypes"]),
+		ExcludeItemTypes:  catalogItemTypes(queryparams["excludeItemTypes"]),
+		Genres:            splitQueryParam(queryparams.Get("genres"), "|"),
+		GenreIDs:          splitQueryParam(queryparams.Get("genreIds"), "|"),
+		Studios:           splitQueryParam(queryparams.Get("studios"), "|"),
+		StudioIDs:         splitQueryParam(queryparams.Get("studioIds"), "|"),
+		OfficialRatings:   splitQueryParam(queryparams.Get("officialRatings"), "|"),
+		ItemIDs:           trimPrefixes(splitQueryParam(queryparams.Get("ids"), ",")),
+		ExcludeItemIDs:    trimPrefixes(splitQueryParam(queryparams.Get("excludeItemIds"), ",")),
+		NameStartsWith:    queryparams.Get("nameStartsWith"),
+		NameLessThan:      queryparams.Get("nameLessThan"),
+		SeriesStatus:      splitQueryParam(queryparams.Get("seriesStatus"), ","),
+		HasSubtitles:      parseBoolQueryParam(queryparams, "hasSubtitles"),
+		HasTrailer:        parseBoolQueryParam(queryparams, "hasTrailer"),
+		IsHD:              parseBoolQueryParam(queryparams, "isHD"),
+		Is4K:              parseBoolQueryParam(queryparams, "is4K"),
+		IsPlayed:          parseBoolQueryParam(queryparams, "isPlayed"),
+		IsFavorite:        parseBoolQueryParam(queryparams, "isFavorite"),
+		IsResumable:       parseBoolQueryParam(queryparams, "isResumable"),
+		SearchTerm:        strings.TrimSpace(queryparams.Get("searchTerm")),
+		MaxParentalRating: user.MaxParentalRating,
+		BlockUnrated:      user.BlockUnratedItems,
+		SortBy:            splitQueryParam(queryparams.Get("sortBy"), ","),
+	}
+	if isUnplayed := parseBoolQueryParam(queryparams, "isUnplayed"); isUnplayed != nil {
+		isPlayed := !*isUnplayed
+		query.IsPlayed = &isPlayed
+	}
+	if rating, err := strconv.ParseFloat(queryparams.Get("minCommunityRating"), 64); err == nil {
+		query.MinCommunityRating = rating
+	}
+	if premiereDate := queryparams.Get("minPremiereDate"); premiereDate != "" {
+		if parsedTime, err := parseTime(premiereDate); err == nil {
+			query.MinPremiereDate = parsedTime
+		}
+	}
+	applyItemFilters(&query, splitQueryParam(queryparams.Get("filters"), ","))
+
+	// Catalog items are videos, except shows which have no media type
+	if mediaTypes := splitQueryParam(queryparams.Get("mediaTypes"), ","); len(mediaTypes) != 0 {
+		if slices.ContainsFunc(mediaTypes, func(m string) bool { return strings.EqualFold(m, "Video") }) {
+			query.ExcludeItemTypes = append(query.ExcludeItemTypes, collection.ItemTypeShow)
+		} else {
+			query.ItemIDs = []string{""}
+		}
+	}
+	for _, year := range splitQueryParam(queryparams.Get("years"), ",") {
+		if intYear, err := strconv.Atoi(year); err == nil {
+			query.Years = append(query.Years, intYear)
+		}
+	}
+	for _, order := range splitQueryParam(queryparams.Get("sortOrder"), ",") {
+		query.SortDescending = append(query.SortDescending, order == "Descending")
+	}
+	if startIndex, err := strconv.Atoi(queryparams.Get("startIndex")); err == nil && startIndex > 0 {
+		query.StartIndex = startIndex
+	}
+	if limit, err := strconv.Atoi(queryparams.Get("limit")); err == nil && limit > 0 {
+		query.Limit = limit
+	}
+
+	// Scope to one collection in case parentId refers to a collection
+	var searchC *collection.Collection
+	if parentID := queryparams.Get("parentId"); parentID != "" {
+		searchC = j.collections.GetCollection(strings.TrimPrefix(parentID, itemprefix_collection))
+	}
+	for _, c := range j.collections.GetCollections() {
+		if (searchC == nil || searchC.ID == c.ID) && collectionAllowed(user, &c) {
+			query.CollectionIDs = append(query.CollectionIDs, CollectionIDToString(c.ID))
+		}
+	}
+	// No accessible collections, make sure nothing matches
+	if len(query.CollectionIDs) == 0 {
+		query.CollectionIDs = []string{""}
+	}
+	return query
+}
+
+// applyItemFilters sets the catalog query fields of the filters parameter,
+// e.g. filters=IsFavorite,IsUnplayed
+func applyItemFilters(query *database.CatalogQuery, filters []string) {
+	yes, no := true, false
+	for _, filter := range filters {
+		switch strings.ToLower(strings.TrimSpace(filter)) {
+		case "isplayed":
+			query.IsPlayed = &yes
+		case "isunplayed":
+			query.IsPlayed = &no
+		case "isfavorite", "isfavoriteorlikes":
+			// Likes are not stored, only favorites
+			query.IsFavorite = &yes
+		case "isresumable":
+			query.IsResumable = &yes
+		case "isfolder":
+			query.ExcludeItemTypes = append(query.ExcludeItemTypes, collection.ItemTypeMovie)
+		case "isnotfolder":
+			query.ExcludeItemTypes = append(query.ExcludeItemTypes, collection.ItemTypeShow)
+		}
+	}
+}
+
+// parseBoolQueryParam returns the value of a boolean query parameter, nil if not provided.
+func parseBoolQueryParam(queryparams url.Values, name string) *bool {
+	value, err := strconv.ParseBool(queryparams.Get(name))
+	if err != nil {
+		return nil
+	}
+	return &value
+}
+
+// catalogItemTypes converts Jellyfin item types, provided as one or more
+// comma separated lists, to catalog item types.
+func catalogItemTypes(itemTypes []string) (types []string) {
+	for _, entry := range itemTypes {
+		for itemType := range strings.SplitSeq(entry, ",") {
+			switch itemType {
+			case "Movie":
+				types = append(types, collection.ItemTypeMovie)
+			case "Series":
+				types = append(types, collection.ItemTypeShow)
+			case "Episode":
+				types = append(types, database.CatalogTypeEpisode)
+			case "Person":
+				types = append(types, database.CatalogTypePerson)
+			case "":
+			default:
+				// Not in catalog, e.g. BoxSet
+				types = append(types, itemType)
+			}
+		}
+	}
+	return
+}
+
+// splitQueryParam splits a query parameter value, returns nil if empty.
+func splitQueryParam(value, separator string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, separator)
+}
+
 // applyItemSorting sorts a list of items based on the provided sortBy and sortOrder parameters
 func (j *Jellyfin) applyItemSorting(items []JFItem, queryparams url.Values) (sortedItems []JFItem) {
 	sortBy := queryparams.Get("sortBy")
@@ -762,8 +1235,16 @@ func (j *Jellyfin) applyItemPaginating(items []JFItem, queryparams url.Values) (
 
 // curl -v http://127.0.0.1:9090/Library/VirtualFolders
 func (j *Jellyfin) libraryVirtualFoldersHandler(w http.ResponseWriter, r *http.Request) {
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	libraries := []JFMediaLibrary{}
 	for _, c := range j.collections.GetCollections() {
+		if !collectionAllowed(user, &c) {
+			continue
+		}
 		collectionItem, err := j.makeJItemCollection(CollectionIDToString(c.ID))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -789,10 +1270,15 @@ func (j *Jellyfin) showsSeasonsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	vars := mux.Vars(r)
 	showID := vars["show"]
-	_, i := j.collections.GetItemByID(showID)
-	if i == nil {
+	c, i := j.collections.GetItemByID(showID)
+	if !itemAllowed(user, c, i) {
 		http.Error(w, "Show not found", http.StatusNotFound)
 		return
 	}
@@ -828,9 +1314,14 @@ func (j *Jellyfin) showsEpisodesHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	vars := mux.Vars(r)
-	_, i := j.collections.GetItemByID(vars["show"])
-	if i == nil {
+	c, i := j.collections.GetItemByID(vars["show"])
+	if !itemAllowed(user, c, i) {
 		http.Error(w, "Show not found", http.StatusNotFound)
 		return
 	}
@@ -859,7 +1350,20 @@ func (j *Jellyfin) showsEpisodesHandler(w http.ResponseWriter, r *http.Request)
 	serveJSON(response, w)
 }
 
+// DELETE /Items/{item}
+//
+// itemsDeleteHandler deletes an item, only playlists can be deleted.
 func (j *Jellyfin) itemsDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	if strings.HasPrefix(vars["item"], itemprefix_playlist) {
+		j.deletePlaylist(w, accessToken.UserID, trimPrefix(vars["item"]))
+		return
+	}
 	http.Error(w, "Not implemented", http.StatusForbidden)
 }
 
@@ -889,6 +1393,12 @@ func (j *Jellyfin) itemsImagesHandler(w http.ResponseWriter, r *http.Request) {
 	itemID := vars["item"]
 	imageType := vars["type"]
 
+	// Images can be fetched without auth, requests without user get the access of the guest user
+	if !j.itemIDAllowed(j.getOptionalUserDetails(r), itemID) {
+		http.Error(w, "Access to item not allowed", http.StatusForbidden)
+		return
+	}
+
 	splitted := strings.Split(itemID, itemprefix_separator)
 	splitted[0] += itemprefix_separator
 	if len(splitted) == 2 {
@@ -979,18 +1489,29 @@ func (j *Jellyfin) itemsImagesHandler(w http.ResponseWriter, r *http.Request) {
 
 // curl -v 'http://127.0.0.1:9090/Items/68d73f6f48efedb7db697bf9fee580cb/PlaybackInfo?UserId=2b1ec0a52b09456c9823a367d84ac9e5'
 func (j *Jellyfin) itemsPlaybackInfoHandler(w http.ResponseWriter, r *http.Request) {
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	vars := mux.Vars(r)
 	itemID := vars["item"]
+	if !j.itemIDAllowed(user, itemID) {
+		http.Error(w, "Access to item not allowed", http.StatusForbidden)
+		return
+	}
 
 	var mediaSource []JFMediaSources
 
 	if _, i := j.collections.GetItemByID(itemID); i != nil {
-		mediaSource = j.makeMediaSource(i.Video, i.Nfo)
+		i.LoadNfo()
+		mediaSource = j.makeMediaSource(itemID, i.Video, i.Nfo, externalSubtitles(i.SrtSubs, i.VttSubs), &user.Configuration)
 	}
 
 	if strings.HasPrefix(itemID, itemprefix_episode) {
 		if _, _, _, episode := j.collections.GetEpisodeByID(trimPrefix(itemID)); episode != nil {
-			mediaSource = j.makeMediaSource(episode.Video, episode.Nfo)
+			episode.LoadNfo()
+			mediaSource = j.makeMediaSource(itemID, episode.Video, episode.Nfo, externalSubtitles(episode.SrtSubs, episode.VttSubs), &user.Configuration)
 		}
 	}
 	if mediaSource == nil {
@@ -1020,8 +1541,17 @@ func (j *Jellyfin) mediaSegmentsHandler(w http.ResponseWriter, r *http.Request)
 
 // curl -v -I 'http://127.0.0.1:9090/Videos/NrXTYiS6xAxFj4QAiJoT/stream'
 func (j *Jellyfin) videoStreamHandler(w http.ResponseWriter, r *http.Request) {
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	vars := mux.Vars(r)
 	itemID := vars["item"]
+	if !j.itemIDAllowed(user, itemID) {
+		http.Error(w, "Access to item not allowed", http.StatusForbidden)
+		return
+	}
 
 	// Is episode?
 	if strings.HasPrefix(itemID, itemprefix_episode) {
@@ -1042,14 +1572,36 @@ func (j *Jellyfin) videoStreamHandler(w http.ResponseWriter, r *http.Request) {
 	j.serveFile(w, r, c.Directory+"/"+i.Name+"/"+i.Video)
 }
 
-// return list of actors (hit by Infuse's search)
-// not supported
+// /Persons?searchTerm=ford
+//
+// personsHandler returns actors and directors matching searchTerm (hit by Infuse's search)
 func (j *Jellyfin) personsHandler(w http.ResponseWriter, r *http.Request) {
 	response := UserItemsResponse{
 		Items:            []JFItem{},
 		TotalRecordCount: 0,
 		StartIndex:       0,
 	}
+
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
+	queryparams := r.URL.Query()
+	if strings.TrimSpace(queryparams.Get("searchTerm")) == "" {
+		serveJSON(response, w)
+		return
+	}
+	queryparams.Set("includeItemTypes", "Person")
+	items, startIndex, totalItemCount, err := j.queryCatalog(user, queryparams, nil)
+	if err != nil {
+		log.Printf("personsHandler: %s\n", err)
+		http.Error(w, "Could not search persons", http.StatusInternalServerError)
+		return
+	}
+	response.Items = items
+	response.StartIndex = startIndex
+	response.TotalRecordCount = totalItemCount
 	serveJSON(response, w)
 }
 
@@ -1093,8 +1645,22 @@ func trimPrefix(s string) string {
 	return s
 }
 
+// trimPrefixes removes the type prefix from item ids.
+func trimPrefixes(itemIDs []string) []string {
+	for n := range itemIDs {
+		itemIDs[n] = trimPrefix(itemIDs[n])
+	}
+	return itemIDs
+}
+
+// isSeasonOrEpisodeID returns true if the item id refers to a season or episode.
+func isSeasonOrEpisodeID(itemID string) bool {
+	return strings.HasPrefix(itemID, itemprefix_season) || strings.HasPrefix(itemID, itemprefix_episode)
+}
+
 func parseTime(input string) (parsedTime time.Time, err error) {
 	timeFormats := []string{
+		time.RFC3339,
 		"15:04:05",
 		"2006-01-02",
 		"2006/01/02",
@@ -0,0 +1,50 @@
+package jellyfin
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/erikbos/jellofin-server/collection"
+)
+
+func TestItemsByIDs(t *testing.T) {
+	s := newTestServer(t)
+	s.j.collections = collection.New(&collection.Options{Db: s.j.db, Collections: collection.Collections{
+		{ID: 1, Name_: "Movies", Type: collection.CollectionMovies, Items: []*collection.Item{
+			{ID: "alien", Name: "Alien", SortName: "alien", Type: collection.ItemTypeMovie},
+		}},
+		{ID: 2, Name_: "Shows", Type: collection.CollectionShows, Items: []*collection.Item{
+			{ID: "dark", Name: "Dark", SortName: "dark", Type: collection.ItemTypeShow, Seasons: []collection.Season{
+				{ID: "dark1", SeasonNo: 1, Episodes: []collection.Episode{
+					{ID: "secrets", Name: "Secrets", SortName: "secrets", SeasonNo: 1, EpisodeNo: 1},
+				}},
+			}},
+		}},
+	}})
+	_, token := s.login(t, "erik", "phone")
+
+	// Seasons and episodes are not in the catalog, their items are looked up
+	tests := []struct {
+		ids  string
+		want []string
+	}{
+		{ids: itemprefix_episode + "secrets", want: []string{itemprefix_episode + "secrets"}},
+		{ids: itemprefix_season + "dark1," + itemprefix_episode + "unknown,alien",
+			want: []string{"alien", itemprefix_season + "dark1"}},
+	}
+	for _, tt := range tests {
+		var response UserItemsResponse
+		if err := json.NewDecoder(s.do(t, "GET", "/Items?ids="+tt.ids, token, nil).Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, item := range response.Items {
+			got = append(got, item.ID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) || response.TotalRecordCount != len(tt.want) {
+			t.Errorf("ids %s = %v, %d, want %v", tt.ids, got, response.TotalRecordCount, tt.want)
+		}
+	}
+}
@@ -5,11 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
-	"net"
 	"net/http"
 	"regexp"
 	"strings"
-	"time"
 
 	"github.com/erikbos/jellofin-server/database"
 )
@@ -46,7 +44,8 @@ func (j *Jellyfin) usersAuthenticateByNameHandler(w http.ResponseWriter, r *http
 
 	user, err := j.db.UserRepo.Validate(request.Username, request.Pw)
 	if err != nil {
-		if err == database.ErrUserNotFound && j.autoRegister {
+		if err == database.ErrUserNotFound && (j.autoRegister || j.firstRun()) {
+			// Insert() makes the first user administrator
 			user, err = j.db.UserRepo.Insert(request.Username, request.Pw)
 			if err != nil {
 				http.Error(w, "Failed to auto-register user", http.StatusInternalServerError)
@@ -57,28 +56,44 @@ func (j *Jellyfin) usersAuthenticateByNameHandler(w http.ResponseWriter, r *http
 			return
 		}
 	}
+	if user.Disabled {
+		http.Error(w, "User is disabled", http.StatusUnauthorized)
+		return
+	}
 
-	remoteAddress, _, _ := net.SplitHostPort(r.RemoteAddr)
+	j.serveAuthenticationResult(w, r, embyHeader, user)
+}
 
-	session := &JFSessionInfo{
-		Id:                 sessionID,
-		UserId:             user.ID,
-		UserName:           user.Username,
-		Client:             embyHeader.client,
+// serveAuthenticationResult generates an access token for the device of an
+// authenticated user, and returns it including user and session details.
+func (j *Jellyfin) serveAuthenticationResult(w http.ResponseWriter, r *http.Request, embyHeader *authSchemeValues, user *database.User) {
+	tokenDetails := database.AccessToken{
+		UserID:             user.ID,
+		DeviceID:           embyHeader.deviceID,
 		DeviceName:         embyHeader.device,
-		DeviceId:           embyHeader.deviceID,
+		Client:             embyHeader.client,
 		ApplicationVersion: embyHeader.version,
-		RemoteEndPoint:     remoteAddress,
-		LastActivityDate:   time.Now().UTC(),
-		IsActive:           true,
 	}
-
-	accesstoken, err := j.db.AccessTokenRepo.Generate(user.ID)
+	accesstoken, err := j.db.AccessTokenRepo.Generate(tokenDetails)
 	if err != nil {
 		http.Error(w, "Failed to generate access token", http.StatusInternalServerError)
 		return
 	}
 
+	s := j.sessions.update(r, embyHeader, &tokenDetails, user)
+	session := &JFSessionInfo{
+		Id:                 s.ID,
+		UserId:             s.UserID,
+		UserName:           s.UserName,
+		Client:             s.Client,
+		DeviceName:         s.DeviceName,
+		DeviceId:           s.DeviceID,
+		ApplicationVersion: s.ApplicationVersion,
+		RemoteEndPoint:     s.RemoteAddress,
+		LastActivityDate:   s.LastActivity,
+		IsActive:           true,
+	}
+
 	response := JFAuthenticateByNameResponse{
 		AccessToken: accesstoken,
 		SessionInfo: session,
@@ -139,26 +154,7 @@ func (j *Jellyfin) parseAuthHeader(r *http.Request) (*authSchemeValues, error) {
 // authMiddleware validates auth token, token can be provided in various headers
 func (j *Jellyfin) authmiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var token string
-		found := false
-
-		if embyHeader, err := j.parseAuthHeader(r); err == nil {
-			token = embyHeader.token
-			found = true
-		}
-		if t := r.Header.Get("x-emby-token"); t != "" {
-			token = t
-			found = true
-		}
-		if t := r.Header.Get("x-mediabrowser-token"); t != "" {
-			token = t
-			found = true
-		}
-		// Needed for Streamyfin's embedded VLC
-		if t := r.URL.Query().Get("api_key"); t != "" {
-			token = t
-			found = true
-		}
+		token, found := j.getRequestToken(r)
 		if !found {
 			// log.Printf("no token found in request headers: %+v", r.Header)
 			http.Error(w, "no token provided", http.StatusUnauthorized)
@@ -172,11 +168,72 @@ func (j *Jellyfin) authmiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		user, err := j.db.UserRepo.GetByID(tokendetails.UserID)
+		if err != nil || user.Disabled {
+			http.Error(w, "user not found or disabled", http.StatusUnauthorized)
+			return
+		}
+
+		embyHeader, _ := j.parseAuthHeader(r)
+		session := j.sessions.update(r, embyHeader, tokendetails, user)
+
 		ctx := context.WithValue(r.Context(), contextAccessTokenDetails, tokendetails)
+		ctx = context.WithValue(ctx, contextUserDetails, user)
+		ctx = context.WithValue(ctx, contextSessionDetails, &session)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// getRequestToken returns access token provided in request headers or query parameters
+func (j *Jellyfin) getRequestToken(r *http.Request) (token string, found bool) {
+	if embyHeader, err := j.parseAuthHeader(r); err == nil {
+		token = embyHeader.token
+		found = true
+	}
+	if t := r.Header.Get("x-emby-token"); t != "" {
+		token = t
+		found = true
+	}
+	if t := r.Header.Get("x-mediabrowser-token"); t != "" {
+		token = t
+		found = true
+	}
+	// Needed for Streamyfin's embedded VLC
+	if t := r.URL.Query().Get("api_key"); t != "" {
+		token = t
+		found = true
+	}
+	return
+}
+
+// adminmiddleware only allows administrators to access an endpoint,
+// needs to be called after authmiddleware()
+func (j *Jellyfin) adminmiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken := j.getAccessTokenDetails(w, r)
+		if accessToken == nil {
+			return
+		}
+		if !j.isAdmin(accessToken.UserID) {
+			http.Error(w, "administrator access required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdmin returns true if the user is an administrator
+func (j *Jellyfin) isAdmin(userID string) bool {
+	user, err := j.db.UserRepo.GetByID(userID)
+	return err == nil && user.Admin && !user.Disabled
+}
+
+// firstRun returns true if no users have been created yet
+func (j *Jellyfin) firstRun() bool {
+	users, err := j.db.UserRepo.GetAll()
+	return err == nil && len(users) == 0
+}
+
 // getAccessTokenDetails returns access token details from the
 // request context populated by authmiddleware()
 //
@@ -191,45 +248,30 @@ func (j *Jellyfin) getAccessTokenDetails(w http.ResponseWriter, r *http.Request)
 	return nil
 }
 
-// GET /QuickConnect/Enabled
+// getSessionDetails returns the session of the device of the request from
+// the request context populated by authmiddleware()
 //
-// quickConnectEnabledHandler returns boolean whether quickconnect is enabled.
-func (j *Jellyfin) quickConnectEnabledHandler(w http.ResponseWriter, r *http.Request) {
-	serveJSON(false, w)
-}
-
-// POST /QuickConnect/Authorize
-//
-// usersAuthenticateByNameHandler stores quickconnect code of an authenticated user.
-func (j *Jellyfin) quickConnectAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
-	accessToken := j.getAccessTokenDetails(w, r)
-	if accessToken == nil {
-		return
-	}
-
-	queryparams := r.URL.Query()
-	userID := queryparams.Get("userId")
-	code := queryparams.Get("code")
-
-	if userID != accessToken.UserID {
-		http.Error(w, "userID does not match access token", http.StatusForbidden)
-		return
+// if not found sends an HTTP unauthorized error
+func (j *Jellyfin) getSessionDetails(w http.ResponseWriter, r *http.Request) *session {
+	// Ctx should have been populated by authmiddleware()
+	details, ok := r.Context().Value(contextSessionDetails).(*session)
+	if ok {
+		return details
 	}
-	log.Printf("quickConnectAuthorizeHandler: user: %s, code: %s", userID, code)
-	http.Error(w, "quickconnect code not implemented", http.StatusUnauthorized)
-}
-
-// GET /QuickConnect/Connect
-//
-// quickConnectConnectHandler returns info about a quick connect code.
-func (j *Jellyfin) quickConnectConnectHandler(w http.ResponseWriter, r *http.Request) {
-	http.Error(w, "quickconnect code not found", http.StatusNotFound)
+	http.Error(w, "session not found", http.StatusUnauthorized)
+	return nil
 }
 
-// POST /QuickConnect/Initiate
+// getUserDetails returns details of the authenticated user from the
+// request context populated by authmiddleware()
 //
-// usersAuthenticateByNameHandler authenticates a user by quick connect code.
-func (j *Jellyfin) quickConnectInitiateHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("quickConnectInitiateHandler: %+v", r)
-	http.Error(w, "quickconnect code not implemented", http.StatusUnauthorized)
+// if not found sends an HTTP unauthorized error
+func (j *Jellyfin) getUserDetails(w http.ResponseWriter, r *http.Request) *database.User {
+	// Ctx should have been populated by authmiddleware()
+	details, ok := r.Context().Value(contextUserDetails).(*database.User)
+	if ok {
+		return details
+	}
+	http.Error(w, "user not found", http.StatusUnauthorized)
+	return nil
 }
@@ -0,0 +1,101 @@
+package jellyfin
+
+import (
+	"net/http"
+
+	"github.com/erikbos/jellofin-server/database"
+)
+
+// GET /Devices
+//
+// devicesHandler returns the devices the user has logged in from.
+func (j *Jellyfin) devicesHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+
+	tokens, err := j.db.AccessTokenRepo.GetAll()
+	if err != nil {
+		http.Error(w, "Could not get devices", http.StatusInternalServerError)
+		return
+	}
+
+	// Tokens are sorted most recently used first, so first token of a device is the most recent one
+	type deviceKey struct {
+		userID   string
+		deviceID string
+	}
+	seen := make(map[deviceKey]bool)
+
+	devices := []JFDeviceInfo{}
+	for _, t := range tokens {
+		key := deviceKey{userID: t.UserID, deviceID: t.DeviceID}
+		if t.UserID != accessToken.UserID || seen[key] {
+			continue
+		}
+		seen[key] = true
+		devices = append(devices, j.makeJFDeviceInfo(t))
+	}
+
+	response := JFDevicesResponse{
+		Items:            devices,
+		TotalRecordCount: len(devices),
+		StartIndex:       0,
+	}
+	serveJSON(response, w)
+}
+
+// DELETE /Devices?id=0dabe147-5d08-4e70-adde-d6b778b725aa
+// DELETE /Devices?userId=XAOVn7iqiBujnIQY8sd0
+//
+// devicesDeleteHandler revokes access of a device by deleting its access tokens.
+// In case no device id is provided all access tokens of the user are revoked.
+func (j *Jellyfin) devicesDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+
+	queryparams := r.URL.Query()
+	deviceID := queryparams.Get("id")
+	userID := queryparams.Get("userId")
+	if userID == "" {
+		userID = accessToken.UserID
+	}
+	if userID != accessToken.UserID && !j.isAdmin(accessToken.UserID) {
+		http.Error(w, "Not allowed to revoke devices of other users", http.StatusForbidden)
+		return
+	}
+
+	var err error
+	if deviceID != "" {
+		err = j.db.AccessTokenRepo.DeleteByDevice(userID, deviceID)
+	} else {
+		err = j.db.AccessTokenRepo.DeleteByUser(userID)
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete device", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (j *Jellyfin) makeJFDeviceInfo(t database.AccessToken) JFDeviceInfo {
+	response := JFDeviceInfo{
+		Name:             t.DeviceName,
+		ID:               t.DeviceID,
+		AppName:          t.Client,
+		AppVersion:       t.ApplicationVersion,
+		LastUserID:       t.UserID,
+		DateLastActivity: t.LastUsed,
+		Capabilities: JFDeviceCapabilities{
+			PlayableMediaTypes: []string{},
+			SupportedCommands:  []string{},
+		},
+	}
+	if user, err := j.db.UserRepo.GetByID(t.UserID); err == nil {
+		response.LastUserName = user.Username
+	}
+	return response
+}
@@ -0,0 +1,143 @@
+package jellyfin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/erikbos/jellofin-server/database"
+)
+
+const (
+	// defaultDisplayPreferencesClient is used in case a client does not provide its name
+	defaultDisplayPreferencesClient = "emby"
+)
+
+// GET /DisplayPreferences/usersettings?userId=2b1ec0a52b09456c9823a367d84ac9e5&client=emby
+//
+// displayPreferencesHandler returns the display preferences of a user for a
+// client, or defaults in case none have been stored.
+func (j *Jellyfin) displayPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, client, ok := j.displayPreferencesUser(w, r)
+	if !ok {
+		return
+	}
+	displayID := mux.Vars(r)["id"]
+
+	prefs, err := j.db.DisplayPreferencesRepo.Get(userID, client, displayID)
+	if errors.Is(err, database.ErrDisplayPreferencesNotFound) {
+		serveJSON(defaultDisplayPreferences(displayID, client), w)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve display preferences", http.StatusInternalServerError)
+		return
+	}
+	serveJSON(DisplayPreferencesResponse{
+		ID:                 prefs.DisplayID,
+		ViewType:           prefs.ViewType,
+		SortBy:             prefs.SortBy,
+		IndexBy:            prefs.IndexBy,
+		RememberIndexing:   prefs.RememberIndexing,
+		PrimaryImageHeight: prefs.PrimaryImageHeight,
+		PrimaryImageWidth:  prefs.PrimaryImageWidth,
+		CustomPrefs:        prefs.CustomPrefs,
+		ScrollDirection:    prefs.ScrollDirection,
+		ShowBackdrop:       prefs.ShowBackdrop,
+		RememberSorting:    prefs.RememberSorting,
+		SortOrder:          prefs.SortOrder,
+		ShowSidebar:        prefs.ShowSidebar,
+		Client:             prefs.Client,
+	}, w)
+}
+
+// POST /DisplayPreferences/usersettings?userId=2b1ec0a52b09456c9823a367d84ac9e5&client=emby
+//
+// displayPreferencesUpdateHandler stores the display preferences of a user for a client.
+func (j *Jellyfin) displayPreferencesUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, client, ok := j.displayPreferencesUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req DisplayPreferencesResponse
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
+		return
+	}
+
+	prefs := database.DisplayPreferences{
+		UserID:             userID,
+		Client:             client,
+		DisplayID:          mux.Vars(r)["id"],
+		ViewType:           req.ViewType,
+		SortBy:             req.SortBy,
+		IndexBy:            req.IndexBy,
+		SortOrder:          req.SortOrder,
+		ScrollDirection:    req.ScrollDirection,
+		RememberIndexing:   req.RememberIndexing,
+		RememberSorting:    req.RememberSorting,
+		ShowBackdrop:       req.ShowBackdrop,
+		ShowSidebar:        req.ShowSidebar,
+		PrimaryImageHeight: req.PrimaryImageHeight,
+		PrimaryImageWidth:  req.PrimaryImageWidth,
+		CustomPrefs:        req.CustomPrefs,
+	}
+	if err := j.db.DisplayPreferencesRepo.Update(prefs); err != nil {
+		http.Error(w, "Failed to store display preferences", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// displayPreferencesUser returns user and client of a display preferences request.
+// Only administrators are allowed to access preferences of other users.
+func (j *Jellyfin) displayPreferencesUser(w http.ResponseWriter, r *http.Request) (userID, client string, ok bool) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return "", "", false
+	}
+
+	queryparams := r.URL.Query()
+	userID = queryparams.Get("userId")
+	if userID == "" {
+		userID = accessToken.UserID
+	}
+	if userID != accessToken.UserID && !j.isAdmin(accessToken.UserID) {
+		http.Error(w, ErrUserNotAllowed, http.StatusForbidden)
+		return "", "", false
+	}
+	client = queryparams.Get("client")
+	if client == "" {
+		client = defaultDisplayPreferencesClient
+	}
+	return userID, client, true
+}
+
+// defaultDisplayPreferences returns display preferences for a display ID
+// that has no stored preferences.
+func defaultDisplayPreferences(displayID, client string) DisplayPreferencesResponse {
+	return DisplayPreferencesResponse{
+		ID:                 displayID,
+		SortBy:             "SortName",
+		RememberIndexing:   false,
+		PrimaryImageHeight: 250,
+		PrimaryImageWidth:  250,
+		CustomPrefs: map[string]string{
+			"chromecastVersion":          "stable",
+			"skipForwardLength":          "30000",
+			"skipBackLength":             "10000",
+			"enableNextVideoInfoOverlay": "False",
+			"tvhome":                     "null",
+			"dashboardTheme":             "null",
+		},
+		ScrollDirection: "Horizontal",
+		ShowBackdrop:    true,
+		RememberSorting: false,
+		SortOrder:       "Ascending",
+		ShowSidebar:     false,
+		Client:          client,
+	}
+}
@@ -2,12 +2,9 @@ package jellyfin
 
 import (
 	"net/http"
-	"slices"
-	"strings"
 
 	"github.com/gorilla/mux"
 
-	"github.com/erikbos/jellofin-server/collection"
 	"github.com/erikbos/jellofin-server/idhash"
 )
 
@@ -19,20 +16,17 @@ func (j *Jellyfin) genresHandler(w http.ResponseWriter, r *http.Request) {
 	if accessToken == nil {
 		return
 	}
-
-	var details collection.CollectionDetails
-	if collection := r.URL.Query().Get("parentId"); collection != "" {
-		// Not every collection has genres (e.g. dynamic collections such as playlists or favorites)
-		if c := j.collections.GetCollection(strings.TrimPrefix(collection, itemprefix_collection)); c != nil {
-			details = c.Details()
-		}
-	} else {
-		details = j.collections.Details()
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
 	}
 
+	allowed := userItemFilter(user)
+	// Count once as counting walks all items
+	genreItemCount := j.collections.GenreItemCount(allowed)
 	genres := []JFItem{}
-	for _, g := range details.Genres {
-		genres = append(genres, j.makeJFItemGenre(g))
+	for _, g := range j.collectionDetails(r.URL.Query().Get("parentId"), allowed).Genres {
+		genres = append(genres, j.makeJFItemGenre(g, genreItemCount))
 	}
 
 	response := UserItemsResponse{
@@ -52,6 +46,10 @@ func (j *Jellyfin) genreHandler(w http.ResponseWriter, r *http.Request) {
 	if accessToken == nil {
 		return
 	}
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
 
 	vars := mux.Vars(r)
 	genreParam := vars["genre"]
@@ -60,9 +58,10 @@ func (j *Jellyfin) genreHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for _, genre := range j.collections.Details().Genres {
+	allowed := userItemFilter(user)
+	for _, genre := range j.collections.Details(allowed).Genres {
 		if genre == genreParam {
-			response := j.makeJFItemGenre(genre)
+			response := j.makeJFItemGenre(genre, j.collections.GenreItemCount(allowed))
 			serveJSON(response, w)
 			return
 		}
@@ -78,19 +77,12 @@ func (j *Jellyfin) usersItemsFiltersHandler(w http.ResponseWriter, r *http.Reque
 	if accessToken == nil {
 		return
 	}
-
-	var details collection.CollectionDetails
-	if collection := r.URL.Query().Get("parentId"); collection != "" {
-		// Not every collection has genres (e.g. dynamic collections such as playlists or favorites)
-		if c := j.collections.GetCollection(strings.TrimPrefix(collection, itemprefix_collection)); c != nil {
-			details = c.Details()
-		}
-	} else {
-		details = j.collections.Details()
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
 	}
 
-	slices.Sort(details.Years)
-
+	details := j.collectionDetails(r.URL.Query().Get("parentId"), userItemFilter(user))
 	response := JFItemFilterResponse{
 		Genres:          details.Genres,
 		Tags:            details.Tags,
@@ -108,15 +100,12 @@ func (j *Jellyfin) usersItemsFilters2Handler(w http.ResponseWriter, r *http.Requ
 	if accessToken == nil {
 		return
 	}
-
-	var details collection.CollectionDetails
-	if searchCollection := r.URL.Query().Get("parentId"); searchCollection != "" {
-		collectionid := strings.TrimPrefix(searchCollection, itemprefix_collection)
-		details = j.collections.GetCollection(collectionid).Details()
-	} else {
-		details = j.collections.Details()
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
 	}
 
+	details := j.collectionDetails(r.URL.Query().Get("parentId"), userItemFilter(user))
 	response := JFItemFilter2Response{
 		Genres: makeJFGenreItems(details.Genres),
 		Tags:   details.Tags,
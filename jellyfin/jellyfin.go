@@ -27,6 +27,8 @@ type Options struct {
 	ServerPort int
 	// Indicates if we should auto-register Jellyfin users
 	AutoRegister bool
+	// QuickConnect allows logged in users to authorize other devices with a code
+	QuickConnect bool
 	// JPEG quality for posters
 	ImageQualityPoster int
 }
@@ -42,8 +44,14 @@ type Jellyfin struct {
 	serverPort int
 	// Indicates if we should auto-register Jellyfin users
 	autoRegister bool
+	// quickConnect holds pending quick connect requests, nil if disabled
+	quickConnect *quickConnectManager
 	// JPEG quality for posters
 	imageQualityPoster int
+	// sessions holds the active sessions of clients
+	sessions *sessionManager
+	// syncPlay holds the groups of sessions watching together
+	syncPlay *syncPlayManager
 }
 
 // API definitions: https://swagger.emby.media/ & https://api.jellyfin.org/
@@ -58,10 +66,16 @@ func New(o *Options) *Jellyfin {
 		imageresizer:       o.Imageresizer,
 		autoRegister:       o.AutoRegister,
 		imageQualityPoster: o.ImageQualityPoster,
+		sessions:           newSessionManager(),
 	}
 	if j.serverName == "" {
 		j.serverName = "Jellyfin"
 	}
+	if o.QuickConnect {
+		j.quickConnect = newQuickConnectManager()
+	}
+	j.syncPlay = newSyncPlayManager(j.sendToDevice, j.itemIDAllowed)
+	j.collections.OnChange(j.notifyLibraryChanged)
 	return j
 }
 
@@ -74,6 +88,10 @@ func (j *Jellyfin) RegisterHandlers(s *mux.Router) {
 	middleware := func(handler http.HandlerFunc) http.Handler {
 		return handlers.CompressHandler(j.authmiddleware(http.HandlerFunc(handler)))
 	}
+	// middleware for endpoints that require a valid auth token of an administrator
+	adminMiddleware := func(handler http.HandlerFunc) http.Handler {
+		return handlers.CompressHandler(j.authmiddleware(j.adminmiddleware(http.HandlerFunc(handler))))
+	}
 
 	r.Handle("/System/Ping", http.HandlerFunc(j.systemPingHandler))
 	r.Handle("/System/Info", middleware(j.systemInfoHandler))
@@ -81,15 +99,22 @@ func (j *Jellyfin) RegisterHandlers(s *mux.Router) {
 	r.Handle("/Plugins", http.HandlerFunc(j.pluginsHandler))
 
 	r.Handle("/Users/AuthenticateByName", http.HandlerFunc(j.usersAuthenticateByNameHandler)).Methods("POST")
+	r.Handle("/Users/AuthenticateWithQuickConnect", http.HandlerFunc(j.usersAuthenticateWithQuickConnectHandler)).Methods("POST")
 	r.Handle("/QuickConnect/Authorize", middleware(j.quickConnectAuthorizeHandler)).Methods("POST")
-	r.Handle("/QuickConnect/Connect", http.HandlerFunc(j.quickConnectConnectHandler))
+	r.Handle("/QuickConnect/Connect", http.HandlerFunc(j.quickConnectConnectHandler)).Methods("GET")
 	r.Handle("/QuickConnect/Enabled", http.HandlerFunc(j.quickConnectEnabledHandler))
-	r.Handle("/QuickConnect/Initiate", http.HandlerFunc(j.quickConnectInitiateHandler)).Methods("POST")
+	r.Handle("/QuickConnect/Initiate", http.HandlerFunc(j.quickConnectInitiateHandler)).Methods("GET", "POST")
 
 	r.Handle("/Users", middleware(j.usersAllHandler))
 	r.Handle("/Users/Me", middleware(j.usersMeHandler))
+	r.Handle("/Users/New", adminMiddleware(j.usersNewHandler)).Methods("POST")
 	r.Handle("/Users/Public", http.HandlerFunc(j.usersPublicHandler))
-	r.Handle("/Users/{user}", middleware(j.usersHandler))
+	r.Handle("/Users/Configuration", middleware(j.usersConfigurationHandler)).Methods("POST")
+	r.Handle("/Users/{user}", middleware(j.usersHandler)).Methods("GET")
+	r.Handle("/Users/{user}", adminMiddleware(j.usersDeleteHandler)).Methods("DELETE")
+	r.Handle("/Users/{user}/Password", middleware(j.usersPasswordHandler)).Methods("POST")
+	r.Handle("/Users/{user}/Policy", adminMiddleware(j.usersPolicyHandler)).Methods("POST")
+	r.Handle("/Users/{user}/Configuration", middleware(j.usersConfigurationHandler)).Methods("POST")
 
 	// Legacy endpoints for Jellyfin <10.9
 	r.Handle("/Users/{user}/Views", middleware(j.usersViewsHandler))
@@ -106,13 +131,18 @@ func (j *Jellyfin) RegisterHandlers(s *mux.Router) {
 	r.Handle("/UserItems/Resume", middleware(j.usersItemsResumeHandler))
 	r.Handle("/UserItems/{item}/Userdata", middleware(j.usersItemUserDataHandler))
 
-	r.Handle("/DisplayPreferences/usersettings", middleware(j.displayPreferencesHandler))
+	r.Handle("/DisplayPreferences/{id}", middleware(j.displayPreferencesHandler)).Methods("GET")
+	r.Handle("/DisplayPreferences/{id}", middleware(j.displayPreferencesUpdateHandler)).Methods("POST")
 
 	r.Handle("/Library/VirtualFolders", middleware(j.libraryVirtualFoldersHandler))
 
 	r.Handle("/Shows/NextUp", middleware(j.showsNextUpHandler))
 	r.Handle("/Shows/{show}/Seasons", middleware(j.showsSeasonsHandler))
 	r.Handle("/Shows/{show}/Episodes", middleware(j.showsEpisodesHandler))
+	r.Handle("/Shows/{item}/Similar", middleware(j.usersItemsSimilarHandler))
+
+	r.Handle("/Movies/Recommendations", middleware(j.moviesRecommendationsHandler))
+	r.Handle("/Movies/{item}/Similar", middleware(j.usersItemsSimilarHandler))
 
 	r.Handle("/Items", middleware(j.usersItemsHandler))
 	r.Handle("/Items/Filters", middleware(j.usersItemsFiltersHandler))
@@ -131,12 +161,18 @@ func (j *Jellyfin) RegisterHandlers(s *mux.Router) {
 
 	r.Handle("/Genres", middleware(j.genresHandler))
 	r.Handle("/Genres/{genre}", middleware(j.genreHandler))
+	r.Handle("/Studios", middleware(j.studiosHandler))
+	r.Handle("/Studios/{name}", middleware(j.studioHandler))
+	r.Handle("/Years", middleware(j.yearsHandler))
+	r.Handle("/Years/{year}", middleware(j.yearHandler))
 
 	r.Handle("/Search/Hints", middleware(j.searchHintsHandler))
 
 	r.Handle("/MediaSegments/{item}", middleware(j.mediaSegmentsHandler))
 	r.Handle("/Videos/{item}/stream", middleware(j.videoStreamHandler))
 	r.Handle("/Videos/{item}/stream.{container}", middleware(j.videoStreamHandler))
+	r.Handle("/Videos/{item}/{mediasource}/Subtitles/{index}/Stream.{format}", middleware(j.videoSubtitleHandler))
+	r.Handle("/Videos/{item}/{mediasource}/Subtitles/{index}/{ticks}/Stream.{format}", middleware(j.videoSubtitleHandler))
 
 	r.Handle("/Persons", middleware(j.personsHandler))
 
@@ -156,6 +192,49 @@ func (j *Jellyfin) RegisterHandlers(s *mux.Router) {
 	r.Handle("/Sessions", middleware(j.sessionsHandler))
 	r.Handle("/Sessions/Capabilities", middleware(j.sessionsCapabilitiesHandler))
 	r.Handle("/Sessions/Capabilities/Full", middleware(j.sessionsCapabilitiesFullHandler))
+	r.Handle("/Sessions/Logout", middleware(j.sessionsLogoutHandler)).Methods("POST")
+	r.Handle("/Sessions/{session}/Playing", middleware(j.sessionsPlayHandler)).Methods("POST")
+	r.Handle("/Sessions/{session}/Playing/{command}", middleware(j.sessionsPlaystateHandler)).Methods("POST")
+	r.Handle("/Sessions/{session}/Command", middleware(j.sessionsCommandHandler)).Methods("POST")
+	r.Handle("/Sessions/{session}/Command/{command}", middleware(j.sessionsCommandHandler)).Methods("POST")
+	r.Handle("/Sessions/{session}/Message", middleware(j.sessionsMessageHandler)).Methods("POST")
+
+	// playback reporting
+	r.Handle("/user_usage_stats/PlayActivity", adminMiddleware(j.usageStatsPlayActivityHandler))
+	r.Handle("/user_usage_stats/user_activity", adminMiddleware(j.usageStatsUserActivityHandler))
+	r.Handle("/user_usage_stats/MoviesReport", adminMiddleware(j.usageStatsMoviesReportHandler))
+	r.Handle("/user_usage_stats/TvShowsReport", adminMiddleware(j.usageStatsTvShowsReportHandler))
+	r.Handle("/user_usage_stats/UserPlaylist", adminMiddleware(j.usageStatsUserPlaylistHandler))
+
+	r.Handle("/socket", middleware(j.socketHandler))
+
+	// SyncPlay
+	r.Handle("/GetUtcTime", http.HandlerFunc(j.getUtcTimeHandler))
+	r.Handle("/SyncPlay/List", middleware(j.syncPlayListHandler)).Methods("GET")
+	r.Handle("/SyncPlay/New", middleware(j.syncPlayNewHandler)).Methods("POST")
+	r.Handle("/SyncPlay/Join", middleware(j.syncPlayJoinHandler)).Methods("POST")
+	r.Handle("/SyncPlay/Leave", middleware(j.syncPlayLeaveHandler)).Methods("POST")
+	r.Handle("/SyncPlay/SetNewQueue", middleware(j.syncPlaySetNewQueueHandler)).Methods("POST")
+	r.Handle("/SyncPlay/Queue", middleware(j.syncPlayQueueHandler)).Methods("POST")
+	r.Handle("/SyncPlay/SetPlaylistItem", middleware(j.syncPlaySetPlaylistItemHandler)).Methods("POST")
+	r.Handle("/SyncPlay/RemoveFromPlaylist", middleware(j.syncPlayRemoveFromPlaylistHandler)).Methods("POST")
+	r.Handle("/SyncPlay/MovePlaylistItem", middleware(j.syncPlayMovePlaylistItemHandler)).Methods("POST")
+	r.Handle("/SyncPlay/NextItem", middleware(j.syncPlayNextItemHandler)).Methods("POST")
+	r.Handle("/SyncPlay/PreviousItem", middleware(j.syncPlayPreviousItemHandler)).Methods("POST")
+	r.Handle("/SyncPlay/SetRepeatMode", middleware(j.syncPlaySetRepeatModeHandler)).Methods("POST")
+	r.Handle("/SyncPlay/SetShuffleMode", middleware(j.syncPlaySetShuffleModeHandler)).Methods("POST")
+	r.Handle("/SyncPlay/Unpause", middleware(j.syncPlayUnpauseHandler)).Methods("POST")
+	r.Handle("/SyncPlay/Pause", middleware(j.syncPlayPauseHandler)).Methods("POST")
+	r.Handle("/SyncPlay/Stop", middleware(j.syncPlayStopHandler)).Methods("POST")
+	r.Handle("/SyncPlay/Seek", middleware(j.syncPlaySeekHandler)).Methods("POST")
+	r.Handle("/SyncPlay/Buffering", middleware(j.syncPlayBufferingHandler)).Methods("POST")
+	r.Handle("/SyncPlay/Ready", middleware(j.syncPlayReadyHandler)).Methods("POST")
+	r.Handle("/SyncPlay/SetIgnoreWait", middleware(j.syncPlaySetIgnoreWaitHandler)).Methods("POST")
+	r.Handle("/SyncPlay/Ping", middleware(j.syncPlayPingHandler)).Methods("POST")
+	r.Handle("/SyncPlay/{group}", middleware(j.syncPlayGroupHandler)).Methods("GET")
+
+	r.Handle("/Devices", middleware(j.devicesHandler)).Methods("GET")
+	r.Handle("/Devices", middleware(j.devicesDeleteHandler)).Methods("DELETE")
 
 	// playlists
 	r.Handle("/Playlists", middleware(j.createPlaylistHandler)).Methods("POST")
@@ -166,9 +245,11 @@ func (j *Jellyfin) RegisterHandlers(s *mux.Router) {
 	// Infuse posts to path ending with /
 	r.Handle("/Playlists/{playlist}/Items/", middleware(j.addPlaylistItemsHandler)).Methods("POST")
 	r.Handle("/Playlists/{playlist}/Items", middleware(j.deletePlaylistItemsHandler)).Methods("DELETE")
-	r.Handle("/Playlists/{playlist}/Items/{item}/Move/{index}", middleware(j.movePlaylistItemHandler)).Methods("GET")
+	r.Handle("/Playlists/{playlist}/Items/{item}/Move/{index}", middleware(j.movePlaylistItemHandler)).Methods("POST")
 	r.Handle("/Playlists/{playlist}/Users", middleware(j.getPlaylistAllUsersHandler)).Methods("GET")
 	r.Handle("/Playlists/{playlist}/Users/{user}", middleware(j.getPlaylistUsersHandler)).Methods("GET")
+	r.Handle("/Playlists/{playlist}/Users/{user}", middleware(j.updatePlaylistUserHandler)).Methods("POST")
+	r.Handle("/Playlists/{playlist}/Users/{user}", middleware(j.deletePlaylistUserHandler)).Methods("DELETE")
 
 	// Branding
 	r.Handle("/Branding/Configuration", middleware(j.brandingConfigurationHandler))
@@ -17,7 +17,6 @@ import (
 const (
 	// Misc IDs for api responses
 	serverID                = "2b11644442754f02a0c1e45d2a9f5c71"
-	sessionID               = "e3a869b7a901f8894de8ee65688db6c0"
 	collectionRootID        = "e9d5075a555c1cbc394eec4cef295274"
 	playlistCollectionID    = "2f0340563593c4d98b97c9bfa21ce23c"
 	favoritesCollectionID   = "f4a0b1c2d3e5c4b8a9e6f7d8e9a0b1c2"
@@ -48,7 +47,7 @@ func (j *Jellyfin) makeJFItemRoot() (response JFItem, e error) {
 	// we add the favorites and playlist collections to the child count
 	childCount += 2
 
-	genres := j.collections.Details().Genres
+	genres := j.collections.Details(nil).Genres
 
 	response = JFItem{
 		Name:                     "Media Folders",
@@ -96,7 +95,7 @@ func (j *Jellyfin) makeJItemCollection(collectionID string) (response JFItem, e
 		e = errors.New("collection not found")
 		return
 	}
-	collectionGenres := c.Details().Genres
+	collectionGenres := c.Details(nil).Genres
 
 	response = JFItem{
 		Name:                     c.Name_,
@@ -274,7 +273,7 @@ func (j *Jellyfin) makeJFItemMovie(userID string, i *collection.Item, parentID s
 
 	i.LoadNfo()
 	// fixme: this should come from collection package
-	response.MediaSources = j.makeMediaSource(i.Video, i.Nfo)
+	response.MediaSources = j.makeMediaSource(response.ID, i.Video, i.Nfo, externalSubtitles(i.SrtSubs, i.VttSubs), nil)
 	response.RunTimeTicks = response.MediaSources[0].RunTimeTicks
 	response.MediaStreams = response.MediaSources[0].MediaStreams
 
@@ -287,6 +286,7 @@ func (j *Jellyfin) makeJFItemMovie(userID string, i *collection.Item, parentID s
 	j.enrichResponseWithNFO(&response, i.Nfo)
 	if i.Nfo != nil {
 		i.Genres = response.Genres
+		i.Studios = i.Nfo.Studio
 		i.OfficialRating = response.OfficialRating
 		i.Year = response.ProductionYear
 	}
@@ -329,58 +329,16 @@ func (j *Jellyfin) makeJFItemShow(userID string, i *collection.Item, parentID st
 		response.ImageTags.Logo = "logo_" + i.ID
 	}
 
+	i.LoadNfo()
 	j.enrichResponseWithNFO(&response, i.Nfo)
 
 	response.ChildCount = len(i.Seasons)
-	// In case show does not have any seasons no need to calculate userdata
-	if response.ChildCount == 0 {
-		return response
-	}
-
-	// Calculate the number of episodes and played episode in the show
-	var playedEpisodes, totalEpisodes int
-	var lastestPlayed time.Time
+	var episodes []collection.Episode
 	for _, s := range i.Seasons {
-		for _, e := range s.Episodes {
-			totalEpisodes++
-			episodePlaystate, err := j.db.UserDataRepo.Get(userID, trimPrefix(e.ID))
-			if err == nil {
-				if episodePlaystate.Played {
-					playedEpisodes++
-					if episodePlaystate.Timestamp.After(lastestPlayed) {
-						lastestPlayed = episodePlaystate.Timestamp
-					}
-				}
-			}
-		}
-	}
-	if totalEpisodes != 0 {
-		playstate, err := j.db.UserDataRepo.Get(userID, trimPrefix(i.ID))
-		if err != nil {
-			playstate = database.UserData{
-				Timestamp: time.Now().UTC(),
-			}
-		}
-		response.UserData = j.makeJFUserData(userID, i.ID, playstate)
-
-		response.UserData.UnplayedItemCount = totalEpisodes - playedEpisodes
-		response.UserData.PlayedPercentage = 100 * playedEpisodes / totalEpisodes
-		response.UserData.LastPlayedDate = lastestPlayed
-		response.UserData.Key = response.ID
-		if playedEpisodes == response.ChildCount {
-			response.UserData.Played = true
-		}
-
-		// response.UserData = &JFUserData{
-		// 	UnplayedItemCount: totalEpisodes - playedEpisodes,
-		// 	PlayedPercentage:  100 * playedEpisodes / totalEpisodes,
-		// 	LastPlayedDate:    lastestPlayed,
-		// 	Key:               response.ID,
-		// }
-		// if playedEpisodes == response.ChildCount {
-		// 	response.UserData.Played = true
-		// }
+		episodes = append(episodes, s.Episodes...)
 	}
+	response.RecursiveItemCount = len(episodes)
+	response.UserData = j.makeJFUserDataFolder(userID, i.ID, episodes)
 	return response
 }
 
@@ -428,44 +386,7 @@ func (j *Jellyfin) makeJFItemSeason(userID, seasonID string) (response JFItem, e
 		response.SortName = "9999"
 	}
 
-	var playedEpisodes int
-	var lastestPlayed time.Time
-	for _, e := range season.Episodes {
-		episodePlaystate, err := j.db.UserDataRepo.Get(userID, trimPrefix(e.ID))
-		if err == nil {
-			if episodePlaystate.Played {
-				playedEpisodes++
-				if episodePlaystate.Timestamp.After(lastestPlayed) {
-					lastestPlayed = episodePlaystate.Timestamp
-				}
-			}
-		}
-	}
-
-	playstate, err := j.db.UserDataRepo.Get(userID, trimPrefix(seasonID))
-	if err != nil {
-		playstate = database.UserData{
-			Timestamp: time.Now().UTC(),
-		}
-	}
-	response.UserData = j.makeJFUserData(userID, seasonID, playstate)
-
-	response.UserData.UnplayedItemCount = response.ChildCount - playedEpisodes
-	response.UserData.PlayedPercentage = 100 * playedEpisodes / response.ChildCount
-	response.UserData.LastPlayedDate = lastestPlayed
-	if playedEpisodes == response.ChildCount {
-		response.UserData.Played = true
-	}
-
-	// response.UserData = &JFUserData{
-	// 	UnplayedItemCount: response.ChildCount - playedEpisodes,
-	// 	PlayedPercentage:  100 * playedEpisodes / response.ChildCount,
-	// 	LastPlayedDate:    lastestPlayed,
-	// 	Key:               response.ID,
-	// }
-	// if playedEpisodes == response.ChildCount {
-	// 	response.UserData.Played = true
-	// }
+	response.UserData = j.makeJFUserDataFolder(userID, seasonID, season.Episodes)
 
 	return response, nil
 }
@@ -520,6 +441,7 @@ func (j *Jellyfin) makeJFItemEpisode(userID, episodeID string) (response JFItem,
 		j.enrichResponseWithNFO(&response, show.Nfo)
 		if show.Nfo != nil {
 			show.Genres = response.Genres
+			show.Studios = show.Nfo.Studio
 			show.OfficialRating = response.OfficialRating
 			show.Year = response.ProductionYear
 		}
@@ -536,7 +458,7 @@ func (j *Jellyfin) makeJFItemEpisode(userID, episodeID string) (response JFItem,
 	}
 
 	// Add some generic mediasource to indicate "720p, stereo"
-	response.MediaSources = j.makeMediaSource(episode.Video, episode.Nfo)
+	response.MediaSources = j.makeMediaSource(response.ID, episode.Video, episode.Nfo, externalSubtitles(episode.SrtSubs, episode.VttSubs), nil)
 	response.RunTimeTicks = response.MediaSources[0].RunTimeTicks
 	response.MediaStreams = response.MediaSources[0].MediaStreams
 
@@ -546,9 +468,9 @@ func (j *Jellyfin) makeJFItemEpisode(userID, episodeID string) (response JFItem,
 	return response, nil
 }
 
-// makeJFItemFavoritesOverview creates a list of favorite items
-func (j *Jellyfin) makeJFItemFavoritesOverview(userID string) (items []JFItem, err error) {
-	favoriteIDs, err := j.db.UserDataRepo.GetFavorites(userID)
+// makeJFItemFavoritesOverview creates a list of favorite items the user has access to
+func (j *Jellyfin) makeJFItemFavoritesOverview(user *database.User) (items []JFItem, err error) {
+	favoriteIDs, err := j.db.UserDataRepo.GetFavorites(user.ID)
 
 	// log.Printf("makeJFItemFavoritesOverview: %+v, %+v", favoriteIDs, err)
 	if err != nil {
@@ -558,8 +480,36 @@ func (j *Jellyfin) makeJFItemFavoritesOverview(userID string) (items []JFItem, e
 	items = []JFItem{}
 	for _, itemID := range favoriteIDs {
 		c, i := j.collections.GetItemByID(itemID)
-		if i != nil {
-			item := j.makeJFItem(userID, i, CollectionIDToString(c.ID), c.Type, false)
+		if itemAllowed(user, c, i) {
+			item := j.makeJFItem(user.ID, i, CollectionIDToString(c.ID), c.Type, false)
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+// makeJFItemsByID creates the movies, shows, seasons and episodes with the
+// provided IDs the user has access to, unknown IDs are skipped.
+func (j *Jellyfin) makeJFItemsByID(user *database.User, itemIDs []string) (items []JFItem) {
+	items = []JFItem{}
+	for _, itemID := range itemIDs {
+		if !j.itemIDAllowed(user, itemID) {
+			continue
+		}
+		var item JFItem
+		var err error
+		switch {
+		case strings.HasPrefix(itemID, itemprefix_season):
+			item, err = j.makeJFItemSeason(user.ID, trimPrefix(itemID))
+		case strings.HasPrefix(itemID, itemprefix_episode):
+			item, err = j.makeJFItemEpisode(user.ID, trimPrefix(itemID))
+		default:
+			var ok bool
+			if item, ok = j.makeJFItemSearchResult(user.ID, database.SearchResult{ID: itemID}); !ok {
+				continue
+			}
+		}
+		if err == nil {
 			items = append(items, item)
 		}
 	}
@@ -599,7 +549,7 @@ func (j *Jellyfin) makeJFItemPlaylist(userID, playlistID string) (response JFIte
 		SortName:                 playlist.Name,
 		Etag:                     idhash.IdHash(playlist.ID),
 		DateCreated:              time.Now().UTC(),
-		CanDelete:                true,
+		CanDelete:                playlist.UserID == userID,
 		CanDownload:              true,
 		Path:                     "/playlist",
 		IsFolder:                 true,
@@ -615,7 +565,74 @@ func (j *Jellyfin) makeJFItemPlaylist(userID, playlistID string) (response JFIte
 	return
 }
 
-func (j *Jellyfin) makeJFItemGenre(genre string) (response JFItem) {
+// makeJFItemStudio makes a studio item, studioItemCount holds the number of items per studio.
+func (j *Jellyfin) makeJFItemStudio(studio string, studioItemCount map[string]int) (response JFItem) {
+
+	response = JFItem{
+		ID:           idhash.IdHash(studio),
+		ServerID:     serverID,
+		Type:         "Studio",
+		Name:         studio,
+		SortName:     studio,
+		Etag:         idhash.IdHash(studio),
+		DateCreated:  time.Now().UTC(),
+		PremiereDate: time.Now().UTC(),
+		LocationType: "FileSystem",
+		MediaType:    "Unknown",
+		ChildCount:   1,
+	}
+
+	if studioCount, ok := studioItemCount[studio]; ok {
+		response.ChildCount = studioCount
+	}
+
+	return
+}
+
+// makeJFItemPerson makes a person, e.g. an actor or director
+func (j *Jellyfin) makeJFItemPerson(name string) (response JFItem) {
+	response = JFItem{
+		ID:           idhash.IdHash(name),
+		ServerID:     serverID,
+		Type:         "Person",
+		Name:         name,
+		SortName:     name,
+		Etag:         idhash.IdHash(name),
+		DateCreated:  time.Now().UTC(),
+		PremiereDate: time.Now().UTC(),
+		LocationType: "FileSystem",
+		MediaType:    "Unknown",
+	}
+	return
+}
+
+// makeJFItemYear makes a production year item, yearItemCount holds the number of items per year.
+func (j *Jellyfin) makeJFItemYear(year int, yearItemCount map[int]int) (response JFItem) {
+	yearName := strconv.Itoa(year)
+
+	response = JFItem{
+		ID:             idhash.IdHash(yearName),
+		ServerID:       serverID,
+		Type:           "Year",
+		Name:           yearName,
+		SortName:       yearName,
+		Etag:           idhash.IdHash(yearName),
+		DateCreated:    time.Now().UTC(),
+		PremiereDate:   time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC),
+		ProductionYear: year,
+		LocationType:   "FileSystem",
+		MediaType:      "Unknown",
+		ChildCount:     1,
+	}
+
+	if yearCount, ok := yearItemCount[year]; ok {
+		response.ChildCount = yearCount
+	}
+
+	return
+}
+
+func (j *Jellyfin) makeJFItemGenre(genre string, genreItemCount map[string]int) (response JFItem) {
 
 	response = JFItem{
 		ID:           idhash.IdHash(genre),
@@ -631,10 +648,8 @@ func (j *Jellyfin) makeJFItemGenre(genre string) (response JFItem) {
 		ChildCount:   1,
 	}
 
-	if genreItemCount := j.collections.GenreItemCount(); genreItemCount != nil {
-		if genreCount, ok := genreItemCount[genre]; ok {
-			response.ChildCount = genreCount
-		}
+	if genreCount, ok := genreItemCount[genre]; ok {
+		response.ChildCount = genreCount
 	}
 
 	return
@@ -651,9 +666,50 @@ func (j *Jellyfin) makeJFUserData(UserID, itemID string, p database.UserData) (r
 		Key:                   UserID + "/" + itemID,
 		ItemID:                "00000000000000000000000000000000",
 	}
+	// Play count and last played date are derived from playback history,
+	// items marked as played without playing them have a play count of 0
+	stats := j.db.PlaybackHistoryRepo.GetPlayStats(UserID, trimPrefix(itemID))
+	response.PlayCount = stats.PlayCount
+	if !stats.LastPlayed.IsZero() {
+		response.LastPlayedDate = stats.LastPlayed
+	}
 	return
 }
 
+// makeJFUserDataFolder creates a JFUserData object for a show or season
+// based upon the play state of its episodes.
+func (j *Jellyfin) makeJFUserDataFolder(userID, itemID string, episodes []collection.Episode) (response *JFUserData) {
+	playstate, err := j.db.UserDataRepo.Get(userID, trimPrefix(itemID))
+	if err != nil {
+		playstate = database.UserData{}
+	}
+	response = j.makeJFUserData(userID, itemID, playstate)
+	// Play state of a folder is derived from its episodes
+	response.PlaybackPositionTicks = 0
+	response.LastPlayedDate = time.Time{}
+	response.Key = itemID
+
+	var playedEpisodes int
+	for _, e := range episodes {
+		episodePlaystate, err := j.db.UserDataRepo.Get(userID, trimPrefix(e.ID))
+		if err != nil || !episodePlaystate.Played {
+			continue
+		}
+		playedEpisodes++
+		if episodePlaystate.Timestamp.After(response.LastPlayedDate) {
+			response.LastPlayedDate = episodePlaystate.Timestamp
+		}
+	}
+
+	response.UnplayedItemCount = len(episodes) - playedEpisodes
+	response.PlayedPercentage = 0
+	if len(episodes) != 0 {
+		response.PlayedPercentage = 100 * playedEpisodes / len(episodes)
+	}
+	response.Played = len(episodes) != 0 && playedEpisodes == len(episodes)
+	return response
+}
+
 func (j *Jellyfin) enrichResponseWithNFO(response *JFItem, n *collection.Nfo) {
 	if n == nil {
 		return
@@ -694,15 +750,17 @@ func (j *Jellyfin) enrichResponseWithNFO(response *JFItem, n *collection.Nfo) {
 		response.GenreItems = makeJFGenreItems(normalizedGenres)
 	}
 
-	if n.Studio != "" {
-		response.Studios = []JFStudios{
-			{
-				Name: n.Studio,
-				ID:   idhash.IdHash(n.Studio),
-			},
-		}
+	if len(n.Studio) != 0 {
+		response.Studios = makeJFStudios(n.Studio)
 	}
 
+	if trailerURL := n.TrailerURL(); trailerURL != "" {
+		response.RemoteTrailers = []JFRemoteTrailers{{URL: trailerURL}}
+	}
+
+	// Series status, e.g. Continuing or Ended
+	response.Status = strings.TrimSpace(n.Status)
+
 	if len(n.UniqueIDs) != 0 {
 		ids := JFProviderIds{}
 		for _, id := range n.UniqueIDs {
@@ -746,7 +804,10 @@ func (j *Jellyfin) enrichResponseWithNFO(response *JFItem, n *collection.Nfo) {
 	}
 }
 
-func (j *Jellyfin) makeMediaSource(filename string, n *collection.Nfo) (mediasources []JFMediaSources) {
+// makeMediaSource returns the media source of a video, with streams based upon
+// the NFO and external subtitles. Default audio and subtitle streams are
+// selected using the preferences of the user, or defaults in case config is nil.
+func (j *Jellyfin) makeMediaSource(itemID, filename string, n *collection.Nfo, subs []collection.Subs, config *database.UserConfiguration) (mediasources []JFMediaSources) {
 	mediasource := JFMediaSources{
 		ID:                    idhash.IdHash(filename),
 		ETag:                  idhash.IdHash(filename),
@@ -776,20 +837,25 @@ func (j *Jellyfin) makeMediaSource(filename string, n *collection.Nfo) (mediasou
 	}
 
 	// log.Printf("makeMediaSource: n: %+v, n2: %+v, n3: %+v\n", n, n.FileInfo, n.FileInfo.StreamDetails)
-	if n == nil || n.FileInfo == nil || n.FileInfo.StreamDetails == nil {
-		return []JFMediaSources{mediasource}
+	if n != nil && n.FileInfo != nil && n.FileInfo.StreamDetails != nil && n.FileInfo.StreamDetails.Video != nil {
+		addNfoStreams(&mediasource, filename, n.FileInfo.StreamDetails)
 	}
+	addExternalSubtitleStreams(&mediasource, itemID, subs)
+	selectDefaultStreams(&mediasource, config)
 
-	NfoVideo := n.FileInfo.StreamDetails.Video
+	return []JFMediaSources{mediasource}
+}
+
+// addNfoStreams adds video, audio and subtitle streams described in the NFO to a media source.
+func addNfoStreams(mediasource *JFMediaSources, filename string, streamDetails *collection.StreamDetails) {
+	NfoVideo := streamDetails.Video
 	mediasource.Bitrate = NfoVideo.Bitrate
 	mediasource.RunTimeTicks = int64(NfoVideo.DurationInSeconds) * 10000000
 
-	// Take first alpha-3 language code, ignore others
-	var language string
-	if n.FileInfo.StreamDetails.Audio != nil && n.FileInfo.StreamDetails.Audio.Language != "" {
-		language = n.FileInfo.StreamDetails.Audio.Language[0:3]
-	} else {
-		language = "eng"
+	// Video stream language is the language of the first audio stream
+	language := "eng"
+	if len(streamDetails.Audio) != 0 {
+		language = nfoAudioLanguage(streamDetails.Audio[0])
 	}
 
 	// Create video stream with high-level details based upon NFO
@@ -837,11 +903,32 @@ func (j *Jellyfin) makeMediaSource(filename string, n *collection.Nfo) (mediasou
 
 	mediasource.MediaStreams = append(mediasource.MediaStreams, videostream)
 
-	// Create audio stream with high-level details based upon NFO
+	// Create audio streams with high-level details based upon NFO
+	for _, NfoAudio := range streamDetails.Audio {
+		mediasource.MediaStreams = append(mediasource.MediaStreams, makeNfoAudioStream(filename, NfoAudio, len(mediasource.MediaStreams)))
+	}
+
+	// Create streams for subtitles embedded in the video
+	for _, NfoSubtitle := range streamDetails.Subtitle {
+		mediasource.MediaStreams = append(mediasource.MediaStreams, JFMediaStreams{
+			Index:                len(mediasource.MediaStreams),
+			Type:                 "Subtitle",
+			Title:                nfoLanguage(NfoSubtitle.Language),
+			DisplayTitle:         nfoLanguage(NfoSubtitle.Language),
+			Language:             nfoLanguage(NfoSubtitle.Language),
+			IsTextSubtitleStream: true,
+			LocalizedDefault:     "Default",
+			LocalizedExternal:    "External",
+		})
+	}
+}
+
+// makeNfoAudioStream returns audio stream of a video, the first audio stream is the default.
+func makeNfoAudioStream(filename string, NfoAudio collection.AudioDetails, index int) JFMediaStreams {
 	audiostream := JFMediaStreams{
-		Index:              1,
+		Index:              index,
 		Type:               "Audio",
-		Language:           language,
+		Language:           nfoAudioLanguage(NfoAudio),
 		TimeBase:           "1/48000",
 		SampleRate:         48000,
 		AudioSpatialFormat: "None",
@@ -849,12 +936,11 @@ func (j *Jellyfin) makeMediaSource(filename string, n *collection.Nfo) (mediasou
 		LocalizedExternal:  "External",
 		IsInterlaced:       false,
 		IsAVC:              false,
-		IsDefault:          true,
+		IsDefault:          index == 1,
 		VideoRange:         "Unknown",
 		VideoRangeType:     "Unknown",
 	}
 
-	NfoAudio := n.FileInfo.StreamDetails.Audio
 	audiostream.BitRate = NfoAudio.Bitrate
 	audiostream.Channels = NfoAudio.Channels
 
@@ -898,10 +984,7 @@ func (j *Jellyfin) makeMediaSource(filename string, n *collection.Nfo) (mediasou
 	}
 
 	audiostream.DisplayTitle = audiostream.Title + " - " + strings.ToUpper(audiostream.Codec)
-
-	mediasource.MediaStreams = append(mediasource.MediaStreams, audiostream)
-
-	return []JFMediaSources{mediasource}
+	return audiostream
 }
 
 func CollectionIDToString(id int) string {
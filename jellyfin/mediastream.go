@@ -0,0 +1,269 @@
+package jellyfin
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/erikbos/jellofin-server/collection"
+	"github.com/erikbos/jellofin-server/database"
+)
+
+// Subtitle modes of user configuration
+const (
+	subtitleModeDefault    = "Default"
+	subtitleModeAlways     = "Always"
+	subtitleModeOnlyForced = "OnlyForced"
+	subtitleModeNone       = "None"
+	subtitleModeSmart      = "Smart"
+)
+
+// iso639Languages maps ISO 639-1 and bibliographic ISO 639-2 language codes
+// to ISO 639-2 terminology codes, as used by clients for language preferences.
+var iso639Languages = map[string]string{
+	"ar": "ara", "cs": "ces", "cze": "ces", "da": "dan", "de": "deu", "ger": "deu",
+	"el": "ell", "gre": "ell", "en": "eng", "es": "spa", "fi": "fin", "fr": "fra",
+	"fre": "fra", "he": "heb", "hi": "hin", "hu": "hun", "it": "ita", "ja": "jpn",
+	"ko": "kor", "nl": "nld", "dut": "nld", "no": "nor", "nb": "nob", "pl": "pol",
+	"pt": "por", "ru": "rus", "sv": "swe", "tr": "tur", "zh": "zho", "chi": "zho",
+}
+
+// GET /Videos/{item}/{mediasource}/Subtitles/{index}/Stream.srt
+// GET /Videos/{item}/{mediasource}/Subtitles/{index}/0/Stream.srt
+// GET /Videos/{item}/{mediasource}/Subtitles/{index}/0/Stream.vtt
+//
+// videoSubtitleHandler returns an external subtitle file of an item.
+func (j *Jellyfin) videoSubtitleHandler(w http.ResponseWriter, r *http.Request) {
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	itemID := vars["item"]
+	if !j.itemIDAllowed(user, itemID) {
+		http.Error(w, "Access to item not allowed", http.StatusForbidden)
+		return
+	}
+	index, err := strconv.Atoi(vars["index"])
+	if err != nil {
+		http.Error(w, "Invalid subtitle index", http.StatusBadRequest)
+		return
+	}
+
+	var directory, video string
+	var nfo *collection.Nfo
+	var subs []collection.Subs
+	if strings.HasPrefix(itemID, itemprefix_episode) {
+		c, item, _, episode := j.collections.GetEpisodeByID(trimPrefix(itemID))
+		if episode == nil {
+			http.Error(w, "Could not find episode", http.StatusNotFound)
+			return
+		}
+		episode.LoadNfo()
+		directory, video, nfo, subs = c.Directory+"/"+item.Name, episode.Video, episode.Nfo, externalSubtitles(episode.SrtSubs, episode.VttSubs)
+	} else {
+		c, i := j.collections.GetItemByID(itemID)
+		if i == nil {
+			http.Error(w, "Item not found", http.StatusNotFound)
+			return
+		}
+		i.LoadNfo()
+		directory, video, nfo, subs = c.Directory+"/"+i.Name, i.Video, i.Nfo, externalSubtitles(i.SrtSubs, i.VttSubs)
+	}
+
+	// External subtitles are the last streams of a media source
+	streams := j.makeMediaSource(itemID, video, nfo, subs, nil)[0].MediaStreams
+	sub := index - (len(streams) - len(subs))
+	if sub < 0 || sub >= len(subs) {
+		http.Error(w, "Subtitle not found", http.StatusNotFound)
+		return
+	}
+	filename, err := url.PathUnescape(subs[sub].Path)
+	if err != nil {
+		http.Error(w, "Subtitle not found", http.StatusNotFound)
+		return
+	}
+	if subtitleFormat(subs[sub]) == "vtt" {
+		w.Header().Set("content-type", "text/vtt; charset=utf-8")
+	} else {
+		w.Header().Set("content-type", "text/plain; charset=utf-8")
+	}
+	j.serveFile(w, r, directory+"/"+filename)
+}
+
+// externalSubtitles returns the srt and vtt subtitle files stored next to
+// the video. The vtt subtitles of an item also list conversions of its srt
+// subtitles, which Notflix creates when requested, these are skipped.
+func externalSubtitles(srt, vtt []collection.Subs) []collection.Subs {
+	subs := slices.Clone(srt)
+	for _, sub := range vtt {
+		converted := strings.TrimSuffix(sub.Path, path.Ext(sub.Path)) + ".srt"
+		if !slices.ContainsFunc(srt, func(s collection.Subs) bool { return s.Path == converted }) {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// subtitleFormat returns the format of a subtitle file, srt or vtt.
+func subtitleFormat(sub collection.Subs) string {
+	if strings.EqualFold(path.Ext(sub.Path), ".vtt") {
+		return "vtt"
+	}
+	return "srt"
+}
+
+// addExternalSubtitleStreams adds subtitle files stored next to the video to a media source.
+func addExternalSubtitleStreams(mediasource *JFMediaSources, itemID string, subs []collection.Subs) {
+	for _, sub := range subs {
+		index := len(mediasource.MediaStreams)
+		language := sub.Lang
+		// Unknown language
+		if language == "zz" {
+			language = ""
+		}
+		title := strings.ToUpper(language)
+		if title == "" {
+			title = "Unknown"
+		}
+		format, codec := subtitleFormat(sub), "subrip"
+		if format == "vtt" {
+			codec = "webvtt"
+		}
+		mediasource.MediaStreams = append(mediasource.MediaStreams, JFMediaStreams{
+			Index:                  index,
+			Type:                   "Subtitle",
+			Codec:                  codec,
+			Language:               language,
+			Title:                  title,
+			DisplayTitle:           title + " - " + strings.ToUpper(codec) + " - External",
+			IsExternal:             true,
+			IsTextSubtitleStream:   true,
+			SupportsExternalStream: true,
+			DeliveryMethod:         "External",
+			DeliveryURL:            fmt.Sprintf("/Videos/%s/%s/Subtitles/%d/0/Stream.%s", itemID, mediasource.ID, index, format),
+			LocalizedDefault:       "Default",
+			LocalizedExternal:      "External",
+		})
+	}
+}
+
+// selectDefaultStreams sets the default audio and subtitle stream of a media
+// source based upon the language preferences and subtitle mode of the user.
+func selectDefaultStreams(mediasource *JFMediaSources, config *database.UserConfiguration) {
+	if config == nil {
+		config = &database.UserConfiguration{
+			SubtitleMode:          subtitleModeDefault,
+			PlayDefaultAudioTrack: true,
+		}
+	}
+
+	var audio, subtitles []JFMediaStreams
+	for _, s := range mediasource.MediaStreams {
+		switch s.Type {
+		case "Audio":
+			audio = append(audio, s)
+		case "Subtitle":
+			subtitles = append(subtitles, s)
+		}
+	}
+
+	mediasource.DefaultAudioStreamIndex = -1
+	audioLanguage := ""
+	if len(audio) != 0 {
+		selected := audio[0]
+		for _, s := range audio {
+			if s.IsDefault {
+				selected = s
+				break
+			}
+		}
+		if !config.PlayDefaultAudioTrack && config.AudioLanguagePreference != "" {
+			for _, s := range audio {
+				if languageMatches(s.Language, config.AudioLanguagePreference) {
+					selected = s
+					break
+				}
+			}
+		}
+		mediasource.DefaultAudioStreamIndex = selected.Index
+		audioLanguage = selected.Language
+	}
+
+	// findSubtitle returns index of the first subtitle stream accepted by match,
+	// preferring streams in the subtitle language preference of the user.
+	findSubtitle := func(match func(s JFMediaStreams) bool) int {
+		if config.SubtitleLanguagePreference != "" {
+			for _, s := range subtitles {
+				if match(s) && languageMatches(s.Language, config.SubtitleLanguagePreference) {
+					return s.Index
+				}
+			}
+		}
+		for _, s := range subtitles {
+			if match(s) {
+				return s.Index
+			}
+		}
+		return -1
+	}
+
+	mediasource.DefaultSubtitleStreamIndex = -1
+	switch config.SubtitleMode {
+	case subtitleModeNone:
+	case subtitleModeAlways:
+		mediasource.DefaultSubtitleStreamIndex = findSubtitle(func(s JFMediaStreams) bool { return true })
+	case subtitleModeOnlyForced:
+		mediasource.DefaultSubtitleStreamIndex = findSubtitle(func(s JFMediaStreams) bool { return s.IsForced })
+	case subtitleModeSmart:
+		// Subtitles only in case audio is not in the preferred language
+		if config.AudioLanguagePreference != "" && !languageMatches(audioLanguage, config.AudioLanguagePreference) {
+			mediasource.DefaultSubtitleStreamIndex = findSubtitle(func(s JFMediaStreams) bool {
+				return config.SubtitleLanguagePreference == "" ||
+					languageMatches(s.Language, config.SubtitleLanguagePreference)
+			})
+		}
+	default:
+		mediasource.DefaultSubtitleStreamIndex = findSubtitle(func(s JFMediaStreams) bool { return s.IsDefault || s.IsForced })
+	}
+}
+
+// languageMatches returns true if both language codes refer to the same language.
+func languageMatches(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return normalizeLanguage(a) == normalizeLanguage(b)
+}
+
+// normalizeLanguage returns the ISO 639-2 terminology code of a language code.
+func normalizeLanguage(language string) string {
+	language = strings.ToLower(language)
+	if code, ok := iso639Languages[language]; ok {
+		return code
+	}
+	return language
+}
+
+// nfoLanguage returns the first alpha-3 language code of an NFO language, ignoring others.
+func nfoLanguage(language string) string {
+	if len(language) > 3 {
+		return language[0:3]
+	}
+	return language
+}
+
+// nfoAudioLanguage returns the language of an NFO audio stream, English in case unknown.
+func nfoAudioLanguage(audio collection.AudioDetails) string {
+	if language := nfoLanguage(audio.Language); language != "" {
+		return language
+	}
+	return "eng"
+}
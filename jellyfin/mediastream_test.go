@@ -0,0 +1,34 @@
+package jellyfin
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/erikbos/jellofin-server/collection"
+)
+
+func TestExternalSubtitleStreams(t *testing.T) {
+	srt := []collection.Subs{{Lang: "en", Path: "movie.en.srt"}}
+	vtt := []collection.Subs{
+		// Conversion of the srt subtitle
+		{Lang: "en", Path: "movie.en.vtt"},
+		{Lang: "nl", Path: "movie.nl.vtt"},
+	}
+	subs := externalSubtitles(srt, vtt)
+	if !slices.Equal(subs, []collection.Subs{srt[0], vtt[1]}) {
+		t.Fatalf("subtitles = %+v", subs)
+	}
+
+	mediasource := JFMediaSources{ID: "source", MediaStreams: []JFMediaStreams{{Index: 0, Type: "Video"}}}
+	addExternalSubtitleStreams(&mediasource, "item", subs)
+	want := []struct{ codec, url string }{
+		{"subrip", "/Videos/item/source/Subtitles/1/0/Stream.srt"},
+		{"webvtt", "/Videos/item/source/Subtitles/2/0/Stream.vtt"},
+	}
+	for n, w := range want {
+		s := mediasource.MediaStreams[n+1]
+		if s.Codec != w.codec || s.DeliveryURL != w.url {
+			t.Errorf("stream %d = %s %s, want %s %s", n+1, s.Codec, s.DeliveryURL, w.codec, w.url)
+		}
+	}
+}
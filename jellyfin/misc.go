@@ -2,6 +2,8 @@ package jellyfin
 
 import (
 	"net/http"
+
+	"github.com/erikbos/jellofin-server/collection"
 )
 
 // Branding/Configuration
@@ -60,12 +62,16 @@ func (j *Jellyfin) localizationOptionsHandler(w http.ResponseWriter, r *http.Req
 }
 
 // Localization/ParentalRatings
+//
+// localizationParentalRatingsHandler returns the parental ratings of all rating systems we know of,
+// value is the score used as maximum parental rating of a user.
 func (j *Jellyfin) localizationParentalRatingsHandler(w http.ResponseWriter, r *http.Request) {
-	response := []JFLocalizationParentalRatings{
-		{
-			Name:  "Unrated",
-			Value: 0,
-		},
+	response := []JFLocalizationParentalRatings{}
+	for _, rating := range collection.ParentalRatings() {
+		response = append(response, JFLocalizationParentalRatings{
+			Name:  rating.Name,
+			Value: rating.Score,
+		})
 	}
 	j.cache1h(w)
 	serveJSON(response, w)
@@ -2,8 +2,10 @@ package jellyfin
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -13,9 +15,11 @@ import (
 )
 
 type JFCreatePlaylistRequest struct {
-	Name   string   `json:"Name"`
-	UserID string   `json:"UserId"`
-	Ids    []string `json:"Ids,omitempty"`
+	Name     string                      `json:"Name"`
+	UserID   string                      `json:"UserId"`
+	Ids      []string                    `json:"Ids,omitempty"`
+	Users    []JFPlaylistUserPermissions `json:"Users,omitempty"`
+	IsPublic bool                        `json:"IsPublic,omitempty"`
 }
 
 type JFCreatePlaylistResponse struct {
@@ -23,14 +27,25 @@ type JFCreatePlaylistResponse struct {
 }
 
 type JFGetPlaylistResponse struct {
-	OpenAccess bool     `json:"OpenAccess"`
-	Shares     []string `json:"Shares"`
-	ItemIds    []string `json:"ItemIds,omitempty"`
+	OpenAccess bool                        `json:"OpenAccess"`
+	Shares     []JFPlaylistUserPermissions `json:"Shares"`
+	ItemIds    []string                    `json:"ItemIds,omitempty"`
 }
 
-type JFPlaylistAccess struct {
-	Users   []string `json:"Users"`
-	Canedit bool     `json:"CanEdit"`
+type JFUpdatePlaylistRequest struct {
+	Name     string                      `json:"Name,omitempty"`
+	Ids      []string                    `json:"Ids,omitempty"`
+	Users    []JFPlaylistUserPermissions `json:"Users,omitempty"`
+	IsPublic *bool                       `json:"IsPublic,omitempty"`
+}
+
+type JFPlaylistUserPermissions struct {
+	UserID  string `json:"UserId"`
+	CanEdit bool   `json:"CanEdit"`
+}
+
+type JFUpdatePlaylistUserRequest struct {
+	CanEdit bool `json:"CanEdit"`
 }
 
 // POST /Playlists
@@ -45,24 +60,36 @@ func (j *Jellyfin) createPlaylistHandler(w http.ResponseWriter, r *http.Request)
 	var req JFCreatePlaylistRequest
 
 	queryparams := r.URL.Query()
-	req.Name = queryparams.Get("Name")
+	req.Name = queryparams.Get("name")
 	req.UserID = queryparams.Get("userId")
 	if r.Body != nil {
 		_ = json.NewDecoder(r.Body).Decode(&req)
 	}
-	if req.Name == "" || req.UserID == "" {
-		http.Error(w, "Name and UserId are required", http.StatusBadRequest)
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	// Playlist is owned by the caller, only an administrator can create one for another user
+	if req.UserID == "" {
+		req.UserID = accessToken.UserID
+	}
+	if req.UserID != accessToken.UserID && !j.isAdmin(accessToken.UserID) {
+		http.Error(w, ErrUserNotAllowed, http.StatusForbidden)
 		return
 	}
 
 	newPlaylist := database.Playlist{
-		Name:   req.Name,
-		UserID: req.UserID,
+		Name:       req.Name,
+		UserID:     req.UserID,
+		OpenAccess: req.IsPublic,
+		Shares:     makePlaylistShares(req.UserID, req.Users),
 	}
 	if req.Ids != nil {
-		newPlaylist.ItemIDs = req.Ids
-	} else {
-		for i := range strings.SplitSeq(queryparams.Get("Ids"), ",") {
+		for _, i := range req.Ids {
+			newPlaylist.ItemIDs = append(newPlaylist.ItemIDs, trimPrefix(i))
+		}
+	} else if ids := queryparams.Get("ids"); ids != "" {
+		for i := range strings.SplitSeq(ids, ",") {
 			newPlaylist.ItemIDs = append(newPlaylist.ItemIDs, trimPrefix(i))
 		}
 	}
@@ -82,29 +109,63 @@ func (j *Jellyfin) createPlaylistHandler(w http.ResponseWriter, r *http.Request)
 
 // POST /Playlists/{playlistId}
 //
-// updatePlaylistHandler updates a playlist
+// updatePlaylistHandler updates name and/or the list of items of a playlist
 func (j *Jellyfin) updatePlaylistHandler(w http.ResponseWriter, r *http.Request) {
-	// vars := mux.Vars(r)
-	// playlistID := vars["playlist"]
-
-	// var req struct {
-	// 	Name string `json:"Name"`
-	// }
-
-	// if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-	// 	http.Error(w, "Invalid request body", http.StatusBadRequest)
-	// 	return
-	// }
-
-	// // Note: Since Jellyfin API typically creates new playlists rather than updating,
-	// // this endpoint might be used for updating playlist metadata
-	// _, err := j.db.PlaylistRepo.GetPlaylist(playlistID)
-	// if err != nil {
-	// 	http.Error(w, "Playlist not found", http.StatusNotFound)
-	// 	return
-	// }
-
-	// w.WriteHeader(http.StatusNoContent)
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	playlistID := trimPrefix(vars["playlist"])
+
+	var req JFUpdatePlaylistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
+		return
+	}
+
+	playlist := j.getEditablePlaylist(w, accessToken.UserID, playlistID)
+	if playlist == nil {
+		return
+	}
+
+	// Only the owner can change who has access to the playlist
+	if (req.Users != nil || req.IsPublic != nil) && playlist.UserID != accessToken.UserID {
+		http.Error(w, "Only the owner can change playlist access", http.StatusForbidden)
+		return
+	}
+
+	update := database.Playlist{
+		ID:   playlistID,
+		Name: req.Name,
+	}
+	if req.Ids != nil {
+		update.ItemIDs = make([]string, 0, len(req.Ids))
+		for _, id := range req.Ids {
+			update.ItemIDs = append(update.ItemIDs, trimPrefix(id))
+		}
+	}
+	if err := j.db.PlaylistRepo.UpdatePlaylist(update); err != nil {
+		http.Error(w, "Failed to update playlist", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Users != nil || req.IsPublic != nil {
+		openAccess := playlist.OpenAccess
+		if req.IsPublic != nil {
+			openAccess = *req.IsPublic
+		}
+		shares := playlist.Shares
+		if req.Users != nil {
+			shares = makePlaylistShares(playlist.UserID, req.Users)
+		}
+		if err := j.db.PlaylistRepo.UpdatePlaylistSharing(playlistID, openAccess, shares); err != nil {
+			http.Error(w, "Failed to update playlist", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // GET /Playlists/{playlistId}
@@ -127,8 +188,8 @@ func (j *Jellyfin) getPlaylistHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := JFGetPlaylistResponse{
-		OpenAccess: false,
-		Shares:     []string{},
+		OpenAccess: playlist.OpenAccess,
+		Shares:     makeJFPlaylistUserPermissions(playlist),
 		ItemIds:    playlist.ItemIDs,
 	}
 	serveJSON(response, w)
@@ -152,17 +213,37 @@ func (j *Jellyfin) getPlaylistItemsHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
 	items := []JFItem{}
-	for _, itemID := range playlist.ItemIDs {
-		c, i := j.collections.GetItemByID(itemID)
-		if c != nil || i != nil {
-			items = append(items, j.makeJFItem(accessToken.UserID, i, idhash.IdHash(c.Name_), c.Type, true))
+	for _, entry := range playlist.Entries {
+		// Skip items in a shared playlist the user has no access to
+		if !j.itemIDAllowed(user, entry.ItemID) {
+			continue
+		}
+		var item JFItem
+		if c, i := j.collections.GetItemByID(entry.ItemID); i != nil {
+			item = j.makeJFItem(accessToken.UserID, i, idhash.IdHash(c.Name_), c.Type, true)
+		} else if episode, err := j.makeJFItemEpisode(accessToken.UserID, entry.ItemID); err == nil {
+			item = episode
+		} else {
+			log.Printf("getPlaylistItemsHandler: item %s not found\n", entry.ItemID)
+			continue
 		}
+		item.PlaylistItemID = entry.ID
+		items = append(items, item)
 	}
+
+	queryparams := r.URL.Query()
+	totalItemCount := len(items)
+	responseItems, startIndex := j.applyItemPaginating(items, queryparams)
 	response := UserItemsResponse{
-		Items:            items,
-		TotalRecordCount: len(items),
-		StartIndex:       0,
+		Items:            responseItems,
+		TotalRecordCount: totalItemCount,
+		StartIndex:       startIndex,
 	}
 	serveJSON(response, w)
 }
@@ -181,8 +262,14 @@ func (j *Jellyfin) addPlaylistItemsHandler(w http.ResponseWriter, r *http.Reques
 	queryparams := r.URL.Query()
 
 	var itemIDs []string
-	for ID := range strings.SplitSeq(queryparams.Get("Ids"), ",") {
-		itemIDs = append(itemIDs, trimPrefix(ID))
+	for ID := range strings.SplitSeq(queryparams.Get("ids"), ",") {
+		if ID != "" {
+			itemIDs = append(itemIDs, trimPrefix(ID))
+		}
+	}
+
+	if j.getEditablePlaylist(w, accessToken.UserID, trimPrefix(playlistID)) == nil {
+		return
 	}
 
 	if err := j.db.PlaylistRepo.AddItemsToPlaylist(accessToken.UserID, trimPrefix(playlistID), itemIDs); err != nil {
@@ -193,76 +280,257 @@ func (j *Jellyfin) addPlaylistItemsHandler(w http.ResponseWriter, r *http.Reques
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// GET /Playlists/{playlistId}/Items/{itemId}/Move/{newIndex}
+// POST /Playlists/{playlistId}/Items/{playlistItemId}/Move/{newIndex}
 //
-// movePlaylistItemHandler moves an item in a playlist
+// movePlaylistItemHandler moves an entry in a playlist to a new position
 func (j *Jellyfin) movePlaylistItemHandler(w http.ResponseWriter, r *http.Request) {
-	// vars := mux.Vars(r)
-	// playlistID := vars["playlist"]
-	// itemID := vars["itemId"]
-	// newIndex, err := strconv.Atoi(vars["newIndex"])
-	// if err != nil {
-	// 	http.Error(w, "Invalid newIndex", http.StatusBadRequest)
-	// 	return
-	// }
-
-	// if err := j.db.PlaylistRepo.MovePlaylistItem(playlistID, itemID, newIndex); err != nil {
-	// 	http.Error(w, "Failed to move item", http.StatusInternalServerError)
-	// 	return
-	// }
-
-	// w.WriteHeader(http.StatusNoContent)
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	playlistID := trimPrefix(vars["playlist"])
+	newIndex, err := strconv.Atoi(vars["index"])
+	if err != nil || newIndex < 0 {
+		http.Error(w, "Invalid newIndex", http.StatusBadRequest)
+		return
+	}
+
+	if j.getEditablePlaylist(w, accessToken.UserID, playlistID) == nil {
+		return
+	}
+
+	err = j.db.PlaylistRepo.MovePlaylistItem(playlistID, vars["item"], newIndex)
+	if errors.Is(err, database.ErrPlaylistEntryNotFound) {
+		http.Error(w, "Playlist item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to move item", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// DELETE /Playlists/{playlistId}/Items
+// DELETE /Playlists/{playlistId}/Items?entryIds=
 //
-// deletePlaylistItemsHandler deletes items from a playlist
+// deletePlaylistItemsHandler deletes entries from a playlist
 func (j *Jellyfin) deletePlaylistItemsHandler(w http.ResponseWriter, r *http.Request) {
-	// vars := mux.Vars(r)
-	// playlistID := vars["playlist"]
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
 
-	// itemIDs := r.URL.Query()["Ids"]
-	// if len(itemIDs) == 0 {
-	// 	http.Error(w, "Ids parameter required", http.StatusBadRequest)
-	// 	return
-	// }
+	vars := mux.Vars(r)
+	playlistID := trimPrefix(vars["playlist"])
+
+	var entryIDs []string
+	for _, entry := range r.URL.Query()["entryIds"] {
+		for id := range strings.SplitSeq(entry, ",") {
+			if id != "" {
+				entryIDs = append(entryIDs, id)
+			}
+		}
+	}
+	if len(entryIDs) == 0 {
+		http.Error(w, "EntryIds parameter required", http.StatusBadRequest)
+		return
+	}
 
-	// if err := j.db.PlaylistRepo.DeleteItemsFromPlaylist(playlistID, itemIDs); err != nil {
-	// 	http.Error(w, "Failed to delete items", http.StatusInternalServerError)
-	// 	return
-	// }
+	if j.getEditablePlaylist(w, accessToken.UserID, playlistID) == nil {
+		return
+	}
+
+	if err := j.db.PlaylistRepo.DeleteItemsFromPlaylist(playlistID, entryIDs); err != nil {
+		http.Error(w, "Failed to delete items", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	// w.WriteHeader(http.StatusNoContent)
+// deletePlaylist deletes a playlist, only its owner is allowed to do so.
+func (j *Jellyfin) deletePlaylist(w http.ResponseWriter, userID, playlistID string) {
+	playlist, err := j.db.PlaylistRepo.GetPlaylist(userID, playlistID)
+	if err != nil {
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
+	}
+	if playlist.UserID != userID {
+		http.Error(w, "Only the owner can delete a playlist", http.StatusForbidden)
+		return
+	}
+	if err := j.db.PlaylistRepo.DeletePlaylist(playlistID); err != nil {
+		http.Error(w, "Failed to delete playlist", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // GET /Playlists/{playlistId}/Users
 //
-// getPlaylistAllUsersHandler retrieves users with access to a playlist. Always returns the current user.
+// getPlaylistAllUsersHandler retrieves users with access to a playlist.
 func (j *Jellyfin) getPlaylistAllUsersHandler(w http.ResponseWriter, r *http.Request) {
 	accessToken := j.getAccessTokenDetails(w, r)
 	if accessToken == nil {
 		return
 	}
-	response := []JFPlaylistAccess{
-		{
-			Users:   []string{accessToken.UserID},
-			Canedit: true,
-		},
+
+	vars := mux.Vars(r)
+	playlist, err := j.db.PlaylistRepo.GetPlaylist(accessToken.UserID, trimPrefix(vars["playlist"]))
+	if err != nil {
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
 	}
-	serveJSON(response, w)
+	serveJSON(makeJFPlaylistUserPermissions(playlist), w)
 }
 
 // GET /Playlists/{playlistId}/Users/{user}
 //
-// getPlaylistUsersHandler retrieves users with access to a playlist. Always returns the current user.
+// getPlaylistUsersHandler retrieves access permissions of a user to a playlist.
 func (j *Jellyfin) getPlaylistUsersHandler(w http.ResponseWriter, r *http.Request) {
 	accessToken := j.getAccessTokenDetails(w, r)
 	if accessToken == nil {
 		return
 	}
-	response := JFPlaylistAccess{
-		Users:   []string{accessToken.UserID},
-		Canedit: true,
+
+	vars := mux.Vars(r)
+	playlist, err := j.db.PlaylistRepo.GetPlaylist(accessToken.UserID, trimPrefix(vars["playlist"]))
+	if err != nil {
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
 	}
-	serveJSON(response, w)
+	for _, permissions := range makeJFPlaylistUserPermissions(playlist) {
+		if permissions.UserID == vars["user"] {
+			serveJSON(permissions, w)
+			return
+		}
+	}
+	http.Error(w, "User has no access to playlist", http.StatusNotFound)
+}
+
+// POST /Playlists/{playlistId}/Users/{user}
+//
+// updatePlaylistUserHandler shares a playlist with a user, or changes the user's permissions.
+func (j *Jellyfin) updatePlaylistUserHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	playlistID := trimPrefix(vars["playlist"])
+	userID := vars["user"]
+
+	var req JFUpdatePlaylistUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := j.db.PlaylistRepo.GetPlaylist(accessToken.UserID, playlistID)
+	if err != nil {
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
+	}
+	if playlist.UserID != accessToken.UserID {
+		http.Error(w, "Only the owner can change playlist access", http.StatusForbidden)
+		return
+	}
+	if userID == playlist.UserID {
+		http.Error(w, "Owner always has access to playlist", http.StatusBadRequest)
+		return
+	}
+	if _, err := j.db.UserRepo.GetByID(userID); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	share := database.PlaylistShare{
+		UserID:  userID,
+		CanEdit: req.CanEdit,
+	}
+	if err := j.db.PlaylistRepo.SetPlaylistShare(playlistID, share); err != nil {
+		http.Error(w, "Failed to update playlist", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /Playlists/{playlistId}/Users/{user}
+//
+// deletePlaylistUserHandler stops sharing a playlist with a user. The owner can
+// remove every user, other users can only remove themselves.
+func (j *Jellyfin) deletePlaylistUserHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	playlistID := trimPrefix(vars["playlist"])
+	userID := vars["user"]
+
+	playlist, err := j.db.PlaylistRepo.GetPlaylist(accessToken.UserID, playlistID)
+	if err != nil {
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return
+	}
+	if playlist.UserID != accessToken.UserID && userID != accessToken.UserID {
+		http.Error(w, "Only the owner can change playlist access", http.StatusForbidden)
+		return
+	}
+
+	if err := j.db.PlaylistRepo.DeletePlaylistShare(playlistID, userID); err != nil {
+		http.Error(w, "Failed to update playlist", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getEditablePlaylist returns a playlist in case the user is allowed to change it,
+// otherwise it writes an error response and returns nil.
+func (j *Jellyfin) getEditablePlaylist(w http.ResponseWriter, userID, playlistID string) *database.Playlist {
+	playlist, err := j.db.PlaylistRepo.GetPlaylist(userID, playlistID)
+	if err != nil {
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+		return nil
+	}
+	if !playlist.CanEdit(userID) {
+		http.Error(w, "Not allowed to change playlist", http.StatusForbidden)
+		return nil
+	}
+	return playlist
+}
+
+// makeJFPlaylistUserPermissions returns the permissions of all users having access
+// to a playlist, the owner is always listed first.
+func makeJFPlaylistUserPermissions(playlist *database.Playlist) []JFPlaylistUserPermissions {
+	permissions := []JFPlaylistUserPermissions{
+		{
+			UserID:  playlist.UserID,
+			CanEdit: true,
+		},
+	}
+	for _, share := range playlist.Shares {
+		permissions = append(permissions, JFPlaylistUserPermissions{
+			UserID:  share.UserID,
+			CanEdit: share.CanEdit,
+		})
+	}
+	return permissions
+}
+
+// makePlaylistShares converts requested user permissions into playlist shares, skipping the owner.
+func makePlaylistShares(ownerID string, users []JFPlaylistUserPermissions) []database.PlaylistShare {
+	shares := make([]database.PlaylistShare, 0, len(users))
+	for _, u := range users {
+		if u.UserID != "" && u.UserID != ownerID {
+			shares = append(shares, database.PlaylistShare{
+				UserID:  u.UserID,
+				CanEdit: u.CanEdit,
+			})
+		}
+	}
+	return shares
 }
@@ -0,0 +1,340 @@
+package jellyfin
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Quick Connect lets a device log in without typing a password: the device
+// initiates a request and shows a code, a logged in user authorizes the code
+// on another device after which the device exchanges its secret for an
+// access token. Requests are kept in memory and expire after a few minutes.
+
+const (
+	// quickConnectExpiry expires requests that have not been used for this long
+	quickConnectExpiry = 10 * time.Minute
+	// quickConnectMaxPending is the maximum number of pending requests, new
+	// requests are refused until pending requests expire or are used
+	quickConnectMaxPending = 100
+	// quickConnectRateWindow is the period rate limits apply to
+	quickConnectRateWindow = time.Minute
+	// quickConnectInitiateLimit is the number of requests that can be initiated from a remote address per window
+	quickConnectInitiateLimit = 5
+	// quickConnectAuthorizeLimit is the number of invalid codes a user can enter per window
+	quickConnectAuthorizeLimit = 5
+
+	ErrQuickConnectDisabled      = "quick connect is disabled"
+	ErrQuickConnectNotFound      = "quick connect request not found"
+	ErrQuickConnectNotAuthorized = "quick connect request not authorized"
+	ErrQuickConnectRateLimited   = "too many quick connect requests, try again later"
+)
+
+var (
+	errQuickConnectNotFound    = errors.New(ErrQuickConnectNotFound)
+	errQuickConnectRateLimited = errors.New(ErrQuickConnectRateLimited)
+)
+
+// quickConnectRequest is a login request of a device.
+type quickConnectRequest struct {
+	Secret string
+	Code   string
+	// Device that initiated the request
+	DeviceID           string
+	DeviceName         string
+	Client             string
+	ApplicationVersion string
+	Created            time.Time
+	// UserID is the user that authorized the request, empty if not authorized yet
+	UserID string
+}
+
+type quickConnectManager struct {
+	mu sync.Mutex
+	// requests keyed by secret
+	requests map[string]*quickConnectRequest
+	// attempts holds times of rate limited actions, keyed by action and address or user
+	attempts map[string][]time.Time
+}
+
+func newQuickConnectManager() *quickConnectManager {
+	return &quickConnectManager{
+		requests: make(map[string]*quickConnectRequest),
+		attempts: make(map[string][]time.Time),
+	}
+}
+
+// initiate creates a request for a device. Requests are limited per remote
+// address, as device IDs are provided by the client.
+func (m *quickConnectManager) initiate(remoteAddress string, embyHeader *authSchemeValues) (quickConnectRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+	key := "initiate/" + remoteAddress
+	if m.rateLimited(key, quickConnectInitiateLimit) || len(m.requests) >= quickConnectMaxPending {
+		return quickConnectRequest{}, errQuickConnectRateLimited
+	}
+	m.attempts[key] = append(m.attempts[key], time.Now())
+
+	code, err := m.newCode()
+	if err != nil {
+		return quickConnectRequest{}, err
+	}
+	request := &quickConnectRequest{
+		Secret:             rand.Text(),
+		Code:               code,
+		DeviceID:           embyHeader.deviceID,
+		DeviceName:         embyHeader.device,
+		Client:             embyHeader.client,
+		ApplicationVersion: embyHeader.version,
+		Created:            time.Now().UTC(),
+	}
+	m.requests[request.Secret] = request
+	return *request, nil
+}
+
+// get returns a copy of the request with the provided secret.
+func (m *quickConnectManager) get(secret string) (quickConnectRequest, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+	request, ok := m.requests[secret]
+	if !ok {
+		return quickConnectRequest{}, false
+	}
+	return *request, true
+}
+
+// authorize marks the pending request with the code as authorized by a user.
+// Users entering too many invalid codes are rate limited to prevent guessing.
+func (m *quickConnectManager) authorize(code, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+	key := "authorize/" + userID
+	if m.rateLimited(key, quickConnectAuthorizeLimit) {
+		return errQuickConnectRateLimited
+	}
+	for _, request := range m.requests {
+		if request.Code == code && request.UserID == "" {
+			request.UserID = userID
+			return nil
+		}
+	}
+	m.attempts[key] = append(m.attempts[key], time.Now())
+	return errQuickConnectNotFound
+}
+
+// redeem removes an authorized request and returns it, a secret can only be used once.
+func (m *quickConnectManager) redeem(secret string) (quickConnectRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+	request, ok := m.requests[secret]
+	if !ok {
+		return quickConnectRequest{}, errQuickConnectNotFound
+	}
+	if request.UserID == "" {
+		return quickConnectRequest{}, errors.New(ErrQuickConnectNotAuthorized)
+	}
+	delete(m.requests, secret)
+	return *request, nil
+}
+
+// newCode returns a random 6 digit code not used by a pending request, caller must hold the lock.
+func (m *quickConnectManager) newCode() (string, error) {
+	for {
+		n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+		if err != nil {
+			return "", err
+		}
+		code := fmt.Sprintf("%06d", n.Int64())
+		inUse := false
+		for _, request := range m.requests {
+			if request.Code == code {
+				inUse = true
+			}
+		}
+		if !inUse {
+			return code, nil
+		}
+	}
+}
+
+// rateLimited returns true if an action has been attempted limit times
+// within the rate window, caller must hold the lock.
+func (m *quickConnectManager) rateLimited(key string, limit int) bool {
+	cutoff := time.Now().Add(-quickConnectRateWindow)
+	var recent []time.Time
+	for _, t := range m.attempts[key] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) == 0 {
+		delete(m.attempts, key)
+	} else {
+		m.attempts[key] = recent
+	}
+	return len(recent) >= limit
+}
+
+// expire removes expired requests and attempts, caller must hold the lock.
+func (m *quickConnectManager) expire() {
+	cutoff := time.Now().UTC().Add(-quickConnectExpiry)
+	for secret, request := range m.requests {
+		if request.Created.Before(cutoff) {
+			delete(m.requests, secret)
+		}
+	}
+	for key := range m.attempts {
+		m.rateLimited(key, 0)
+	}
+}
+
+// GET /QuickConnect/Enabled
+//
+// quickConnectEnabledHandler returns boolean whether quickconnect is enabled.
+func (j *Jellyfin) quickConnectEnabledHandler(w http.ResponseWriter, r *http.Request) {
+	serveJSON(j.quickConnect != nil, w)
+}
+
+// POST /QuickConnect/Initiate
+//
+// quickConnectInitiateHandler starts a quick connect request of the device,
+// the device needs to show the returned code to the user.
+func (j *Jellyfin) quickConnectInitiateHandler(w http.ResponseWriter, r *http.Request) {
+	if j.quickConnect == nil {
+		http.Error(w, ErrQuickConnectDisabled, http.StatusUnauthorized)
+		return
+	}
+	embyHeader, err := j.parseAuthHeader(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	request, err := j.quickConnect.initiate(remoteAddress(r), embyHeader)
+	if err != nil {
+		if errors.Is(err, errQuickConnectRateLimited) {
+			http.Error(w, ErrQuickConnectRateLimited, http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serveJSON(makeJFQuickConnectResult(request), w)
+}
+
+// GET /QuickConnect/Connect?secret=2N5DRIVQ6UFJKYGBTZVXTR43EN
+//
+// quickConnectConnectHandler returns the state of a quick connect request,
+// polled by the device until the request has been authorized.
+func (j *Jellyfin) quickConnectConnectHandler(w http.ResponseWriter, r *http.Request) {
+	if j.quickConnect == nil {
+		http.Error(w, ErrQuickConnectDisabled, http.StatusUnauthorized)
+		return
+	}
+	request, ok := j.quickConnect.get(r.URL.Query().Get("secret"))
+	if !ok {
+		http.Error(w, ErrQuickConnectNotFound, http.StatusNotFound)
+		return
+	}
+	serveJSON(makeJFQuickConnectResult(request), w)
+}
+
+// POST /QuickConnect/Authorize?code=123456&userId=2b1ec0a52b09456c9823a367d84ac9e5
+//
+// quickConnectAuthorizeHandler authorizes a quick connect request by its code,
+// logging in the device as the user.
+func (j *Jellyfin) quickConnectAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+	if j.quickConnect == nil {
+		http.Error(w, ErrQuickConnectDisabled, http.StatusUnauthorized)
+		return
+	}
+
+	queryparams := r.URL.Query()
+	userID := queryparams.Get("userId")
+	if userID == "" {
+		userID = accessToken.UserID
+	}
+	if userID != accessToken.UserID && !j.isAdmin(accessToken.UserID) {
+		http.Error(w, ErrUserNotAllowed, http.StatusForbidden)
+		return
+	}
+
+	if err := j.quickConnect.authorize(queryparams.Get("code"), userID); err != nil {
+		if errors.Is(err, errQuickConnectRateLimited) {
+			http.Error(w, ErrQuickConnectRateLimited, http.StatusTooManyRequests)
+			return
+		}
+		http.Error(w, ErrQuickConnectNotFound, http.StatusNotFound)
+		return
+	}
+	serveJSON(true, w)
+}
+
+// POST /Users/AuthenticateWithQuickConnect
+//
+// usersAuthenticateWithQuickConnectHandler exchanges the secret of an
+// authorized quick connect request for an access token.
+func (j *Jellyfin) usersAuthenticateWithQuickConnectHandler(w http.ResponseWriter, r *http.Request) {
+	if j.quickConnect == nil {
+		http.Error(w, ErrQuickConnectDisabled, http.StatusUnauthorized)
+		return
+	}
+	var body JFAuthenticateWithQuickConnectRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
+		return
+	}
+
+	request, err := j.quickConnect.redeem(body.Secret)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	user, err := j.db.UserRepo.GetByID(request.UserID)
+	if err != nil || user.Disabled {
+		http.Error(w, "user not found or disabled", http.StatusUnauthorized)
+		return
+	}
+
+	// Log in the device that initiated the request in case the header is missing
+	embyHeader, err := j.parseAuthHeader(r)
+	if err != nil {
+		embyHeader = &authSchemeValues{
+			deviceID: request.DeviceID,
+			device:   request.DeviceName,
+			client:   request.Client,
+			version:  request.ApplicationVersion,
+		}
+	}
+	j.serveAuthenticationResult(w, r, embyHeader, user)
+}
+
+// makeJFQuickConnectResult returns the state of a quick connect request.
+func makeJFQuickConnectResult(request quickConnectRequest) JFQuickConnectResult {
+	return JFQuickConnectResult{
+		Authenticated: request.UserID != "",
+		Secret:        request.Secret,
+		Code:          request.Code,
+		DeviceID:      request.DeviceID,
+		DeviceName:    request.DeviceName,
+		AppName:       request.Client,
+		AppVersion:    request.ApplicationVersion,
+		DateAdded:     request.Created,
+	}
+}
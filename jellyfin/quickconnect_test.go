@@ -0,0 +1,145 @@
+package jellyfin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestQuickConnectExpiry(t *testing.T) {
+	m := newQuickConnectManager()
+	request, err := m.initiate("10.0.0.1", &authSchemeValues{deviceID: "tv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.requests[request.Secret].Created = time.Now().UTC().Add(-quickConnectExpiry - time.Second)
+
+	if _, ok := m.get(request.Secret); ok {
+		t.Error("expired request found")
+	}
+	if err := m.authorize(request.Code, "erik"); !errors.Is(err, errQuickConnectNotFound) {
+		t.Errorf("authorize expired request: err = %v, want %v", err, errQuickConnectNotFound)
+	}
+}
+
+func TestQuickConnectRedeemOnce(t *testing.T) {
+	m := newQuickConnectManager()
+	request, err := m.initiate("10.0.0.1", &authSchemeValues{deviceID: "tv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.redeem(request.Secret); err == nil {
+		t.Fatal("request redeemed before it was authorized")
+	}
+	if err := m.authorize(request.Code, "erik"); err != nil {
+		t.Fatal(err)
+	}
+	// A code can only be authorized once
+	if err := m.authorize(request.Code, "anna"); !errors.Is(err, errQuickConnectNotFound) {
+		t.Errorf("authorize twice: err = %v, want %v", err, errQuickConnectNotFound)
+	}
+	redeemed, err := m.redeem(request.Secret)
+	if err != nil || redeemed.UserID != "erik" || redeemed.DeviceID != "tv" {
+		t.Fatalf("redeem = %+v, %v", redeemed, err)
+	}
+	if _, err := m.redeem(request.Secret); !errors.Is(err, errQuickConnectNotFound) {
+		t.Errorf("redeem twice: err = %v, want %v", err, errQuickConnectNotFound)
+	}
+}
+
+func TestQuickConnectAuthorizeRateLimit(t *testing.T) {
+	m := newQuickConnectManager()
+	request, err := m.initiate("10.0.0.1", &authSchemeValues{deviceID: "tv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := "1000000"
+	for range quickConnectAuthorizeLimit {
+		if err := m.authorize(invalid, "erik"); !errors.Is(err, errQuickConnectNotFound) {
+			t.Fatalf("authorize invalid code: err = %v", err)
+		}
+	}
+	// Guessing stops, even for a valid code
+	if err := m.authorize(request.Code, "erik"); !errors.Is(err, errQuickConnectRateLimited) {
+		t.Errorf("authorize after too many invalid codes: err = %v, want %v", err, errQuickConnectRateLimited)
+	}
+	if err := m.authorize(request.Code, "anna"); err != nil {
+		t.Errorf("authorize of other user: %v", err)
+	}
+}
+
+func TestQuickConnectInitiateLimits(t *testing.T) {
+	m := newQuickConnectManager()
+	tv := &authSchemeValues{deviceID: "tv"}
+	for range quickConnectInitiateLimit {
+		if _, err := m.initiate("10.0.0.1", tv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.initiate("10.0.0.1", tv); !errors.Is(err, errQuickConnectRateLimited) {
+		t.Errorf("initiate after limit: err = %v, want %v", err, errQuickConnectRateLimited)
+	}
+	// Other addresses are not limited
+	first, err := m.initiate("10.0.0.2", tv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pending requests over the maximum are refused, pending requests are kept
+	for n := len(m.requests); n < quickConnectMaxPending; n++ {
+		secret := fmt.Sprintf("secret%d", n)
+		m.requests[secret] = &quickConnectRequest{Secret: secret, Created: time.Now().UTC()}
+	}
+	if _, err := m.initiate("10.0.0.3", tv); !errors.Is(err, errQuickConnectRateLimited) {
+		t.Errorf("initiate with maximum pending requests: err = %v, want %v", err, errQuickConnectRateLimited)
+	}
+	if _, ok := m.get(first.Secret); !ok {
+		t.Error("pending request removed")
+	}
+}
+
+func TestQuickConnectInitiateRotatingDeviceIDs(t *testing.T) {
+	m := newQuickConnectManager()
+	for n := range quickConnectInitiateLimit {
+		if _, err := m.initiate("10.0.0.1", &authSchemeValues{deviceID: fmt.Sprintf("device%d", n)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A new device ID does not reset the limit of an address
+	if _, err := m.initiate("10.0.0.1", &authSchemeValues{deviceID: "another"}); !errors.Is(err, errQuickConnectRateLimited) {
+		t.Errorf("initiate with new device ID after limit: err = %v, want %v", err, errQuickConnectRateLimited)
+	}
+}
+
+func TestQuickConnectLogin(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.login(t, "erik", "tv")
+
+	req, _ := http.NewRequest("POST", s.URL+"/QuickConnect/Initiate", nil)
+	req.Header.Set("Authorization", `MediaBrowser Client="app", Device="Phone", DeviceId="phone", Version="1.0"`)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result JFQuickConnectResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp := s.do(t, "POST", "/QuickConnect/Authorize?code="+result.Code, token, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("authorize: status %d", resp.StatusCode)
+	}
+	secret := map[string]string{"Secret": result.Secret}
+	resp = s.do(t, "POST", "/Users/AuthenticateWithQuickConnect", "", secret)
+	var auth JFAuthenticateByNameResponse
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil || auth.AccessToken == "" || auth.SessionInfo.DeviceId != "phone" {
+		t.Fatalf("authenticate: status %d, %+v, %v", resp.StatusCode, auth, err)
+	}
+	if resp := s.do(t, "POST", "/Users/AuthenticateWithQuickConnect", "", secret); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("authenticate twice: status %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
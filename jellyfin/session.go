@@ -1,40 +1,355 @@
 package jellyfin
 
 import (
+	"encoding/json"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/erikbos/jellofin-server/idhash"
 )
 
-// /Sessions
+const (
+	ErrSessionNotFound         = "session not found"
+	ErrSessionNoRemoteControl  = "session does not support remote control"
+	ErrSessionCommandNotSent   = "failed to send command to session"
+	ErrSessionInvalidCommand   = "invalid command"
+	ErrSessionItemNotFound     = "item not found"
+	ErrSessionItemIDsRequired  = "itemIds required"
+	ErrSessionMessageTextEmpty = "message text required"
+)
+
+// playCommands are the commands supported by POST /Sessions/{session}/Playing
+var playCommands = []string{"PlayNow", "PlayNext", "PlayLast", "PlayInstantMix", "PlayShuffle"}
+
+// playstateCommands are the commands supported by POST /Sessions/{session}/Playing/{command}
+var playstateCommands = []string{"Stop", "Pause", "Unpause", "NextTrack", "PreviousTrack",
+	"Seek", "Rewind", "FastForward", "PlayPause"}
+
+// GET /Sessions?activeWithinSeconds=960&deviceId=0dabe147-5d08-4e70-adde-d6b778b725aa
+// GET /Sessions?controllableByUserId=2b1ec0a52b09456c9823a367d84ac9e5
 //
-// sessionsHandler returns a list of active user sessions known to the server.
+// sessionsHandler returns a list of active sessions known to the server.
+// Administrators get to see sessions of all users. In case controllableByUserId
+// is provided only sessions that user can control remotely are returned.
 func (j *Jellyfin) sessionsHandler(w http.ResponseWriter, r *http.Request) {
 	accessToken := j.getAccessTokenDetails(w, r)
 	if accessToken == nil {
 		return
 	}
-	dbuser, err := j.db.UserRepo.GetByID(accessToken.UserID)
-	if err != nil {
-		http.Error(w, ErrUserIDNotFound, http.StatusNotFound)
+
+	queryparams := r.URL.Query()
+	deviceID := queryparams.Get("deviceId")
+	var activeSince time.Time
+	if seconds, err := strconv.Atoi(queryparams.Get("activeWithinSeconds")); err == nil && seconds > 0 {
+		activeSince = time.Now().UTC().Add(-time.Duration(seconds) * time.Second)
+	}
+
+	userID := accessToken.UserID
+	controllableByUserID := queryparams.Get("controllableByUserId")
+	if controllableByUserID != "" {
+		if controllableByUserID != userID && !j.isAdmin(userID) {
+			http.Error(w, ErrUserNotAllowed, http.StatusForbidden)
+			return
+		}
+		userID = controllableByUserID
+	}
+
+	response := j.makeJFSessions(userID, deviceID, activeSince)
+	if controllableByUserID != "" {
+		response = slices.DeleteFunc(response, func(s JFSessionResponse) bool {
+			return !s.SupportsRemoteControl
+		})
+	}
+	serveJSON(response, w)
+}
+
+// POST /Sessions/Capabilities?playableMediaTypes=Video&supportedCommands=Play,DisplayMessage&supportsMediaControl=true
+//
+// sessionsCapabilitiesHandler stores the capabilities of the client.
+func (j *Jellyfin) sessionsCapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	session := j.getSessionDetails(w, r)
+	if session == nil {
+		return
+	}
+
+	queryparams := r.URL.Query()
+	supportsMediaControl, _ := strconv.ParseBool(queryparams.Get("supportsMediaControl"))
+	supportsPersistentIdentifier, _ := strconv.ParseBool(queryparams.Get("supportsPersistentIdentifier"))
+	capabilities := JFSessionResponseCapabilities{
+		PlayableMediaTypes:           splitQueryParam(queryparams.Get("playableMediaTypes"), ","),
+		SupportedCommands:            splitQueryParam(queryparams.Get("supportedCommands"), ","),
+		SupportsMediaControl:         supportsMediaControl,
+		SupportsPersistentIdentifier: supportsPersistentIdentifier,
+	}
+	j.sessions.setCapabilities(session.UserID, session.DeviceID, capabilities)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /Sessions/Capabilities/Full
+//
+// sessionsCapabilitiesFullHandler stores the capabilities of the client.
+func (j *Jellyfin) sessionsCapabilitiesFullHandler(w http.ResponseWriter, r *http.Request) {
+	session := j.getSessionDetails(w, r)
+	if session == nil {
+		return
+	}
+
+	var capabilities JFSessionResponseCapabilities
+	if err := json.NewDecoder(r.Body).Decode(&capabilities); err != nil {
+		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
+		return
+	}
+	j.sessions.setCapabilities(session.UserID, session.DeviceID, capabilities)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /Sessions/Logout
+//
+// sessionsLogoutHandler logs out the user by revoking the access token used.
+func (j *Jellyfin) sessionsLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+	if err := j.db.AccessTokenRepo.Delete(accessToken.Token); err != nil {
+		http.Error(w, "Failed to logout", http.StatusInternalServerError)
+		return
+	}
+	if session := j.getSessionDetails(w, r); session != nil {
+		j.sessions.remove(session.UserID, session.DeviceID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /Sessions/{session}/Playing?playCommand=PlayNow&itemIds=2b1ec0a52b09456c9823a367d84ac9e5&startPositionTicks=0
+//
+// sessionsPlayHandler instructs a session to play items.
+func (j *Jellyfin) sessionsPlayHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+	target := j.sessionsControlTarget(w, r, accessToken.UserID)
+	if target == nil {
+		return
+	}
+
+	queryparams := r.URL.Query()
+	request := JFPlayRequest{
+		ItemIDs:           splitQueryParam(queryparams.Get("itemIds"), ","),
+		PlayCommand:       queryparams.Get("playCommand"),
+		MediaSourceID:     queryparams.Get("mediaSourceId"),
+		ControllingUserID: accessToken.UserID,
+	}
+	if len(request.ItemIDs) == 0 {
+		http.Error(w, ErrSessionItemIDsRequired, http.StatusBadRequest)
+		return
+	}
+	for _, itemID := range request.ItemIDs {
+		if !j.itemIDAllowed(user, itemID) {
+			http.Error(w, ErrSessionItemNotFound, http.StatusNotFound)
+			return
+		}
+	}
+	if request.PlayCommand == "" {
+		request.PlayCommand = "PlayNow"
+	}
+	if !slices.Contains(playCommands, request.PlayCommand) {
+		http.Error(w, ErrSessionInvalidCommand, http.StatusBadRequest)
+		return
+	}
+	if v, err := strconv.Atoi(queryparams.Get("startPositionTicks")); err == nil {
+		request.StartPositionTicks = v
+	}
+	if v, err := strconv.Atoi(queryparams.Get("startIndex")); err == nil {
+		request.StartIndex = v
+	}
+	if v, err := strconv.Atoi(queryparams.Get("audioStreamIndex")); err == nil {
+		request.AudioStreamIndex = &v
+	}
+	if v, err := strconv.Atoi(queryparams.Get("subtitleStreamIndex")); err == nil {
+		request.SubtitleStreamIndex = &v
+	}
+	j.sessionsSendCommand(w, target, socketMessagePlay, request)
+}
+
+// POST /Sessions/{session}/Playing/{command}?seekPositionTicks=1200000000
+//
+// sessionsPlaystateHandler instructs a session to pause, seek, stop, etc. playback.
+func (j *Jellyfin) sessionsPlaystateHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+	target := j.sessionsControlTarget(w, r, accessToken.UserID)
+	if target == nil {
 		return
 	}
 
-	remoteAdress := strings.Split(r.RemoteAddr, ":")
+	// Commands are case insensitive
+	vars := mux.Vars(r)
+	index := slices.IndexFunc(playstateCommands, func(c string) bool {
+		return strings.EqualFold(c, vars["command"])
+	})
+	if index == -1 {
+		http.Error(w, ErrSessionInvalidCommand, http.StatusBadRequest)
+		return
+	}
+	request := JFPlaystateRequest{
+		Command:           playstateCommands[index],
+		ControllingUserID: accessToken.UserID,
+	}
+	if v, err := strconv.Atoi(r.URL.Query().Get("seekPositionTicks")); err == nil {
+		request.SeekPositionTicks = v
+	}
+	j.sessionsSendCommand(w, target, socketMessagePlaystate, request)
+}
+
+// POST /Sessions/{session}/Command
+// POST /Sessions/{session}/Command/{command}
+//
+// sessionsCommandHandler sends a general command to a session, e.g. SetVolume.
+// The command is provided in the path or as JSON body including arguments.
+func (j *Jellyfin) sessionsCommandHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+	target := j.sessionsControlTarget(w, r, accessToken.UserID)
+	if target == nil {
+		return
+	}
 
-	// Every connected client gets to see the same session details ;-)
+	var request JFGeneralCommand
+	if command, ok := mux.Vars(r)["command"]; ok {
+		request.Name = command
+	} else if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
+		return
+	}
+	if request.Name == "" {
+		http.Error(w, ErrSessionInvalidCommand, http.StatusBadRequest)
+		return
+	}
+	if request.Arguments == nil {
+		request.Arguments = map[string]string{}
+	}
+	request.ControllingUserID = accessToken.UserID
+	j.sessionsSendCommand(w, target, socketMessageGeneralCommand, request)
+}
+
+// POST /Sessions/{session}/Message
+//
+// sessionsMessageHandler sends a message to be displayed by a session.
+func (j *Jellyfin) sessionsMessageHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+	target := j.sessionsControlTarget(w, r, accessToken.UserID)
+	if target == nil {
+		return
+	}
+
+	var message JFMessageCommand
+	if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
+		return
+	}
+	if message.Text == "" {
+		http.Error(w, ErrSessionMessageTextEmpty, http.StatusBadRequest)
+		return
+	}
+	request := JFGeneralCommand{
+		Name:              "DisplayMessage",
+		ControllingUserID: accessToken.UserID,
+		Arguments: map[string]string{
+			"Header": message.Header,
+			"Text":   message.Text,
+		},
+	}
+	if message.TimeoutMs != nil {
+		request.Arguments["TimeoutMs"] = strconv.Itoa(*message.TimeoutMs)
+	}
+	j.sessionsSendCommand(w, target, socketMessageGeneralCommand, request)
+}
+
+// sessionsControlTarget returns the session to be controlled by a user. Users
+// can control their own sessions, administrators can control all sessions.
+//
+// if not found or not allowed sends an HTTP error
+func (j *Jellyfin) sessionsControlTarget(w http.ResponseWriter, r *http.Request, userID string) *session {
+	target, ok := j.sessions.get(mux.Vars(r)["session"])
+	if !ok || (target.UserID != userID && !j.isAdmin(userID)) {
+		http.Error(w, ErrSessionNotFound, http.StatusNotFound)
+		return nil
+	}
+	if !j.sessions.connected(target.UserID, target.DeviceID) {
+		http.Error(w, ErrSessionNoRemoteControl, http.StatusBadRequest)
+		return nil
+	}
+	return &target
+}
+
+// sessionsSendCommand sends a command to the clients of a session.
+func (j *Jellyfin) sessionsSendCommand(w http.ResponseWriter, target *session, messageType string, command any) {
+	if !j.sendToDevice(target.UserID, target.DeviceID, messageType, command) {
+		http.Error(w, ErrSessionCommandNotSent, http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// makeJFSessions returns the sessions visible to a user, optionally of one
+// device and active since a point in time. Administrators see all sessions.
+func (j *Jellyfin) makeJFSessions(userID, deviceID string, activeSince time.Time) []JFSessionResponse {
+	admin := j.isAdmin(userID)
+
+	response := []JFSessionResponse{}
+	for _, s := range j.sessions.getAll() {
+		if s.UserID != userID && !admin {
+			continue
+		}
+		if (deviceID != "" && s.DeviceID != deviceID) || s.LastActivity.Before(activeSince) {
+			continue
+		}
+		response = append(response, j.makeJFSession(userID, s))
+	}
+	return response
+}
+
+// makeJFSession returns session details, including the item being played.
+func (j *Jellyfin) makeJFSession(userID string, s session) JFSessionResponse {
+	capabilities := JFSessionResponseCapabilities{
+		PlayableMediaTypes: []string{},
+		SupportedCommands:  []string{},
+	}
+	if s.Capabilities != nil {
+		capabilities = *s.Capabilities
+	}
 	response := JFSessionResponse{
-		ID:                    sessionID,
-		UserID:                accessToken.UserID,
-		UserName:              dbuser.Username,
-		LastActivityDate:      accessToken.LastUsed,
-		RemoteEndPoint:        remoteAdress[0],
-		DeviceName:            "Client",
-		DeviceID:              "Client",
-		Client:                "curl",
-		ApplicationVersion:    "1.0",
+		ID:                    s.ID,
+		UserID:                s.UserID,
+		UserName:              s.UserName,
+		LastActivityDate:      s.LastActivity,
+		LastPlaybackCheckIn:   s.LastPlaybackCheckIn,
+		RemoteEndPoint:        s.RemoteAddress,
+		DeviceName:            s.DeviceName,
+		DeviceID:              s.DeviceID,
+		Client:                s.Client,
+		ApplicationVersion:    s.ApplicationVersion,
 		IsActive:              true,
-		SupportsMediaControl:  false,
-		SupportsRemoteControl: false,
+		SupportsMediaControl:  capabilities.SupportsMediaControl,
+		SupportsRemoteControl: j.sessions.connected(s.UserID, s.DeviceID),
 		HasCustomDeviceName:   false,
 		ServerID:              serverID,
 		AdditionalUsers:       []string{},
@@ -42,29 +357,31 @@ func (j *Jellyfin) sessionsHandler(w http.ResponseWriter, r *http.Request) {
 			RepeatMode:    "RepeatNone",
 			PlaybackOrder: "Default",
 		},
-		Capabilities: JFSessionResponseCapabilities{
-			PlayableMediaTypes:           []string{},
-			SupportedCommands:            []string{},
-			SupportsPersistentIdentifier: true,
-		},
+		Capabilities:             capabilities,
 		NowPlayingQueue:          []string{},
 		NowPlayingQueueFullItems: []string{},
-		SupportedCommands:        []string{},
-		PlayableMediaTypes:       []string{},
+		SupportedCommands:        capabilities.SupportedCommands,
+		PlayableMediaTypes:       capabilities.PlayableMediaTypes,
 	}
-	serveJSON(response, w)
-}
-
-// /Sessions/Capabilities
-//
-// sessionsCapabilitiesHandler accepts the capabilities of the client. Ignored.
-func (j *Jellyfin) sessionsCapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNoContent)
+	if np := s.NowPlaying; np != nil {
+		response.PlayState.PositionTicks = np.PositionTicks
+		response.PlayState.CanSeek = np.CanSeek
+		response.PlayState.IsPaused = np.IsPaused
+		response.PlayState.IsMuted = np.IsMuted
+		response.PlayState.MediaSourceID = np.MediaSourceID
+		response.PlayState.PlayMethod = np.PlayMethod
+		if item, ok := j.makeJFItemNowPlaying(userID, np.ItemID); ok {
+			response.NowPlayingItem = &item
+		}
+	}
+	return response
 }
 
-// /Sessions/Capabilities/Full
-//
-// sessionsCapabilitiesFullHandler accepts the capabilities of the client. Ignored.
-func (j *Jellyfin) sessionsCapabilitiesFullHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNoContent)
+// makeJFItemNowPlaying returns the movie or episode being played.
+func (j *Jellyfin) makeJFItemNowPlaying(userID, itemID string) (JFItem, bool) {
+	if c, i := j.collections.GetItemByID(trimPrefix(itemID)); i != nil {
+		return j.makeJFItem(userID, i, idhash.IdHash(c.Name_), c.Type, true), true
+	}
+	item, err := j.makeJFItemEpisode(userID, trimPrefix(itemID))
+	return item, err == nil
 }
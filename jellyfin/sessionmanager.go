@@ -0,0 +1,245 @@
+package jellyfin
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/erikbos/jellofin-server/database"
+	"github.com/erikbos/jellofin-server/idhash"
+)
+
+// The session manager keeps track of connected clients. A session is created
+// by the first request of a user on a device and is updated on every request,
+// sessions that have not been active for sessionIdleTimeout are expired.
+
+const (
+	// sessionIdleTimeout expires sessions without requests for this duration
+	sessionIdleTimeout = 15 * time.Minute
+)
+
+// session is a client connected to the server, identified by its user and device ID.
+type session struct {
+	ID                 string
+	UserID             string
+	UserName           string
+	DeviceID           string
+	DeviceName         string
+	Client             string
+	ApplicationVersion string
+	RemoteAddress      string
+	LastActivity       time.Time
+	// LastPlaybackCheckIn is the time of the last playback report
+	LastPlaybackCheckIn time.Time
+	// Capabilities as reported by the client, nil if not reported
+	Capabilities *JFSessionResponseCapabilities
+	// NowPlaying is the item being played, nil if not playing
+	NowPlaying *sessionNowPlaying
+}
+
+// key returns the key of the session, the user and device.
+func (s *session) key() sessionKey {
+	return sessionKey{userID: s.UserID, deviceID: s.DeviceID}
+}
+
+// sessionNowPlaying holds the item being played in a session and its play state.
+type sessionNowPlaying struct {
+	ItemID        string
+	MediaSourceID string
+	PlaySessionID string
+	PlayMethod    string
+	PositionTicks int
+	CanSeek       bool
+	IsPaused      bool
+	IsMuted       bool
+}
+
+// sessionKey identifies the session of a user on a device, a device can be
+// used by multiple users at the same time.
+type sessionKey struct {
+	userID   string
+	deviceID string
+}
+
+type sessionManager struct {
+	mu       sync.Mutex
+	sessions map[sessionKey]*session
+	// sockets holds the connected WebSockets of clients
+	sockets map[*socketConn]bool
+}
+
+func newSessionManager() *sessionManager {
+	return &sessionManager{
+		sessions: make(map[sessionKey]*session),
+		sockets:  make(map[*socketConn]bool),
+	}
+}
+
+// update registers activity of a user on a device, creating a session if
+// needed, and returns a copy of the session. The device is the one the access
+// token was issued to, other device details are taken from the emby
+// authorization header of that device, or from the access token otherwise.
+func (m *sessionManager) update(r *http.Request, embyHeader *authSchemeValues, accessToken *database.AccessToken, user *database.User) session {
+	deviceID, deviceName, client, version := accessToken.DeviceID, accessToken.DeviceName,
+		accessToken.Client, accessToken.ApplicationVersion
+	// Tokens issued before devices were stored do not have a device, use the
+	// device of the request or a device of its own for each of these tokens
+	if deviceID == "" && embyHeader != nil {
+		deviceID = embyHeader.deviceID
+	}
+	if deviceID == "" {
+		deviceID = r.URL.Query().Get("deviceId")
+	}
+	if deviceID == "" {
+		deviceID = "token-" + idhash.IdHash(accessToken.Token)
+	}
+	if embyHeader != nil && embyHeader.deviceID == deviceID {
+		deviceName, client, version = embyHeader.device, embyHeader.client, embyHeader.version
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+	key := sessionKey{userID: user.ID, deviceID: deviceID}
+	s, ok := m.sessions[key]
+	if !ok {
+		s = &session{
+			ID:       idhash.IdHash(deviceID + user.ID),
+			UserID:   user.ID,
+			DeviceID: deviceID,
+		}
+		m.sessions[key] = s
+	}
+	s.UserName = user.Username
+	s.DeviceName = deviceName
+	s.Client = client
+	s.ApplicationVersion = version
+	s.RemoteAddress = remoteAddress(r)
+	s.LastActivity = time.Now().UTC()
+	return *s
+}
+
+// touch registers activity of a user on a device without request, e.g. a WebSocket keepalive.
+func (m *sessionManager) touch(userID, deviceID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[sessionKey{userID: userID, deviceID: deviceID}]; ok {
+		s.LastActivity = time.Now().UTC()
+	}
+}
+
+// setCapabilities stores the capabilities reported by a device of a user.
+func (m *sessionManager) setCapabilities(userID, deviceID string, capabilities JFSessionResponseCapabilities) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[sessionKey{userID: userID, deviceID: deviceID}]; ok {
+		s.Capabilities = &capabilities
+	}
+}
+
+// setNowPlaying stores the item a user plays on a device, nil means playback has stopped.
+func (m *sessionManager) setNowPlaying(userID, deviceID string, nowPlaying *sessionNowPlaying) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.sessions[sessionKey{userID: userID, deviceID: deviceID}]; ok {
+		s.NowPlaying = nowPlaying
+		s.LastPlaybackCheckIn = time.Now().UTC()
+	}
+}
+
+// remove ends the session of a user on a device.
+func (m *sessionManager) remove(userID, deviceID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, sessionKey{userID: userID, deviceID: deviceID})
+}
+
+// get returns a copy of the session with the provided ID.
+func (m *sessionManager) get(sessionID string) (session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+	for _, s := range m.sessions {
+		if s.ID == sessionID {
+			return *s, true
+		}
+	}
+	return session{}, false
+}
+
+// getAll returns copies of all active sessions, most recently active first.
+func (m *sessionManager) getAll() []session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+	sessions := make([]session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, *s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastActivity.After(sessions[j].LastActivity)
+	})
+	return sessions
+}
+
+// expire removes idle sessions, caller must hold the lock.
+func (m *sessionManager) expire() {
+	cutoff := time.Now().UTC().Add(-sessionIdleTimeout)
+	for key, s := range m.sessions {
+		if s.LastActivity.Before(cutoff) {
+			delete(m.sessions, key)
+		}
+	}
+}
+
+// addSocket registers a WebSocket connection of a client.
+func (m *sessionManager) addSocket(s *socketConn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sockets[s] = true
+}
+
+// removeSocket unregisters a WebSocket connection of a client.
+func (m *sessionManager) removeSocket(s *socketConn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sockets, s)
+}
+
+// connected returns true if a device of a user has a WebSocket connection,
+// which allows the device to be controlled remotely.
+func (m *sessionManager) connected(userID, deviceID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for s := range m.sockets {
+		if s.userID == userID && s.deviceID == deviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// getSockets returns the WebSocket connections matching filter, nil matches all connections.
+func (m *sessionManager) getSockets(filter func(*socketConn) bool) []*socketConn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sockets []*socketConn
+	for s := range m.sockets {
+		if filter == nil || filter(s) {
+			sockets = append(sockets, s)
+		}
+	}
+	return sockets
+}
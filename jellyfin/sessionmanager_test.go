@@ -0,0 +1,57 @@
+package jellyfin
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/erikbos/jellofin-server/database"
+)
+
+func TestSessionManagerUpdate(t *testing.T) {
+	m := newSessionManager()
+	r := httptest.NewRequest("GET", "/", nil)
+	erik, anna := &database.User{ID: "erik"}, &database.User{ID: "anna"}
+	tv := &database.AccessToken{DeviceID: "tv", DeviceName: "TV"}
+
+	s1 := m.update(r, nil, tv, erik)
+	// Another user on the same device gets its own session
+	s2 := m.update(r, nil, tv, anna)
+	if s1.ID == s2.ID || len(m.getAll()) != 2 {
+		t.Errorf("sessions of two users on one device: %s, %s, %d sessions", s1.ID, s2.ID, len(m.getAll()))
+	}
+
+	// The device of the access token is used, not the one claimed by the header
+	header := &authSchemeValues{deviceID: "phone", device: "Phone", client: "app"}
+	if s := m.update(r, header, tv, anna); s.ID != s2.ID || s.DeviceName != "TV" {
+		t.Errorf("session with header of other device = %+v, want session %s of TV", s, s2.ID)
+	}
+	header.deviceID = "tv"
+	if s := m.update(r, header, tv, anna); s.DeviceName != "Phone" || s.Client != "app" {
+		t.Errorf("session details not taken from header of device: %+v", s)
+	}
+
+	m.setNowPlaying("anna", "tv", &sessionNowPlaying{ItemID: "item"})
+	if s, _ := m.get(s1.ID); s.NowPlaying != nil {
+		t.Error("playback of one user set on session of another user")
+	}
+	m.remove("anna", "tv")
+	if _, ok := m.get(s1.ID); !ok {
+		t.Error("removing session of one user removed session of another user")
+	}
+
+	// Tokens issued before devices were stored get the device of the request,
+	// or a device of their own
+	legacy := &database.AccessToken{Token: "legacy"}
+	socket := httptest.NewRequest("GET", "/socket?api_key=legacy&deviceId=phone", nil)
+	if s := m.update(socket, nil, legacy, erik); s.DeviceID != "phone" {
+		t.Errorf("device of token without device and deviceId parameter = %q, want phone", s.DeviceID)
+	}
+	s3 := m.update(r, nil, legacy, erik)
+	s4 := m.update(r, nil, &database.AccessToken{Token: "other"}, erik)
+	if s3.DeviceID == "" || s3.ID == s4.ID {
+		t.Errorf("sessions of tokens without device: %+v, %+v", s3, s4)
+	}
+	if s := m.update(r, nil, legacy, erik); s.ID != s3.ID {
+		t.Errorf("session of token without device changed: %s, want %s", s.ID, s3.ID)
+	}
+}
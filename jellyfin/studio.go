@@ -0,0 +1,181 @@
+package jellyfin
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/erikbos/jellofin-server/collection"
+	"github.com/erikbos/jellofin-server/idhash"
+)
+
+// /Studios
+//
+// studiosHandler returns a list of studios and networks for one or all collections.
+func (j *Jellyfin) studiosHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
+	queryparams := r.URL.Query()
+
+	allowed := j.collectionItemFilter(queryparams.Get("parentId"), userItemFilter(user))
+	// Count once as counting walks all items
+	studioItemCount := j.collections.StudioItemCount(allowed)
+	studios := []JFItem{}
+	for _, s := range j.collectionDetails(queryparams.Get("parentId"), allowed).Studios {
+		studios = append(studios, j.makeJFItemStudio(s, studioItemCount))
+	}
+
+	totalItemCount := len(studios)
+	responseItems, startIndex := j.applyItemPaginating(j.applyItemSorting(studios, queryparams), queryparams)
+	response := UserItemsResponse{
+		Items:            responseItems,
+		TotalRecordCount: totalItemCount,
+		StartIndex:       startIndex,
+	}
+	serveJSON(response, w)
+}
+
+// /Studios/HBO
+//
+// studioHandler returns details of a specific studio, items are counted
+// within the collection provided as parentId.
+func (j *Jellyfin) studioHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	studioParam, _ := url.PathUnescape(vars["name"])
+	if studioParam == "" {
+		http.Error(w, "Missing studio", http.StatusBadRequest)
+		return
+	}
+
+	allowed := j.collectionItemFilter(r.URL.Query().Get("parentId"), userItemFilter(user))
+	for _, studio := range j.collections.Details(allowed).Studios {
+		if studio == studioParam {
+			response := j.makeJFItemStudio(studio, j.collections.StudioItemCount(allowed))
+			serveJSON(response, w)
+			return
+		}
+	}
+	http.Error(w, "Studio not found", http.StatusNotFound)
+}
+
+// /Years?parentId=collection_1&sortBy=SortName&sortOrder=Descending
+//
+// yearsHandler returns a list of production years for one or all collections.
+func (j *Jellyfin) yearsHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
+	queryparams := r.URL.Query()
+
+	allowed := j.collectionItemFilter(queryparams.Get("parentId"), userItemFilter(user))
+	years := j.collectionDetails(queryparams.Get("parentId"), allowed).Years
+
+	// Count once as counting walks all items
+	yearItemCount := j.collections.YearItemCount(allowed)
+	items := []JFItem{}
+	for _, y := range years {
+		items = append(items, j.makeJFItemYear(y, yearItemCount))
+	}
+
+	totalItemCount := len(items)
+	responseItems, startIndex := j.applyItemPaginating(j.applyItemSorting(items, queryparams), queryparams)
+	response := UserItemsResponse{
+		Items:            responseItems,
+		TotalRecordCount: totalItemCount,
+		StartIndex:       startIndex,
+	}
+	serveJSON(response, w)
+}
+
+// /Years/1982
+//
+// yearHandler returns details of a specific production year, items are
+// counted within the collection provided as parentId.
+func (j *Jellyfin) yearHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	year, err := strconv.Atoi(vars["year"])
+	if err != nil {
+		http.Error(w, "Invalid year", http.StatusBadRequest)
+		return
+	}
+
+	allowed := j.collectionItemFilter(r.URL.Query().Get("parentId"), userItemFilter(user))
+	if slices.Contains(j.collections.Details(allowed).Years, year) {
+		serveJSON(j.makeJFItemYear(year, j.collections.YearItemCount(allowed)), w)
+		return
+	}
+	http.Error(w, "Year not found", http.StatusNotFound)
+}
+
+// collectionDetails returns details of the allowed items of the collection provided
+// as parentId, or of all collections in case no parentId is provided.
+func (j *Jellyfin) collectionDetails(parentID string,
+	allowed func(c *collection.Collection, i *collection.Item) bool) (details collection.CollectionDetails) {
+	if parentID == "" {
+		return j.collections.Details(allowed)
+	}
+	// Not every collection has details (e.g. dynamic collections such as playlists or favorites)
+	if c := j.collections.GetCollection(strings.TrimPrefix(parentID, itemprefix_collection)); c != nil {
+		return c.Details(allowed)
+	}
+	return
+}
+
+// collectionItemFilter returns a filter that restricts allowed to items of the
+// collection provided as parentId, or to items of all collections in case no
+// parentId is provided.
+func (j *Jellyfin) collectionItemFilter(parentID string,
+	allowed func(c *collection.Collection, i *collection.Item) bool) func(c *collection.Collection, i *collection.Item) bool {
+	if parentID == "" {
+		return allowed
+	}
+	parent := j.collections.GetCollection(strings.TrimPrefix(parentID, itemprefix_collection))
+	return func(c *collection.Collection, i *collection.Item) bool {
+		return parent != nil && c.ID == parent.ID && allowed(c, i)
+	}
+}
+
+func makeJFStudios(array []string) (studios []JFStudios) {
+	for _, v := range array {
+		studios = append(studios, JFStudios{
+			Name: v,
+			ID:   idhash.IdHash(v),
+		})
+	}
+	return studios
+}
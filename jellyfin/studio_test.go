@@ -0,0 +1,69 @@
+package jellyfin
+
+import (
+	"encoding/json"
+	"maps"
+	"testing"
+
+	"github.com/erikbos/jellofin-server/collection"
+)
+
+func TestStudiosAndYearsCountedPerCollection(t *testing.T) {
+	s := newTestServer(t)
+	s.setCollections(collection.Collections{
+		{ID: 1, Name_: "Movies", Type: collection.CollectionMovies, Items: []*collection.Item{
+			{ID: "sopranos", Name: "The Sopranos", Type: collection.ItemTypeMovie, Studios: []string{"HBO"}, Year: 1999},
+			{ID: "wire", Name: "The Wire", Type: collection.ItemTypeMovie, Studios: []string{"HBO"}, Year: 2002},
+		}},
+		{ID: 2, Name_: "Shows", Type: collection.CollectionShows, Items: []*collection.Item{
+			{ID: "chernobyl", Name: "Chernobyl", Type: collection.ItemTypeShow, Studios: []string{"HBO"}, Year: 1999},
+		}},
+	})
+	_, token := s.login(t, "erik", "tv")
+
+	childCount := func(path string) int {
+		t.Helper()
+		var item JFItem
+		if err := json.NewDecoder(s.do(t, "GET", path, token, nil).Body).Decode(&item); err != nil {
+			t.Fatal(err)
+		}
+		return item.ChildCount
+	}
+	childCounts := func(path string) map[string]int {
+		t.Helper()
+		var response UserItemsResponse
+		if err := json.NewDecoder(s.do(t, "GET", path, token, nil).Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		counts := make(map[string]int)
+		for _, item := range response.Items {
+			counts[item.Name] = item.ChildCount
+		}
+		return counts
+	}
+
+	tests := []struct {
+		path string
+		want map[string]int
+	}{
+		{path: "/Studios", want: map[string]int{"HBO": 3}},
+		{path: "/Studios?parentId=collection_2", want: map[string]int{"HBO": 1}},
+		{path: "/Years", want: map[string]int{"1999": 2, "2002": 1}},
+		{path: "/Years?parentId=collection_2", want: map[string]int{"1999": 1}},
+	}
+	for _, tt := range tests {
+		if got := childCounts(tt.path); !maps.Equal(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	if got := childCount("/Studios/HBO?parentId=collection_1"); got != 2 {
+		t.Errorf("HBO items of collection 1 = %d, want 2", got)
+	}
+	if got := childCount("/Years/1999?parentId=collection_2"); got != 1 {
+		t.Errorf("1999 items of collection 2 = %d, want 1", got)
+	}
+	if got := childCount("/Years/1999"); got != 2 {
+		t.Errorf("1999 items = %d, want 2", got)
+	}
+}
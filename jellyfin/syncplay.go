@@ -0,0 +1,337 @@
+package jellyfin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// SyncPlay endpoints. Requests are handled asynchronously like Jellyfin does,
+// results are sent to the members of a group as SyncPlayGroupUpdate and
+// SyncPlayCommand messages over their WebSocket.
+
+const (
+	ErrSyncPlayNoWebSocket   = "SyncPlay requires a WebSocket connection"
+	ErrSyncPlayGroupNotFound = "group not found"
+)
+
+// GET /GetUtcTime
+//
+// getUtcTimeHandler returns the time of the server, used by clients to
+// synchronize their clock for SyncPlay.
+func (j *Jellyfin) getUtcTimeHandler(w http.ResponseWriter, r *http.Request) {
+	response := JFUtcTimeResponse{
+		RequestReceptionTime: time.Now().UTC(),
+	}
+	response.ResponseTransmissionTime = time.Now().UTC()
+	serveJSON(response, w)
+}
+
+// GET /SyncPlay/List
+//
+// syncPlayListHandler returns all groups the user can join.
+func (j *Jellyfin) syncPlayListHandler(w http.ResponseWriter, r *http.Request) {
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+	serveJSON(j.syncPlay.list(user), w)
+}
+
+// GET /SyncPlay/{group}
+//
+// syncPlayGroupHandler returns details of a group.
+func (j *Jellyfin) syncPlayGroupHandler(w http.ResponseWriter, r *http.Request) {
+	user := j.getUserDetails(w, r)
+	if user == nil {
+		return
+	}
+	group, ok := j.syncPlay.get(user, mux.Vars(r)["group"])
+	if !ok {
+		http.Error(w, ErrSyncPlayGroupNotFound, http.StatusNotFound)
+		return
+	}
+	serveJSON(group, w)
+}
+
+// POST /SyncPlay/New
+//
+// syncPlayNewHandler creates a group and joins it.
+func (j *Jellyfin) syncPlayNewHandler(w http.ResponseWriter, r *http.Request) {
+	member := j.syncPlayMember(w, r)
+	if member == nil {
+		return
+	}
+	var request JFSyncPlayNewGroupRequest
+	if !syncPlayDecode(w, r, &request) {
+		return
+	}
+	j.syncPlay.newGroup(*member, request.GroupName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /SyncPlay/Join
+//
+// syncPlayJoinHandler joins a group.
+func (j *Jellyfin) syncPlayJoinHandler(w http.ResponseWriter, r *http.Request) {
+	member := j.syncPlayMember(w, r)
+	if member == nil {
+		return
+	}
+	var request JFSyncPlayJoinGroupRequest
+	if !syncPlayDecode(w, r, &request) {
+		return
+	}
+	j.syncPlay.join(*member, request.GroupID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /SyncPlay/Leave
+//
+// syncPlayLeaveHandler leaves the current group.
+func (j *Jellyfin) syncPlayLeaveHandler(w http.ResponseWriter, r *http.Request) {
+	session := j.getSessionDetails(w, r)
+	if session == nil {
+		return
+	}
+	if !j.syncPlay.leaveGroup(session.key()) {
+		j.syncPlay.sendNotInGroup(session.key())
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /SyncPlay/SetNewQueue
+//
+// syncPlaySetNewQueueHandler replaces the queue of the group and starts playback.
+func (j *Jellyfin) syncPlaySetNewQueueHandler(w http.ResponseWriter, r *http.Request) {
+	session := j.getSessionDetails(w, r)
+	user := j.getUserDetails(w, r)
+	if session == nil || user == nil {
+		return
+	}
+	var request JFSyncPlaySetNewQueueRequest
+	if !syncPlayDecode(w, r, &request) {
+		return
+	}
+	j.syncPlay.queueRequest(session.key(), user, request.PlayingQueue, func(g *syncPlayGroup) {
+		g.setQueue(request.PlayingQueue, request.PlayingItemPosition, request.StartPositionTicks)
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /SyncPlay/Queue
+//
+// syncPlayQueueHandler adds items to the queue of the group.
+func (j *Jellyfin) syncPlayQueueHandler(w http.ResponseWriter, r *http.Request) {
+	session := j.getSessionDetails(w, r)
+	user := j.getUserDetails(w, r)
+	if session == nil || user == nil {
+		return
+	}
+	var request JFSyncPlayQueueRequest
+	if !syncPlayDecode(w, r, &request) {
+		return
+	}
+	j.syncPlay.queueRequest(session.key(), user, request.ItemIDs, func(g *syncPlayGroup) {
+		g.queue(request.ItemIDs, request.Mode)
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /SyncPlay/SetPlaylistItem
+//
+// syncPlaySetPlaylistItemHandler starts playback of an item in the queue.
+func (j *Jellyfin) syncPlaySetPlaylistItemHandler(w http.ResponseWriter, r *http.Request) {
+	var request JFSyncPlayPlaylistItemRequest
+	j.syncPlayRequest(w, r, &request, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.setPlaylistItem(request.PlaylistItemID)
+	})
+}
+
+// POST /SyncPlay/RemoveFromPlaylist
+//
+// syncPlayRemoveFromPlaylistHandler removes items from the queue.
+func (j *Jellyfin) syncPlayRemoveFromPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	var request JFSyncPlayRemoveFromPlaylistRequest
+	j.syncPlayRequest(w, r, &request, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.removeItems(request.PlaylistItemIDs, request.ClearPlaylist, request.ClearPlayingItem)
+	})
+}
+
+// POST /SyncPlay/MovePlaylistItem
+//
+// syncPlayMovePlaylistItemHandler moves an item in the queue.
+func (j *Jellyfin) syncPlayMovePlaylistItemHandler(w http.ResponseWriter, r *http.Request) {
+	var request JFSyncPlayMovePlaylistItemRequest
+	j.syncPlayRequest(w, r, &request, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.moveItem(request.PlaylistItemID, request.NewIndex)
+	})
+}
+
+// POST /SyncPlay/NextItem
+//
+// syncPlayNextItemHandler starts playback of the next item in the queue.
+func (j *Jellyfin) syncPlayNextItemHandler(w http.ResponseWriter, r *http.Request) {
+	var request JFSyncPlayPlaylistItemRequest
+	j.syncPlayRequest(w, r, &request, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.nextItem(request.PlaylistItemID)
+	})
+}
+
+// POST /SyncPlay/PreviousItem
+//
+// syncPlayPreviousItemHandler starts playback of the previous item in the queue.
+func (j *Jellyfin) syncPlayPreviousItemHandler(w http.ResponseWriter, r *http.Request) {
+	var request JFSyncPlayPlaylistItemRequest
+	j.syncPlayRequest(w, r, &request, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.previousItem(request.PlaylistItemID)
+	})
+}
+
+// POST /SyncPlay/SetRepeatMode
+//
+// syncPlaySetRepeatModeHandler sets the repeat mode of the queue.
+func (j *Jellyfin) syncPlaySetRepeatModeHandler(w http.ResponseWriter, r *http.Request) {
+	var request JFSyncPlayModeRequest
+	j.syncPlayRequest(w, r, &request, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.setRepeatMode(request.Mode)
+	})
+}
+
+// POST /SyncPlay/SetShuffleMode
+//
+// syncPlaySetShuffleModeHandler sets the shuffle mode of the queue.
+func (j *Jellyfin) syncPlaySetShuffleModeHandler(w http.ResponseWriter, r *http.Request) {
+	var request JFSyncPlayModeRequest
+	j.syncPlayRequest(w, r, &request, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.setShuffleMode(request.Mode)
+	})
+}
+
+// POST /SyncPlay/Unpause
+//
+// syncPlayUnpauseHandler starts playback of the group.
+func (j *Jellyfin) syncPlayUnpauseHandler(w http.ResponseWriter, r *http.Request) {
+	j.syncPlayRequest(w, r, nil, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.unpause()
+	})
+}
+
+// POST /SyncPlay/Pause
+//
+// syncPlayPauseHandler pauses playback of the group.
+func (j *Jellyfin) syncPlayPauseHandler(w http.ResponseWriter, r *http.Request) {
+	j.syncPlayRequest(w, r, nil, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.pause()
+	})
+}
+
+// POST /SyncPlay/Stop
+//
+// syncPlayStopHandler stops playback of the group.
+func (j *Jellyfin) syncPlayStopHandler(w http.ResponseWriter, r *http.Request) {
+	j.syncPlayRequest(w, r, nil, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.stop()
+	})
+}
+
+// POST /SyncPlay/Seek
+//
+// syncPlaySeekHandler moves the play position of the group.
+func (j *Jellyfin) syncPlaySeekHandler(w http.ResponseWriter, r *http.Request) {
+	var request JFSyncPlaySeekRequest
+	j.syncPlayRequest(w, r, &request, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.seek(request.PositionTicks)
+	})
+}
+
+// POST /SyncPlay/Buffering
+//
+// syncPlayBufferingHandler reports the client is buffering, which pauses the group.
+func (j *Jellyfin) syncPlayBufferingHandler(w http.ResponseWriter, r *http.Request) {
+	var request JFSyncPlayBufferRequest
+	j.syncPlayRequest(w, r, &request, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.buffering(m, request)
+	})
+}
+
+// POST /SyncPlay/Ready
+//
+// syncPlayReadyHandler reports the client is ready to play.
+func (j *Jellyfin) syncPlayReadyHandler(w http.ResponseWriter, r *http.Request) {
+	var request JFSyncPlayBufferRequest
+	j.syncPlayRequest(w, r, &request, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.ready(m, request)
+	})
+}
+
+// POST /SyncPlay/SetIgnoreWait
+//
+// syncPlaySetIgnoreWaitHandler sets whether the group waits for the client to buffer.
+func (j *Jellyfin) syncPlaySetIgnoreWaitHandler(w http.ResponseWriter, r *http.Request) {
+	var request JFSyncPlayIgnoreWaitRequest
+	j.syncPlayRequest(w, r, &request, func(g *syncPlayGroup, m *syncPlayMember) {
+		g.setIgnoreWait(m, request.IgnoreWait)
+	})
+}
+
+// POST /SyncPlay/Ping
+//
+// syncPlayPingHandler reports the round trip time of the client in milliseconds.
+func (j *Jellyfin) syncPlayPingHandler(w http.ResponseWriter, r *http.Request) {
+	var request JFSyncPlayPingRequest
+	j.syncPlayRequest(w, r, &request, func(g *syncPlayGroup, m *syncPlayMember) {
+		m.ping = time.Duration(max(request.Ping, 0)) * time.Millisecond
+	})
+}
+
+// syncPlayRequest decodes the JSON body of a request into request, unless
+// nil, and runs handle on the group of the session.
+func (j *Jellyfin) syncPlayRequest(w http.ResponseWriter, r *http.Request, request any,
+	handle func(g *syncPlayGroup, m *syncPlayMember)) {
+	session := j.getSessionDetails(w, r)
+	user := j.getUserDetails(w, r)
+	if session == nil || user == nil {
+		return
+	}
+	if request != nil && !syncPlayDecode(w, r, request) {
+		return
+	}
+	j.syncPlay.request(session.key(), user, handle)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// syncPlayMember returns the session of the request as group member, clients
+// need a WebSocket connection to receive updates of the group.
+//
+// if not found or not connected sends an HTTP error
+func (j *Jellyfin) syncPlayMember(w http.ResponseWriter, r *http.Request) *syncPlayMember {
+	session := j.getSessionDetails(w, r)
+	user := j.getUserDetails(w, r)
+	if session == nil || user == nil {
+		return nil
+	}
+	if !j.sessions.connected(session.UserID, session.DeviceID) {
+		http.Error(w, ErrSyncPlayNoWebSocket, http.StatusBadRequest)
+		return nil
+	}
+	return &syncPlayMember{
+		UserID:   session.UserID,
+		UserName: session.UserName,
+		DeviceID: session.DeviceID,
+		user:     user,
+	}
+}
+
+// syncPlayDecode decodes the JSON body of a request.
+//
+// if decoding fails sends an HTTP error
+func syncPlayDecode(w http.ResponseWriter, r *http.Request, request any) bool {
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,744 @@
+package jellyfin
+
+import (
+	"crypto/rand"
+	mathrand "math/rand/v2"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/erikbos/jellofin-server/database"
+)
+
+// SyncPlay lets members of a group watch a shared queue of items together.
+// The group holds the authoritative play state and instructs the clients of
+// its members over their WebSocket when to start, pause and seek playback.
+// Playback only (re)starts after all members have buffered the item.
+
+const (
+	// syncPlayDefaultPing is the assumed ping of members that did not report one
+	syncPlayDefaultPing = 500 * time.Millisecond
+
+	// Group states
+	syncPlayStateIdle    = "Idle"
+	syncPlayStateWaiting = "Waiting"
+	syncPlayStatePaused  = "Paused"
+	syncPlayStatePlaying = "Playing"
+
+	// Group update types
+	syncPlayUpdateUserJoined          = "UserJoined"
+	syncPlayUpdateUserLeft            = "UserLeft"
+	syncPlayUpdateGroupJoined         = "GroupJoined"
+	syncPlayUpdateGroupLeft           = "GroupLeft"
+	syncPlayUpdateStateUpdate         = "StateUpdate"
+	syncPlayUpdatePlayQueue           = "PlayQueue"
+	syncPlayUpdateNotInGroup          = "NotInGroup"
+	syncPlayUpdateGroupDoesNotExist   = "GroupDoesNotExist"
+	syncPlayUpdateLibraryAccessDenied = "LibraryAccessDenied"
+
+	// Playback commands
+	syncPlayCommandUnpause = "Unpause"
+	syncPlayCommandPause   = "Pause"
+	syncPlayCommandStop    = "Stop"
+	syncPlayCommandSeek    = "Seek"
+
+	// Queue modes
+	syncPlayRepeatNone   = "RepeatNone"
+	syncPlayRepeatAll    = "RepeatAll"
+	syncPlayRepeatOne    = "RepeatOne"
+	syncPlayShuffleOff   = "Sorted"
+	syncPlayShuffleOn    = "Shuffle"
+	syncPlayQueueNext    = "QueueNext"
+	syncPlayQueueDefault = "Queue"
+)
+
+// syncPlayMember is a session that joined a group.
+type syncPlayMember struct {
+	UserID   string
+	UserName string
+	DeviceID string
+	// user holds the access policy of the member as of its last request
+	user *database.User
+	// ping is the round trip time reported by the client
+	ping time.Duration
+	// buffering is true until the client reports it is ready to play the current item
+	buffering bool
+	// ignoreWait is true if the group should not wait for this member to buffer
+	ignoreWait bool
+}
+
+// syncPlayGroup is a group of sessions playing the same queue of items.
+type syncPlayGroup struct {
+	ID      string
+	Name    string
+	state   string
+	members map[sessionKey]*syncPlayMember
+	// playlist is the queue in play order
+	playlist []JFSyncPlayQueueItem
+	// sorted is the queue in original order while shuffled, nil otherwise
+	sorted       []JFSyncPlayQueueItem
+	playingIndex int
+	repeatMode   string
+	shuffleMode  string
+	// positionTicks is the play position at lastUpdate, when playing
+	// the position advances from there
+	positionTicks int
+	lastUpdate    time.Time
+	// resumePlayback is true if playback starts once all members are ready
+	resumePlayback bool
+	queueUpdate    time.Time
+	// send delivers a message to the clients of a user on a device
+	send func(userID, deviceID, messageType string, data any) bool
+}
+
+type syncPlayManager struct {
+	mu sync.Mutex
+	// groups keyed by group ID
+	groups map[string]*syncPlayGroup
+	// memberOf holds the group of each member, keyed by its session
+	memberOf map[sessionKey]*syncPlayGroup
+	// send delivers a message to the clients of a user on a device
+	send func(userID, deviceID, messageType string, data any) bool
+	// itemAllowed returns true if a user has access to an item, users
+	// are resolved by the caller so no lookups happen holding the lock
+	itemAllowed func(user *database.User, itemID string) bool
+}
+
+func newSyncPlayManager(send func(userID, deviceID, messageType string, data any) bool,
+	itemAllowed func(user *database.User, itemID string) bool) *syncPlayManager {
+	return &syncPlayManager{
+		groups:      make(map[string]*syncPlayGroup),
+		memberOf:    make(map[sessionKey]*syncPlayGroup),
+		send:        send,
+		itemAllowed: itemAllowed,
+	}
+}
+
+// newGroup creates a group with the member as first participant.
+func (m *syncPlayManager) newGroup(member syncPlayMember, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.leave(member.key())
+	g := &syncPlayGroup{
+		ID:          rand.Text(),
+		Name:        name,
+		state:       syncPlayStateIdle,
+		members:     make(map[sessionKey]*syncPlayMember),
+		repeatMode:  syncPlayRepeatNone,
+		shuffleMode: syncPlayShuffleOff,
+		lastUpdate:  time.Now().UTC(),
+		send:        m.send,
+	}
+	if g.Name == "" {
+		g.Name = member.UserName + "'s group"
+	}
+	m.groups[g.ID] = g
+	m.memberOf[member.key()] = g
+	g.members[member.key()] = &member
+	g.sendTo(&member, syncPlayUpdateGroupJoined, g.info())
+}
+
+// join adds a member to a group, the member leaves its current group.
+func (m *syncPlayManager) join(member syncPlayMember, groupID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, ok := m.groups[groupID]
+	if !ok {
+		m.send(member.UserID, member.DeviceID, socketMessageSyncPlayGroupUpdate, JFSyncPlayGroupUpdate{
+			GroupID: groupID,
+			Type:    syncPlayUpdateGroupDoesNotExist,
+			Data:    "",
+		})
+		return
+	}
+	if !m.queueAllowed(member.user, g.playlist) {
+		g.sendTo(&member, syncPlayUpdateLibraryAccessDenied, "")
+		return
+	}
+	if current, ok := m.memberOf[member.key()]; ok && current == g {
+		g.sendTo(&member, syncPlayUpdateGroupJoined, g.info())
+		return
+	}
+	m.leave(member.key())
+	m.memberOf[member.key()] = g
+	g.addMember(&member)
+}
+
+// leave removes a member from its group, groups without members are removed.
+func (m *syncPlayManager) leave(key sessionKey) {
+	g, ok := m.memberOf[key]
+	if !ok {
+		return
+	}
+	delete(m.memberOf, key)
+	g.removeMember(key)
+	if len(g.members) == 0 {
+		delete(m.groups, g.ID)
+	}
+}
+
+// leaveGroup removes a member from its group, returns false in case it was not a member.
+func (m *syncPlayManager) leaveGroup(key sessionKey) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.memberOf[key]; !ok {
+		return false
+	}
+	m.leave(key)
+	return true
+}
+
+// list returns all groups the user has access to, by name.
+func (m *syncPlayManager) list(user *database.User) []JFSyncPlayGroupInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	groups := []JFSyncPlayGroupInfo{}
+	for _, g := range m.groups {
+		if m.queueAllowed(user, g.playlist) {
+			groups = append(groups, g.info())
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].GroupName < groups[j].GroupName
+	})
+	return groups
+}
+
+// get returns a group the user has access to.
+func (m *syncPlayManager) get(user *database.User, groupID string) (JFSyncPlayGroupInfo, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, ok := m.groups[groupID]
+	if !ok || !m.queueAllowed(user, g.playlist) {
+		return JFSyncPlayGroupInfo{}, false
+	}
+	return g.info(), true
+}
+
+// request runs a request of a member on its group.
+func (m *syncPlayManager) request(key sessionKey, user *database.User, request func(g *syncPlayGroup, member *syncPlayMember)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, ok := m.memberOf[key]
+	if !ok {
+		m.sendNotInGroup(key)
+		return
+	}
+	member := g.members[key]
+	member.user = user
+	request(g, member)
+}
+
+// queueRequest runs a request of a member that adds items to the queue of
+// its group, in case all members have access to the items.
+func (m *syncPlayManager) queueRequest(key sessionKey, user *database.User, itemIDs []string, request func(g *syncPlayGroup)) {
+	m.request(key, user, func(g *syncPlayGroup, requester *syncPlayMember) {
+		for _, member := range g.members {
+			for _, itemID := range itemIDs {
+				if !m.itemAllowed(member.user, itemID) {
+					g.sendTo(requester, syncPlayUpdateLibraryAccessDenied, "")
+					return
+				}
+			}
+		}
+		request(g)
+	})
+}
+
+// queueAllowed returns true if the user has access to all items of a queue.
+func (m *syncPlayManager) queueAllowed(user *database.User, playlist []JFSyncPlayQueueItem) bool {
+	for _, item := range playlist {
+		if !m.itemAllowed(user, item.ItemID) {
+			return false
+		}
+	}
+	return true
+}
+
+// sendNotInGroup tells a session its request failed as it is not a member of a group.
+func (m *syncPlayManager) sendNotInGroup(key sessionKey) {
+	m.send(key.userID, key.deviceID, socketMessageSyncPlayGroupUpdate, JFSyncPlayGroupUpdate{
+		Type: syncPlayUpdateNotInGroup,
+		Data: "",
+	})
+}
+
+// addMember adds a member, in case the group is playing playback is paused
+// until the new member has buffered the current item.
+func (g *syncPlayGroup) addMember(member *syncPlayMember) {
+	g.members[member.key()] = member
+	g.sendTo(member, syncPlayUpdateGroupJoined, g.info())
+	g.sendOthers(member.key(), syncPlayUpdateUserJoined, member.UserName)
+	if len(g.playlist) == 0 {
+		return
+	}
+
+	member.buffering = true
+	g.sendTo(member, syncPlayUpdatePlayQueue, g.playQueue("NewPlaylist"))
+	if g.state == syncPlayStatePlaying {
+		g.positionTicks = g.currentPosition()
+		g.lastUpdate = time.Now().UTC()
+		g.state = syncPlayStateWaiting
+		g.resumePlayback = true
+		g.sendCommand(syncPlayCommandPause, g.lastUpdate)
+	}
+	g.sendState("Join")
+}
+
+// removeMember removes a member, the group continues in case it was waiting for it.
+func (g *syncPlayGroup) removeMember(key sessionKey) {
+	member, ok := g.members[key]
+	if !ok {
+		return
+	}
+	delete(g.members, key)
+	g.sendTo(member, syncPlayUpdateGroupLeft, g.ID)
+	g.sendAll(syncPlayUpdateUserLeft, member.UserName)
+	g.checkReady()
+}
+
+// setQueue replaces the queue and starts playback of an item.
+func (g *syncPlayGroup) setQueue(itemIDs []string, playingIndex, startPositionTicks int) {
+	g.playlist = make([]JFSyncPlayQueueItem, 0, len(itemIDs))
+	for _, itemID := range itemIDs {
+		g.playlist = append(g.playlist, newSyncPlayQueueItem(itemID))
+	}
+	g.sorted = nil
+	g.shuffleMode = syncPlayShuffleOff
+	if len(g.playlist) == 0 {
+		g.stop()
+		return
+	}
+	g.playingIndex = min(max(playingIndex, 0), len(g.playlist)-1)
+	g.startItem("NewPlaylist", startPositionTicks)
+}
+
+// setPlaylistItem starts playback of an item in the queue.
+func (g *syncPlayGroup) setPlaylistItem(playlistItemID string) {
+	if index := g.indexOf(playlistItemID); index != -1 {
+		g.playingIndex = index
+		g.startItem("SetCurrentItem", 0)
+	}
+}
+
+// nextItem starts playback of the next item, the request is ignored in case
+// playlistItemID is not the current item.
+func (g *syncPlayGroup) nextItem(playlistItemID string) {
+	if !g.isCurrentItem(playlistItemID) {
+		return
+	}
+	index := g.playingIndex + 1
+	if index >= len(g.playlist) {
+		if g.repeatMode != syncPlayRepeatAll {
+			return
+		}
+		index = 0
+	}
+	g.playingIndex = index
+	g.startItem("NextItem", 0)
+}
+
+// previousItem starts playback of the previous item, the request is ignored
+// in case playlistItemID is not the current item.
+func (g *syncPlayGroup) previousItem(playlistItemID string) {
+	if !g.isCurrentItem(playlistItemID) {
+		return
+	}
+	index := g.playingIndex - 1
+	if index < 0 {
+		if g.repeatMode != syncPlayRepeatAll {
+			return
+		}
+		index = len(g.playlist) - 1
+	}
+	g.playingIndex = index
+	g.startItem("PreviousItem", 0)
+}
+
+// startItem starts playback of the current item once all members have buffered it.
+func (g *syncPlayGroup) startItem(reason string, positionTicks int) {
+	g.positionTicks = max(positionTicks, 0)
+	g.lastUpdate = time.Now().UTC()
+	g.state = syncPlayStateWaiting
+	g.resumePlayback = true
+	g.setBuffering()
+	g.sendAll(syncPlayUpdatePlayQueue, g.playQueue(reason))
+	g.sendState(reason)
+	g.checkReady()
+}
+
+// queue adds items to the end of the queue, or after the current item in case of QueueNext.
+func (g *syncPlayGroup) queue(itemIDs []string, mode string) {
+	if len(itemIDs) == 0 {
+		return
+	}
+	if len(g.playlist) == 0 {
+		g.setQueue(itemIDs, 0, 0)
+		return
+	}
+	items := make([]JFSyncPlayQueueItem, 0, len(itemIDs))
+	for _, itemID := range itemIDs {
+		items = append(items, newSyncPlayQueueItem(itemID))
+	}
+	if mode == syncPlayQueueNext {
+		g.playlist = slices.Insert(g.playlist, g.playingIndex+1, items...)
+	} else {
+		mode = syncPlayQueueDefault
+		g.playlist = append(g.playlist, items...)
+	}
+	if g.sorted != nil {
+		g.sorted = append(g.sorted, items...)
+	}
+	g.sendAll(syncPlayUpdatePlayQueue, g.playQueue(mode))
+}
+
+// removeItems removes items from the queue, in case the current item is
+// removed playback continues with the next item.
+func (g *syncPlayGroup) removeItems(playlistItemIDs []string, clearPlaylist, clearPlayingItem bool) {
+	if len(g.playlist) == 0 {
+		return
+	}
+	current := g.playlist[g.playingIndex].PlaylistItemID
+	remove := make(map[string]bool)
+	for _, id := range playlistItemIDs {
+		remove[id] = true
+	}
+	for _, item := range g.playlist {
+		if clearPlaylist && item.PlaylistItemID != current {
+			remove[item.PlaylistItemID] = true
+		}
+	}
+	if clearPlayingItem {
+		remove[current] = true
+	}
+	removed := func(item JFSyncPlayQueueItem) bool {
+		return remove[item.PlaylistItemID]
+	}
+
+	// The item following the current one becomes current in case it is removed
+	index := g.playingIndex
+	for _, item := range g.playlist[:g.playingIndex] {
+		if removed(item) {
+			index--
+		}
+	}
+	g.playlist = slices.DeleteFunc(g.playlist, removed)
+	if g.sorted != nil {
+		g.sorted = slices.DeleteFunc(g.sorted, removed)
+	}
+	if len(g.playlist) == 0 {
+		g.playingIndex = 0
+		g.sendAll(syncPlayUpdatePlayQueue, g.playQueue("RemoveItems"))
+		g.stop()
+		return
+	}
+	g.playingIndex = min(index, len(g.playlist)-1)
+	if remove[current] {
+		g.startItem("RemoveItems", 0)
+		return
+	}
+	g.sendAll(syncPlayUpdatePlayQueue, g.playQueue("RemoveItems"))
+}
+
+// moveItem moves an item in the queue.
+func (g *syncPlayGroup) moveItem(playlistItemID string, newIndex int) {
+	index := g.indexOf(playlistItemID)
+	if index == -1 {
+		return
+	}
+	current := g.playlist[g.playingIndex].PlaylistItemID
+	item := g.playlist[index]
+	g.playlist = slices.Delete(g.playlist, index, index+1)
+	newIndex = min(max(newIndex, 0), len(g.playlist))
+	g.playlist = slices.Insert(g.playlist, newIndex, item)
+	g.playingIndex = g.indexOf(current)
+	g.sendAll(syncPlayUpdatePlayQueue, g.playQueue("MoveItem"))
+}
+
+// setRepeatMode sets whether the current item or queue is repeated.
+func (g *syncPlayGroup) setRepeatMode(mode string) {
+	switch mode {
+	case syncPlayRepeatNone, syncPlayRepeatAll, syncPlayRepeatOne:
+		g.repeatMode = mode
+		g.sendAll(syncPlayUpdatePlayQueue, g.playQueue("RepeatMode"))
+	}
+}
+
+// setShuffleMode shuffles the queue, the current item becomes the first item.
+// Sorted restores the original order of the queue.
+func (g *syncPlayGroup) setShuffleMode(mode string) {
+	if len(g.playlist) != 0 {
+		current := g.playlist[g.playingIndex]
+		switch {
+		case mode == syncPlayShuffleOn:
+			if g.sorted == nil {
+				g.sorted = slices.Clone(g.playlist)
+			}
+			others := slices.DeleteFunc(slices.Clone(g.playlist), func(item JFSyncPlayQueueItem) bool {
+				return item.PlaylistItemID == current.PlaylistItemID
+			})
+			mathrand.Shuffle(len(others), func(i, j int) {
+				others[i], others[j] = others[j], others[i]
+			})
+			g.playlist = append([]JFSyncPlayQueueItem{current}, others...)
+		case mode == syncPlayShuffleOff && g.sorted != nil:
+			g.playlist = g.sorted
+			g.sorted = nil
+		}
+		g.playingIndex = max(g.indexOf(current.PlaylistItemID), 0)
+	}
+	if mode == syncPlayShuffleOn || mode == syncPlayShuffleOff {
+		g.shuffleMode = mode
+		g.sendAll(syncPlayUpdatePlayQueue, g.playQueue("ShuffleMode"))
+	}
+}
+
+// unpause starts playback, once all members are ready.
+func (g *syncPlayGroup) unpause() {
+	switch g.state {
+	case syncPlayStatePaused:
+		g.state = syncPlayStateWaiting
+		g.resumePlayback = true
+		g.checkReady()
+	case syncPlayStateWaiting:
+		g.resumePlayback = true
+		g.checkReady()
+	}
+}
+
+// pause pauses playback of all members.
+func (g *syncPlayGroup) pause() {
+	switch g.state {
+	case syncPlayStatePlaying:
+		g.positionTicks = g.currentPosition()
+		g.lastUpdate = time.Now().UTC()
+		g.state = syncPlayStatePaused
+		g.sendCommand(syncPlayCommandPause, g.lastUpdate)
+		g.sendState("Pause")
+	case syncPlayStateWaiting:
+		g.resumePlayback = false
+		g.sendCommand(syncPlayCommandPause, time.Now().UTC())
+	}
+}
+
+// stop ends playback of all members, the queue is kept.
+func (g *syncPlayGroup) stop() {
+	g.state = syncPlayStateIdle
+	g.resumePlayback = false
+	g.positionTicks = 0
+	g.lastUpdate = time.Now().UTC()
+	for _, m := range g.members {
+		m.buffering = false
+	}
+	g.sendCommand(syncPlayCommandStop, g.lastUpdate)
+	g.sendState("Stop")
+}
+
+// seek moves the play position of all members, playback continues once
+// all members have buffered the new position.
+func (g *syncPlayGroup) seek(positionTicks int) {
+	if g.state == syncPlayStateIdle || len(g.playlist) == 0 {
+		return
+	}
+	g.resumePlayback = g.state == syncPlayStatePlaying || (g.state == syncPlayStateWaiting && g.resumePlayback)
+	g.positionTicks = max(positionTicks, 0)
+	g.lastUpdate = time.Now().UTC()
+	g.state = syncPlayStateWaiting
+	g.setBuffering()
+	g.sendCommand(syncPlayCommandSeek, g.lastUpdate)
+	g.sendState("Seek")
+	g.checkReady()
+}
+
+// buffering pauses playback of the group while a member is buffering.
+func (g *syncPlayGroup) buffering(member *syncPlayMember, request JFSyncPlayBufferRequest) {
+	if !g.isCurrentItem(request.PlaylistItemID) {
+		return
+	}
+	member.buffering = true
+	if g.state != syncPlayStatePlaying || member.ignoreWait {
+		return
+	}
+	g.positionTicks = g.currentPosition()
+	g.lastUpdate = time.Now().UTC()
+	g.state = syncPlayStateWaiting
+	g.resumePlayback = true
+	g.sendCommand(syncPlayCommandPause, g.lastUpdate)
+	g.sendState("Buffer")
+}
+
+// ready marks a member as ready to play, the group continues in case it was waiting for it.
+func (g *syncPlayGroup) ready(member *syncPlayMember, request JFSyncPlayBufferRequest) {
+	if !g.isCurrentItem(request.PlaylistItemID) {
+		return
+	}
+	member.buffering = false
+	g.checkReady()
+}
+
+// setIgnoreWait sets whether the group waits for a member to buffer.
+func (g *syncPlayGroup) setIgnoreWait(member *syncPlayMember, ignoreWait bool) {
+	member.ignoreWait = ignoreWait
+	g.checkReady()
+}
+
+// checkReady continues a waiting group in case all members are ready.
+func (g *syncPlayGroup) checkReady() {
+	if g.state != syncPlayStateWaiting {
+		return
+	}
+	for _, m := range g.members {
+		if m.buffering && !m.ignoreWait {
+			return
+		}
+	}
+	if !g.resumePlayback {
+		g.state = syncPlayStatePaused
+		g.sendState("Ready")
+		return
+	}
+	// Give all members time to receive the command before playback starts
+	g.state = syncPlayStatePlaying
+	g.resumePlayback = false
+	g.lastUpdate = time.Now().UTC().Add(2 * g.highestPing())
+	g.sendCommand(syncPlayCommandUnpause, g.lastUpdate)
+	g.sendState("Ready")
+}
+
+// setBuffering marks all members as buffering the current item.
+func (g *syncPlayGroup) setBuffering() {
+	for _, m := range g.members {
+		m.buffering = true
+	}
+}
+
+// currentPosition returns the play position, which advances while playing.
+func (g *syncPlayGroup) currentPosition() int {
+	if g.state != syncPlayStatePlaying {
+		return g.positionTicks
+	}
+	elapsed := max(time.Since(g.lastUpdate), 0)
+	return g.positionTicks + int(elapsed.Milliseconds())*TicsToSeconds/1000
+}
+
+// highestPing returns the highest ping of all members.
+func (g *syncPlayGroup) highestPing() time.Duration {
+	ping := syncPlayDefaultPing
+	for _, m := range g.members {
+		ping = max(ping, m.ping)
+	}
+	return ping
+}
+
+// indexOf returns the index of an item in the queue, -1 if not found.
+func (g *syncPlayGroup) indexOf(playlistItemID string) int {
+	return slices.IndexFunc(g.playlist, func(item JFSyncPlayQueueItem) bool {
+		return item.PlaylistItemID == playlistItemID
+	})
+}
+
+// isCurrentItem returns true if the playlist item is the item being played.
+func (g *syncPlayGroup) isCurrentItem(playlistItemID string) bool {
+	return len(g.playlist) != 0 && g.playlist[g.playingIndex].PlaylistItemID == playlistItemID
+}
+
+// info returns the details of the group.
+func (g *syncPlayGroup) info() JFSyncPlayGroupInfo {
+	participants := make([]string, 0, len(g.members))
+	for _, m := range g.members {
+		participants = append(participants, m.UserName)
+	}
+	sort.Strings(participants)
+	return JFSyncPlayGroupInfo{
+		GroupID:       g.ID,
+		GroupName:     g.Name,
+		State:         g.state,
+		Participants:  participants,
+		LastUpdatedAt: g.lastUpdate,
+	}
+}
+
+// playQueue returns the queue of the group.
+func (g *syncPlayGroup) playQueue(reason string) JFSyncPlayPlayQueueUpdate {
+	g.queueUpdate = time.Now().UTC()
+	return JFSyncPlayPlayQueueUpdate{
+		Reason:             reason,
+		LastUpdate:         g.queueUpdate,
+		Playlist:           slices.Clone(g.playlist),
+		PlayingItemIndex:   g.playingIndex,
+		StartPositionTicks: g.currentPosition(),
+		IsPlaying:          g.state == syncPlayStatePlaying || (g.state == syncPlayStateWaiting && g.resumePlayback),
+		ShuffleMode:        g.shuffleMode,
+		RepeatMode:         g.repeatMode,
+	}
+}
+
+// sendCommand sends a playback command to all members.
+func (g *syncPlayGroup) sendCommand(command string, when time.Time) {
+	var playlistItemID string
+	if len(g.playlist) != 0 {
+		playlistItemID = g.playlist[g.playingIndex].PlaylistItemID
+	}
+	msg := JFSyncPlayCommand{
+		GroupID:        g.ID,
+		PlaylistItemID: playlistItemID,
+		When:           when,
+		PositionTicks:  g.positionTicks,
+		Command:        command,
+		EmittedAt:      time.Now().UTC(),
+	}
+	for _, m := range g.members {
+		g.send(m.UserID, m.DeviceID, socketMessageSyncPlayCommand, msg)
+	}
+}
+
+// sendState sends the state of the group to all members.
+func (g *syncPlayGroup) sendState(reason string) {
+	g.sendAll(syncPlayUpdateStateUpdate, JFSyncPlayStateUpdate{
+		State:  g.state,
+		Reason: reason,
+	})
+}
+
+// sendAll sends a group update to all members.
+func (g *syncPlayGroup) sendAll(updateType string, data any) {
+	g.sendOthers(sessionKey{}, updateType, data)
+}
+
+// sendOthers sends a group update to all members except one.
+func (g *syncPlayGroup) sendOthers(except sessionKey, updateType string, data any) {
+	for key, m := range g.members {
+		if key != except {
+			g.sendTo(m, updateType, data)
+		}
+	}
+}
+
+// sendTo sends a group update to one member.
+func (g *syncPlayGroup) sendTo(member *syncPlayMember, updateType string, data any) {
+	g.send(member.UserID, member.DeviceID, socketMessageSyncPlayGroupUpdate, JFSyncPlayGroupUpdate{
+		GroupID: g.ID,
+		Type:    updateType,
+		Data:    data,
+	})
+}
+
+// key returns the key of the session of the member.
+func (m *syncPlayMember) key() sessionKey {
+	return sessionKey{userID: m.UserID, deviceID: m.DeviceID}
+}
+
+// newSyncPlayQueueItem returns a queue entry of an item.
+func newSyncPlayQueueItem(itemID string) JFSyncPlayQueueItem {
+	return JFSyncPlayQueueItem{
+		ItemID:         itemID,
+		PlaylistItemID: rand.Text(),
+	}
+}
@@ -0,0 +1,276 @@
+package jellyfin
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/erikbos/jellofin-server/database"
+)
+
+// newTestSyncPlayManager returns a manager that records the group updates
+// sent, and only allows items listed as allowed for a user.
+func newTestSyncPlayManager(allowed map[string][]string) (*syncPlayManager, map[sessionKey][]string) {
+	updates := make(map[sessionKey][]string)
+	send := func(userID, deviceID, messageType string, data any) bool {
+		if update, ok := data.(JFSyncPlayGroupUpdate); ok {
+			key := sessionKey{userID: userID, deviceID: deviceID}
+			updates[key] = append(updates[key], update.Type)
+		}
+		return true
+	}
+	itemAllowed := func(user *database.User, itemID string) bool {
+		return allowed == nil || slices.Contains(allowed[user.ID], itemID)
+	}
+	return newSyncPlayManager(send, itemAllowed), updates
+}
+
+func newTestSyncPlayMember(userID, deviceID string) *syncPlayMember {
+	return &syncPlayMember{UserID: userID, UserName: userID, DeviceID: deviceID, user: &database.User{ID: userID}}
+}
+
+func TestSyncPlayGroup(t *testing.T) {
+	current := func(g *syncPlayGroup) JFSyncPlayBufferRequest {
+		return JFSyncPlayBufferRequest{PlaylistItemID: g.playlist[g.playingIndex].PlaylistItemID}
+	}
+	tests := []struct {
+		name string
+		// run acts on a group of members a and b playing the first of items 1, 2 and 3
+		run          func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember)
+		wantState    string
+		wantItems    []string
+		wantPlaying  int
+		wantPosition int
+	}{
+		{
+			name: "join while playing waits for new member",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				m.join(*newTestSyncPlayMember("c", "phone"), g.ID)
+			},
+			wantState: syncPlayStateWaiting,
+		},
+		{
+			name: "join while playing resumes once new member is ready",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				m.join(*newTestSyncPlayMember("c", "phone"), g.ID)
+				g.ready(g.members[sessionKey{userID: "c", deviceID: "phone"}], current(g))
+			},
+			wantState: syncPlayStatePlaying,
+		},
+		{
+			name: "buffering pauses",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				g.buffering(a, current(g))
+			},
+			wantState: syncPlayStateWaiting,
+		},
+		{
+			name: "buffering of other item is ignored",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				g.buffering(a, JFSyncPlayBufferRequest{PlaylistItemID: g.playlist[1].PlaylistItemID})
+			},
+			wantState: syncPlayStatePlaying,
+		},
+		{
+			name: "ready after buffering resumes",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				g.buffering(a, current(g))
+				g.ready(a, current(g))
+			},
+			wantState: syncPlayStatePlaying,
+		},
+		{
+			name: "buffering of member not waited for is ignored",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				g.setIgnoreWait(a, true)
+				g.buffering(a, current(g))
+			},
+			wantState: syncPlayStatePlaying,
+		},
+		{
+			name: "seek waits for all members",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				g.seek(1000)
+				g.ready(a, current(g))
+			},
+			wantState:    syncPlayStateWaiting,
+			wantPosition: 1000,
+		},
+		{
+			name: "seek resumes once all members are ready",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				g.seek(1000)
+				g.ready(a, current(g))
+				g.ready(b, current(g))
+			},
+			wantState:    syncPlayStatePlaying,
+			wantPosition: 1000,
+		},
+		{
+			name: "seek while paused stays paused",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				g.pause()
+				g.seek(1000)
+				g.ready(a, current(g))
+				g.ready(b, current(g))
+			},
+			wantState:    syncPlayStatePaused,
+			wantPosition: 1000,
+		},
+		{
+			name: "removing current item plays next item",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				g.removeItems([]string{current(g).PlaylistItemID}, false, false)
+			},
+			wantState: syncPlayStateWaiting,
+			wantItems: []string{"2", "3"},
+		},
+		{
+			name: "removing last item while playing it plays previous item",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				g.setPlaylistItem(g.playlist[2].PlaylistItemID)
+				g.removeItems(nil, false, true)
+			},
+			wantState:   syncPlayStateWaiting,
+			wantItems:   []string{"1", "2"},
+			wantPlaying: 1,
+		},
+		{
+			name: "removing other item continues playback",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				g.setPlaylistItem(g.playlist[1].PlaylistItemID)
+				g.ready(a, current(g))
+				g.ready(b, current(g))
+				g.removeItems([]string{g.playlist[0].PlaylistItemID}, false, false)
+			},
+			wantState: syncPlayStatePlaying,
+			wantItems: []string{"2", "3"},
+		},
+		{
+			name: "clearing the queue stops playback",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				g.removeItems(nil, true, true)
+			},
+			wantState: syncPlayStateIdle,
+			wantItems: []string{},
+		},
+		{
+			name: "sorted restores order of shuffled queue",
+			run: func(m *syncPlayManager, g *syncPlayGroup, a, b *syncPlayMember) {
+				g.setShuffleMode(syncPlayShuffleOn)
+				g.queue([]string{"4"}, syncPlayQueueDefault)
+				g.setShuffleMode(syncPlayShuffleOff)
+			},
+			wantState: syncPlayStatePlaying,
+			wantItems: []string{"1", "2", "3", "4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestSyncPlayManager(nil)
+			// Two users watching on the same device are separate members
+			a, b := newTestSyncPlayMember("a", "tv"), newTestSyncPlayMember("b", "tv")
+			m.newGroup(*a, "")
+			g := m.memberOf[a.key()]
+			m.join(*b, g.ID)
+			a, b = g.members[a.key()], g.members[b.key()]
+			g.setQueue([]string{"1", "2", "3"}, 0, 0)
+			g.ready(a, current(g))
+			g.ready(b, current(g))
+			if g.state != syncPlayStatePlaying {
+				t.Fatalf("state before test = %s", g.state)
+			}
+
+			tt.run(m, g, a, b)
+			if g.state != tt.wantState {
+				t.Errorf("state = %s, want %s", g.state, tt.wantState)
+			}
+			items := []string{}
+			for _, item := range g.playlist {
+				items = append(items, item.ItemID)
+			}
+			if tt.wantItems == nil {
+				tt.wantItems = []string{"1", "2", "3"}
+			}
+			if !slices.Equal(items, tt.wantItems) {
+				t.Errorf("queue = %v, want %v", items, tt.wantItems)
+			}
+			if g.playingIndex != tt.wantPlaying {
+				t.Errorf("playing index = %d, want %d", g.playingIndex, tt.wantPlaying)
+			}
+			if g.state != syncPlayStatePlaying && g.positionTicks != tt.wantPosition {
+				t.Errorf("position = %d, want %d", g.positionTicks, tt.wantPosition)
+			}
+		})
+	}
+}
+
+func TestSyncPlayShuffleKeepsCurrentItemFirst(t *testing.T) {
+	m, _ := newTestSyncPlayManager(nil)
+	a := newTestSyncPlayMember("a", "tv")
+	m.newGroup(*a, "")
+	g := m.memberOf[a.key()]
+	g.setQueue([]string{"1", "2", "3", "4", "5"}, 2, 0)
+
+	g.setShuffleMode(syncPlayShuffleOn)
+	items := []string{}
+	for _, item := range g.playlist {
+		items = append(items, item.ItemID)
+	}
+	if g.playingIndex != 0 || items[0] != "3" {
+		t.Errorf("shuffled queue = %v playing %d, want 3 first", items, g.playingIndex)
+	}
+	slices.Sort(items)
+	if !slices.Equal(items, []string{"1", "2", "3", "4", "5"}) {
+		t.Errorf("shuffled queue holds %v", items)
+	}
+
+	g.setShuffleMode(syncPlayShuffleOff)
+	if g.playingIndex != 2 || g.playlist[2].ItemID != "3" {
+		t.Errorf("sorted queue plays index %d, want 2", g.playingIndex)
+	}
+}
+
+func TestSyncPlayManagerMembers(t *testing.T) {
+	m, updates := newTestSyncPlayManager(map[string][]string{"a": {"1"}, "b": {"1"}, "kid": {}})
+	a, b := newTestSyncPlayMember("a", "tv"), newTestSyncPlayMember("b", "tv")
+	m.newGroup(*a, "movie night")
+	g := m.memberOf[a.key()]
+	m.join(*b, g.ID)
+	if len(g.members) != 2 {
+		t.Fatalf("%d members of group, want 2", len(g.members))
+	}
+
+	m.queueRequest(b.key(), b.user, []string{"1"}, func(g *syncPlayGroup) {
+		g.setQueue([]string{"1"}, 0, 0)
+	})
+	if len(g.playlist) != 1 {
+		t.Fatal("queue of allowed item not set")
+	}
+
+	// Groups playing items a user has no access to are hidden
+	kid := newTestSyncPlayMember("kid", "tablet")
+	if groups := m.list(kid.user); len(groups) != 0 {
+		t.Errorf("groups listed for user without access = %+v", groups)
+	}
+	if _, ok := m.get(kid.user, g.ID); ok {
+		t.Error("group returned for user without access")
+	}
+	m.join(*kid, g.ID)
+	if _, ok := m.memberOf[kid.key()]; ok || !slices.Contains(updates[kid.key()], syncPlayUpdateLibraryAccessDenied) {
+		t.Errorf("user without access joined group, updates %v", updates[kid.key()])
+	}
+
+	// Leaving removes only the member of the user, not the one of the other user on the device
+	if !m.leaveGroup(a.key()) {
+		t.Fatal("member not in group")
+	}
+	if _, ok := m.memberOf[b.key()]; !ok || len(g.members) != 1 {
+		t.Error("other user on device left group")
+	}
+	m.request(a.key(), a.user, func(g *syncPlayGroup, member *syncPlayMember) {
+		t.Error("request of member that left the group ran")
+	})
+	if !slices.Contains(updates[a.key()], syncPlayUpdateNotInGroup) {
+		t.Errorf("updates of member that left = %v, want %s", updates[a.key()], syncPlayUpdateNotInGroup)
+	}
+}
@@ -2,6 +2,7 @@ package jellyfin
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 )
 
@@ -94,33 +95,6 @@ func (j *Jellyfin) pluginsHandler(w http.ResponseWriter, r *http.Request) {
 	serveJSON(response, w)
 }
 
-// /DisplayPreferences/usersettings?userId=2b1ec0a52b09456c9823a367d84ac9e5&client=emby'
-//
-// displayPreferencesHandler returns the display preferences for the user
-func (j *Jellyfin) displayPreferencesHandler(w http.ResponseWriter, r *http.Request) {
-	serveJSON(DisplayPreferencesResponse{
-		ID:                 "3ce5b65d-e116-d731-65d1-efc4a30ec35c",
-		SortBy:             "SortName",
-		RememberIndexing:   false,
-		PrimaryImageHeight: 250,
-		PrimaryImageWidth:  250,
-		CustomPrefs: DisplayPreferencesCustomPrefs{
-			ChromecastVersion:          "stable",
-			SkipForwardLength:          "30000",
-			SkipBackLength:             "10000",
-			EnableNextVideoInfoOverlay: "False",
-			Tvhome:                     "null",
-			DashboardTheme:             "null",
-		},
-		ScrollDirection: "Horizontal",
-		ShowBackdrop:    true,
-		RememberSorting: false,
-		SortOrder:       "Ascending",
-		ShowSidebar:     false,
-		Client:          "emby",
-	}, w)
-}
-
 func localAddress(r *http.Request) string {
 	protocol := "http"
 	if r.TLS != nil {
@@ -128,3 +102,12 @@ func localAddress(r *http.Request) string {
 	}
 	return fmt.Sprintf("%s://%s", protocol, r.Host)
 }
+
+// remoteAddress returns the IP address of the client of a request.
+func remoteAddress(r *http.Request) string {
+	address, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return address
+}
@@ -75,6 +75,7 @@ type JFUser struct {
 }
 
 type JFUserConfiguration struct {
+	AudioLanguagePreference    string   `json:"AudioLanguagePreference"`
 	PlayDefaultAudioTrack      bool     `json:"PlayDefaultAudioTrack"`
 	SubtitleLanguagePreference string   `json:"SubtitleLanguagePreference"`
 	DisplayMissingEpisodes     bool     `json:"DisplayMissingEpisodes"`
@@ -104,6 +105,7 @@ type JFUserPolicy struct {
 	EnableUserPreferenceAccess       bool     `json:"EnableUserPreferenceAccess"`
 	AccessSchedules                  []string `json:"AccessSchedules"`
 	BlockUnratedItems                []string `json:"BlockUnratedItems"`
+	MaxParentalRating                *int     `json:"MaxParentalRating"`
 	EnableRemoteControlOfOtherUsers  bool     `json:"EnableRemoteControlOfOtherUsers"`
 	EnableSharedDeviceControl        bool     `json:"EnableSharedDeviceControl"`
 	EnableRemoteAccess               bool     `json:"EnableRemoteAccess"`
@@ -141,6 +143,30 @@ type JFAuthenticateUserByNameRequest struct {
 	Username string `json:"Username"`
 	Pw       string `json:"Pw"`
 }
+type JFCreateUserByNameRequest struct {
+	Name     string `json:"Name"`
+	Password string `json:"Password"`
+}
+type JFUpdateUserPasswordRequest struct {
+	CurrentPw     string `json:"CurrentPw"`
+	NewPw         string `json:"NewPw"`
+	ResetPassword bool   `json:"ResetPassword"`
+}
+type JFQuickConnectResult struct {
+	Authenticated bool      `json:"Authenticated"`
+	Secret        string    `json:"Secret"`
+	Code          string    `json:"Code"`
+	DeviceID      string    `json:"DeviceId"`
+	DeviceName    string    `json:"DeviceName"`
+	AppName       string    `json:"AppName"`
+	AppVersion    string    `json:"AppVersion"`
+	DateAdded     time.Time `json:"DateAdded"`
+}
+
+type JFAuthenticateWithQuickConnectRequest struct {
+	Secret string `json:"Secret"`
+}
+
 type JFAuthenticateByNameResponse struct {
 	User        JFUser         `json:"User"`
 	SessionInfo *JFSessionInfo `json:"SessionInfo"`
@@ -166,6 +192,35 @@ type JFUsersItemsSuggestionsResponse struct {
 	StartIndex       int      `json:"StartIndex"`
 }
 
+type JFRecommendation struct {
+	Items              []JFItem `json:"Items"`
+	RecommendationType string   `json:"RecommendationType"`
+	BaselineItemName   string   `json:"BaselineItemName"`
+	CategoryId         string   `json:"CategoryId"`
+}
+
+type JFDevicesResponse struct {
+	Items            []JFDeviceInfo `json:"Items"`
+	TotalRecordCount int            `json:"TotalRecordCount"`
+	StartIndex       int            `json:"StartIndex"`
+}
+
+type JFDeviceInfo struct {
+	Name             string               `json:"Name"`
+	ID               string               `json:"Id"`
+	LastUserName     string               `json:"LastUserName"`
+	AppName          string               `json:"AppName"`
+	AppVersion       string               `json:"AppVersion"`
+	LastUserID       string               `json:"LastUserId"`
+	DateLastActivity time.Time            `json:"DateLastActivity"`
+	Capabilities     JFDeviceCapabilities `json:"Capabilities"`
+}
+
+type JFDeviceCapabilities struct {
+	PlayableMediaTypes []string `json:"PlayableMediaTypes"`
+	SupportedCommands  []string `json:"SupportedCommands"`
+}
+
 type JFSessionInfo struct {
 	PlayState          *JFPlayState `json:"PlayState,omitempty"`
 	RemoteEndPoint     string       `json:"RemoteEndPoint,omitempty"`
@@ -180,28 +235,21 @@ type JFSessionInfo struct {
 	IsActive           bool         `json:"IsActive"`
 }
 
-type DisplayPreferencesCustomPrefs struct {
-	ChromecastVersion          string `json:"chromecastVersion"`
-	SkipForwardLength          string `json:"skipForwardLength"`
-	SkipBackLength             string `json:"skipBackLength"`
-	EnableNextVideoInfoOverlay string `json:"enableNextVideoInfoOverlay"`
-	Tvhome                     string `json:"tvhome"`
-	DashboardTheme             string `json:"dashboardTheme"`
-}
-
 type DisplayPreferencesResponse struct {
-	ID                 string                        `json:"Id"`
-	SortBy             string                        `json:"SortBy"`
-	RememberIndexing   bool                          `json:"RememberIndexing"`
-	PrimaryImageHeight int                           `json:"PrimaryImageHeight"`
-	PrimaryImageWidth  int                           `json:"PrimaryImageWidth"`
-	CustomPrefs        DisplayPreferencesCustomPrefs `json:"CustomPrefs"`
-	ScrollDirection    string                        `json:"ScrollDirection"`
-	ShowBackdrop       bool                          `json:"ShowBackdrop"`
-	RememberSorting    bool                          `json:"RememberSorting"`
-	SortOrder          string                        `json:"SortOrder"`
-	ShowSidebar        bool                          `json:"ShowSidebar"`
-	Client             string                        `json:"Client"`
+	ID                 string            `json:"Id"`
+	ViewType           string            `json:"ViewType,omitempty"`
+	SortBy             string            `json:"SortBy"`
+	IndexBy            string            `json:"IndexBy,omitempty"`
+	RememberIndexing   bool              `json:"RememberIndexing"`
+	PrimaryImageHeight int               `json:"PrimaryImageHeight"`
+	PrimaryImageWidth  int               `json:"PrimaryImageWidth"`
+	CustomPrefs        map[string]string `json:"CustomPrefs"`
+	ScrollDirection    string            `json:"ScrollDirection"`
+	ShowBackdrop       bool              `json:"ShowBackdrop"`
+	RememberSorting    bool              `json:"RememberSorting"`
+	SortOrder          string            `json:"SortOrder"`
+	ShowSidebar        bool              `json:"ShowSidebar"`
+	Client             string            `json:"Client"`
 }
 
 type JFCollection struct {
@@ -253,6 +301,7 @@ type JFItem struct {
 	RunTimeTicks             int64              `json:"RunTimeTicks,omitempty"`
 	PlayAccess               string             `json:"PlayAccess,omitempty"`
 	ProductionYear           int                `json:"ProductionYear,omitempty"`
+	Status                   string             `json:"Status,omitempty"`
 	RemoteTrailers           []JFRemoteTrailers `json:"RemoteTrailers,omitempty"`
 	ProviderIds              JFProviderIds      `json:"ProviderIds,omitempty"`
 	IsFolder                 bool               `json:"IsFolder"`
@@ -288,6 +337,7 @@ type JFItem struct {
 	ParentLogoItemId         string             `json:"ParentLogoItemId,omitempty"`
 	RecursiveItemCount       int                `json:"RecursiveItemCount,omitempty"`
 	HasSubtitles             bool               `json:"HasSubtitles,omitempty"`
+	PlaylistItemID           string             `json:"PlaylistItemId,omitempty"`
 }
 
 type JFExternalUrls struct {
@@ -324,6 +374,8 @@ type JFMediaStreams struct {
 	IsExternal             bool    `json:"IsExternal"`
 	IsTextSubtitleStream   bool    `json:"IsTextSubtitleStream"`
 	SupportsExternalStream bool    `json:"SupportsExternalStream"`
+	DeliveryMethod         string  `json:"DeliveryMethod,omitempty"`
+	DeliveryURL            string  `json:"DeliveryUrl,omitempty"`
 	PixelFormat            string  `json:"PixelFormat,omitempty"`
 	Level                  int     `json:"Level"`
 	IsAnamorphic           bool    `json:"IsAnamorphic,omitempty"`
@@ -376,6 +428,8 @@ type JFMediaSources struct {
 	RequiredHTTPHeaders     JFRequiredHTTPHeaders `json:"RequiredHttpHeaders"`
 	TranscodingSubProtocol  string                `json:"TranscodingSubProtocol"`
 	DefaultAudioStreamIndex int                   `json:"DefaultAudioStreamIndex"`
+	// DefaultSubtitleStreamIndex is -1 in case subtitles should not be shown
+	DefaultSubtitleStreamIndex int `json:"DefaultSubtitleStreamIndex"`
 }
 
 type JFRemoteTrailers struct {
@@ -643,6 +697,7 @@ type JFSessionResponse struct {
 	IsActive                 bool                          `json:"IsActive"`
 	SupportsMediaControl     bool                          `json:"SupportsMediaControl"`
 	SupportsRemoteControl    bool                          `json:"SupportsRemoteControl"`
+	NowPlayingItem           *JFItem                       `json:"NowPlayingItem,omitempty"`
 	NowPlayingQueue          []string                      `json:"NowPlayingQueue"`
 	NowPlayingQueueFullItems []string                      `json:"NowPlayingQueueFullItems"`
 	HasCustomDeviceName      bool                          `json:"HasCustomDeviceName"`
@@ -651,9 +706,12 @@ type JFSessionResponse struct {
 }
 
 type JFSessionResponsePlayState struct {
+	PositionTicks int    `json:"PositionTicks,omitempty"`
 	CanSeek       bool   `json:"CanSeek"`
 	IsPaused      bool   `json:"IsPaused"`
 	IsMuted       bool   `json:"IsMuted"`
+	MediaSourceID string `json:"MediaSourceId,omitempty"`
+	PlayMethod    string `json:"PlayMethod,omitempty"`
 	RepeatMode    string `json:"RepeatMode"`
 	PlaybackOrder string `json:"PlaybackOrder"`
 }
@@ -664,3 +722,213 @@ type JFSessionResponseCapabilities struct {
 	SupportsMediaControl         bool     `json:"SupportsMediaControl"`
 	SupportsPersistentIdentifier bool     `json:"SupportsPersistentIdentifier"`
 }
+
+// WebSocket messages
+
+type JFWebSocketMessage struct {
+	MessageType string `json:"MessageType"`
+	MessageID   string `json:"MessageId"`
+	Data        any    `json:"Data,omitempty"`
+}
+
+type JFUserDataChangedInfo struct {
+	UserID       string       `json:"UserId"`
+	UserDataList []JFUserData `json:"UserDataList"`
+}
+
+type JFLibraryUpdateInfo struct {
+	FoldersAddedTo     []string `json:"FoldersAddedTo"`
+	FoldersRemovedFrom []string `json:"FoldersRemovedFrom"`
+	ItemsAdded         []string `json:"ItemsAdded"`
+	ItemsRemoved       []string `json:"ItemsRemoved"`
+	ItemsUpdated       []string `json:"ItemsUpdated"`
+	CollectionFolders  []string `json:"CollectionFolders"`
+}
+
+type JFPlayRequest struct {
+	ItemIDs []string `json:"ItemIds"`
+	// PlayCommand is one of PlayNow, PlayNext, PlayLast, PlayInstantMix or PlayShuffle
+	PlayCommand         string `json:"PlayCommand"`
+	StartPositionTicks  int    `json:"StartPositionTicks,omitempty"`
+	StartIndex          int    `json:"StartIndex,omitempty"`
+	MediaSourceID       string `json:"MediaSourceId,omitempty"`
+	AudioStreamIndex    *int   `json:"AudioStreamIndex,omitempty"`
+	SubtitleStreamIndex *int   `json:"SubtitleStreamIndex,omitempty"`
+	ControllingUserID   string `json:"ControllingUserId"`
+}
+
+type JFPlaystateRequest struct {
+	// Command is one of Stop, Pause, Unpause, NextTrack, PreviousTrack, Seek, Rewind, FastForward or PlayPause
+	Command           string `json:"Command"`
+	SeekPositionTicks int    `json:"SeekPositionTicks,omitempty"`
+	ControllingUserID string `json:"ControllingUserId"`
+}
+
+type JFGeneralCommand struct {
+	// Name is the command, e.g. DisplayMessage, SetVolume or GoHome
+	Name              string            `json:"Name"`
+	ControllingUserID string            `json:"ControllingUserId"`
+	Arguments         map[string]string `json:"Arguments"`
+}
+
+type JFMessageCommand struct {
+	Header    string `json:"Header"`
+	Text      string `json:"Text"`
+	TimeoutMs *int   `json:"TimeoutMs"`
+}
+
+// SyncPlay
+
+type JFUtcTimeResponse struct {
+	RequestReceptionTime     time.Time `json:"RequestReceptionTime"`
+	ResponseTransmissionTime time.Time `json:"ResponseTransmissionTime"`
+}
+
+type JFSyncPlayGroupInfo struct {
+	GroupID       string    `json:"GroupId"`
+	GroupName     string    `json:"GroupName"`
+	State         string    `json:"State"`
+	Participants  []string  `json:"Participants"`
+	LastUpdatedAt time.Time `json:"LastUpdatedAt"`
+}
+
+type JFSyncPlayGroupUpdate struct {
+	GroupID string `json:"GroupId"`
+	// Type is one of UserJoined, UserLeft, GroupJoined, GroupLeft, StateUpdate, PlayQueue,
+	// NotInGroup, GroupDoesNotExist or LibraryAccessDenied
+	Type string `json:"Type"`
+	Data any    `json:"Data"`
+}
+
+type JFSyncPlayStateUpdate struct {
+	State  string `json:"State"`
+	Reason string `json:"Reason"`
+}
+
+type JFSyncPlayPlayQueueUpdate struct {
+	Reason             string                `json:"Reason"`
+	LastUpdate         time.Time             `json:"LastUpdate"`
+	Playlist           []JFSyncPlayQueueItem `json:"Playlist"`
+	PlayingItemIndex   int                   `json:"PlayingItemIndex"`
+	StartPositionTicks int                   `json:"StartPositionTicks"`
+	IsPlaying          bool                  `json:"IsPlaying"`
+	ShuffleMode        string                `json:"ShuffleMode"`
+	RepeatMode         string                `json:"RepeatMode"`
+}
+
+type JFSyncPlayQueueItem struct {
+	ItemID         string `json:"ItemId"`
+	PlaylistItemID string `json:"PlaylistItemId"`
+}
+
+type JFSyncPlayCommand struct {
+	GroupID        string    `json:"GroupId"`
+	PlaylistItemID string    `json:"PlaylistItemId"`
+	When           time.Time `json:"When"`
+	PositionTicks  int       `json:"PositionTicks"`
+	// Command is one of Unpause, Pause, Stop or Seek
+	Command   string    `json:"Command"`
+	EmittedAt time.Time `json:"EmittedAt"`
+}
+
+type JFSyncPlayNewGroupRequest struct {
+	GroupName string `json:"GroupName"`
+}
+
+type JFSyncPlayJoinGroupRequest struct {
+	GroupID string `json:"GroupId"`
+}
+
+type JFSyncPlaySetNewQueueRequest struct {
+	PlayingQueue        []string `json:"PlayingQueue"`
+	PlayingItemPosition int      `json:"PlayingItemPosition"`
+	StartPositionTicks  int      `json:"StartPositionTicks"`
+}
+
+type JFSyncPlayPlaylistItemRequest struct {
+	PlaylistItemID string `json:"PlaylistItemId"`
+}
+
+type JFSyncPlayRemoveFromPlaylistRequest struct {
+	PlaylistItemIDs  []string `json:"PlaylistItemIds"`
+	ClearPlaylist    bool     `json:"ClearPlaylist"`
+	ClearPlayingItem bool     `json:"ClearPlayingItem"`
+}
+
+type JFSyncPlayMovePlaylistItemRequest struct {
+	PlaylistItemID string `json:"PlaylistItemId"`
+	NewIndex       int    `json:"NewIndex"`
+}
+
+type JFSyncPlayQueueRequest struct {
+	ItemIDs []string `json:"ItemIds"`
+	// Mode is Queue or QueueNext
+	Mode string `json:"Mode"`
+}
+
+type JFSyncPlaySeekRequest struct {
+	PositionTicks int `json:"PositionTicks"`
+}
+
+type JFSyncPlayBufferRequest struct {
+	When           time.Time `json:"When"`
+	PositionTicks  int       `json:"PositionTicks"`
+	IsPlaying      bool      `json:"IsPlaying"`
+	PlaylistItemID string    `json:"PlaylistItemId"`
+}
+
+type JFSyncPlayIgnoreWaitRequest struct {
+	IgnoreWait bool `json:"IgnoreWait"`
+}
+
+type JFSyncPlayModeRequest struct {
+	Mode string `json:"Mode"`
+}
+
+type JFSyncPlayPingRequest struct {
+	Ping int `json:"Ping"`
+}
+
+// Playback reporting, modelled after the Jellyfin Playback Reporting plugin
+
+type JFUsageStatsPlayActivity struct {
+	UserID   string `json:"user_id"`
+	UserName string `json:"user_name"`
+	// UserUsage holds plays or play duration in seconds per day, keyed by YYYY-MM-DD
+	UserUsage map[string]int `json:"user_usage"`
+}
+
+type JFUsageStatsUserActivity struct {
+	UserID         string    `json:"user_id"`
+	UserName       string    `json:"user_name"`
+	LatestDate     time.Time `json:"latest_date"`
+	LastClientName string    `json:"last_client_name"`
+	LastDeviceName string    `json:"last_device_name"`
+	ItemID         string    `json:"item_id"`
+	ItemName       string    `json:"item_name"`
+	TotalCount     int       `json:"total_count"`
+	// TotalPlayTime in seconds
+	TotalPlayTime int `json:"total_play_time"`
+}
+
+type JFUsageStatsItem struct {
+	Label string `json:"label"`
+	Count int    `json:"count"`
+	// Time played in seconds
+	Time int `json:"time"`
+}
+
+type JFUsageStatsPlayback struct {
+	Date       time.Time `json:"date"`
+	UserID     string    `json:"user_id"`
+	UserName   string    `json:"user_name"`
+	ItemID     string    `json:"item_id"`
+	ItemName   string    `json:"item_name"`
+	ItemType   string    `json:"item_type"`
+	ClientName string    `json:"client_name"`
+	DeviceName string    `json:"device_name"`
+	PlayMethod string    `json:"play_method"`
+	// Duration played in seconds
+	Duration  int  `json:"duration"`
+	Completed bool `json:"completed"`
+}
@@ -0,0 +1,240 @@
+package jellyfin
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/erikbos/jellofin-server/collection"
+)
+
+// Playback reporting endpoints, modelled after the Jellyfin Playback Reporting
+// plugin. All endpoints accept days (default 7) and endDate (YYYY-MM-DD,
+// default today) to select the reporting period.
+
+const (
+	ErrUsageStatsFailed = "failed to retrieve playback history"
+)
+
+// GET /user_usage_stats/PlayActivity
+//
+// usageStatsPlayActivityHandler returns number of plays, or play duration in
+// seconds in case dataType=time, per user per day.
+func (j *Jellyfin) usageStatsPlayActivityHandler(w http.ResponseWriter, r *http.Request) {
+	since, until := usageStatsPeriod(r)
+	plays, err := j.db.PlaybackHistoryRepo.GetPlaysPerDay(since, until)
+	if err != nil {
+		http.Error(w, ErrUsageStatsFailed, http.StatusInternalServerError)
+		return
+	}
+	playDuration := r.URL.Query().Get("dataType") == "time"
+
+	userNames := j.usageStatsUserNames()
+	activity := make(map[string]*JFUsageStatsPlayActivity)
+	for _, p := range plays {
+		a, ok := activity[p.UserID]
+		if !ok {
+			a = &JFUsageStatsPlayActivity{
+				UserID:    p.UserID,
+				UserName:  userNames[p.UserID],
+				UserUsage: make(map[string]int),
+			}
+			// Include all days of the period so clients can draw a chart
+			for day := since; day.Before(until); day = day.AddDate(0, 0, 1) {
+				a.UserUsage[day.Format(time.DateOnly)] = 0
+			}
+			activity[p.UserID] = a
+		}
+		if playDuration {
+			a.UserUsage[p.Date] += p.PlayDuration
+		} else {
+			a.UserUsage[p.Date] += p.Count
+		}
+	}
+
+	response := []JFUsageStatsPlayActivity{}
+	for _, a := range activity {
+		response = append(response, *a)
+	}
+	sort.Slice(response, func(i, j int) bool {
+		return response[i].UserName < response[j].UserName
+	})
+	serveJSON(response, w)
+}
+
+// GET /user_usage_stats/user_activity
+//
+// usageStatsUserActivityHandler returns number of plays and play duration per
+// user, including the most recently played item.
+func (j *Jellyfin) usageStatsUserActivityHandler(w http.ResponseWriter, r *http.Request) {
+	since, until := usageStatsPeriod(r)
+	activity, err := j.db.PlaybackHistoryRepo.GetUserActivity(since, until)
+	if err != nil {
+		http.Error(w, ErrUsageStatsFailed, http.StatusInternalServerError)
+		return
+	}
+
+	userNames := j.usageStatsUserNames()
+	response := []JFUsageStatsUserActivity{}
+	for _, a := range activity {
+		itemName, _, _ := j.usageStatsItem(a.LastPlayback.ItemID)
+		response = append(response, JFUsageStatsUserActivity{
+			UserID:         a.UserID,
+			UserName:       userNames[a.UserID],
+			LatestDate:     a.LastPlayback.LastUpdate,
+			LastClientName: a.LastPlayback.Client,
+			LastDeviceName: a.LastPlayback.DeviceName,
+			ItemID:         a.LastPlayback.ItemID,
+			ItemName:       itemName,
+			TotalCount:     a.Count,
+			TotalPlayTime:  a.PlayDuration,
+		})
+	}
+	serveJSON(response, w)
+}
+
+// GET /user_usage_stats/MoviesReport
+//
+// usageStatsMoviesReportHandler returns the most played movies.
+func (j *Jellyfin) usageStatsMoviesReportHandler(w http.ResponseWriter, r *http.Request) {
+	j.usageStatsTopItems(w, r, false)
+}
+
+// GET /user_usage_stats/TvShowsReport
+//
+// usageStatsTvShowsReportHandler returns the most played shows.
+func (j *Jellyfin) usageStatsTvShowsReportHandler(w http.ResponseWriter, r *http.Request) {
+	j.usageStatsTopItems(w, r, true)
+}
+
+// usageStatsTopItems returns the most played movies, or shows in which case
+// plays of all episodes of a show are counted.
+func (j *Jellyfin) usageStatsTopItems(w http.ResponseWriter, r *http.Request, shows bool) {
+	since, until := usageStatsPeriod(r)
+	plays, err := j.db.PlaybackHistoryRepo.GetTopItems(since, until)
+	if err != nil {
+		http.Error(w, ErrUsageStatsFailed, http.StatusInternalServerError)
+		return
+	}
+
+	items := make(map[string]*JFUsageStatsItem)
+	var order []string
+	for _, p := range plays {
+		name, itemType, show := j.usageStatsItem(p.ItemID)
+		if shows {
+			if show == nil {
+				continue
+			}
+			name = show.Name
+		} else if itemType != "Movie" {
+			continue
+		}
+		item, ok := items[name]
+		if !ok {
+			item = &JFUsageStatsItem{Label: name}
+			items[name] = item
+			order = append(order, name)
+		}
+		item.Count += p.Count
+		item.Time += p.PlayDuration
+	}
+
+	response := make([]JFUsageStatsItem, 0, len(order))
+	for _, name := range order {
+		response = append(response, *items[name])
+	}
+	sort.SliceStable(response, func(i, j int) bool {
+		return response[i].Count > response[j].Count
+	})
+	if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit > 0 && limit < len(response) {
+		response = response[:limit]
+	}
+	serveJSON(response, w)
+}
+
+// GET /user_usage_stats/UserPlaylist
+//
+// usageStatsUserPlaylistHandler returns playback history, of one user in case
+// user_id is provided, most recent first.
+func (j *Jellyfin) usageStatsUserPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	since, until := usageStatsPeriod(r)
+	limit := 500
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	history, err := j.db.PlaybackHistoryRepo.GetHistory(r.URL.Query().Get("user_id"), since, until, limit)
+	if err != nil {
+		http.Error(w, ErrUsageStatsFailed, http.StatusInternalServerError)
+		return
+	}
+
+	userNames := j.usageStatsUserNames()
+	response := make([]JFUsageStatsPlayback, 0, len(history))
+	for _, h := range history {
+		itemName, itemType, _ := j.usageStatsItem(h.ItemID)
+		response = append(response, JFUsageStatsPlayback{
+			Date:       h.Started,
+			UserID:     h.UserID,
+			UserName:   userNames[h.UserID],
+			ItemID:     h.ItemID,
+			ItemName:   itemName,
+			ItemType:   itemType,
+			ClientName: h.Client,
+			DeviceName: h.DeviceName,
+			PlayMethod: h.PlayMethod,
+			Duration:   h.PlayDuration,
+			Completed:  h.Completed,
+		})
+	}
+	serveJSON(response, w)
+}
+
+// usageStatsPeriod returns the reporting period of a request, based upon
+// days and endDate query parameters.
+func usageStatsPeriod(r *http.Request) (since, until time.Time) {
+	queryparams := r.URL.Query()
+	days := 7
+	if v, err := strconv.Atoi(queryparams.Get("days")); err == nil && v > 0 {
+		days = v
+	}
+	now := time.Now().UTC()
+	endDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if v, err := time.Parse(time.DateOnly, queryparams.Get("endDate")); err == nil {
+		endDate = v
+	}
+	until = endDate.AddDate(0, 0, 1)
+	since = until.AddDate(0, 0, -days)
+	return
+}
+
+// usageStatsUserNames returns names of all users, keyed by user ID.
+func (j *Jellyfin) usageStatsUserNames() map[string]string {
+	names := make(map[string]string)
+	users, err := j.db.UserRepo.GetAll()
+	if err != nil {
+		return names
+	}
+	for _, u := range users {
+		names[u.ID] = u.Username
+	}
+	return names
+}
+
+// usageStatsItem returns name and type of a movie or episode, and its show
+// in case of an episode.
+func (j *Jellyfin) usageStatsItem(itemID string) (name, itemType string, show *collection.Item) {
+	if _, i := j.collections.GetItemByID(itemID); i != nil {
+		return i.Name, "Movie", nil
+	}
+	if _, show, _, e := j.collections.GetEpisodeByID(itemID); e != nil {
+		name = fmt.Sprintf("%s - s%02de%02d", show.Name, e.SeasonNo, e.EpisodeNo)
+		e.LoadNfo()
+		if e.Nfo != nil && e.Nfo.Title != "" {
+			name += " - " + e.Nfo.Title
+		}
+		return name, "Episode", show
+	}
+	return itemID, "Unknown", nil
+}
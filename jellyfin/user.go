@@ -1,7 +1,10 @@
 package jellyfin
 
 import (
+	"encoding/json"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -10,25 +13,40 @@ import (
 )
 
 const (
-	ErrUserIDNotFound = "userid not found"
+	ErrUserIDNotFound    = "userid not found"
+	ErrUserNotAllowed    = "not allowed to access other users"
+	ErrUserLastAdmin     = "cannot remove last administrator"
+	ErrUserUpdateFailed  = "failed to update user"
+	ErrUserPasswordEmpty = "password required"
 )
 
 // GET /Users
 //
-// usersAllHandler returns all users, we return only the current user
+// usersAllHandler returns all users, non-administrators only get themselves
 func (j *Jellyfin) usersAllHandler(w http.ResponseWriter, r *http.Request) {
 	accessToken := j.getAccessTokenDetails(w, r)
 	if accessToken == nil {
 		return
 	}
 
-	dbuser, err := j.db.UserRepo.GetByID(accessToken.UserID)
+	if !j.isAdmin(accessToken.UserID) {
+		dbuser, err := j.db.UserRepo.GetByID(accessToken.UserID)
+		if err != nil {
+			http.Error(w, ErrUserIDNotFound, http.StatusNotFound)
+			return
+		}
+		serveJSON([]JFUser{makeJFUser(dbuser)}, w)
+		return
+	}
+
+	users, err := j.db.UserRepo.GetAll()
 	if err != nil {
-		http.Error(w, ErrUserIDNotFound, http.StatusNotFound)
+		http.Error(w, "Could not get users", http.StatusInternalServerError)
 		return
 	}
-	response := []JFUser{
-		makeJFUser(dbuser),
+	response := make([]JFUser, 0, len(users))
+	for _, u := range users {
+		response = append(response, makeJFUser(&u))
 	}
 	serveJSON(response, w)
 }
@@ -53,7 +71,7 @@ func (j *Jellyfin) usersMeHandler(w http.ResponseWriter, r *http.Request) {
 
 // GET /Users/{user}
 //
-// usersHandler returns a user, we always return the current user
+// usersHandler returns a user, non-administrators can only retrieve themselves
 func (j *Jellyfin) usersHandler(w http.ResponseWriter, r *http.Request) {
 	accessToken := j.getAccessTokenDetails(w, r)
 	if accessToken == nil {
@@ -61,12 +79,13 @@ func (j *Jellyfin) usersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	vars := mux.Vars(r)
-	if vars["user"] != accessToken.UserID {
+	userID := vars["user"]
+	if userID != accessToken.UserID && !j.isAdmin(accessToken.UserID) {
 		http.Error(w, ErrUserIDNotFound, http.StatusNotFound)
 		return
 	}
 
-	dbuser, err := j.db.UserRepo.GetByID(accessToken.UserID)
+	dbuser, err := j.db.UserRepo.GetByID(userID)
 	if err != nil {
 		http.Error(w, ErrUserIDNotFound, http.StatusNotFound)
 		return
@@ -75,6 +94,220 @@ func (j *Jellyfin) usersHandler(w http.ResponseWriter, r *http.Request) {
 	serveJSON(response, w)
 }
 
+// POST /Users/New
+//
+// usersNewHandler creates a new user, administrator only
+func (j *Jellyfin) usersNewHandler(w http.ResponseWriter, r *http.Request) {
+	var request JFCreateUserByNameRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
+		return
+	}
+	if request.Name == "" {
+		http.Error(w, "name required", http.StatusBadRequest)
+		return
+	}
+	if request.Password == "" {
+		http.Error(w, ErrUserPasswordEmpty, http.StatusBadRequest)
+		return
+	}
+
+	user, err := j.db.UserRepo.Insert(request.Name, request.Password)
+	if err == database.ErrUserExists {
+		http.Error(w, "user already exists", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to create user", http.StatusInternalServerError)
+		return
+	}
+	serveJSON(makeJFUser(user), w)
+}
+
+// DELETE /Users/{user}
+//
+// usersDeleteHandler deletes a user and revokes its access tokens, administrator only
+func (j *Jellyfin) usersDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user"]
+
+	switch err := j.db.UserRepo.Delete(userID); err {
+	case nil:
+	case database.ErrUserNotFound:
+		http.Error(w, ErrUserIDNotFound, http.StatusNotFound)
+		return
+	case database.ErrLastAdmin:
+		http.Error(w, ErrUserLastAdmin, http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, "failed to delete user", http.StatusInternalServerError)
+		return
+	}
+	if err := j.db.AccessTokenRepo.DeleteByUser(userID); err != nil {
+		http.Error(w, "failed to revoke access tokens", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /Users/{user}/Password
+//
+// usersPasswordHandler changes password of a user. Users need to provide their
+// current password, administrators can change password of any user without it.
+func (j *Jellyfin) usersPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	userID := vars["user"]
+	admin := j.isAdmin(accessToken.UserID)
+	if userID != accessToken.UserID && !admin {
+		http.Error(w, ErrUserNotAllowed, http.StatusForbidden)
+		return
+	}
+
+	var request JFUpdateUserPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
+		return
+	}
+	// We do not support users without password
+	if request.ResetPassword || request.NewPw == "" {
+		http.Error(w, ErrUserPasswordEmpty, http.StatusBadRequest)
+		return
+	}
+
+	dbuser, err := j.db.UserRepo.GetByID(userID)
+	if err != nil {
+		http.Error(w, ErrUserIDNotFound, http.StatusNotFound)
+		return
+	}
+	if !admin {
+		if _, err := j.db.UserRepo.Validate(dbuser.Username, request.CurrentPw); err != nil {
+			http.Error(w, "invalid current password", http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := j.db.UserRepo.SetPassword(userID, request.NewPw); err != nil {
+		http.Error(w, ErrUserUpdateFailed, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /Users/{user}/Policy
+//
+// usersPolicyHandler updates policy of a user, administrator only.
+// Stored are IsAdministrator, IsDisabled, library access: EnableAllFolders,
+// EnabledFolders and BlockedMediaFolders, and parental control: MaxParentalRating
+// and BlockUnratedItems. Fields not provided keep their value.
+func (j *Jellyfin) usersPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := vars["user"]
+
+	dbuser, err := j.db.UserRepo.GetByID(userID)
+	if err != nil {
+		http.Error(w, ErrUserIDNotFound, http.StatusNotFound)
+		return
+	}
+
+	request := makeJFUser(dbuser).Policy
+	request.BlockedMediaFolders = nil
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
+		return
+	}
+	dbuser.Admin = request.IsAdministrator
+	dbuser.Disabled = request.IsDisabled
+	dbuser.EnableAllFolders = request.EnableAllFolders
+	dbuser.MaxParentalRating = request.MaxParentalRating
+	// We do not distinguish between item types, blocking any type blocks all unrated items
+	dbuser.BlockUnratedItems = len(request.BlockUnratedItems) > 0
+	dbuser.EnabledFolders = []string{}
+	for _, folderID := range request.EnabledFolders {
+		dbuser.EnabledFolders = append(dbuser.EnabledFolders, strings.TrimPrefix(folderID, itemprefix_collection))
+	}
+	// Blocked folders are the inverse of enabled folders
+	if len(request.BlockedMediaFolders) > 0 {
+		if dbuser.EnableAllFolders {
+			dbuser.EnableAllFolders = false
+			dbuser.EnabledFolders = []string{}
+			for _, c := range j.collections.GetCollections() {
+				dbuser.EnabledFolders = append(dbuser.EnabledFolders, CollectionIDToString(c.ID))
+			}
+		}
+		for _, folderID := range request.BlockedMediaFolders {
+			dbuser.EnabledFolders = slices.DeleteFunc(dbuser.EnabledFolders, func(id string) bool {
+				return id == strings.TrimPrefix(folderID, itemprefix_collection)
+			})
+		}
+	}
+
+	switch err := j.db.UserRepo.Update(*dbuser); err {
+	case nil:
+	case database.ErrLastAdmin:
+		http.Error(w, ErrUserLastAdmin, http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, ErrUserUpdateFailed, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /Users/{user}/Configuration
+// POST /Users/Configuration?userId=XAOVn7iqiBujnIQY8sd0
+//
+// usersConfigurationHandler stores playback and home screen preferences of a user.
+func (j *Jellyfin) usersConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	accessToken := j.getAccessTokenDetails(w, r)
+	if accessToken == nil {
+		return
+	}
+
+	vars := mux.Vars(r)
+	userID := vars["user"]
+	if userID == "" {
+		userID = r.URL.Query().Get("userId")
+	}
+	if userID == "" {
+		userID = accessToken.UserID
+	}
+	if userID != accessToken.UserID && !j.isAdmin(accessToken.UserID) {
+		http.Error(w, ErrUserNotAllowed, http.StatusForbidden)
+		return
+	}
+	if _, err := j.db.UserRepo.GetByID(userID); err != nil {
+		http.Error(w, ErrUserIDNotFound, http.StatusNotFound)
+		return
+	}
+
+	var request JFUserConfiguration
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
+		return
+	}
+	config := database.UserConfiguration{
+		AudioLanguagePreference:    request.AudioLanguagePreference,
+		SubtitleLanguagePreference: request.SubtitleLanguagePreference,
+		SubtitleMode:               request.SubtitleMode,
+		PlayDefaultAudioTrack:      request.PlayDefaultAudioTrack,
+		OrderedViews:               request.OrderedViews,
+		LatestItemsExcludes:        request.LatestItemsExcludes,
+	}
+	if config.SubtitleMode == "" {
+		config.SubtitleMode = subtitleModeDefault
+	}
+	if err := j.db.UserRepo.UpdateConfiguration(userID, config); err != nil {
+		http.Error(w, ErrUserUpdateFailed, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // GET /Users/Public
 //
 // usersHandler returns list of public users, none
@@ -84,6 +317,14 @@ func (j *Jellyfin) usersPublicHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func makeJFUser(user *database.User) JFUser {
+	enabledFolders := make([]string, 0, len(user.EnabledFolders))
+	for _, folderID := range user.EnabledFolders {
+		enabledFolders = append(enabledFolders, itemprefix_collection+folderID)
+	}
+	blockUnratedItems := []string{}
+	if user.BlockUnratedItems {
+		blockUnratedItems = []string{"Movie", "Series"}
+	}
 	return JFUser{
 		Id:                        user.ID,
 		Name:                      user.Username,
@@ -95,15 +336,18 @@ func makeJFUser(user *database.User) JFUser {
 		LastLoginDate:             time.Now().UTC(),
 		LastActivityDate:          time.Now().UTC(),
 		Configuration: JFUserConfiguration{
-			GroupedFolders:      []string{},
-			LatestItemsExcludes: []string{},
-			MyMediaExcludes:     []string{},
-			OrderedViews:        []string{},
-			SubtitleMode:        "Default",
+			AudioLanguagePreference:    user.Configuration.AudioLanguagePreference,
+			PlayDefaultAudioTrack:      user.Configuration.PlayDefaultAudioTrack,
+			SubtitleLanguagePreference: user.Configuration.SubtitleLanguagePreference,
+			SubtitleMode:               user.Configuration.SubtitleMode,
+			GroupedFolders:             []string{},
+			LatestItemsExcludes:        user.Configuration.LatestItemsExcludes,
+			MyMediaExcludes:            []string{},
+			OrderedViews:               user.Configuration.OrderedViews,
 		},
 		Policy: JFUserPolicy{
-			// Needs to be true to allow Streamyfin to Cast
-			IsAdministrator: true,
+			IsAdministrator: user.Admin,
+			IsDisabled:      user.Disabled,
 			// Checked by Streamyfin to permit download
 			EnableContentDownloading:         true,
 			AccessSchedules:                  []string{},
@@ -111,10 +355,12 @@ func makeJFUser(user *database.User) JFUser {
 			BlockedChannels:                  []string{},
 			BlockedMediaFolders:              []string{},
 			BlockedTags:                      []string{},
-			BlockUnratedItems:                []string{},
+			BlockUnratedItems:                blockUnratedItems,
+			MaxParentalRating:                user.MaxParentalRating,
 			EnabledChannels:                  []string{},
 			EnabledDevices:                   []string{},
-			EnabledFolders:                   []string{},
+			EnableAllFolders:                 user.EnableAllFolders,
+			EnabledFolders:                   enabledFolders,
 			EnableContentDeletionFromFolders: []string{},
 			EnableMediaPlayback:              true,
 			EnableRemoteAccess:               true,
@@ -2,6 +2,7 @@ package jellyfin
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"github.com/erikbos/jellofin-server/collection"
 	"github.com/erikbos/jellofin-server/database"
 )
 
@@ -23,16 +25,21 @@ const (
 // POST /Users/{user}/PlayedItems/{item}
 //
 // usersPlayedItemsPostHandler marks an item as played.
+// Marking a show or season marks all of its episodes.
 func (j *Jellyfin) usersPlayedItemsPostHandler(w http.ResponseWriter, r *http.Request) {
-	accessToken := j.getAccessTokenDetails(w, r)
-	if accessToken == nil {
+	user := j.getUserDetails(w, r)
+	if user == nil {
 		return
 	}
 
 	vars := mux.Vars(r)
 	itemID := vars["item"]
+	if !j.itemIDAllowed(user, itemID) {
+		http.Error(w, "Access to item not allowed", http.StatusForbidden)
+		return
+	}
 
-	if err := j.userDataUpdate(accessToken.UserID, itemID, 0, true); err != nil {
+	if err := j.userDataSetPlayed(user.ID, itemID, true); err != nil {
 		http.Error(w, ErrFailedToUpdateUserData, http.StatusInternalServerError)
 		return
 	}
@@ -42,25 +49,51 @@ func (j *Jellyfin) usersPlayedItemsPostHandler(w http.ResponseWriter, r *http.Re
 // DELETE /UserPlayedItems/{item}
 // DELETE /Users/{user}/PlayedItems/{item}
 //
-// // usersPlayedItemsPostHandler marks an item as not played.
+// usersPlayedItemsDeleteHandler marks an item as not played.
 func (j *Jellyfin) usersPlayedItemsDeleteHandler(w http.ResponseWriter, r *http.Request) {
-	accessToken := j.getAccessTokenDetails(w, r)
-	if accessToken == nil {
+	user := j.getUserDetails(w, r)
+	if user == nil {
 		return
 	}
 
 	vars := mux.Vars(r)
 	itemID := vars["item"]
+	if !j.itemIDAllowed(user, itemID) {
+		http.Error(w, "Access to item not allowed", http.StatusForbidden)
+		return
+	}
 
-	if err := j.userDataUpdate(accessToken.UserID, itemID, 0, false); err != nil {
+	if err := j.userDataSetPlayed(user.ID, itemID, false); err != nil {
 		http.Error(w, ErrFailedToUpdateUserData, http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
-// /Sessions/Playing
+// POST /Sessions/Playing
+//
+// sessionsPlayingHandler reports start of playback of an item.
 func (j *Jellyfin) sessionsPlayingHandler(w http.ResponseWriter, r *http.Request) {
+	j.sessionsPlayingReport(w, r, database.PlaybackStart)
+}
+
+// POST /Sessions/Playing/Progress
+//
+// sessionsPlayingProgressHandler reports playback progress of an item.
+func (j *Jellyfin) sessionsPlayingProgressHandler(w http.ResponseWriter, r *http.Request) {
+	j.sessionsPlayingReport(w, r, database.PlaybackProgress)
+}
+
+// POST /Sessions/Playing/Stopped
+//
+// sessionsPlayingStoppedHandler reports end of playback of an item.
+func (j *Jellyfin) sessionsPlayingStoppedHandler(w http.ResponseWriter, r *http.Request) {
+	j.sessionsPlayingReport(w, r, database.PlaybackStop)
+}
+
+// sessionsPlayingReport updates play state of the item and records the
+// playback event in the playback history.
+func (j *Jellyfin) sessionsPlayingReport(w http.ResponseWriter, r *http.Request, eventType string) {
 	accessToken := j.getAccessTokenDetails(w, r)
 	if accessToken == nil {
 		return
@@ -71,87 +104,129 @@ func (j *Jellyfin) sessionsPlayingHandler(w http.ResponseWriter, r *http.Request
 		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
 		return
 	}
-	// log.Printf("\nsessionsPlayingHandler UserID: %s, ItemId: %s, Progress: %d seconds\n\n",
-	// 	accessToken.UserID, request.ItemId, request.PositionTicks/TicsToSeconds)
-	if err := j.userDataUpdate(accessToken.UserID, request.ItemId, request.PositionTicks, false); err != nil {
+	// log.Printf("\nsessionsPlayingReport %s UserID: %s, ItemId: %s, Progress: %d seconds\n\n",
+	// 	eventType, accessToken.UserID, request.ItemId, request.PositionTicks/TicsToSeconds)
+	played, err := j.userDataUpdate(accessToken.UserID, request.ItemId, request.PositionTicks, false)
+	if err != nil {
 		http.Error(w, ErrFailedToUpdateUserData, http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
-}
 
-// /Sessions/Playing/Progress
-func (j *Jellyfin) sessionsPlayingProgressHandler(w http.ResponseWriter, r *http.Request) {
-	accessToken := j.getAccessTokenDetails(w, r)
-	if accessToken == nil {
-		return
+	event := database.PlaybackEvent{
+		Type:          eventType,
+		UserID:        accessToken.UserID,
+		ItemID:        trimPrefix(request.ItemId),
+		PlaySessionID: request.PlaySessionID,
+		DeviceID:      accessToken.DeviceID,
+		DeviceName:    accessToken.DeviceName,
+		Client:        accessToken.Client,
+		PlayMethod:    request.PlayMethod,
+		Position:      request.PositionTicks / TicsToSeconds,
+		Paused:        request.IsPaused,
+		Completed:     played,
 	}
-
-	var request JFPlayState
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
-		return
+	if err := j.db.PlaybackHistoryRepo.RecordPlayback(event); err != nil {
+		log.Printf("Error recording playback history: %s\n", err)
 	}
-	// log.Printf("\nsessionsPlayingProgressHandler UserID: %s, ItemId: %s, Progress: %d seconds\n\n",
-	// 	accessToken.UserID, request.ItemId, request.PositionTicks/TicsToSeconds)
-	if err := j.userDataUpdate(accessToken.UserID, request.ItemId, request.PositionTicks, false); err != nil {
-		http.Error(w, ErrFailedToUpdateUserData, http.StatusInternalServerError)
-		return
+
+	if session := j.getSessionDetails(w, r); session != nil {
+		var nowPlaying *sessionNowPlaying
+		if eventType != database.PlaybackStop {
+			nowPlaying = &sessionNowPlaying{
+				ItemID:        request.ItemId,
+				MediaSourceID: request.MediaSourceID,
+				PlaySessionID: request.PlaySessionID,
+				PlayMethod:    request.PlayMethod,
+				PositionTicks: request.PositionTicks,
+				CanSeek:       request.CanSeek,
+				IsPaused:      request.IsPaused,
+				IsMuted:       request.IsMuted,
+			}
+		}
+		j.sessions.setNowPlaying(session.UserID, session.DeviceID, nowPlaying)
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// /Sessions/Playing/Stopped
-func (j *Jellyfin) sessionsPlayingStoppedHandler(w http.ResponseWriter, r *http.Request) {
-	accessToken := j.getAccessTokenDetails(w, r)
-	if accessToken == nil {
-		return
+// userDataSetPlayed marks an item as played or not played, in case of
+// a show or season all of its episodes are updated instead.
+func (j *Jellyfin) userDataSetPlayed(userID, itemID string, played bool) error {
+	var episodeIDs []string
+	if strings.HasPrefix(itemID, itemprefix_season) {
+		_, _, season := j.collections.GetSeasonByID(trimPrefix(itemID))
+		if season == nil {
+			return errors.New("season not found")
+		}
+		for _, e := range season.Episodes {
+			episodeIDs = append(episodeIDs, e.ID)
+		}
+	} else if _, show := j.collections.GetItemByID(trimPrefix(itemID)); show != nil && show.Type == collection.ItemTypeShow {
+		for _, s := range show.Seasons {
+			for _, e := range s.Episodes {
+				episodeIDs = append(episodeIDs, e.ID)
+			}
+		}
+	} else {
+		episodeIDs = []string{trimPrefix(itemID)}
 	}
 
-	var request JFPlayState
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, ErrInvalidJSONPayload, http.StatusBadRequest)
-		return
+	for _, id := range episodeIDs {
+		playstate, err := j.db.UserDataRepo.Get(userID, id)
+		if err != nil {
+			playstate = database.UserData{}
+		}
+		// Leave play state of episodes alone that are already in the requested state
+		if playstate.Played == played && (played || playstate.Position == 0) {
+			continue
+		}
+		playstate.Position = 0
+		playstate.PlayedPercentage = 0
+		playstate.Played = played
+		if err := j.userDataStore(userID, id, playstate); err != nil {
+			return err
+		}
 	}
-	// log.Printf("\nsessionsPlayingStoppedHandler UserID: %s, ItemId: %s, Progress: %d seconds, canSeek: %t\n\n",
-	// 	accessToken.UserID, request.ItemId, request.PositionTicks/TicsToSeconds, request.CanSeek)
-	if err := j.userDataUpdate(accessToken.UserID, request.ItemId, request.PositionTicks, false); err != nil {
-		http.Error(w, ErrFailedToUpdateUserData, http.StatusInternalServerError)
-		return
+	return nil
+}
+
+// itemPlayed returns true if a user has played an item, a show is played
+// in case all of its episodes are played.
+func (j *Jellyfin) itemPlayed(userID string, i *collection.Item) bool {
+	if i.Type != collection.ItemTypeShow {
+		playstate, err := j.db.UserDataRepo.Get(userID, trimPrefix(i.ID))
+		return err == nil && playstate.Played
 	}
-	w.WriteHeader(http.StatusNoContent)
+	var episodes int
+	for _, s := range i.Seasons {
+		for _, e := range s.Episodes {
+			if playstate, err := j.db.UserDataRepo.Get(userID, e.ID); err != nil || !playstate.Played {
+				return false
+			}
+			episodes++
+		}
+	}
+	return episodes != 0
 }
 
-func (j *Jellyfin) userDataUpdate(userID, itemID string, positionTicks int, markAsWatched bool) (err error) {
+// userDataUpdate updates the play position of an item, played is true in
+// case the item has been played until (almost) the end.
+func (j *Jellyfin) userDataUpdate(userID, itemID string, positionTicks int, markAsWatched bool) (played bool, err error) {
 	// log.Printf("playStateUpdate userID: %s, itemID: %s, Progress: %d sec\n",
 	// 	userID, itemID, positionTicks/TicsToSeconds)
 
-	// fixme: duration determination should be moved to collection package
 	var duration int
 	if strings.HasPrefix(itemID, itemprefix_episode) {
 		_, _, _, episode := j.collections.GetEpisodeByID(trimPrefix(itemID))
-
-		// fix me: we should not have to load NFO here
-		episode.LoadNfo()
-		if episode.Nfo != nil &&
-			episode.Nfo.FileInfo != nil &&
-			episode.Nfo.FileInfo.StreamDetails != nil &&
-			episode.Nfo.FileInfo.StreamDetails.Video != nil {
-			duration = episode.Nfo.FileInfo.StreamDetails.Video.DurationInSeconds
-		} else {
+		if episode != nil {
+			duration = episode.Duration()
+		}
+		if duration == 0 {
 			log.Printf("playStateUpdate: no duration for episode %s\n", itemID)
 		}
 	} else {
-		_, item := j.collections.GetItemByID(itemID)
+		_, item := j.collections.GetItemByID(trimPrefix(itemID))
 		if item != nil {
-			item.LoadNfo()
-		}
-		if item.Nfo != nil {
-			if item.Nfo.Runtime != 0 {
-				duration = item.Nfo.Runtime * 60
-			} else if item.Nfo.FileInfo.StreamDetails.Video.DurationInSeconds != 0 {
-				duration = item.Nfo.FileInfo.StreamDetails.Video.DurationInSeconds
-			}
+			duration = item.Duration()
 		}
 	}
 	// fixme: hack: if we don't have a duration, we assume 1 hour
@@ -180,33 +255,46 @@ func (j *Jellyfin) userDataUpdate(userID, itemID string, positionTicks int, mark
 		playstate.Played = false
 	}
 
-	return j.db.UserDataRepo.Update(userID, trimPrefix(itemID), playstate)
+	return playstate.Played, j.userDataStore(userID, trimPrefix(itemID), playstate)
+}
+
+// userDataStore stores play state of an item and notifies clients of the user.
+func (j *Jellyfin) userDataStore(userID, itemID string, playstate database.UserData) error {
+	if err := j.db.UserDataRepo.Update(userID, itemID, playstate); err != nil {
+		return err
+	}
+	j.notifyUserDataChanged(userID, itemID, playstate)
+	return nil
 }
 
 // POST /UserFavoriteItems/{item}
 //
 // // userFavoriteItemsPostHandler marks an item as favorite.
 func (j *Jellyfin) userFavoriteItemsPostHandler(w http.ResponseWriter, r *http.Request) {
-	accessToken := j.getAccessTokenDetails(w, r)
-	if accessToken == nil {
+	user := j.getUserDetails(w, r)
+	if user == nil {
 		return
 	}
 
 	vars := mux.Vars(r)
 	itemID := vars["item"]
+	if !j.itemIDAllowed(user, itemID) {
+		http.Error(w, "Access to item not allowed", http.StatusForbidden)
+		return
+	}
 
-	playstate, err := j.db.UserDataRepo.Get(accessToken.UserID, trimPrefix(itemID))
+	playstate, err := j.db.UserDataRepo.Get(user.ID, trimPrefix(itemID))
 	if err != nil {
 		playstate = database.UserData{}
 	}
 
 	playstate.Favorite = true
 
-	if err := j.db.UserDataRepo.Update(accessToken.UserID, itemID, playstate); err != nil {
+	if err := j.userDataStore(user.ID, itemID, playstate); err != nil {
 		http.Error(w, ErrFailedToUpdateUserData, http.StatusInternalServerError)
 		return
 	}
-	userData := j.makeJFUserData(accessToken.UserID, itemID, playstate)
+	userData := j.makeJFUserData(user.ID, itemID, playstate)
 	serveJSON(userData, w)
 }
 
@@ -214,25 +302,29 @@ func (j *Jellyfin) userFavoriteItemsPostHandler(w http.ResponseWriter, r *http.R
 //
 // // userFavoriteItemsDeleteHandler unmarks an item as favorite.
 func (j *Jellyfin) userFavoriteItemsDeleteHandler(w http.ResponseWriter, r *http.Request) {
-	accessToken := j.getAccessTokenDetails(w, r)
-	if accessToken == nil {
+	user := j.getUserDetails(w, r)
+	if user == nil {
 		return
 	}
 
 	vars := mux.Vars(r)
 	itemID := vars["item"]
+	if !j.itemIDAllowed(user, itemID) {
+		http.Error(w, "Access to item not allowed", http.StatusForbidden)
+		return
+	}
 
-	playstate, err := j.db.UserDataRepo.Get(accessToken.UserID, trimPrefix(itemID))
+	playstate, err := j.db.UserDataRepo.Get(user.ID, trimPrefix(itemID))
 	if err != nil {
 		playstate = database.UserData{}
 	}
 
 	playstate.Favorite = false
 
-	if err := j.db.UserDataRepo.Update(accessToken.UserID, itemID, playstate); err != nil {
+	if err := j.userDataStore(user.ID, itemID, playstate); err != nil {
 		http.Error(w, ErrFailedToUpdateUserData, http.StatusInternalServerError)
 		return
 	}
-	userData := j.makeJFUserData(accessToken.UserID, itemID, playstate)
+	userData := j.makeJFUserData(user.ID, itemID, playstate)
 	serveJSON(userData, w)
 }
@@ -0,0 +1,54 @@
+package jellyfin
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/erikbos/jellofin-server/collection"
+)
+
+func TestUserDataOfHiddenItems(t *testing.T) {
+	s := newTestServer(t)
+	s.setCollections(collection.Collections{
+		{ID: 1, Name_: "Movies", Type: collection.CollectionMovies, Items: []*collection.Item{
+			{ID: "alien", Name: "Alien", Type: collection.ItemTypeMovie},
+		}},
+		{ID: 2, Name_: "Shows", Type: collection.CollectionShows, Items: []*collection.Item{
+			{ID: "bluey", Name: "Bluey", Type: collection.ItemTypeShow, Seasons: []collection.Season{
+				{ID: "bluey1", SeasonNo: 1, Episodes: []collection.Episode{{ID: "magic", SeasonNo: 1, EpisodeNo: 1}}},
+			}},
+		}},
+	})
+	kid, token := s.login(t, "kid", "tablet")
+	kid.EnableAllFolders, kid.EnabledFolders = false, []string{"2"}
+	if err := s.j.db.UserRepo.Update(*kid); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"POST", "/UserPlayedItems/alien", http.StatusForbidden},
+		{"DELETE", "/UserPlayedItems/alien", http.StatusForbidden},
+		{"POST", "/UserFavoriteItems/alien", http.StatusForbidden},
+		{"DELETE", "/UserFavoriteItems/alien", http.StatusForbidden},
+		{"POST", "/UserPlayedItems/unknown", http.StatusForbidden},
+		{"POST", "/UserPlayedItems/bluey", http.StatusOK},
+		{"POST", "/UserFavoriteItems/bluey", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if resp := s.do(t, tt.method, tt.path, token, nil); resp.StatusCode != tt.want {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+		}
+	}
+	if _, err := s.j.db.UserDataRepo.Get(kid.ID, "alien"); err == nil {
+		t.Error("play state of hidden item stored")
+	}
+	if state, err := s.j.db.UserDataRepo.Get(kid.ID, "magic"); err != nil || !state.Played {
+		t.Errorf("play state of episode of allowed show = %+v, %v", state, err)
+	}
+	if state, err := s.j.db.UserDataRepo.Get(kid.ID, "bluey"); err != nil || !state.Favorite {
+		t.Errorf("play state of allowed show = %+v, %v", state, err)
+	}
+}
@@ -0,0 +1,345 @@
+package jellyfin
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/erikbos/jellofin-server/collection"
+	"github.com/erikbos/jellofin-server/database"
+)
+
+// Clients connect to /socket to receive updates pushed by the server, e.g.
+// changed user data, library changes and remote control commands. Messages
+// in both directions are JSON objects with MessageType and optional Data.
+
+const (
+	// socketKeepAliveTimeout closes connections that did not send a message
+	// for this duration, clients send a keepalive every half of it.
+	socketKeepAliveTimeout = 60 * time.Second
+	// socketWriteTimeout is the maximum duration of writing a message
+	socketWriteTimeout = 10 * time.Second
+	// socketMaxMessageSize is the maximum size of a message sent by a client
+	socketMaxMessageSize = 64 * 1024
+	// socketSendQueueLength is the number of messages queued per connection,
+	// messages are dropped in case a client does not keep up.
+	socketSendQueueLength = 32
+	// socketMinSessionsInterval is the minimum interval of sessions updates
+	socketMinSessionsInterval = time.Second
+
+	// Message types
+	socketMessageKeepAlive           = "KeepAlive"
+	socketMessageForceKeepAlive      = "ForceKeepAlive"
+	socketMessageUserDataChanged     = "UserDataChanged"
+	socketMessageLibraryChanged      = "LibraryChanged"
+	socketMessageSessionsStart       = "SessionsStart"
+	socketMessageSessionsStop        = "SessionsStop"
+	socketMessageSessions            = "Sessions"
+	socketMessagePlay                = "Play"
+	socketMessagePlaystate           = "Playstate"
+	socketMessageGeneralCommand      = "GeneralCommand"
+	socketMessageSyncPlayCommand     = "SyncPlayCommand"
+	socketMessageSyncPlayGroupUpdate = "SyncPlayGroupUpdate"
+)
+
+var socketUpgrader = websocket.Upgrader{
+	// Clients are authenticated by access token, not by origin
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// socketConn is a WebSocket connection of a client.
+type socketConn struct {
+	conn     *websocket.Conn
+	userID   string
+	deviceID string
+	// send holds messages to be written to the client
+	send chan JFWebSocketMessage
+	// subscribe receives changes of the sessions subscription
+	subscribe chan socketSubscription
+	// closed is closed when the connection is shutting down
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// socketSubscription is a request to receive periodic sessions updates,
+// an interval of 0 ends the subscription.
+type socketSubscription struct {
+	initialDelay time.Duration
+	interval     time.Duration
+}
+
+// socketInboundMessage is a message sent by a client.
+type socketInboundMessage struct {
+	MessageType string          `json:"MessageType"`
+	Data        json.RawMessage `json:"Data"`
+}
+
+// GET /socket?api_key=aea78abca5744378b2a2badf710e7307&deviceId=0dabe147-5d08-4e70-adde-d6b778b725aa
+//
+// socketHandler upgrades the request to a WebSocket connection to push updates to the client.
+func (j *Jellyfin) socketHandler(w http.ResponseWriter, r *http.Request) {
+	session := j.getSessionDetails(w, r)
+	if session == nil {
+		return
+	}
+
+	// Upgrade replies with an HTTP error in case of failure
+	conn, err := socketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("socketHandler: %s\n", err)
+		return
+	}
+	s := &socketConn{
+		conn:      conn,
+		userID:    session.UserID,
+		deviceID:  session.DeviceID,
+		send:      make(chan JFWebSocketMessage, socketSendQueueLength),
+		subscribe: make(chan socketSubscription, 1),
+		closed:    make(chan struct{}),
+	}
+	j.sessions.addSocket(s)
+	defer func() {
+		j.sessions.removeSocket(s)
+		// SyncPlay needs a connection to keep members in sync
+		if !j.sessions.connected(s.userID, s.deviceID) {
+			j.syncPlay.leaveGroup(sessionKey{userID: s.userID, deviceID: s.deviceID})
+		}
+	}()
+	defer s.close()
+
+	go j.socketWriter(s)
+	s.queue(socketMessageForceKeepAlive, int(socketKeepAliveTimeout/time.Second))
+	j.socketReader(s)
+}
+
+// socketReader handles messages of the client until the connection is closed or times out.
+func (j *Jellyfin) socketReader(s *socketConn) {
+	s.conn.SetReadLimit(socketMaxMessageSize)
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(socketKeepAliveTimeout))
+		var msg socketInboundMessage
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("socketReader: device %s: %s\n", s.deviceID, err)
+			}
+			return
+		}
+		j.sessions.touch(s.userID, s.deviceID)
+
+		switch msg.MessageType {
+		case socketMessageKeepAlive:
+			s.queue(socketMessageKeepAlive, nil)
+		case socketMessageSessionsStart:
+			s.setSubscription(parseSocketSubscription(msg.Data))
+		case socketMessageSessionsStop:
+			s.setSubscription(socketSubscription{})
+		default:
+			log.Printf("socketReader: device %s: unsupported message type %s\n", s.deviceID, msg.MessageType)
+		}
+	}
+}
+
+// socketWriter writes queued messages and sessions updates to the client
+// until the connection is closed.
+func (j *Jellyfin) socketWriter(s *socketConn) {
+	defer s.conn.Close()
+
+	var subscription socketSubscription
+	var sessionsUpdate <-chan time.Time
+	for {
+		select {
+		case <-s.closed:
+			s.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(socketWriteTimeout))
+			return
+		case subscription = <-s.subscribe:
+			sessionsUpdate = nil
+			if subscription.interval > 0 {
+				sessionsUpdate = time.After(subscription.initialDelay)
+			}
+		case <-sessionsUpdate:
+			sessionsUpdate = time.After(subscription.interval)
+			if err := s.write(makeSocketMessage(socketMessageSessions,
+				j.makeJFSessions(s.userID, "", time.Time{}))); err != nil {
+				s.close()
+				return
+			}
+		case msg := <-s.send:
+			if err := s.write(msg); err != nil {
+				s.close()
+				return
+			}
+		}
+	}
+}
+
+// write writes a message to the client.
+func (s *socketConn) write(msg JFWebSocketMessage) error {
+	s.conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+	return s.conn.WriteJSON(msg)
+}
+
+// queue queues a message to be sent to the client, the message is dropped
+// in case the send queue is full. Returns true if the message was queued.
+func (s *socketConn) queue(messageType string, data any) bool {
+	select {
+	case <-s.closed:
+		return false
+	default:
+	}
+	select {
+	case s.send <- makeSocketMessage(messageType, data):
+		return true
+	default:
+		log.Printf("socket: device %s: send queue full, dropping %s message\n", s.deviceID, messageType)
+		return false
+	}
+}
+
+// setSubscription replaces the sessions subscription of the connection.
+func (s *socketConn) setSubscription(subscription socketSubscription) {
+	// Only the most recent subscription request matters
+	select {
+	case <-s.subscribe:
+	default:
+	}
+	s.subscribe <- subscription
+}
+
+// close shuts down the connection, it is safe to call more than once.
+func (s *socketConn) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+}
+
+// parseSocketSubscription parses the data of a SessionsStart message, which
+// holds initial delay and interval in milliseconds, e.g. "0,1500".
+func parseSocketSubscription(data json.RawMessage) socketSubscription {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return socketSubscription{}
+	}
+	parts := strings.Split(value, ",")
+	var subscription socketSubscription
+	if delay, err := strconv.Atoi(strings.TrimSpace(parts[0])); err == nil && delay > 0 {
+		subscription.initialDelay = time.Duration(delay) * time.Millisecond
+	}
+	subscription.interval = socketMinSessionsInterval
+	if len(parts) > 1 {
+		if interval, err := strconv.Atoi(strings.TrimSpace(parts[1])); err == nil {
+			subscription.interval = max(time.Duration(interval)*time.Millisecond, socketMinSessionsInterval)
+		}
+	}
+	return subscription
+}
+
+// makeSocketMessage returns a message to be sent to a client.
+func makeSocketMessage(messageType string, data any) JFWebSocketMessage {
+	return JFWebSocketMessage{
+		MessageType: messageType,
+		MessageID:   rand.Text(),
+		Data:        data,
+	}
+}
+
+// sendToDevice sends a message to the clients of a user on a device, returns
+// false in case no client received it.
+func (j *Jellyfin) sendToDevice(userID, deviceID, messageType string, command any) bool {
+	sent := false
+	for _, s := range j.sessions.getSockets(func(s *socketConn) bool {
+		return s.userID == userID && s.deviceID == deviceID
+	}) {
+		sent = s.queue(messageType, command) || sent
+	}
+	return sent
+}
+
+// notifyUserDataChanged sends changed user data of an item to all clients of the user.
+func (j *Jellyfin) notifyUserDataChanged(userID, itemID string, playstate database.UserData) {
+	sockets := j.sessions.getSockets(func(s *socketConn) bool {
+		return s.userID == userID
+	})
+	if len(sockets) == 0 {
+		return
+	}
+
+	// Episodes are stored without prefix, clients know them by their prefixed ID
+	if !strings.Contains(itemID, itemprefix_separator) {
+		if _, _, _, e := j.collections.GetEpisodeByID(itemID); e != nil {
+			itemID = itemprefix_episode + itemID
+		}
+	}
+	userData := j.makeJFUserData(userID, itemID, playstate)
+	userData.ItemID = itemID
+	info := JFUserDataChangedInfo{
+		UserID:       userID,
+		UserDataList: []JFUserData{*userData},
+	}
+	for _, s := range sockets {
+		s.queue(socketMessageUserDataChanged, info)
+	}
+}
+
+// notifyLibraryChanged sends changes of a collection found by a scan to
+// clients of all users that have access to the collection.
+func (j *Jellyfin) notifyLibraryChanged(change collection.LibraryChange) {
+	collectionID := CollectionIDToString(change.CollectionID)
+	// Look up users after copying the connections, not while holding the session lock
+	users := make(map[string]bool)
+	sockets := slices.DeleteFunc(j.sessions.getSockets(nil), func(s *socketConn) bool {
+		allowed, ok := users[s.userID]
+		if !ok {
+			user, err := j.db.UserRepo.GetByID(s.userID)
+			allowed = err == nil && user.CollectionAllowed(collectionID)
+			users[s.userID] = allowed
+		}
+		return !allowed
+	})
+	if len(sockets) == 0 {
+		return
+	}
+
+	folderID := itemprefix_collection + collectionID
+	info := JFLibraryUpdateInfo{
+		FoldersAddedTo:     []string{},
+		FoldersRemovedFrom: []string{},
+		ItemsAdded:         nonNilSlice(change.Added),
+		ItemsRemoved:       nonNilSlice(change.Removed),
+		ItemsUpdated:       nonNilSlice(change.Updated),
+		CollectionFolders:  []string{folderID},
+	}
+	if len(change.Added) != 0 {
+		info.FoldersAddedTo = []string{folderID}
+	}
+	if len(change.Removed) != 0 {
+		info.FoldersRemovedFrom = []string{folderID}
+	}
+	for _, s := range sockets {
+		s.queue(socketMessageLibraryChanged, info)
+	}
+}
+
+// nonNilSlice returns an empty slice in case of nil, so it is marshalled as [] instead of null.
+func nonNilSlice(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// Shutdown closes all WebSocket connections, as these are not closed by shutting down the HTTP server.
+func (j *Jellyfin) Shutdown() {
+	for _, s := range j.sessions.getSockets(nil) {
+		s.close()
+	}
+}
@@ -0,0 +1,244 @@
+package jellyfin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"github.com/erikbos/jellofin-server/collection"
+	"github.com/erikbos/jellofin-server/database"
+)
+
+// testServer is a Jellyfin API server with an empty library.
+type testServer struct {
+	*httptest.Server
+	j *Jellyfin
+}
+
+// newTestServer returns a server with a database in a temporary directory.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	db, err := database.New(&database.Options{Filename: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := New(&Options{
+		Collections:  collection.New(&collection.Options{Db: db}),
+		Db:           db,
+		QuickConnect: true,
+	})
+	r := mux.NewRouter()
+	j.RegisterHandlers(r)
+	s := &testServer{Server: httptest.NewServer(r), j: j}
+	t.Cleanup(func() {
+		j.Shutdown()
+		s.Close()
+		db.Close()
+	})
+	return s
+}
+
+// setCollections replaces the collections of the server.
+func (s *testServer) setCollections(collections collection.Collections) {
+	s.j.collections = collection.New(&collection.Options{Db: s.j.db, Collections: collections})
+}
+
+// login creates a user and returns an access token of the user for a device.
+func (s *testServer) login(t *testing.T, username, deviceID string) (user *database.User, token string) {
+	t.Helper()
+	user, err := s.j.db.UserRepo.Insert(username, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err = s.j.db.AccessTokenRepo.Generate(database.AccessToken{
+		UserID: user.ID, DeviceID: deviceID, DeviceName: deviceID, Client: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, token
+}
+
+// do sends a request authenticated by token.
+func (s *testServer) do(t *testing.T, method, path, token string, body any) *http.Response {
+	t.Helper()
+	var payload strings.Builder
+	if body != nil {
+		json.NewEncoder(&payload).Encode(body)
+	}
+	req, err := http.NewRequest(method, s.URL+path, strings.NewReader(payload.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("X-Emby-Token", token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// dial opens a WebSocket connection authenticated by token.
+func (s *testServer) dial(t *testing.T, token string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/socket?api_key="+token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// socketMessage is a message received from the server.
+type socketMessage struct {
+	MessageType string
+	Data        json.RawMessage
+}
+
+// readMessage returns the next message of a type, skipping other messages.
+func readMessage(t *testing.T, conn *websocket.Conn, messageType string) socketMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg socketMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("waiting for %s: %s", messageType, err)
+		}
+		if msg.MessageType == messageType {
+			return msg
+		}
+	}
+}
+
+func TestSocket(t *testing.T) {
+	s := newTestServer(t)
+	s.setCollections(collection.Collections{{ID: 1, Name_: "Movies", Type: collection.CollectionMovies,
+		Items: []*collection.Item{{ID: "item1", Name: "Item", Type: collection.ItemTypeMovie}}}})
+	user, token := s.login(t, "erik", "tv")
+	conn := s.dial(t, token)
+
+	// Server tells client to send keepalives
+	msg := readMessage(t, conn, socketMessageForceKeepAlive)
+	if string(msg.Data) != "60" {
+		t.Errorf("ForceKeepAlive data = %s, want 60", msg.Data)
+	}
+
+	if err := conn.WriteJSON(map[string]any{"MessageType": socketMessageKeepAlive}); err != nil {
+		t.Fatal(err)
+	}
+	readMessage(t, conn, socketMessageKeepAlive)
+
+	// Changes of play state are pushed
+	if resp := s.do(t, "POST", "/UserPlayedItems/item1", token, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("mark played: status %d", resp.StatusCode)
+	}
+	msg = readMessage(t, conn, socketMessageUserDataChanged)
+	var changed JFUserDataChangedInfo
+	if err := json.Unmarshal(msg.Data, &changed); err != nil {
+		t.Fatal(err)
+	}
+	if changed.UserID != user.ID || len(changed.UserDataList) != 1 ||
+		changed.UserDataList[0].ItemID != "item1" || !changed.UserDataList[0].Played {
+		t.Errorf("UserDataChanged = %+v", changed)
+	}
+
+	// Subscribe to sessions updates
+	if err := conn.WriteJSON(map[string]any{"MessageType": socketMessageSessionsStart, "Data": "0,1500"}); err != nil {
+		t.Fatal(err)
+	}
+	msg = readMessage(t, conn, socketMessageSessions)
+	var sessions []JFSessionResponse
+	if err := json.Unmarshal(msg.Data, &sessions); err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].DeviceID != "tv" || !sessions[0].SupportsRemoteControl {
+		t.Errorf("Sessions = %+v, want remote controllable session of tv", sessions)
+	}
+}
+
+func TestSocketLibraryChangedOnlyForAllowedUsers(t *testing.T) {
+	s := newTestServer(t)
+	_, token := s.login(t, "erik", "tv")
+	kid, kidToken := s.login(t, "kid", "tablet")
+	kid.EnableAllFolders, kid.EnabledFolders = false, []string{"2"}
+	if err := s.j.db.UserRepo.Update(*kid); err != nil {
+		t.Fatal(err)
+	}
+	conn, kidConn := s.dial(t, token), s.dial(t, kidToken)
+	readMessage(t, conn, socketMessageForceKeepAlive)
+	readMessage(t, kidConn, socketMessageForceKeepAlive)
+
+	s.j.notifyLibraryChanged(collection.LibraryChange{CollectionID: 1, Added: []string{"item1"}})
+	s.j.notifyLibraryChanged(collection.LibraryChange{CollectionID: 2, Added: []string{"item2"}})
+
+	var info JFLibraryUpdateInfo
+	if err := json.Unmarshal(readMessage(t, conn, socketMessageLibraryChanged).Data, &info); err != nil {
+		t.Fatal(err)
+	}
+	if len(info.ItemsAdded) != 1 || info.ItemsAdded[0] != "item1" {
+		t.Errorf("first library change = %+v, want item1 added", info)
+	}
+	if err := json.Unmarshal(readMessage(t, kidConn, socketMessageLibraryChanged).Data, &info); err != nil {
+		t.Fatal(err)
+	}
+	if len(info.ItemsAdded) != 1 || info.ItemsAdded[0] != "item2" {
+		t.Errorf("library change of user without access to collection 1 = %+v, want item2 added", info)
+	}
+}
+
+func TestSocketCommandsOnlyReachUserOfSession(t *testing.T) {
+	s := newTestServer(t)
+	erik, token := s.login(t, "erik", "tv")
+	anna, annaToken := s.login(t, "anna", "tv")
+	conn := s.dial(t, token)
+	readMessage(t, conn, socketMessageForceKeepAlive)
+	// Anna uses the same device without WebSocket connection
+	s.do(t, "GET", "/Sessions", annaToken, nil)
+
+	sessionOf := func(userID string) session {
+		for _, session := range s.j.sessions.getAll() {
+			if session.UserID == userID {
+				return session
+			}
+		}
+		t.Fatalf("no session of user %s", userID)
+		return session{}
+	}
+	message := map[string]string{"Header": "Hi", "Text": "Dinner is ready"}
+	if resp := s.do(t, "POST", "/Sessions/"+sessionOf(anna.ID).ID+"/Message", token, message); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("message to session without connection: status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+	if resp := s.do(t, "POST", "/Sessions/"+sessionOf(erik.ID).ID+"/Message", token, message); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("message to own session: status %d", resp.StatusCode)
+	}
+	var command JFGeneralCommand
+	if err := json.Unmarshal(readMessage(t, conn, socketMessageGeneralCommand).Data, &command); err != nil {
+		t.Fatal(err)
+	}
+	if command.Arguments["Text"] != "Dinner is ready" {
+		t.Errorf("command = %+v", command)
+	}
+
+	var sessions []JFSessionResponse
+	if err := json.NewDecoder(s.do(t, "GET", "/Sessions", token, nil).Body).Decode(&sessions); err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("%d sessions, want 2", len(sessions))
+	}
+	for _, session := range sessions {
+		if session.SupportsRemoteControl != (session.UserID == erik.ID) {
+			t.Errorf("session of user %s supports remote control: %v", session.UserName, session.SupportsRemoteControl)
+		}
+	}
+}
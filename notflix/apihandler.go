@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
@@ -33,6 +34,7 @@ type Notflix struct {
 func New(o *Options) *Notflix {
 	return &Notflix{
 		collections:  o.Collections,
+		db:           o.Db,
 		imageresizer: o.Imageresizer,
 		Appdir:       o.Appdir,
 	}
@@ -82,6 +84,46 @@ func preCheck(w http.ResponseWriter, r *http.Request, keys ...string) (done bool
 	return
 }
 
+// getUser returns the user of a request in case an access token was provided
+// as api_key query parameter or X-Emby-Token header. Notflix does not require
+// authentication, requests without token get the guest user which holds the
+// most restrictive policy of all users.
+func (n *Notflix) getUser(r *http.Request) (*database.User, error) {
+	token := r.URL.Query().Get("api_key")
+	if token == "" {
+		token = r.Header.Get("x-emby-token")
+	}
+	if token == "" {
+		return n.db.UserRepo.GetGuest()
+	}
+	accessToken, err := n.db.AccessTokenRepo.Get(token)
+	if err != nil {
+		return nil, err
+	}
+	return n.db.UserRepo.GetByID(accessToken.UserID)
+}
+
+// collectionAllowed checks if the user of a request has access to a collection,
+// if not sends an HTTP error.
+func (n *Notflix) collectionAllowed(w http.ResponseWriter, r *http.Request, c *collection.Collection) bool {
+	user, err := n.getUser(r)
+	if err != nil || user.Disabled {
+		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if !user.CollectionAllowed(strconv.Itoa(c.ID)) {
+		http.Error(w, "403 Access denied", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// itemAllowed returns true if the user is allowed to watch an item based
+// upon its parental rating.
+func itemAllowed(user *database.User, i *collection.Item) bool {
+	return user != nil && user.ParentalRatingAllowed(i.ParentalRatingScore())
+}
+
 func setheaders(h http.Header) {
 	h.Set("Access-Control-Allow-Origin", "*")
 	h.Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
@@ -98,8 +140,16 @@ func (n *Notflix) collectionsHandler(w http.ResponseWriter, r *http.Request) {
 	if preCheck(w, r) {
 		return
 	}
+	user, err := n.getUser(r)
+	if err != nil || user.Disabled {
+		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+		return
+	}
 	cc := []Collection{}
 	for _, c := range n.collections.GetCollections() {
+		if !user.CollectionAllowed(strconv.Itoa(c.ID)) {
+			continue
+		}
 		cc = append(cc, copyCollection(c))
 	}
 	serveJSON(cc, w)
@@ -115,6 +165,9 @@ func (n *Notflix) collectionHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "404 Not Found", http.StatusNotFound)
 		return
 	}
+	if !n.collectionAllowed(w, r, c) {
+		return
+	}
 	serveJSON(copyCollection(*c), w)
 }
 
@@ -128,6 +181,9 @@ func (n *Notflix) itemsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "404 Not Found", http.StatusNotFound)
 		return
 	}
+	if !n.collectionAllowed(w, r, c) {
+		return
+	}
 
 	var lastVideo int64
 	for i := range c.Items {
@@ -141,7 +197,14 @@ func (n *Notflix) itemsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "HEAD" {
 		return
 	}
-	serveJSON(copyItems(c.Items), w)
+	user, _ := n.getUser(r)
+	items := make([]*collection.Item, 0, len(c.Items))
+	for _, i := range c.Items {
+		if itemAllowed(user, i) {
+			items = append(items, i)
+		}
+	}
+	serveJSON(copyItems(items), w)
 }
 
 func (n *Notflix) itemHandler(w http.ResponseWriter, r *http.Request) {
@@ -154,6 +217,13 @@ func (n *Notflix) itemHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "404 Not Found", http.StatusNotFound)
 		return
 	}
+	if !n.collectionAllowed(w, r, n.collections.GetCollection(vars["coll"])) {
+		return
+	}
+	if user, _ := n.getUser(r); !itemAllowed(user, i) {
+		http.Error(w, "403 Access denied", http.StatusForbidden)
+		return
+	}
 
 	if i.LastVideo > 0 && checkEtagObj(w, r, time.UnixMilli(i.LastVideo)) {
 		return
@@ -191,12 +261,32 @@ func (n *Notflix) genresHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "404 Not Found", http.StatusNotFound)
 		return
 	}
+	if !n.collectionAllowed(w, r, c) {
+		return
+	}
 
-	gc := c.GenreCount()
+	user, _ := n.getUser(r)
+	gc := c.GenreCount(func(_ *collection.Collection, i *collection.Item) bool {
+		return itemAllowed(user, i)
+	})
 	serveJSON(gc, w)
 }
 
 func (n *Notflix) dataHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if c := n.collections.GetCollection(vars["source"]); c != nil {
+		if !n.collectionAllowed(w, r, c) {
+			return
+		}
+		// First path element is the directory name of the item
+		itemName, _, _ := strings.Cut(vars["path"], "/")
+		if i := n.collections.GetItem(vars["source"], itemName); i != nil {
+			if user, _ := n.getUser(r); !itemAllowed(user, i) {
+				http.Error(w, "403 Access denied", http.StatusForbidden)
+				return
+			}
+		}
+	}
 	if n.hlsHandler(w, r) {
 		return
 	}
@@ -204,7 +294,6 @@ func (n *Notflix) dataHandler(w http.ResponseWriter, r *http.Request) {
 	if preCheck(w, r, "source", "path") {
 		return
 	}
-	vars := mux.Vars(r)
 	c := n.collections.GetCollection(vars["source"])
 	if c == nil {
 		return
@@ -296,7 +385,9 @@ func copyItem(item collection.Item) Item {
 			Premiered: item.Nfo.Premiered,
 			MPAA:      item.Nfo.Mpaa,
 			Aired:     item.Nfo.Aired,
-			Studio:    item.Nfo.Studio,
+		}
+		if len(item.Nfo.Studio) > 0 {
+			ci.Nfo.Studio = item.Nfo.Studio[0]
 		}
 	}
 	return ci
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -9,8 +11,10 @@ import (
 	"log/syslog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/XS4ALL/curlyconf-go"
@@ -37,8 +41,22 @@ type cfgMain struct {
 		ServerName string
 		// Indicates if we should auto-register Jellyfin users
 		AutoRegister bool
+		// QuickConnect allows logged in users to authorize other devices with a code
+		QuickConnect bool
 		// JPEG quality for posters
 		ImageQualityPoster int
+		// TokenIdleTimeout expires access tokens that have not been used for this long
+		TokenIdleTimeout time.Duration
+		// TokenMaxAge expires access tokens this long after login
+		TokenMaxAge time.Duration
+	}
+	Backup struct {
+		// Directory to write periodic database backups to, empty disables backups
+		Directory string
+		// Interval between backups
+		Interval time.Duration
+		// Keep is the number of backups to keep, 0 means all
+		Keep int
 	}
 }
 
@@ -47,15 +65,20 @@ type cfgListen struct {
 	Tls     bool
 	TlsCert string
 	TlsKey  string
+	// ShutdownTimeout is how long to wait for requests to finish when shutting down
+	ShutdownTimeout time.Duration
 }
 
 func main() {
 	log.Printf("Parsing config file")
 	config := cfgMain{
 		Listen: cfgListen{
-			Port: 8080,
+			Port:            8080,
+			ShutdownTimeout: 30 * time.Second,
 		},
 	}
+	config.Backup.Interval = 24 * time.Hour
+	config.Backup.Keep = 7
 	p, err := curlyconf.NewParser(configFile, curlyconf.ParserNL)
 	if err == nil {
 		err = p.Parse(&config)
@@ -97,13 +120,49 @@ func main() {
 
 	log.Printf("dbinit")
 	database, err := database.New(&database.Options{
-		Filename: path.Join(config.Dbdir, "tink-items.db"),
+		Filename:               path.Join(config.Dbdir, "tink-items.db"),
+		AccessTokenIdleTimeout: config.Jellyfin.TokenIdleTimeout,
+		AccessTokenMaxAge:      config.Jellyfin.TokenMaxAge,
 	})
 	if err != nil {
 		log.Fatalf("database.New: %s", err)
 	}
-	go database.AccessTokenRepo.BackgroundJobs()
-	go database.UserDataRepo.BackgroundJobs()
+
+	// Run command such as export, import or backup instead of serving
+	if flag.NArg() > 0 {
+		err := runCommand(&config, database, flag.Args())
+		if closeErr := database.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Shutdown gracefully on SIGINT and SIGTERM
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	// Background jobs are stopped after the HTTP server has been shutdown,
+	// so they do not miss state changes of the last requests.
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	var jobs sync.WaitGroup
+	runJob := func(job func(ctx context.Context)) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job(jobsCtx)
+		}()
+	}
+
+	runJob(database.AccessTokenRepo.BackgroundJobs)
+	runJob(database.UserDataRepo.BackgroundJobs)
+	if config.Backup.Directory != "" {
+		runJob(func(ctx context.Context) {
+			database.BackgroundBackup(ctx, config.Backup.Directory, config.Backup.Interval, config.Backup.Keep)
+		})
+	}
 
 	collection := collection.New(&collection.Options{
 		Collections: config.Collections,
@@ -137,6 +196,7 @@ func main() {
 		ServerPort:         config.Listen.Port,
 		ServerName:         config.Jellyfin.ServerName,
 		AutoRegister:       config.Jellyfin.AutoRegister,
+		QuickConnect:       config.Jellyfin.QuickConnect,
 		ImageQualityPoster: config.Jellyfin.ImageQualityPoster,
 	})
 	j.RegisterHandlers(r)
@@ -147,30 +207,58 @@ func main() {
 
 	log.Printf("Initializing collections..")
 	collection.Init()
-	go collection.Background()
+	runJob(collection.Background)
 
 	addr := fmt.Sprintf(":%d", config.Listen.Port)
-
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: server,
+	}
+	srv.RegisterOnShutdown(j.Shutdown)
 	if config.Listen.TlsCert != "" && config.Listen.TlsKey != "" {
 		kpr, err := NewKeypairReloader(config.Listen.TlsCert, config.Listen.TlsKey)
 		if err != nil {
 			log.Fatalf("error loading keypair: %v", err)
 		}
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS13,
+			GetCertificate: kpr.GetCertificateFunc(),
+		}
+	}
 
-		srv := &http.Server{
-			Addr:    addr,
-			Handler: server,
-			TLSConfig: &tls.Config{
-				MinVersion:     tls.VersionTLS13,
-				GetCertificate: kpr.GetCertificateFunc(),
-			},
+	go func() {
+		var err error
+		if srv.TLSConfig != nil {
+			log.Printf("Serving HTTPS on %s", addr)
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Serving HTTP on %s", addr)
+			err = srv.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
 		}
-		log.Printf("Serving HTTPS on %s", addr)
-		srv.ListenAndServeTLS("", "")
-	} else {
-		log.Printf("Serving HTTP on %s", addr)
-		log.Fatal(http.ListenAndServe(addr, server))
+	}()
+
+	<-signalCtx.Done()
+	// Restore default signal handling so a second signal terminates immediately
+	stopSignals()
+
+	log.Printf("Shutting down, waiting up to %s for requests to finish", config.Listen.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Listen.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down HTTP server: %s", err)
+		srv.Close()
+	}
+
+	stopJobs()
+	jobs.Wait()
+
+	if err := database.Close(); err != nil {
+		log.Printf("Error closing database: %s", err)
 	}
+	log.Printf("Shutdown complete")
 }
 
 type keypairReloader struct {